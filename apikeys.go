@@ -0,0 +1,137 @@
+package staticbackend
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+)
+
+func apiKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		createAPIKey(w, r)
+	} else if r.Method == http.MethodDelete {
+		revokeAPIKey(w, r)
+	} else if r.Method == http.MethodGet {
+		listAPIKeys(w, r)
+	} else {
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func createAPIKey(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var data = new(struct {
+		Name    string    `json:"name"`
+		Scopes  []string  `json:"scopes"`
+		Expires time.Time `json:"expires"`
+	})
+	if err := parseBody(r.Body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, token, err := newAPIKey(conf.Name, auth, data.Name, data.Scopes, data.Expires)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the full key is only returned once, we only keep its hash
+	respond(w, http.StatusCreated, struct {
+		internal.APIKey
+		Key string `json:"key"`
+	}{key, token})
+}
+
+// newAPIKey saves a new API key and returns it along with the full key value
+func newAPIKey(dbName string, auth internal.Auth, name string, scopes []string, expires time.Time) (key internal.APIKey, token string, err error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		err = errors.New("an API key needs a name")
+		return
+	} else if len(scopes) == 0 {
+		err = errors.New("an API key needs at least one scope")
+		return
+	}
+
+	secret, err := randomSecret(24)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	key = internal.APIKey{
+		AccountID: auth.AccountID,
+		TokenID:   auth.UserID,
+		Name:      name,
+		Hash:      internal.HashAPIKeySecret(secret),
+		Scopes:    scopes,
+		Expires:   expires,
+		Created:   now,
+	}
+
+	id, err := datastore.CreateAPIKey(dbName, key)
+	if err != nil {
+		return
+	}
+
+	key.ID = id
+	token = fmt.Sprintf("%s%s_%s", internal.APIKeyPrefix, id, secret)
+	return
+}
+
+func randomSecret(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	keys, err := datastore.ListAPIKeys(conf.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if keys == nil {
+		keys = make([]internal.APIKey, 0)
+	}
+
+	respond(w, http.StatusOK, keys)
+}
+
+func revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if err := datastore.DeleteAPIKey(conf.Name, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, http.StatusOK, true)
+}
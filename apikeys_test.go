@@ -0,0 +1,54 @@
+package staticbackend
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/staticbackendhq/core/middleware"
+)
+
+func TestCreateAndRevokeAPIKey(t *testing.T) {
+	data := new(struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	})
+	data.Name = "unit-test"
+	data.Scopes = []string{"db:read:tasks"}
+
+	resp := dbReq(t, apiKeys, "POST", "/sudo/apikeys", data, true)
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var created struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := middleware.ValidateAPIKey(datastore, dbName, created.Key)
+	if err != nil {
+		t.Fatal(err)
+	} else if !key.Allows("db:read:tasks") || key.Allows("db:write:tasks") {
+		t.Errorf("unexpected scopes %v", key.Scopes)
+	}
+
+	if _, err := middleware.ValidateAPIKey(datastore, dbName, created.Key+"x"); err == nil {
+		t.Errorf("expected a tampered key to be invalid")
+	}
+
+	resp2 := dbReq(t, apiKeys, "DELETE", "/sudo/apikeys?id="+created.ID, nil, true)
+	defer resp2.Body.Close()
+
+	if resp2.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp2))
+	}
+
+	if _, err := middleware.ValidateAPIKey(datastore, dbName, created.Key); err == nil {
+		t.Errorf("expected a revoked key to be invalid")
+	}
+}
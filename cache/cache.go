@@ -2,10 +2,14 @@ package cache
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/staticbackendhq/core/internal"
@@ -16,6 +20,9 @@ import (
 type Cache struct {
 	Rdb *redis.Client
 	Ctx context.Context
+
+	// FindRule loads a collection's rule when it's not in cache yet
+	FindRule func(dbName, col string) (internal.Rule, error)
 }
 
 // NewCache returns an initiated Redis client
@@ -79,6 +86,58 @@ func (c *Cache) Dec(key string, by int64) (int64, error) {
 	return c.Rdb.DecrBy(c.Ctx, key, by).Result()
 }
 
+// IncWindow increments a counter that expires after window. It returns the
+// counter value and the time left before it resets.
+func (c *Cache) IncWindow(key string, window time.Duration) (int64, time.Duration, error) {
+	pipe := c.Rdb.TxPipeline()
+	incr := pipe.Incr(c.Ctx, key)
+	ttl := pipe.TTL(c.Ctx, key)
+	if _, err := pipe.Exec(c.Ctx); err != nil {
+		return 0, 0, err
+	}
+
+	// a new counter does not have an expiry yet
+	left := ttl.Val()
+	if left < 0 {
+		if err := c.Rdb.Expire(c.Ctx, key, window).Err(); err != nil {
+			return 0, 0, err
+		}
+		left = window
+	}
+	return incr.Val(), left, nil
+}
+
+// SetEx sets a key that expires after ttl
+func (c *Cache) SetEx(key, value string, ttl time.Duration) error {
+	return c.Rdb.Set(c.Ctx, key, value, ttl).Err()
+}
+
+// TTL returns the time left before a key expires, zero if it does not exist
+func (c *Cache) TTL(key string) (time.Duration, error) {
+	d, err := c.Rdb.TTL(c.Ctx, key).Result()
+	if err != nil {
+		return 0, err
+	} else if d < 0 {
+		return 0, nil
+	}
+	return d, nil
+}
+
+// TryLock sets the key if it does not exist, it returns false if another
+// node holds the lock
+func (c *Cache) TryLock(key string, ttl time.Duration) (bool, error) {
+	return c.Rdb.SetNX(c.Ctx, key, "1", ttl).Result()
+}
+
+// Unlock releases a lock taken with TryLock
+func (c *Cache) Unlock(key string) error {
+	return c.Del(key)
+}
+
+func (c *Cache) Del(keys ...string) error {
+	return c.Rdb.Del(c.Ctx, keys...).Err()
+}
+
 func (c *Cache) Subscribe(send chan internal.Command, token, channel string, close chan bool) {
 	pubsub := c.Rdb.Subscribe(c.Ctx, channel)
 
@@ -91,7 +150,11 @@ func (c *Cache) Subscribe(send chan internal.Command, token, channel string, clo
 
 	for {
 		select {
-		case m := <-ch:
+		case m, ok := <-ch:
+			if !ok {
+				return
+			}
+
 			var msg internal.Command
 			if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
 				log.Println("error parsing JSON message", err)
@@ -102,12 +165,31 @@ func (c *Cache) Subscribe(send chan internal.Command, token, channel string, clo
 			// TODO: this will need more thinking
 			if msg.Type == internal.MsgTypeChanIn {
 				msg.Type = internal.MsgTypeChanOut
-			} else if msg.IsSystemEvent {
+			}
 
-			} else if msg.IsDBEvent() && c.HasPermission(token, channel, msg.Data) == false {
-				continue
+			// the system channel receives all events with the publisher's
+			// token, server-side functions run on its behalf
+			if channel != "sbsys" {
+				if msg.IsDBEvent() {
+					data, ok := c.readableEvent(token, channel, msg.Data)
+					if !ok {
+						continue
+					}
+					msg.Data = data
+				}
+
+				msg.Token = ""
+				msg.Base = ""
+			}
+
+			// the client might not read anymore, the subscription must still
+			// be able to close
+			select {
+			case send <- msg:
+			case <-close:
+				_ = pubsub.Close()
+				return
 			}
-			send <- msg
 		case <-close:
 			_ = pubsub.Close()
 			return
@@ -116,6 +198,15 @@ func (c *Cache) Subscribe(send chan internal.Command, token, channel string, clo
 }
 
 func (c *Cache) Publish(msg internal.Command) error {
+	// Publish the event to system so server-side function can trigger
+	go c.publishSystem(msg)
+
+	return c.Broadcast(msg)
+}
+
+// Broadcast publishes the message to the channel's subscribers without the
+// system channel, the functions and webhooks are not triggered
+func (c *Cache) Broadcast(msg internal.Command) error {
 	b, err := json.Marshal(msg)
 	if err != nil {
 		return err
@@ -124,41 +215,37 @@ func (c *Cache) Publish(msg internal.Command) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
 	defer cancel()
 
-	// Publish the event to system so server-side function can trigger
-	go func(sysmsg internal.Command) {
-		sysmsg.IsSystemEvent = true
-		b, err := json.Marshal(sysmsg)
-		if err != nil {
-			log.Println("error marshaling the system msg: ", err)
-			return
-		}
-
-		sysctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
-		defer cancel()
-		if err := c.Rdb.Publish(sysctx, "sbsys", string(b)).Err(); err != nil {
-			log.Println("error publishing to system channel: ", err)
-		}
-	}(msg)
-
 	return c.Rdb.Publish(ctx, msg.Channel, string(b)).Err()
 }
 
-func (c *Cache) PublishDocument(channel, typ string, v interface{}) {
-	subs, err := c.Rdb.PubSubNumSub(c.Ctx, channel).Result()
-	if err != nil {
-		fmt.Println("error getting db subscribers for ", channel)
+func (c *Cache) publishSystem(sysmsg internal.Command) {
+	sysmsg.IsSystemEvent = true
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		log.Println("error generating the system event ID: ", err)
 		return
 	}
+	sysmsg.EventID = hex.EncodeToString(id)
 
-	count, ok := subs[channel]
-	if !ok {
-		fmt.Println("cannot find channel in subs", channel)
-		return
-	} else if count == 0 {
+	b, err := json.Marshal(sysmsg)
+	if err != nil {
+		log.Println("error marshaling the system msg: ", err)
 		return
 	}
 
-	b, err := json.Marshal(v)
+	sysctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if err := c.Rdb.Publish(sysctx, "sbsys", string(b)).Err(); err != nil {
+		log.Println("error publishing to system channel: ", err)
+	}
+}
+
+// PublishDocument publishes a database event to the channel's subscribers
+// and to the server-side functions. The actor's token is only kept for the
+// functions.
+func (c *Cache) PublishDocument(channel string, evt internal.DocumentEvent) {
+	b, err := json.Marshal(evt)
 	if err != nil {
 		fmt.Println("error publishing db doc: ", err)
 		return
@@ -167,7 +254,21 @@ func (c *Cache) PublishDocument(channel, typ string, v interface{}) {
 	msg := internal.Command{
 		Channel: channel,
 		Data:    string(b),
-		Type:    typ,
+		Type:    evt.EventType(),
+		Token:   evt.Token,
+		Base:    evt.Base,
+	}
+
+	subs, err := c.Rdb.PubSubNumSub(c.Ctx, channel).Result()
+	if err != nil {
+		fmt.Println("error getting db subscribers for ", channel)
+		return
+	}
+
+	// functions trigger even if no client listens to the channel
+	if subs[channel] == 0 {
+		c.publishSystem(msg)
+		return
 	}
 
 	if err := c.Publish(msg); err != nil {
@@ -175,16 +276,234 @@ func (c *Cache) PublishDocument(channel, typ string, v interface{}) {
 	}
 }
 
+// JoinPresence adds or refreshes a channel's member until ttl. Members are
+// kept in a sorted set scored by their expiration and their data in a hash.
+func (c *Cache) JoinPresence(channel string, member internal.PresenceMember, ttl time.Duration) error {
+	b, err := json.Marshal(member)
+	if err != nil {
+		return err
+	}
+
+	key := presenceKey(channel)
+	expires := time.Now().Add(ttl)
+
+	pipe := c.Rdb.TxPipeline()
+	pipe.ZAdd(c.Ctx, key, &redis.Z{Score: float64(expires.Unix()), Member: member.ID})
+	pipe.HSet(c.Ctx, key+"_meta", member.ID, string(b))
+	// the whole channel disappears if no server refreshes it
+	pipe.Expire(c.Ctx, key, ttl)
+	pipe.Expire(c.Ctx, key+"_meta", ttl)
+	_, err = pipe.Exec(c.Ctx)
+	return err
+}
+
+// LeavePresence removes a channel's member, it returns false if the member
+// was already gone.
+func (c *Cache) LeavePresence(channel, id string) (bool, error) {
+	key := presenceKey(channel)
+
+	n, err := c.Rdb.ZRem(c.Ctx, key, id).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if err := c.Rdb.HDel(c.Ctx, key+"_meta", id).Err(); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// PresenceMembers returns the members of a channel. Expired members, from
+// crashed servers, are removed and their presence_leave events published.
+func (c *Cache) PresenceMembers(channel string) ([]internal.PresenceMember, error) {
+	key := presenceKey(channel)
+
+	expired, err := c.Rdb.ZRangeByScore(c.Ctx, key, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprintf("%d", time.Now().Unix()),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range expired {
+		meta, err := c.Rdb.HGet(c.Ctx, key+"_meta", id).Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+
+		// another server might be removing it at the same time
+		ok, err := c.LeavePresence(channel, id)
+		if err != nil {
+			return nil, err
+		} else if !ok || len(meta) == 0 {
+			continue
+		}
+
+		msg := internal.Command{Type: internal.MsgTypePresenceLeave, Channel: channel, Data: meta}
+		if err := c.Publish(msg); err != nil {
+			log.Println("error publishing presence leave: ", err)
+		}
+	}
+
+	ids, err := c.Rdb.ZRange(c.Ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	} else if len(ids) == 0 {
+		return []internal.PresenceMember{}, nil
+	}
+
+	metas, err := c.Rdb.HMGet(c.Ctx, key+"_meta", ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]internal.PresenceMember, 0, len(metas))
+	for _, meta := range metas {
+		s, ok := meta.(string)
+		if !ok {
+			continue
+		}
+
+		var m internal.PresenceMember
+		if err := json.Unmarshal([]byte(s), &m); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+func presenceKey(channel string) string {
+	return "presence_" + channel
+}
+
+// AppendHistory adds the message to the channel's stream, keeping about its
+// last maxLen messages. It returns the message ID.
+func (c *Cache) AppendHistory(channel string, msg internal.Command, maxLen int64) (string, error) {
+	// the publisher's token is for server-side functions only
+	msg.Token = ""
+	msg.Base = ""
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+
+	return c.Rdb.XAdd(c.Ctx, &redis.XAddArgs{
+		Stream:       historyKey(channel),
+		MaxLenApprox: maxLen,
+		Values:       map[string]interface{}{"msg": string(b)},
+	}).Result()
+}
+
+// History returns up to limit messages published on the channel after the
+// since message ID.
+func (c *Cache) History(channel, since string, limit int64) ([]internal.Command, error) {
+	// since is inclusive, it's skipped below
+	entries, err := c.Rdb.XRangeN(c.Ctx, historyKey(channel), since, "+", limit+1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []internal.Command
+	for _, entry := range entries {
+		if entry.ID == since {
+			continue
+		}
+
+		s, ok := entry.Values["msg"].(string)
+		if !ok {
+			continue
+		}
+
+		var msg internal.Command
+		if err := json.Unmarshal([]byte(s), &msg); err != nil {
+			return nil, err
+		}
+
+		if msg.Type == internal.MsgTypeChanIn {
+			msg.Type = internal.MsgTypeChanOut
+		}
+		msg.ID = entry.ID
+
+		msgs = append(msgs, msg)
+	}
+
+	if int64(len(msgs)) > limit {
+		msgs = msgs[:limit]
+	}
+	return msgs, nil
+}
+
+func historyKey(channel string) string {
+	return "history_" + channel
+}
+
+// HasPermission returns true if the subscriber can read the document of a
+// database event
 func (c *Cache) HasPermission(token, repo, payload string) bool {
+	_, ok := c.readableEvent(token, repo, payload)
+	return ok
+}
+
+// readableEvent returns the database event the subscriber can read. The
+// previous version of an updated document is removed unless it's readable
+// too, the update of a document entering the subscriber's permission does
+// not reveal what it was.
+func (c *Cache) readableEvent(token, repo, payload string) (string, bool) {
 	var me internal.Auth
 	if err := c.GetTyped(token, &me); err != nil {
-		return false
+		return payload, false
 	}
 
-	docs := make(map[string]interface{})
-	if err := json.Unmarshal([]byte(payload), &docs); err != nil {
+	var evt internal.DocumentEvent
+	if err := json.Unmarshal([]byte(payload), &evt); err != nil {
 		fmt.Println("error decoding docs for permissions check", err)
-		return false
+		return payload, false
+	}
+
+	if me.Role >= 100 {
+		return payload, true
+	}
+
+	// a collection's read rule replaces the permission suffixes, the event
+	// is denied if the rule cannot be loaded
+	rule, err := c.getRule(token, repo)
+	if err != nil {
+		fmt.Println("error loading rule for permissions check", err)
+		return payload, false
+	}
+
+	if !canRead(me, rule, repo, evt.Doc()) {
+		return payload, false
+	} else if evt.Document == nil || evt.Previous == nil || canRead(me, rule, repo, evt.Previous) {
+		return payload, true
+	}
+
+	evt.Previous = nil
+	b, err := json.Marshal(evt)
+	if err != nil {
+		fmt.Println("error encoding the readable event", err)
+		return payload, false
+	}
+	return string(b), true
+}
+
+// canRead returns true if the collection's read rule or permission allows
+// the user to read the document
+func canRead(me internal.Auth, rule internal.Rule, repo string, docs map[string]interface{}) bool {
+	if docs == nil {
+		docs = make(map[string]interface{})
+	}
+
+	if cond := rule.Condition(internal.RuleRead); len(cond) > 0 {
+		allowed, err := internal.EvalRule(cond, internal.RuleEnv(me, docs))
+		if err != nil {
+			fmt.Println("error evaluating read rule", err)
+			return false
+		}
+		return allowed
 	}
 
 	switch internal.ReadPermission(repo) {
@@ -207,6 +526,46 @@ func (c *Cache) HasPermission(token, repo, payload string) bool {
 	}
 }
 
+// RuleKey returns the cache key for a collection's rule
+func RuleKey(dbName, col string) string {
+	return fmt.Sprintf("rule_%s_%s", dbName, internal.CleanCollectionName(col))
+}
+
+// getRule returns the rule of the collection of a database channel, a
+// collection without rule has an empty one
+func (c *Cache) getRule(token, repo string) (rule internal.Rule, err error) {
+	var conf internal.BaseConfig
+	if err = c.GetTyped("base:"+token, &conf); err != nil {
+		return rule, fmt.Errorf("cannot find the base of the subscriber: %v", err)
+	}
+
+	return c.Rule(conf.Name, strings.TrimPrefix(repo, "db-"))
+}
+
+// Rule returns a collection's rule from cache, it's loaded with FindRule
+// and cached when missing. The /sudo/rules endpoints replace the cached
+// rules when they change.
+func (c *Cache) Rule(dbName, col string) (rule internal.Rule, err error) {
+	key := RuleKey(dbName, col)
+	if err := c.GetTyped(key, &rule); err == nil {
+		return rule, nil
+	}
+
+	if c.FindRule == nil {
+		return rule, errors.New("unable to load rules, FindRule is not set")
+	}
+
+	rule, err = c.FindRule(dbName, col)
+	if err != nil {
+		return
+	}
+
+	if err := c.SetTyped(key, rule); err != nil {
+		log.Println("error caching rule", err)
+	}
+	return rule, nil
+}
+
 func (c *Cache) QueueWork(key, value string) error {
 	return c.Rdb.RPush(c.Ctx, key, value).Err()
 }
@@ -0,0 +1,166 @@
+package staticbackend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/staticbackendhq/core/function"
+	"github.com/staticbackendhq/core/internal"
+)
+
+var (
+	errChannelDenied = errors.New("you are not allowed on this channel")
+)
+
+// how long a base's channel rules and channel_auth functions are kept in
+// memory before they're read again
+var channelAuthCacheTTL = 10 * time.Second
+
+var channelAuths = &channelAuthCache{bases: make(map[string]channelAuthEntry)}
+
+// channelAuthCache keeps the channel rules and channel_auth functions of
+// the bases, joins and publishes would otherwise query them each time.
+type channelAuthCache struct {
+	mu    sync.Mutex
+	bases map[string]channelAuthEntry
+}
+
+type channelAuthEntry struct {
+	rules   map[string]internal.Rule
+	funcs   []internal.ExecData
+	expires time.Time
+}
+
+func (cac *channelAuthCache) get(dbName string) (channelAuthEntry, error) {
+	cac.mu.Lock()
+	entry, ok := cac.bases[dbName]
+	cac.mu.Unlock()
+
+	if ok && time.Now().Before(entry.expires) {
+		return entry, nil
+	}
+
+	rules, err := datastore.ListRules(dbName)
+	if err != nil {
+		return entry, err
+	}
+
+	funcs, err := datastore.ListFunctionsByTrigger(dbName, internal.TriggerChannelAuth)
+	if err != nil {
+		return entry, err
+	}
+
+	entry = channelAuthEntry{
+		rules:   make(map[string]internal.Rule),
+		funcs:   funcs,
+		expires: time.Now().Add(channelAuthCacheTTL),
+	}
+
+	prefix := internal.ChannelRuleName("")
+	for _, rule := range rules {
+		if strings.HasPrefix(rule.Collection, prefix) {
+			entry.rules[rule.Collection] = rule
+		}
+	}
+
+	cac.mu.Lock()
+	defer cac.mu.Unlock()
+
+	cac.bases[dbName] = entry
+	return entry, nil
+}
+
+// forget drops the base's entry after its rules or functions changed
+func (cac *channelAuthCache) forget(dbName string) {
+	cac.mu.Lock()
+	defer cac.mu.Unlock()
+
+	delete(cac.bases, dbName)
+}
+
+// authorizeChannel decides if the user can join or publish on a channel.
+//
+// Channels are checked against their rule, or the default channel rule,
+// then against the functions triggered by channel_auth. Without rule or
+// function the channel is open to authenticated users. Database channels
+// (db-) are read-only and their events are still filtered by the
+// collection permission.
+func authorizeChannel(conf internal.BaseConfig, auth internal.Auth, channel, op string) error {
+	if len(channel) == 0 {
+		return errors.New("no channel was specified")
+	}
+
+	if op == internal.ChannelPublish && strings.HasPrefix(strings.ToLower(channel), "db-") {
+		return errors.New("you cannot write to database channel")
+	}
+
+	if strings.HasPrefix(channel, internal.TailChannelPrefix) {
+		return errors.New("the function logs channels are reserved")
+	}
+
+	if auth.Role >= 100 {
+		return nil
+	}
+
+	entry, err := channelAuths.get(conf.Name)
+	if err != nil {
+		return err
+	}
+
+	if cond := channelCondition(entry.rules, channel, op); len(cond) > 0 {
+		ok, err := internal.EvalRule(cond, internal.ChannelRuleEnv(auth, channel, op))
+		if err != nil {
+			return fmt.Errorf("error evaluating channel rule: %v", err)
+		} else if !ok {
+			return errChannelDenied
+		}
+	}
+
+	data := map[string]interface{}{
+		"channel": channel,
+		"op":      op,
+		"auth":    auth,
+	}
+
+	for _, fn := range entry.funcs {
+		exe := &function.ExecutionEnvironment{
+			Auth:          auth,
+			BaseName:      conf.Name,
+			BaseID:        conf.ID,
+			DataStore:     datastore,
+			Volatile:      volatile,
+			Storer:        storer,
+			Mailer:        emailer,
+			Data:          fn,
+			BaseLimits:    conf.Settings.Functions,
+			FetchSettings: conf.Settings.Fetch,
+		}
+
+		ok, err := exe.Authorize(data)
+		if err != nil {
+			return fmt.Errorf(`executing "%s" function failed: %v`, fn.FunctionName, err)
+		} else if !ok {
+			return errChannelDenied
+		}
+	}
+
+	return nil
+}
+
+func channelCondition(rules map[string]internal.Rule, channel, op string) string {
+	ruleOp := internal.RuleRead
+	if op == internal.ChannelPublish {
+		ruleOp = internal.RuleWrite
+	}
+
+	// a channel's own rule replaces the default channel rule
+	for _, name := range []string{internal.ChannelRuleName(channel), internal.ChannelRuleDefault} {
+		if rule, ok := rules[name]; ok {
+			return rule.Condition(ruleOp)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,156 @@
+package mongo
+
+import (
+	"errors"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LocalAPIKey struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	AccountID primitive.ObjectID `bson:"accountId" json:"accountId"`
+	TokenID   primitive.ObjectID `bson:"tokenId" json:"tokenId"`
+	Name      string             `bson:"name" json:"name"`
+	Hash      string             `bson:"hash" json:"-"`
+	Scopes    []string           `bson:"scopes" json:"scopes"`
+	Expires   time.Time          `bson:"exp" json:"expires"`
+	LastUsed  time.Time          `bson:"used" json:"lastUsed"`
+	Created   time.Time          `bson:"created" json:"created"`
+}
+
+func toLocalAPIKey(key internal.APIKey) LocalAPIKey {
+	id, err := primitive.ObjectIDFromHex(key.ID)
+	if err != nil {
+		return LocalAPIKey{}
+	}
+
+	acctID, err := primitive.ObjectIDFromHex(key.AccountID)
+	if err != nil {
+		return LocalAPIKey{}
+	}
+
+	tokID, err := primitive.ObjectIDFromHex(key.TokenID)
+	if err != nil {
+		return LocalAPIKey{}
+	}
+
+	return LocalAPIKey{
+		ID:        id,
+		AccountID: acctID,
+		TokenID:   tokID,
+		Name:      key.Name,
+		Hash:      key.Hash,
+		Scopes:    key.Scopes,
+		Expires:   key.Expires,
+		LastUsed:  key.LastUsed,
+		Created:   key.Created,
+	}
+}
+
+func fromLocalAPIKey(lk LocalAPIKey) internal.APIKey {
+	return internal.APIKey{
+		ID:        lk.ID.Hex(),
+		AccountID: lk.AccountID.Hex(),
+		TokenID:   lk.TokenID.Hex(),
+		Name:      lk.Name,
+		Hash:      lk.Hash,
+		Scopes:    lk.Scopes,
+		Expires:   lk.Expires,
+		LastUsed:  lk.LastUsed,
+		Created:   lk.Created,
+	}
+}
+
+func (mg *Mongo) CreateAPIKey(dbName string, key internal.APIKey) (id string, err error) {
+	db := mg.Client.Database(dbName)
+
+	key.ID = primitive.NewObjectID().Hex()
+
+	lk := toLocalAPIKey(key)
+	if lk.ID.IsZero() {
+		return "", errors.New("invalid account or token id for API key")
+	}
+
+	if _, err = db.Collection("sb_apikeys").InsertOne(mg.Ctx, lk); err != nil {
+		return
+	}
+
+	id = key.ID
+	return
+}
+
+func (mg *Mongo) FindAPIKey(dbName, id string) (key internal.APIKey, err error) {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return
+	}
+
+	var lk LocalAPIKey
+	sr := db.Collection("sb_apikeys").FindOne(mg.Ctx, bson.M{FieldID: oid})
+	if err = sr.Decode(&lk); err != nil {
+		return
+	}
+
+	key = fromLocalAPIKey(lk)
+	return
+}
+
+func (mg *Mongo) ListAPIKeys(dbName string) (results []internal.APIKey, err error) {
+	db := mg.Client.Database(dbName)
+
+	opt := options.Find()
+	opt.SetSort(bson.M{"created": -1})
+
+	cur, err := db.Collection("sb_apikeys").Find(mg.Ctx, bson.M{}, opt)
+	if err != nil {
+		return
+	}
+	defer cur.Close(mg.Ctx)
+
+	for cur.Next(mg.Ctx) {
+		var lk LocalAPIKey
+		if err = cur.Decode(&lk); err != nil {
+			return
+		}
+
+		results = append(results, fromLocalAPIKey(lk))
+	}
+
+	err = cur.Err()
+	return
+}
+
+func (mg *Mongo) APIKeyUsed(dbName, id string, at time.Time) error {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{"used": at}}
+	if _, err := db.Collection("sb_apikeys").UpdateOne(mg.Ctx, bson.M{FieldID: oid}, update); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) DeleteAPIKey(dbName, id string) error {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Collection("sb_apikeys").DeleteOne(mg.Ctx, bson.M{FieldID: oid}); err != nil {
+		return err
+	}
+	return nil
+}
@@ -10,11 +10,12 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Base struct {
-	PublishDocument func(topic, msg string, doc interface{})
+	PublishDocument internal.PublishDocumentEvent
 }
 
 func (mg *Mongo) CreateDocument(auth internal.Auth, dbName, col string, doc map[string]interface{}) (map[string]interface{}, error) {
@@ -30,6 +31,10 @@ func (mg *Mongo) CreateDocument(auth internal.Auth, dbName, col string, doc map[
 		return nil, err
 	}
 
+	if err := mg.canCreate(auth, dbName, col, doc); err != nil {
+		return nil, err
+	}
+
 	newID := primitive.NewObjectID()
 
 	doc[FieldID] = newID
@@ -42,7 +47,7 @@ func (mg *Mongo) CreateDocument(auth internal.Auth, dbName, col string, doc map[
 
 	cleanMap(doc)
 
-	mg.PublishDocument("db-"+col, internal.MsgTypeDBCreated, doc)
+	mg.PublishDocument("db-"+col, internal.NewDocumentEvent(auth, dbName, col, internal.DocumentCreate, nil, doc))
 
 	go mg.ensureIndex(dbName, internal.CleanCollectionName(col))
 
@@ -130,6 +135,10 @@ func (mg *Mongo) BulkCreateDocument(auth internal.Auth, dbName, col string, docs
 			return fmt.Errorf("unable to cast docs to map")
 		}
 
+		if err := mg.canCreate(auth, dbName, col, doc); err != nil {
+			return err
+		}
+
 		delete(doc, "id")
 		delete(doc, FieldID)
 		delete(doc, FieldAccountID)
@@ -161,7 +170,9 @@ func (mg *Mongo) ListDocuments(auth internal.Auth, dbName, col string, params in
 
 	filter := bson.M{}
 
-	secureRead(acctID, userID, auth.Role, col, filter)
+	if err := mg.secureRead(auth, acctID, userID, dbName, col, filter); err != nil {
+		return result, err
+	}
 
 	count, err := db.Collection(internal.CleanCollectionName(col)).CountDocuments(mg.Ctx, filter)
 	if err != nil {
@@ -230,7 +241,9 @@ func (mg *Mongo) QueryDocuments(auth internal.Auth, dbName, col string, filter m
 		return result, err
 	}
 
-	secureRead(acctID, userID, auth.Role, col, filter)
+	if err := mg.secureRead(auth, acctID, userID, dbName, col, filter); err != nil {
+		return result, err
+	}
 
 	count, err := db.Collection(internal.CleanCollectionName(col)).CountDocuments(mg.Ctx, filter)
 	if err != nil {
@@ -303,7 +316,9 @@ func (mg *Mongo) GetDocumentByID(auth internal.Auth, dbName, col, id string) (ma
 
 	filter := bson.M{FieldID: oid}
 
-	secureRead(acctID, userID, auth.Role, col, filter)
+	if err := mg.secureRead(auth, acctID, userID, dbName, col, filter); err != nil {
+		return result, err
+	}
 
 	sr := db.Collection(internal.CleanCollectionName(col)).FindOne(mg.Ctx, filter)
 	if err := sr.Decode(&result); err != nil {
@@ -337,13 +352,25 @@ func (mg *Mongo) UpdateDocument(auth internal.Auth, dbName, col, id string, doc
 
 	filter := bson.M{FieldID: oid}
 
-	secureWrite(acctID, userID, auth.Role, col, filter)
+	if err := mg.secureWrite(auth, acctID, userID, dbName, col, internal.RuleWrite, filter); err != nil {
+		return doc, err
+	}
 
 	newProps := bson.M{}
 	for k, v := range doc {
 		newProps[k] = v
 	}
 
+	// the updated document must still satisfy the write rule
+	merge := func(current bson.M) {
+		for k, v := range newProps {
+			current[k] = v
+		}
+	}
+	if err := mg.canUpdate(auth, dbName, col, filter, merge); err != nil {
+		return doc, err
+	}
+
 	update := bson.M{"$set": newProps}
 
 	res := db.Collection(internal.CleanCollectionName(col)).FindOneAndUpdate(mg.Ctx, filter, update)
@@ -351,6 +378,13 @@ func (mg *Mongo) UpdateDocument(auth internal.Auth, dbName, col, id string, doc
 		return doc, err
 	}
 
+	// FindOneAndUpdate returns the document before the update
+	var previous bson.M
+	if err := res.Decode(&previous); err != nil {
+		return doc, err
+	}
+	cleanMap(previous)
+
 	var result bson.M
 	sr := db.Collection(internal.CleanCollectionName(col)).FindOne(mg.Ctx, filter)
 	if err := sr.Decode(&result); err != nil {
@@ -361,7 +395,7 @@ func (mg *Mongo) UpdateDocument(auth internal.Auth, dbName, col, id string, doc
 
 	cleanMap(result)
 
-	mg.PublishDocument("db-"+col, internal.MsgTypeDBUpdated, result)
+	mg.PublishDocument("db-"+col, internal.NewDocumentEvent(auth, dbName, col, internal.DocumentUpdate, previous, result))
 
 	return result, nil
 }
@@ -381,7 +415,25 @@ func (mg *Mongo) IncrementValue(auth internal.Auth, dbName, col, id, field strin
 
 	filter := bson.M{FieldID: oid}
 
-	secureWrite(acctID, userID, auth.Role, col, filter)
+	if err := mg.secureWrite(auth, acctID, userID, dbName, col, internal.RuleWrite, filter); err != nil {
+		return err
+	}
+
+	inc := func(current bson.M) {
+		var v float64
+		switch x := current[field].(type) {
+		case float64:
+			v = x
+		case int32:
+			v = float64(x)
+		case int64:
+			v = float64(x)
+		}
+		current[field] = v + float64(n)
+	}
+	if err := mg.canUpdate(auth, dbName, col, filter, inc); err != nil {
+		return err
+	}
 
 	update := bson.M{"$inc": bson.M{field: n}}
 
@@ -390,12 +442,18 @@ func (mg *Mongo) IncrementValue(auth internal.Auth, dbName, col, id, field strin
 		return err
 	}
 
+	var previous bson.M
+	if err := res.Decode(&previous); err != nil {
+		return err
+	}
+	cleanMap(previous)
+
 	updated, err := mg.GetDocumentByID(auth, dbName, col, id)
 	if err != nil {
 		return err
 	}
 
-	mg.PublishDocument("db-"+col, internal.MsgTypeDBUpdated, updated)
+	mg.PublishDocument("db-"+col, internal.NewDocumentEvent(auth, dbName, col, internal.DocumentUpdate, previous, updated))
 
 	return nil
 }
@@ -415,16 +473,26 @@ func (mg *Mongo) DeleteDocument(auth internal.Auth, dbName, col, id string) (int
 
 	filter := bson.M{FieldID: oid}
 
-	secureWrite(acctID, userID, auth.Role, col, filter)
+	if err := mg.secureWrite(auth, acctID, userID, dbName, col, internal.RuleDelete, filter); err != nil {
+		return 0, err
+	}
 
-	res, err := db.Collection(internal.CleanCollectionName(col)).DeleteOne(mg.Ctx, filter)
-	if err != nil {
+	// the deleted document is the event's previous version
+	var previous bson.M
+	res := db.Collection(internal.CleanCollectionName(col)).FindOneAndDelete(mg.Ctx, filter)
+	if err := res.Decode(&previous); err == mongo.ErrNoDocuments {
+		return 0, nil
+	} else if err != nil {
 		return 0, err
 	}
 
-	mg.PublishDocument("db-"+col, internal.MsgTypeDBDeleted, id)
+	cleanMap(previous)
+
+	evt := internal.NewDocumentEvent(auth, dbName, col, internal.DocumentDelete, previous, nil)
+	evt.ID = id
+	mg.PublishDocument("db-"+col, evt)
 
-	return res.DeletedCount, nil
+	return 1, nil
 }
 
 func (mg *Mongo) ListCollections(dbName string) ([]string, error) {
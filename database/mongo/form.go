@@ -66,7 +66,7 @@ func (mg *Mongo) ListFormSubmissions(dbName, name string) (results []map[string]
 func (mg *Mongo) GetForms(dbName string) ([]string, error) {
 	db := mg.Client.Database(dbName)
 
-	pipeline := mongo.Pipeline{bson.D{{"$group", bson.D{{"_id", "$form"}}}}}
+	pipeline := mongo.Pipeline{bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$form"}}}}}
 	cur, err := db.Collection("sb_forms").Aggregate(mg.Ctx, pipeline)
 	if err != nil {
 		return nil, err
@@ -7,27 +7,56 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type LocalExecData struct {
+	ID            primitive.ObjectID      `bson:"_id" json:"id"`
+	FunctionName  string                  `bson:"name" json:"name"`
+	TriggerTopic  string                  `bson:"tr" json:"trigger"`
+	Code          string                  `bson:"code" json:"code"`
+	Version       int                     `bson:"v" json:"version"`
+	LastUpdated   time.Time               `bson:"lu" json:"lastUpdated"`
+	LastRun       time.Time               `bson:"lr" json:"lastRun"`
+	Limits        internal.FunctionLimits `bson:"limits" json:"limits"`
+	PinnedVersion int                     `bson:"pv" json:"pinnedVersion"`
+	Kind          string                  `bson:"kind" json:"kind"`
+	Retry         internal.RetryPolicy    `bson:"retry" json:"retry"`
+	History       []LocalExecHistory      `bson:"h" json:"history"`
+}
+
+type LocalFunctionVersion struct {
 	ID           primitive.ObjectID `bson:"_id" json:"id"`
-	FunctionName string             `bson:"name" json:"name"`
-	TriggerTopic string             `bson:"tr" json:"trigger"`
-	Code         string             `bson:"code" json:"code"`
+	FunctionID   primitive.ObjectID `bson:"fnId" json:"functionId"`
 	Version      int                `bson:"v" json:"version"`
-	LastUpdated  time.Time          `bson:"lu" json:"lastUpdated"`
-	LastRun      time.Time          `bson:"lr" json:"lastRun"`
-	History      []LocalExecHistory `bson:"h" json:"history"`
+	Code         string             `bson:"code" json:"code"`
+	TriggerTopic string             `bson:"tr" json:"trigger"`
+	Created      time.Time          `bson:"created" json:"created"`
+}
+
+type LocalFunctionDeadLetter struct {
+	ID           primitive.ObjectID `bson:"_id" json:"id"`
+	FunctionID   primitive.ObjectID `bson:"fnId" json:"functionId"`
+	FunctionName string             `bson:"name" json:"functionName"`
+	Command      internal.Command   `bson:"cmd" json:"command"`
+	Auth         internal.Auth      `bson:"auth" json:"-"`
+	Attempts     int                `bson:"attempts" json:"attempts"`
+	Error        string             `bson:"error" json:"error"`
+	Created      time.Time          `bson:"created" json:"created"`
+	Pending      bool               `bson:"pending" json:"pending"`
+	NextAttempt  time.Time          `bson:"next" json:"nextAttempt"`
 }
 
 type LocalExecHistory struct {
-	ID        string    `bson:"id" json:"id"`
-	Version   int       `bson:"v" json:"version"`
-	Started   time.Time `bson:"s" json:"started"`
-	Completed time.Time `bson:"c" json:"completed"`
-	Success   bool      `bson:"ok" json:"success"`
-	Output    []string  `bson:"out" json:"output"`
+	ID        string                 `bson:"id" json:"id"`
+	Version   int                    `bson:"v" json:"version"`
+	Started   time.Time              `bson:"s" json:"started"`
+	Completed time.Time              `bson:"c" json:"completed"`
+	Success   bool                   `bson:"ok" json:"success"`
+	Output    []string               `bson:"out" json:"output"`
+	Reason    string                 `bson:"reason" json:"reason"`
+	Logs      []internal.FunctionLog `bson:"logs" json:"logs"`
 }
 
 func toLocalExecData(ex internal.ExecData) LocalExecData {
@@ -38,14 +67,18 @@ func toLocalExecData(ex internal.ExecData) LocalExecData {
 	}
 
 	return LocalExecData{
-		ID:           oid,
-		FunctionName: ex.FunctionName,
-		TriggerTopic: ex.TriggerTopic,
-		Code:         ex.Code,
-		Version:      ex.Version,
-		LastUpdated:  ex.LastUpdated,
-		LastRun:      ex.LastRun,
-		History:      toLocalExecHistory(ex.History),
+		ID:            oid,
+		FunctionName:  ex.FunctionName,
+		TriggerTopic:  ex.TriggerTopic,
+		Code:          ex.Code,
+		Version:       ex.Version,
+		LastUpdated:   ex.LastUpdated,
+		LastRun:       ex.LastRun,
+		Limits:        ex.Limits,
+		PinnedVersion: ex.PinnedVersion,
+		Kind:          ex.Kind,
+		Retry:         ex.Retry,
+		History:       toLocalExecHistory(ex.History),
 	}
 }
 
@@ -60,6 +93,8 @@ func toLocalExecHistory(h []internal.ExecHistory) []LocalExecHistory {
 			Completed: exh.Completed,
 			Success:   exh.Success,
 			Output:    exh.Output,
+			Reason:    exh.Reason,
+			Logs:      exh.Logs,
 		})
 	}
 
@@ -67,15 +102,24 @@ func toLocalExecHistory(h []internal.ExecHistory) []LocalExecHistory {
 }
 
 func fromLocalExecData(lex LocalExecData) internal.ExecData {
+	// the functions created before the modules have no kind
+	if len(lex.Kind) == 0 {
+		lex.Kind = internal.FunctionKindFunction
+	}
+
 	return internal.ExecData{
-		ID:           lex.ID.Hex(),
-		FunctionName: lex.FunctionName,
-		TriggerTopic: lex.TriggerTopic,
-		Code:         lex.Code,
-		Version:      lex.Version,
-		LastUpdated:  lex.LastUpdated,
-		LastRun:      lex.LastRun,
-		History:      fromLocalExecHistory(lex.History),
+		ID:            lex.ID.Hex(),
+		FunctionName:  lex.FunctionName,
+		TriggerTopic:  lex.TriggerTopic,
+		Code:          lex.Code,
+		Version:       lex.Version,
+		LastUpdated:   lex.LastUpdated,
+		LastRun:       lex.LastRun,
+		Limits:        lex.Limits,
+		PinnedVersion: lex.PinnedVersion,
+		Kind:          lex.Kind,
+		Retry:         lex.Retry,
+		History:       fromLocalExecHistory(lex.History),
 	}
 }
 
@@ -89,6 +133,8 @@ func fromLocalExecHistory(lh []LocalExecHistory) []internal.ExecHistory {
 			Completed: exh.Completed,
 			Success:   exh.Success,
 			Output:    exh.Output,
+			Reason:    exh.Reason,
+			Logs:      exh.Logs,
 		})
 	}
 
@@ -100,6 +146,9 @@ func (mg *Mongo) AddFunction(dbName string, data internal.ExecData) (string, err
 
 	data.ID = primitive.NewObjectID().Hex()
 	data.Version = 1
+	if len(data.Kind) == 0 {
+		data.Kind = internal.FunctionKindFunction
+	}
 	data.LastUpdated = time.Now()
 	data.History = make([]internal.ExecHistory, 0)
 
@@ -110,6 +159,10 @@ func (mg *Mongo) AddFunction(dbName string, data internal.ExecData) (string, err
 		return "", err
 	}
 
+	if err := mg.addFunctionVersion(dbName, lex); err != nil {
+		return "", err
+	}
+
 	/*oid, ok := res.InsertedID.(primitive.ObjectID)
 	if !ok {
 		return "", nil
@@ -132,11 +185,134 @@ func (mg *Mongo) UpdateFunction(dbName, id, code, trigger string) error {
 	}
 	filter := bson.M{FieldID: oid}
 
-	res := db.Collection("sb_functions").FindOneAndUpdate(mg.Ctx, filter, update)
-	if err := res.Err(); err != nil {
+	opt := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var lex LocalExecData
+	res := db.Collection("sb_functions").FindOneAndUpdate(mg.Ctx, filter, update, opt)
+	if err := res.Decode(&lex); err != nil {
+		return err
+	}
+
+	return mg.addFunctionVersion(dbName, lex)
+}
+
+// addFunctionVersion saves the current code of a function as its version
+func (mg *Mongo) addFunctionVersion(dbName string, lex LocalExecData) error {
+	db := mg.Client.Database(dbName)
+
+	v := LocalFunctionVersion{
+		ID:           primitive.NewObjectID(),
+		FunctionID:   lex.ID,
+		Version:      lex.Version,
+		Code:         lex.Code,
+		TriggerTopic: lex.TriggerTopic,
+		Created:      time.Now(),
+	}
+
+	_, err := db.Collection("sb_function_versions").InsertOne(mg.Ctx, v)
+	return err
+}
+
+func fromLocalFunctionVersion(lv LocalFunctionVersion) internal.FunctionVersion {
+	return internal.FunctionVersion{
+		ID:           lv.ID.Hex(),
+		FunctionID:   lv.FunctionID.Hex(),
+		Version:      lv.Version,
+		Code:         lv.Code,
+		TriggerTopic: lv.TriggerTopic,
+		Created:      lv.Created,
+	}
+}
+
+func (mg *Mongo) ListFunctionVersions(dbName, id string) (results []internal.FunctionVersion, err error) {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return
+	}
+
+	opt := options.Find().SetSort(bson.M{"v": -1})
+
+	cur, err := db.Collection("sb_function_versions").Find(mg.Ctx, bson.M{"fnId": oid}, opt)
+	if err != nil {
+		return
+	}
+	defer cur.Close(mg.Ctx)
+
+	for cur.Next(mg.Ctx) {
+		var lv LocalFunctionVersion
+		if err = cur.Decode(&lv); err != nil {
+			return
+		}
+
+		results = append(results, fromLocalFunctionVersion(lv))
+	}
+
+	err = cur.Err()
+	return
+}
+
+func (mg *Mongo) GetFunctionVersion(dbName, id string, version int) (result internal.FunctionVersion, err error) {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return
+	}
+
+	var lv LocalFunctionVersion
+	filter := bson.M{"fnId": oid, "v": version}
+	if err = db.Collection("sb_function_versions").FindOne(mg.Ctx, filter).Decode(&lv); err != nil {
+		return
+	}
+
+	result = fromLocalFunctionVersion(lv)
+	return
+}
+
+func (mg *Mongo) PinFunctionVersion(dbName, id string, version int) error {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{"pv": version}}
+	if _, err := db.Collection("sb_functions").UpdateOne(mg.Ctx, bson.M{FieldID: oid}, update); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) UpdateFunctionLimits(dbName, id string, limits internal.FunctionLimits) error {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{"limits": limits}}
+	if _, err := db.Collection("sb_functions").UpdateOne(mg.Ctx, bson.M{FieldID: oid}, update); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) UpdateFunctionRetry(dbName, id string, retry internal.RetryPolicy) error {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
 		return err
 	}
 
+	update := bson.M{"$set": bson.M{"retry": retry}}
+	if _, err := db.Collection("sb_functions").UpdateOne(mg.Ctx, bson.M{FieldID: oid}, update); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -254,7 +430,18 @@ func (mg *Mongo) DeleteFunction(dbName, name string) error {
 
 	filter := bson.M{"name": name}
 
-	if _, err := db.Collection("sb_functions").DeleteOne(mg.Ctx, filter); err != nil {
+	var lex LocalExecData
+	if err := db.Collection("sb_functions").FindOneAndDelete(mg.Ctx, filter).Decode(&lex); err == mongo.ErrNoDocuments {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// the versions and dead letters are deleted with their function
+	if _, err := db.Collection("sb_function_versions").DeleteMany(mg.Ctx, bson.M{"fnId": lex.ID}); err != nil {
+		return err
+	}
+	if _, err := db.Collection("sb_function_dead_letters").DeleteMany(mg.Ctx, bson.M{"fnId": lex.ID}); err != nil {
 		return err
 	}
 	return nil
@@ -282,3 +469,260 @@ func (mg *Mongo) RanFunction(dbName, id string, rh internal.ExecHistory) error {
 	}
 	return nil
 }
+
+// ListFunctionRuns returns a page of a function's runs matching the filter
+func (mg *Mongo) ListFunctionRuns(dbName, id string, filter internal.RunFilter) (result internal.FunctionRuns, err error) {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return
+	}
+
+	filter = filter.WithDefaults()
+
+	match := bson.M{}
+	switch filter.Status {
+	case internal.RunStatusSuccess:
+		match["ok"] = true
+	case internal.RunStatusFailed:
+		match["ok"] = false
+	}
+
+	started := bson.M{}
+	if !filter.From.IsZero() {
+		started["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		started["$lte"] = filter.To
+	}
+	if len(started) > 0 {
+		match["s"] = started
+	}
+
+	if filter.Version > 0 {
+		match["v"] = filter.Version
+	}
+
+	// the runs are kept in their function's document
+	pipeline := []bson.M{
+		{"$match": bson.M{FieldID: oid}},
+		{"$unwind": "$h"},
+		{"$replaceRoot": bson.M{"newRoot": "$h"}},
+		{"$match": match},
+		{"$sort": bson.M{"s": -1}},
+		{"$facet": bson.M{
+			"total": []bson.M{{"$count": "n"}},
+			"results": []bson.M{
+				{"$skip": (filter.Page - 1) * filter.Size},
+				{"$limit": filter.Size},
+			},
+		}},
+	}
+
+	cur, err := db.Collection("sb_functions").Aggregate(mg.Ctx, pipeline)
+	if err != nil {
+		return
+	}
+	defer cur.Close(mg.Ctx)
+
+	var page struct {
+		Total []struct {
+			N int64 `bson:"n"`
+		} `bson:"total"`
+		Results []LocalExecHistory `bson:"results"`
+	}
+
+	if cur.Next(mg.Ctx) {
+		if err = cur.Decode(&page); err != nil {
+			return
+		}
+	}
+
+	if err = cur.Err(); err != nil {
+		return
+	}
+
+	result.Page = filter.Page
+	result.Size = filter.Size
+	if len(page.Total) > 0 {
+		result.Total = page.Total[0].N
+	}
+
+	result.Results = fromLocalExecHistory(page.Results)
+	for i := range result.Results {
+		result.Results[i].FunctionID = id
+	}
+	return
+}
+
+// DeleteFunctionRuns deletes the runs started before a time
+func (mg *Mongo) DeleteFunctionRuns(dbName string, before time.Time) error {
+	db := mg.Client.Database(dbName)
+
+	update := bson.M{"$pull": bson.M{"h": bson.M{"s": bson.M{"$lt": before}}}}
+	if _, err := db.Collection("sb_functions").UpdateMany(mg.Ctx, bson.M{}, update); err != nil {
+		return err
+	}
+	return nil
+}
+
+func fromLocalFunctionDeadLetter(ldl LocalFunctionDeadLetter) internal.FunctionDeadLetter {
+	return internal.FunctionDeadLetter{
+		ID:           ldl.ID.Hex(),
+		FunctionID:   ldl.FunctionID.Hex(),
+		FunctionName: ldl.FunctionName,
+		Command:      ldl.Command,
+		Auth:         ldl.Auth,
+		Attempts:     ldl.Attempts,
+		Error:        ldl.Error,
+		Created:      ldl.Created,
+		Pending:      ldl.Pending,
+		NextAttempt:  ldl.NextAttempt,
+	}
+}
+
+func (mg *Mongo) AddFunctionDeadLetter(dbName string, dl internal.FunctionDeadLetter) (id string, err error) {
+	db := mg.Client.Database(dbName)
+
+	fnID, err := primitive.ObjectIDFromHex(dl.FunctionID)
+	if err != nil {
+		return
+	}
+
+	ldl := LocalFunctionDeadLetter{
+		ID:           primitive.NewObjectID(),
+		FunctionID:   fnID,
+		FunctionName: dl.FunctionName,
+		Command:      dl.Command,
+		Auth:         dl.Auth,
+		Attempts:     dl.Attempts,
+		Error:        dl.Error,
+		Created:      dl.Created,
+		Pending:      dl.Pending,
+		NextAttempt:  dl.NextAttempt,
+	}
+
+	if _, err = db.Collection("sb_function_dead_letters").InsertOne(mg.Ctx, ldl); err != nil {
+		return
+	}
+
+	id = ldl.ID.Hex()
+	return
+}
+
+func (mg *Mongo) UpdateFunctionDeadLetter(dbName string, dl internal.FunctionDeadLetter) error {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(dl.ID)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{
+		"attempts": dl.Attempts,
+		"error":    dl.Error,
+		"pending":  dl.Pending,
+		"next":     dl.NextAttempt,
+	}}
+	if _, err := db.Collection("sb_function_dead_letters").UpdateOne(mg.Ctx, bson.M{FieldID: oid}, update); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) GetFunctionDeadLetter(dbName, id string) (dl internal.FunctionDeadLetter, err error) {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return
+	}
+
+	var ldl LocalFunctionDeadLetter
+	if err = db.Collection("sb_function_dead_letters").FindOne(mg.Ctx, bson.M{FieldID: oid}).Decode(&ldl); err != nil {
+		return
+	}
+
+	dl = fromLocalFunctionDeadLetter(ldl)
+	return
+}
+
+func (mg *Mongo) ListFunctionDeadLetters(dbName, functionID string) (results []internal.FunctionDeadLetter, err error) {
+	db := mg.Client.Database(dbName)
+
+	// the dead letters saved before the pending ones have no "pending"
+	filter := bson.M{"pending": bson.M{"$ne": true}}
+	if len(functionID) > 0 {
+		oid, err := primitive.ObjectIDFromHex(functionID)
+		if err != nil {
+			return nil, err
+		}
+		filter["fnId"] = oid
+	}
+
+	opt := options.Find()
+	opt.SetSort(bson.M{"created": -1})
+	opt.SetLimit(100)
+
+	cur, err := db.Collection("sb_function_dead_letters").Find(mg.Ctx, filter, opt)
+	if err != nil {
+		return
+	}
+	defer cur.Close(mg.Ctx)
+
+	for cur.Next(mg.Ctx) {
+		var ldl LocalFunctionDeadLetter
+		if err = cur.Decode(&ldl); err != nil {
+			return
+		}
+
+		results = append(results, fromLocalFunctionDeadLetter(ldl))
+	}
+
+	err = cur.Err()
+	return
+}
+
+// ListDueFunctionDeadLetters returns the pending events to attempt again
+func (mg *Mongo) ListDueFunctionDeadLetters(dbName string, now time.Time) (results []internal.FunctionDeadLetter, err error) {
+	db := mg.Client.Database(dbName)
+
+	filter := bson.M{"pending": true, "next": bson.M{"$lte": now}}
+
+	opt := options.Find()
+	opt.SetSort(bson.M{"next": 1})
+	opt.SetLimit(100)
+
+	cur, err := db.Collection("sb_function_dead_letters").Find(mg.Ctx, filter, opt)
+	if err != nil {
+		return
+	}
+	defer cur.Close(mg.Ctx)
+
+	for cur.Next(mg.Ctx) {
+		var ldl LocalFunctionDeadLetter
+		if err = cur.Decode(&ldl); err != nil {
+			return
+		}
+
+		results = append(results, fromLocalFunctionDeadLetter(ldl))
+	}
+
+	err = cur.Err()
+	return
+}
+
+func (mg *Mongo) DeleteFunctionDeadLetter(dbName, id string) error {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Collection("sb_function_dead_letters").DeleteOne(mg.Ctx, bson.M{FieldID: oid}); err != nil {
+		return err
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package mongo
 
 import (
 	"errors"
+	"time"
 
 	"github.com/staticbackendhq/core/internal"
 	"go.mongodb.org/mongo-driver/bson"
@@ -14,6 +15,58 @@ type LocalAccount struct {
 	Email string             `bson:"email" json:"email"`
 }
 
+type LocalInvitation struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	AccountID primitive.ObjectID `bson:"accountId" json:"accountId"`
+	Email     string             `bson:"email" json:"email"`
+	Role      int                `bson:"role" json:"role"`
+	Code      string             `bson:"code" json:"-"`
+	InvitedBy primitive.ObjectID `bson:"by" json:"invitedBy"`
+	Created   time.Time          `bson:"created" json:"created"`
+	Expires   time.Time          `bson:"exp" json:"expires"`
+}
+
+func toLocalInvitation(inv internal.Invitation) LocalInvitation {
+	id, err := primitive.ObjectIDFromHex(inv.ID)
+	if err != nil {
+		return LocalInvitation{}
+	}
+
+	acctID, err := primitive.ObjectIDFromHex(inv.AccountID)
+	if err != nil {
+		return LocalInvitation{}
+	}
+
+	by, err := primitive.ObjectIDFromHex(inv.InvitedBy)
+	if err != nil {
+		return LocalInvitation{}
+	}
+
+	return LocalInvitation{
+		ID:        id,
+		AccountID: acctID,
+		Email:     inv.Email,
+		Role:      inv.Role,
+		Code:      inv.Code,
+		InvitedBy: by,
+		Created:   inv.Created,
+		Expires:   inv.Expires,
+	}
+}
+
+func fromLocalInvitation(linv LocalInvitation) internal.Invitation {
+	return internal.Invitation{
+		ID:        linv.ID.Hex(),
+		AccountID: linv.AccountID.Hex(),
+		Email:     linv.Email,
+		Role:      linv.Role,
+		Code:      linv.Code,
+		InvitedBy: linv.InvitedBy.Hex(),
+		Created:   linv.Created,
+		Expires:   linv.Expires,
+	}
+}
+
 func (mg *Mongo) CreateUserAccount(dbName, email string) (id string, err error) {
 	db := mg.Client.Database(dbName)
 
@@ -121,3 +174,84 @@ func (mg *Mongo) GetFirstTokenFromAccountID(dbName, accountID string) (tok inter
 
 	return
 }
+
+func (mg *Mongo) CreateInvitation(dbName string, inv internal.Invitation) (id string, err error) {
+	db := mg.Client.Database(dbName)
+
+	inv.ID = primitive.NewObjectID().Hex()
+
+	linv := toLocalInvitation(inv)
+	if linv.ID.IsZero() {
+		return "", errors.New("invalid account or user id for invitation")
+	}
+
+	if _, err = db.Collection("sb_invitations").InsertOne(mg.Ctx, linv); err != nil {
+		return
+	}
+
+	id = inv.ID
+	return
+}
+
+func (mg *Mongo) FindInvitation(dbName, code string) (inv internal.Invitation, err error) {
+	db := mg.Client.Database(dbName)
+
+	var linv LocalInvitation
+	sr := db.Collection("sb_invitations").FindOne(mg.Ctx, bson.M{"code": code})
+	if err = sr.Decode(&linv); err != nil {
+		return
+	}
+
+	inv = fromLocalInvitation(linv)
+	return
+}
+
+func (mg *Mongo) ListInvitations(dbName, accountID string) (results []internal.Invitation, err error) {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(accountID)
+	if err != nil {
+		return
+	}
+
+	opt := options.Find()
+	opt.SetSort(bson.M{"created": -1})
+
+	cur, err := db.Collection("sb_invitations").Find(mg.Ctx, bson.M{FieldAccountID: oid}, opt)
+	if err != nil {
+		return
+	}
+	defer cur.Close(mg.Ctx)
+
+	for cur.Next(mg.Ctx) {
+		var linv LocalInvitation
+		if err = cur.Decode(&linv); err != nil {
+			return
+		}
+
+		results = append(results, fromLocalInvitation(linv))
+	}
+
+	err = cur.Err()
+	return
+}
+
+func (mg *Mongo) DeleteInvitation(dbName, accountID, id string) error {
+	db := mg.Client.Database(dbName)
+
+	acctID, err := primitive.ObjectIDFromHex(accountID)
+	if err != nil {
+		return err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{FieldID: oid, FieldAccountID: acctID}
+	if _, err := db.Collection("sb_invitations").DeleteOne(mg.Ctx, filter); err != nil {
+		return err
+	}
+	return nil
+}
@@ -14,18 +14,31 @@ type Mongo struct {
 	Client          *mongo.Client
 	Ctx             context.Context
 	PublishDocument internal.PublishDocumentEvent
+	// FindRule returns the cached rules, GetRule is used when it's nil
+	FindRule internal.RuleFinder
 }
 
-func New(client *mongo.Client, pubdoc internal.PublishDocumentEvent) internal.Persister {
+func New(client *mongo.Client, pubdoc internal.PublishDocumentEvent, findRule internal.RuleFinder) internal.Persister {
 	return &Mongo{
 		Client:          client,
 		Ctx:             context.Background(),
 		PublishDocument: pubdoc,
+		FindRule:        findRule,
 	}
 }
 
+// rule returns a collection's rule, from cache when available
+func (mg *Mongo) rule(dbName, col string) (internal.Rule, error) {
+	if mg.FindRule != nil {
+		return mg.FindRule(dbName, col)
+	}
+	return mg.GetRule(dbName, col)
+}
+
 func (mg *Mongo) Ping() error {
-	ctx, _ := context.WithTimeout(context.Background(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
 	return mg.Client.Ping(ctx, readpref.Primary())
 }
 
@@ -28,12 +28,14 @@ var (
 	adminAuth    internal.Auth
 )
 
-func fakePubDocEvent(channel, typ string, v interface{}) {
+func fakePubDocEvent(channel string, evt internal.DocumentEvent) {
 	//no event pub in those tests
 }
 
 func TestMain(m *testing.M) {
-	ctx, _ := context.WithTimeout(context.Background(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
 	cl, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
 	if err != nil {
 		log.Fatal(err)
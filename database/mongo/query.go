@@ -51,9 +51,15 @@ func (mg *Mongo) ParseQuery(clauses [][]interface{}) (map[string]interface{}, er
 	return filter, nil
 }
 
-func secureRead(acctID, userID primitive.ObjectID, role int, col string, filter bson.M) {
+func (mg *Mongo) secureRead(auth internal.Auth, acctID, userID primitive.ObjectID, dbName, col string, filter bson.M) error {
+	if ok, err := mg.applyRule(auth, dbName, col, internal.RuleRead, filter); err != nil {
+		return err
+	} else if ok {
+		return nil
+	}
+
 	// if they're not root and repo is not public
-	if !strings.HasPrefix(col, "pub_") && role < 100 {
+	if !strings.HasPrefix(col, "pub_") && auth.Role < 100 {
 		switch internal.ReadPermission(col) {
 		case internal.PermGroup:
 			filter[FieldAccountID] = acctID
@@ -62,11 +68,19 @@ func secureRead(acctID, userID primitive.ObjectID, role int, col string, filter
 			filter[FieldOwnerID] = userID
 		}
 	}
+	return nil
 }
 
-func secureWrite(acctID, userID primitive.ObjectID, role int, col string, filter bson.M) {
+// secureWrite adds the filter for the write or delete operation
+func (mg *Mongo) secureWrite(auth internal.Auth, acctID, userID primitive.ObjectID, dbName, col, op string, filter bson.M) error {
+	if ok, err := mg.applyRule(auth, dbName, col, op, filter); err != nil {
+		return err
+	} else if ok {
+		return nil
+	}
+
 	// if they are not "root", we use permission
-	if role < 100 {
+	if auth.Role < 100 {
 		switch internal.WritePermission(col) {
 		case internal.PermGroup:
 			filter[FieldAccountID] = acctID
@@ -75,4 +89,225 @@ func secureWrite(acctID, userID primitive.ObjectID, role int, col string, filter
 			filter[FieldOwnerID] = userID
 		}
 	}
+	return nil
+}
+
+// applyRule adds the collection's rule to the filter if there's one for
+// this operation. Root users are not restricted by rules.
+func (mg *Mongo) applyRule(auth internal.Auth, dbName, col, op string, filter bson.M) (bool, error) {
+	if auth.Role >= 100 {
+		return false, nil
+	}
+
+	rule, err := mg.rule(dbName, col)
+	if err != nil {
+		return false, err
+	}
+
+	cond := rule.Condition(op)
+	if len(cond) == 0 {
+		return false, nil
+	}
+
+	e, err := internal.ParseRule(cond)
+	if err != nil {
+		return false, err
+	}
+
+	e, err = internal.BindRule(e, internal.RuleEnv(auth, nil))
+	if err != nil {
+		return false, err
+	}
+
+	ruleFilter, err := ruleToFilter(e)
+	if err != nil {
+		return false, err
+	}
+
+	// the rule is combined with the existing filter so it cannot
+	// overwrite fields from the query
+	and, _ := filter["$and"].([]interface{})
+	filter["$and"] = append(and, ruleFilter)
+	return true, nil
+}
+
+// canCreate evaluates the write rule against the document to be created.
+func (mg *Mongo) canCreate(auth internal.Auth, dbName, col string, doc map[string]interface{}) error {
+	data := make(map[string]interface{})
+	for k, v := range doc {
+		data[k] = v
+	}
+	data[FieldAccountID] = auth.AccountID
+	data["ownerId"] = auth.UserID
+
+	return mg.checkWrite(auth, dbName, col, data, "create")
+}
+
+// canUpdate evaluates the write rule against the document matching filter
+// once change is applied to it.
+func (mg *Mongo) canUpdate(auth internal.Auth, dbName, col string, filter bson.M, change func(doc bson.M)) error {
+	if auth.Role >= 100 {
+		return nil
+	}
+
+	var doc bson.M
+	sr := mg.Client.Database(dbName).Collection(internal.CleanCollectionName(col)).FindOne(mg.Ctx, filter)
+	if err := sr.Decode(&doc); err != nil {
+		// the update will not match anything either
+		return nil
+	}
+
+	owner, _ := doc[FieldOwnerID].(primitive.ObjectID)
+
+	cleanMap(doc)
+	change(doc)
+	doc["ownerId"] = owner.Hex()
+
+	return mg.checkWrite(auth, dbName, col, doc, "update")
+}
+
+func (mg *Mongo) checkWrite(auth internal.Auth, dbName, col string, data map[string]interface{}, action string) error {
+	if auth.Role >= 100 {
+		return nil
+	}
+
+	rule, err := mg.rule(dbName, col)
+	if err != nil {
+		return err
+	}
+
+	cond := rule.Condition(internal.RuleWrite)
+	if len(cond) == 0 {
+		return nil
+	}
+
+	ok, err := internal.EvalRule(cond, internal.RuleEnv(auth, data))
+	if err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("not enough permission to %s this document", action)
+	}
+	return nil
+}
+
+func ruleToFilter(e internal.Expr) (bson.M, error) {
+	switch x := e.(type) {
+	case internal.Literal:
+		b, ok := x.Value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("condition must be a boolean: %v", x.Value)
+		} else if b {
+			return bson.M{}, nil
+		}
+		// matches nothing
+		return bson.M{FieldID: bson.M{"$exists": false}}, nil
+	case internal.NotExpr:
+		inner, err := ruleToFilter(x.X)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$nor": []interface{}{inner}}, nil
+	case internal.BinaryExpr:
+		if x.Op == "&&" || x.Op == "||" {
+			l, err := ruleToFilter(x.Left)
+			if err != nil {
+				return nil, err
+			}
+			r, err := ruleToFilter(x.Right)
+			if err != nil {
+				return nil, err
+			}
+
+			op := "$and"
+			if x.Op == "||" {
+				op = "$or"
+			}
+			return bson.M{op: []interface{}{l, r}}, nil
+		}
+
+		return comparisonToFilter(x)
+	case internal.Ident:
+		return nil, fmt.Errorf("%s must be compared to a value", x.Name)
+	}
+	return nil, fmt.Errorf("unsupported condition: %v", e)
+}
+
+func comparisonToFilter(x internal.BinaryExpr) (bson.M, error) {
+	op := x.Op
+	left, right := x.Left, x.Right
+
+	// we want the document field on the left side
+	if _, ok := left.(internal.Literal); ok {
+		left, right = right, left
+		op = internal.FlipComparison(op)
+	}
+
+	id, ok := left.(internal.Ident)
+	if !ok || id.Root() != "doc" {
+		return nil, fmt.Errorf("unknown variable in condition: %v", left)
+	}
+
+	mop, err := mongoOp(op)
+	if err != nil {
+		return nil, err
+	}
+
+	field := ruleField(id.Field())
+
+	// two document fields are compared with an aggregation expression
+	if other, ok := right.(internal.Ident); ok {
+		if other.Root() != "doc" {
+			return nil, fmt.Errorf("unknown variable in condition: %s", other.Name)
+		}
+
+		pair := []interface{}{"$" + field, "$" + ruleField(other.Field())}
+		return bson.M{"$expr": bson.M{mop: pair}}, nil
+	}
+
+	lit, ok := right.(internal.Literal)
+	if !ok {
+		return nil, fmt.Errorf("unsupported comparison: %v", right)
+	}
+
+	val := lit.Value
+
+	// system fields are stored as ObjectID
+	if field == FieldID || field == FieldAccountID || field == FieldOwnerID {
+		if s, ok := val.(string); ok {
+			if oid, err := primitive.ObjectIDFromHex(s); err == nil {
+				val = oid
+			}
+		}
+	}
+
+	return bson.M{field: bson.M{mop: val}}, nil
+}
+
+// ruleField returns the name of the stored field for a rule's doc field.
+func ruleField(field string) string {
+	switch field {
+	case "id":
+		return FieldID
+	case "ownerId":
+		return FieldOwnerID
+	}
+	return field
+}
+
+func mongoOp(op string) (string, error) {
+	switch op {
+	case "==":
+		return "$eq", nil
+	case "!=":
+		return "$ne", nil
+	case ">":
+		return "$gt", nil
+	case "<":
+		return "$lt", nil
+	case ">=":
+		return "$gte", nil
+	case "<=":
+		return "$lte", nil
+	}
+	return "", fmt.Errorf("unsupported operator %s", op)
 }
@@ -0,0 +1,104 @@
+package mongo
+
+import (
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LocalRule struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	Collection string             `bson:"col" json:"collection"`
+	Read       string             `bson:"read" json:"read"`
+	Write      string             `bson:"write" json:"write"`
+	Delete     string             `bson:"del" json:"delete"`
+	Updated    time.Time          `bson:"updated" json:"updated"`
+}
+
+func fromLocalRule(lr LocalRule) internal.Rule {
+	return internal.Rule{
+		ID:         lr.ID.Hex(),
+		Collection: lr.Collection,
+		Read:       lr.Read,
+		Write:      lr.Write,
+		Delete:     lr.Delete,
+		Updated:    lr.Updated,
+	}
+}
+
+func (mg *Mongo) SaveRule(dbName string, rule internal.Rule) error {
+	db := mg.Client.Database(dbName)
+
+	filter := bson.M{"col": internal.CleanCollectionName(rule.Collection)}
+	update := bson.M{
+		"$set": bson.M{
+			"read":    rule.Read,
+			"write":   rule.Write,
+			"del":     rule.Delete,
+			"updated": time.Now(),
+		},
+		"$setOnInsert": bson.M{FieldID: primitive.NewObjectID()},
+	}
+
+	opt := options.Update()
+	opt.SetUpsert(true)
+
+	_, err := db.Collection("sb_rules").UpdateOne(mg.Ctx, filter, update, opt)
+	return err
+}
+
+// GetRule returns an empty rule when the collection does not have one
+func (mg *Mongo) GetRule(dbName, col string) (internal.Rule, error) {
+	db := mg.Client.Database(dbName)
+
+	filter := bson.M{"col": internal.CleanCollectionName(col)}
+
+	var lr LocalRule
+	sr := db.Collection("sb_rules").FindOne(mg.Ctx, filter)
+	if err := sr.Decode(&lr); err == mongo.ErrNoDocuments {
+		return internal.Rule{}, nil
+	} else if err != nil {
+		return internal.Rule{}, err
+	}
+
+	return fromLocalRule(lr), nil
+}
+
+func (mg *Mongo) ListRules(dbName string) ([]internal.Rule, error) {
+	db := mg.Client.Database(dbName)
+
+	opt := options.Find()
+	opt.SetSort(bson.M{"col": 1})
+
+	cur, err := db.Collection("sb_rules").Find(mg.Ctx, bson.M{}, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(mg.Ctx)
+
+	var results []internal.Rule
+	for cur.Next(mg.Ctx) {
+		var lr LocalRule
+		if err := cur.Decode(&lr); err != nil {
+			return nil, err
+		}
+
+		results = append(results, fromLocalRule(lr))
+	}
+
+	return results, cur.Err()
+}
+
+func (mg *Mongo) DeleteRule(dbName, col string) error {
+	db := mg.Client.Database(dbName)
+
+	filter := bson.M{"col": internal.CleanCollectionName(col)}
+	if _, err := db.Collection("sb_rules").DeleteOne(mg.Ctx, filter); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package mongo
+
+import (
+	"testing"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestRules(t *testing.T) {
+	rule := internal.Rule{
+		Collection: "ruled_docs",
+		Read:       "doc.status == 'published' || doc.ownerId == auth.userId",
+		Write:      "auth.role >= 50",
+	}
+
+	if err := datastore.SaveRule(confDBName, rule); err != nil {
+		t.Fatal(err)
+	}
+
+	check, err := datastore.GetRule(confDBName, rule.Collection)
+	if err != nil {
+		t.Fatal(err)
+	} else if check.Read != rule.Read || check.Write != rule.Write {
+		t.Errorf("expected rule %v got %v", rule, check)
+	}
+
+	published := map[string]interface{}{"status": "published"}
+	if _, err := datastore.CreateDocument(adminAuth, confDBName, rule.Collection, published); err != nil {
+		t.Fatal(err)
+	}
+
+	draft := map[string]interface{}{"status": "draft"}
+	if _, err := datastore.CreateDocument(adminAuth, confDBName, rule.Collection, draft); err != nil {
+		t.Fatal(err)
+	}
+
+	// another user from another account only sees published documents
+	other := adminAuth
+	other.UserID = adminAuth.AccountID
+	other.Role = 0
+
+	docs, err := datastore.ListDocuments(other, confDBName, rule.Collection, internal.ListParams{Page: 1, Size: 50})
+	if err != nil {
+		t.Fatal(err)
+	} else if docs.Total != 1 {
+		t.Errorf("expected 1 visible document got %d", docs.Total)
+	}
+
+	// the write rule requires role 50
+	if _, err := datastore.CreateDocument(other, confDBName, rule.Collection, draft); err == nil {
+		t.Errorf("expected create to be denied by the write rule")
+	}
+
+	if err := datastore.DeleteRule(confDBName, rule.Collection); err != nil {
+		t.Fatal(err)
+	}
+
+	check, err = datastore.GetRule(confDBName, rule.Collection)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(check.Read) > 0 {
+		t.Errorf("expected rule to be deleted got %v", check)
+	}
+}
+
+func TestRulesCompareDocumentFields(t *testing.T) {
+	rule := internal.Rule{
+		Collection: "budget_docs",
+		Read:       "doc.spent <= doc.budget",
+	}
+
+	if err := datastore.SaveRule(confDBName, rule); err != nil {
+		t.Fatal(err)
+	}
+	defer datastore.DeleteRule(confDBName, rule.Collection)
+
+	docs := []map[string]interface{}{
+		{"spent": 10, "budget": 50},
+		{"spent": 90, "budget": 50},
+	}
+	for _, doc := range docs {
+		if _, err := datastore.CreateDocument(adminAuth, confDBName, rule.Collection, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	other := adminAuth
+	other.UserID = adminAuth.AccountID
+	other.Role = 0
+
+	list, err := datastore.ListDocuments(other, confDBName, rule.Collection, internal.ListParams{Page: 1, Size: 50})
+	if err != nil {
+		t.Fatal(err)
+	} else if list.Total != 1 {
+		t.Errorf("expected 1 visible document got %d", list.Total)
+	}
+}
+
+func TestRulesUpdateChecksNewDocument(t *testing.T) {
+	rule := internal.Rule{
+		Collection: "locked_docs",
+		Write:      "doc.status != 'locked'",
+	}
+
+	if err := datastore.SaveRule(confDBName, rule); err != nil {
+		t.Fatal(err)
+	}
+	defer datastore.DeleteRule(confDBName, rule.Collection)
+
+	doc, err := datastore.CreateDocument(adminAuth, confDBName, rule.Collection, map[string]interface{}{"status": "draft"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, ok := doc["id"].(string)
+	if !ok {
+		t.Fatalf("expected the created document id, got %v", doc)
+	}
+
+	other := adminAuth
+	other.UserID = adminAuth.AccountID
+	other.Role = 0
+
+	// the existing document matches the rule but the updated one does not
+	locked := map[string]interface{}{"status": "locked"}
+	if _, err := datastore.UpdateDocument(other, confDBName, rule.Collection, id, locked); err == nil {
+		t.Errorf("expected the update to be denied by the write rule")
+	}
+
+	check, err := datastore.GetDocumentByID(adminAuth, confDBName, rule.Collection, id)
+	if err != nil {
+		t.Fatal(err)
+	} else if check["status"] != "draft" {
+		t.Errorf("expected status to still be draft got %v", check["status"])
+	}
+}
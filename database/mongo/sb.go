@@ -51,12 +51,13 @@ func (mg *Mongo) CreateCustomer(customer internal.Customer) (internal.Customer,
 }
 
 type LocalBase struct {
-	ID               primitive.ObjectID `bson:"_id" json:"id"`
-	SBID             primitive.ObjectID `bson:"accountId" json:"-"`
-	Name             string             `bson:"name" json:"name"`
-	Whitelist        []string           `bson:"whitelist" json:"whitelist"`
-	IsActive         bool               `bson:"active" json:"-"`
-	MonthlyEmailSent int                `bson:"mes" json:"-"`
+	ID               primitive.ObjectID    `bson:"_id" json:"id"`
+	SBID             primitive.ObjectID    `bson:"accountId" json:"-"`
+	Name             string                `bson:"name" json:"name"`
+	Whitelist        []string              `bson:"whitelist" json:"whitelist"`
+	IsActive         bool                  `bson:"active" json:"-"`
+	MonthlyEmailSent int                   `bson:"mes" json:"-"`
+	Settings         internal.BaseSettings `bson:"settings" json:"settings"`
 }
 
 func toLocalBase(b internal.BaseConfig) LocalBase {
@@ -71,6 +72,7 @@ func toLocalBase(b internal.BaseConfig) LocalBase {
 		Whitelist:        b.AllowedDomain,
 		IsActive:         b.IsActive,
 		MonthlyEmailSent: b.MonthlySentEmail,
+		Settings:         b.Settings,
 	}
 }
 
@@ -82,6 +84,7 @@ func fromLocalBase(b LocalBase) internal.BaseConfig {
 		AllowedDomain:    b.Whitelist,
 		IsActive:         b.IsActive,
 		MonthlySentEmail: b.MonthlyEmailSent,
+		Settings:         b.Settings,
 	}
 }
 
@@ -206,6 +209,22 @@ func (mg *Mongo) IncrementMonthlyEmailSent(baseID string) error {
 	return nil
 }
 
+func (mg *Mongo) UpdateBaseSettings(baseID string, settings internal.BaseSettings) error {
+	db := mg.Client.Database("sbsys")
+
+	id, err := primitive.ObjectIDFromHex(baseID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{FieldID: id}
+	update := bson.M{"$set": bson.M{"settings": settings}}
+	if _, err := db.Collection("bases").UpdateOne(mg.Ctx, filter, update); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (mg *Mongo) ActivateCustomer(customerID string) error {
 	db := mg.Client.Database("sbsys")
 
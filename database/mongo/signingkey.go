@@ -0,0 +1,86 @@
+package mongo
+
+import (
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LocalSigningKey struct {
+	ID        string    `bson:"_id" json:"id"`
+	Algorithm string    `bson:"alg" json:"alg"`
+	Private   []byte    `bson:"priv" json:"-"`
+	Public    []byte    `bson:"pub" json:"-"`
+	Created   time.Time `bson:"created" json:"created"`
+	Expires   time.Time `bson:"exp" json:"expires"`
+}
+
+func (mg *Mongo) AddSigningKey(dbName string, key internal.SigningKey) error {
+	db := mg.Client.Database(dbName)
+
+	lk := LocalSigningKey{
+		ID:        key.ID,
+		Algorithm: key.Algorithm,
+		Private:   key.Private,
+		Public:    key.Public,
+		Created:   key.Created,
+		Expires:   key.Expires,
+	}
+
+	_, err := db.Collection("sb_signing_keys").InsertOne(mg.Ctx, lk)
+	return err
+}
+
+// ListSigningKeys returns the keys from the newest to the oldest
+func (mg *Mongo) ListSigningKeys(dbName string) ([]internal.SigningKey, error) {
+	db := mg.Client.Database(dbName)
+
+	opt := options.Find()
+	opt.SetSort(bson.M{"created": -1})
+
+	cur, err := db.Collection("sb_signing_keys").Find(mg.Ctx, bson.M{}, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(mg.Ctx)
+
+	var results []internal.SigningKey
+	for cur.Next(mg.Ctx) {
+		var lk LocalSigningKey
+		if err := cur.Decode(&lk); err != nil {
+			return nil, err
+		}
+
+		results = append(results, internal.SigningKey{
+			ID:        lk.ID,
+			Algorithm: lk.Algorithm,
+			Private:   lk.Private,
+			Public:    lk.Public,
+			Created:   lk.Created,
+			Expires:   lk.Expires,
+		})
+	}
+
+	return results, cur.Err()
+}
+
+func (mg *Mongo) ExpireSigningKey(dbName, id string, expires time.Time) error {
+	db := mg.Client.Database(dbName)
+
+	update := bson.M{"$set": bson.M{"exp": expires}}
+	if _, err := db.Collection("sb_signing_keys").UpdateOne(mg.Ctx, bson.M{FieldID: id}, update); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) DeleteSigningKey(dbName, id string) error {
+	db := mg.Client.Database(dbName)
+
+	if _, err := db.Collection("sb_signing_keys").DeleteOne(mg.Ctx, bson.M{FieldID: id}); err != nil {
+		return err
+	}
+	return nil
+}
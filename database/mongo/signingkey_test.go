@@ -0,0 +1,43 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestSigningKeys(t *testing.T) {
+	key, err := internal.GenerateSigningKey(internal.SigningAlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := datastore.AddSigningKey(confDBName, key); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := datastore.ListSigningKeys(confDBName)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(keys) == 0 || keys[0].ID != key.ID {
+		t.Fatalf("expected newest key to be %s got %v", key.ID, keys)
+	} else if !keys[0].IsActive() {
+		t.Errorf("expected new key to be active")
+	}
+
+	if err := datastore.ExpireSigningKey(confDBName, key.ID, time.Now().Add(-1*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err = datastore.ListSigningKeys(confDBName)
+	if err != nil {
+		t.Fatal(err)
+	} else if !keys[0].IsExpired() {
+		t.Errorf("expected key to be expired")
+	}
+
+	if err := datastore.DeleteSigningKey(confDBName, key.ID); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,290 @@
+package mongo
+
+import (
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LocalWebhook struct {
+	ID      primitive.ObjectID `bson:"_id" json:"id"`
+	Name    string             `bson:"name" json:"name"`
+	URL     string             `bson:"url" json:"url"`
+	Events  []string           `bson:"events" json:"events"`
+	Secret  string             `bson:"secret" json:"secret"`
+	Active  bool               `bson:"active" json:"active"`
+	Created time.Time          `bson:"created" json:"created"`
+}
+
+type LocalWebhookDelivery struct {
+	ID          primitive.ObjectID `bson:"_id" json:"id"`
+	WebhookID   primitive.ObjectID `bson:"whId" json:"webhookId"`
+	Event       string             `bson:"event" json:"event"`
+	Channel     string             `bson:"channel" json:"channel"`
+	Payload     string             `bson:"payload" json:"payload"`
+	State       string             `bson:"state" json:"state"`
+	Attempts    int                `bson:"attempts" json:"attempts"`
+	Status      int                `bson:"status" json:"status"`
+	Error       string             `bson:"error" json:"error"`
+	NextAttempt time.Time          `bson:"next" json:"nextAttempt"`
+	Created     time.Time          `bson:"created" json:"created"`
+	Updated     time.Time          `bson:"updated" json:"updated"`
+}
+
+func fromLocalWebhook(lw LocalWebhook) internal.Webhook {
+	return internal.Webhook{
+		ID:      lw.ID.Hex(),
+		Name:    lw.Name,
+		URL:     lw.URL,
+		Events:  lw.Events,
+		Secret:  lw.Secret,
+		Active:  lw.Active,
+		Created: lw.Created,
+	}
+}
+
+func fromLocalWebhookDelivery(ld LocalWebhookDelivery) internal.WebhookDelivery {
+	return internal.WebhookDelivery{
+		ID:          ld.ID.Hex(),
+		WebhookID:   ld.WebhookID.Hex(),
+		Event:       ld.Event,
+		Channel:     ld.Channel,
+		Payload:     ld.Payload,
+		State:       ld.State,
+		Attempts:    ld.Attempts,
+		Status:      ld.Status,
+		Error:       ld.Error,
+		NextAttempt: ld.NextAttempt,
+		Created:     ld.Created,
+		Updated:     ld.Updated,
+	}
+}
+
+func (mg *Mongo) AddWebhook(dbName string, wh internal.Webhook) (id string, err error) {
+	db := mg.Client.Database(dbName)
+
+	lw := LocalWebhook{
+		ID:      primitive.NewObjectID(),
+		Name:    wh.Name,
+		URL:     wh.URL,
+		Events:  wh.Events,
+		Secret:  wh.Secret,
+		Active:  wh.Active,
+		Created: wh.Created,
+	}
+
+	if _, err = db.Collection("sb_webhooks").InsertOne(mg.Ctx, lw); err != nil {
+		return
+	}
+
+	id = lw.ID.Hex()
+	return
+}
+
+func (mg *Mongo) ListWebhooks(dbName string) (results []internal.Webhook, err error) {
+	db := mg.Client.Database(dbName)
+
+	opt := options.Find()
+	opt.SetSort(bson.M{"created": -1})
+
+	cur, err := db.Collection("sb_webhooks").Find(mg.Ctx, bson.M{}, opt)
+	if err != nil {
+		return
+	}
+	defer cur.Close(mg.Ctx)
+
+	for cur.Next(mg.Ctx) {
+		var lw LocalWebhook
+		if err = cur.Decode(&lw); err != nil {
+			return
+		}
+
+		results = append(results, fromLocalWebhook(lw))
+	}
+
+	err = cur.Err()
+	return
+}
+
+func (mg *Mongo) DeleteWebhook(dbName, id string) error {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Collection("sb_webhooks").DeleteOne(mg.Ctx, bson.M{FieldID: oid}); err != nil {
+		return err
+	}
+
+	if _, err := db.Collection("sb_webhook_deliveries").DeleteMany(mg.Ctx, bson.M{"whId": oid}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) UpdateWebhookSecret(dbName, id, secret string) error {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{"secret": secret}}
+	if _, err := db.Collection("sb_webhooks").UpdateOne(mg.Ctx, bson.M{FieldID: oid}, update); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) AddWebhookDelivery(dbName string, d internal.WebhookDelivery) (id string, err error) {
+	db := mg.Client.Database(dbName)
+
+	whID, err := primitive.ObjectIDFromHex(d.WebhookID)
+	if err != nil {
+		return
+	}
+
+	ld := LocalWebhookDelivery{
+		ID:          primitive.NewObjectID(),
+		WebhookID:   whID,
+		Event:       d.Event,
+		Channel:     d.Channel,
+		Payload:     d.Payload,
+		State:       d.State,
+		Attempts:    d.Attempts,
+		Status:      d.Status,
+		Error:       d.Error,
+		NextAttempt: d.NextAttempt,
+		Created:     d.Created,
+		Updated:     d.Updated,
+	}
+
+	if _, err = db.Collection("sb_webhook_deliveries").InsertOne(mg.Ctx, ld); err != nil {
+		return
+	}
+
+	id = ld.ID.Hex()
+	return
+}
+
+func (mg *Mongo) UpdateWebhookDelivery(dbName string, d internal.WebhookDelivery) error {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(d.ID)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{
+		"state":    d.State,
+		"attempts": d.Attempts,
+		"status":   d.Status,
+		"error":    d.Error,
+		"updated":  d.Updated,
+		"next":     d.NextAttempt,
+	}}
+	if _, err := db.Collection("sb_webhook_deliveries").UpdateOne(mg.Ctx, bson.M{FieldID: oid}, update); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mg *Mongo) GetWebhookDelivery(dbName, id string) (d internal.WebhookDelivery, err error) {
+	db := mg.Client.Database(dbName)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return
+	}
+
+	var ld LocalWebhookDelivery
+	sr := db.Collection("sb_webhook_deliveries").FindOne(mg.Ctx, bson.M{FieldID: oid})
+	if err = sr.Decode(&ld); err != nil {
+		return
+	}
+
+	d = fromLocalWebhookDelivery(ld)
+	return
+}
+
+// ListWebhookDeliveries returns the last 100 deliveries, optionally of a
+// webhook and/or in a state
+func (mg *Mongo) ListWebhookDeliveries(dbName, webhookID, state string) (results []internal.WebhookDelivery, err error) {
+	db := mg.Client.Database(dbName)
+
+	filter := bson.M{}
+	if len(webhookID) > 0 {
+		oid, err := primitive.ObjectIDFromHex(webhookID)
+		if err != nil {
+			return nil, err
+		}
+		filter["whId"] = oid
+	}
+	if len(state) > 0 {
+		filter["state"] = state
+	}
+
+	opt := options.Find()
+	opt.SetSort(bson.M{"created": -1})
+	opt.SetLimit(100)
+
+	cur, err := db.Collection("sb_webhook_deliveries").Find(mg.Ctx, filter, opt)
+	if err != nil {
+		return
+	}
+	defer cur.Close(mg.Ctx)
+
+	for cur.Next(mg.Ctx) {
+		var ld LocalWebhookDelivery
+		if err = cur.Decode(&ld); err != nil {
+			return
+		}
+
+		results = append(results, fromLocalWebhookDelivery(ld))
+	}
+
+	err = cur.Err()
+	return
+}
+
+// ListDueWebhookDeliveries returns the pending deliveries to attempt again
+func (mg *Mongo) ListDueWebhookDeliveries(dbName string, now time.Time) (results []internal.WebhookDelivery, err error) {
+	db := mg.Client.Database(dbName)
+
+	// the deliveries saved before the next attempts are due
+	filter := bson.M{
+		"state": internal.WebhookPending,
+		"$or": bson.A{
+			bson.M{"next": bson.M{"$lte": now}},
+			bson.M{"next": bson.M{"$exists": false}},
+		},
+	}
+
+	opt := options.Find()
+	opt.SetSort(bson.M{"next": 1})
+	opt.SetLimit(100)
+
+	cur, err := db.Collection("sb_webhook_deliveries").Find(mg.Ctx, filter, opt)
+	if err != nil {
+		return
+	}
+	defer cur.Close(mg.Ctx)
+
+	for cur.Next(mg.Ctx) {
+		var ld LocalWebhookDelivery
+		if err = cur.Decode(&ld); err != nil {
+			return
+		}
+
+		results = append(results, fromLocalWebhookDelivery(ld))
+	}
+
+	err = cur.Err()
+	return
+}
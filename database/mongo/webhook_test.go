@@ -0,0 +1,105 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestWebhooks(t *testing.T) {
+	wh := internal.Webhook{
+		Name:    "orders",
+		URL:     "http://localhost:8080/hook",
+		Events:  []string{"db_*:db-orders"},
+		Secret:  "secret",
+		Active:  true,
+		Created: time.Now(),
+	}
+
+	id, err := datastore.AddWebhook(confDBName, wh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hooks, err := datastore.ListWebhooks(confDBName)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(hooks) == 0 || hooks[0].ID != id {
+		t.Fatalf("expected newest webhook to be %s got %v", id, hooks)
+	} else if len(hooks[0].Events) != 1 || hooks[0].Secret != "secret" {
+		t.Errorf("expected events and secret to be saved got %v", hooks[0])
+	}
+
+	if err := datastore.UpdateWebhookSecret(confDBName, id, "rotated"); err != nil {
+		t.Fatal(err)
+	}
+
+	hooks, err = datastore.ListWebhooks(confDBName)
+	if err != nil {
+		t.Fatal(err)
+	} else if hooks[0].Secret != "rotated" {
+		t.Errorf("expected the rotated secret got %s", hooks[0].Secret)
+	}
+
+	d := internal.WebhookDelivery{
+		WebhookID:   id,
+		Event:       internal.MsgTypeDBCreated,
+		Channel:     "db-orders",
+		Payload:     "{}",
+		State:       internal.WebhookPending,
+		NextAttempt: time.Now().Add(time.Minute),
+		Created:     time.Now(),
+		Updated:     time.Now(),
+	}
+
+	d.ID, err = datastore.AddWebhookDelivery(confDBName, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if due, err := datastore.ListDueWebhookDeliveries(confDBName, time.Now()); err != nil {
+		t.Fatal(err)
+	} else if len(due) > 0 {
+		t.Errorf("expected no due delivery got %v", due)
+	}
+
+	due, err := datastore.ListDueWebhookDeliveries(confDBName, time.Now().Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(due) != 1 || due[0].ID != d.ID {
+		t.Errorf("expected delivery %s to be due got %v", d.ID, due)
+	}
+
+	d.State = internal.WebhookDead
+	d.Attempts = internal.WebhookMaxAttempts
+	d.Status = 500
+	if err := datastore.UpdateWebhookDelivery(confDBName, d); err != nil {
+		t.Fatal(err)
+	}
+
+	dead, err := datastore.ListWebhookDeliveries(confDBName, id, internal.WebhookDead)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(dead) != 1 || dead[0].ID != d.ID {
+		t.Fatalf("expected 1 dead letter got %v", dead)
+	}
+
+	check, err := datastore.GetWebhookDelivery(confDBName, d.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if check.Attempts != internal.WebhookMaxAttempts || check.Status != 500 {
+		t.Errorf("expected the delivery to be updated got %v", check)
+	}
+
+	if err := datastore.DeleteWebhook(confDBName, id); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := datastore.ListWebhookDeliveries(confDBName, id, "")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(deliveries) > 0 {
+		t.Errorf("expected the deliveries to be deleted with the webhook got %v", deliveries)
+	}
+}
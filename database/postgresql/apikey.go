@@ -0,0 +1,108 @@
+package postgresql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/staticbackendhq/core/internal"
+)
+
+func (pg *PostgreSQL) CreateAPIKey(dbName string, key internal.APIKey) (id string, err error) {
+	qry := fmt.Sprintf(`
+		INSERT INTO %s.sb_apikeys(account_id, token_id, name, hash, scopes, expires, last_used, created)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id;
+	`, dbName)
+
+	err = pg.DB.QueryRow(
+		qry,
+		key.AccountID,
+		key.TokenID,
+		key.Name,
+		key.Hash,
+		pq.Array(key.Scopes),
+		key.Expires,
+		key.LastUsed,
+		key.Created,
+	).Scan(&id)
+	return
+}
+
+func (pg *PostgreSQL) FindAPIKey(dbName, id string) (key internal.APIKey, err error) {
+	qry := fmt.Sprintf(`
+		SELECT * 
+		FROM %s.sb_apikeys 
+		WHERE id = $1
+	`, dbName)
+
+	row := pg.DB.QueryRow(qry, id)
+
+	err = scanAPIKey(row, &key)
+	return
+}
+
+func (pg *PostgreSQL) ListAPIKeys(dbName string) (results []internal.APIKey, err error) {
+	qry := fmt.Sprintf(`
+		SELECT * 
+		FROM %s.sb_apikeys 
+		ORDER BY created DESC
+	`, dbName)
+
+	rows, err := pg.DB.Query(qry)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key internal.APIKey
+		if err = scanAPIKey(rows, &key); err != nil {
+			return
+		}
+
+		results = append(results, key)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (pg *PostgreSQL) APIKeyUsed(dbName, id string, at time.Time) error {
+	qry := fmt.Sprintf(`
+		UPDATE %s.sb_apikeys SET
+			last_used = $2
+		WHERE id = $1
+	`, dbName)
+
+	if _, err := pg.DB.Exec(qry, id, at); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgreSQL) DeleteAPIKey(dbName, id string) error {
+	qry := fmt.Sprintf(`
+		DELETE FROM %s.sb_apikeys
+		WHERE id = $1
+	`, dbName)
+
+	if _, err := pg.DB.Exec(qry, id); err != nil {
+		return err
+	}
+	return nil
+}
+
+func scanAPIKey(rows Scanner, key *internal.APIKey) error {
+	return rows.Scan(
+		&key.ID,
+		&key.AccountID,
+		&key.TokenID,
+		&key.Name,
+		&key.Hash,
+		pq.Array(&key.Scopes),
+		&key.Expires,
+		&key.LastUsed,
+		&key.Created,
+	)
+}
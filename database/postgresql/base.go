@@ -1,6 +1,7 @@
 package postgresql
 
 import (
+	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
@@ -42,6 +43,10 @@ func (j *JSONB) Scan(value interface{}) error {
 func (pg *PostgreSQL) CreateDocument(auth internal.Auth, dbName, col string, doc map[string]interface{}) (inserted map[string]interface{}, err error) {
 	inserted = doc
 
+	if err = pg.canCreate(auth, dbName, col, doc); err != nil {
+		return
+	}
+
 	cleancol := internal.CleanCollectionName(col)
 
 	//TODO: find a good way to prevent doing the create
@@ -76,12 +81,14 @@ func (pg *PostgreSQL) CreateDocument(auth internal.Auth, dbName, col string, doc
 		return
 	}
 
-	err = pg.DB.QueryRow(qry, auth.AccountID, auth.UserID, b, time.Now()).Scan(&id)
+	if err = pg.DB.QueryRow(qry, auth.AccountID, auth.UserID, b, time.Now()).Scan(&id); err != nil {
+		return
+	}
 
 	inserted[FieldID] = id
 	inserted[FieldAccountID] = auth.AccountID
 
-	pg.PublishDocument("db-"+col, internal.MsgTypeDBCreated, inserted)
+	pg.PublishDocument("db-"+col, internal.NewDocumentEvent(auth, dbName, col, internal.DocumentCreate, nil, inserted))
 
 	return
 }
@@ -103,7 +110,10 @@ func (pg *PostgreSQL) BulkCreateDocument(auth internal.Auth, dbName, col string,
 }
 
 func (pg *PostgreSQL) ListDocuments(auth internal.Auth, dbName, col string, params internal.ListParams) (result internal.PagedResult, err error) {
-	where := secureRead(auth, col)
+	where, err := pg.secureRead(auth, dbName, col)
+	if err != nil {
+		return
+	}
 
 	paging := setPaging(params)
 
@@ -152,7 +162,10 @@ func (pg *PostgreSQL) ListDocuments(auth internal.Auth, dbName, col string, para
 }
 
 func (pg *PostgreSQL) QueryDocuments(auth internal.Auth, dbName, col string, filters map[string]interface{}, params internal.ListParams) (result internal.PagedResult, err error) {
-	where := secureRead(auth, col)
+	where, err := pg.secureRead(auth, dbName, col)
+	if err != nil {
+		return
+	}
 	where = applyFilter(where, filters)
 
 	paging := setPaging(params)
@@ -200,7 +213,10 @@ func (pg *PostgreSQL) QueryDocuments(auth internal.Auth, dbName, col string, fil
 }
 
 func (pg *PostgreSQL) GetDocumentByID(auth internal.Auth, dbName, col, id string) (map[string]interface{}, error) {
-	where := secureRead(auth, col)
+	where, err := pg.secureRead(auth, dbName, col)
+	if err != nil {
+		return nil, err
+	}
 
 	qry := fmt.Sprintf(`
 		SELECT * 
@@ -222,72 +238,142 @@ func (pg *PostgreSQL) GetDocumentByID(auth internal.Auth, dbName, col, id string
 }
 
 func (pg *PostgreSQL) UpdateDocument(auth internal.Auth, dbName, col, id string, doc map[string]interface{}) (map[string]interface{}, error) {
-	where := secureWrite(auth, col)
+	where, err := pg.secureWrite(auth, dbName, col, internal.RuleWrite)
+	if err != nil {
+		return nil, err
+	}
 
 	qry := fmt.Sprintf(`
-		UPDATE %s.%s SET
-			data = data || $4
-		%s AND id = $3
-	`, dbName, internal.CleanCollectionName(col), where)
+		UPDATE %s.%s AS doc SET
+			data = doc.data || $4
+		%s
+	`, dbName, internal.CleanCollectionName(col), updateReturning(dbName, col, where))
 
 	b, err := json.Marshal(doc)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := pg.DB.Exec(qry, auth.AccountID, auth.UserID, id, b); err != nil {
+	tx, err := pg.DB.Begin()
+	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	updated, err := pg.GetDocumentByID(auth, dbName, col, id)
+	previous, updated, owner, err := scanUpdate(tx.QueryRow(qry, auth.AccountID, auth.UserID, id, b))
 	if err != nil {
 		return nil, err
 	}
 
-	pg.PublishDocument("db-"+col, internal.MsgTypeDBUpdated, updated)
+	// the updated document must still satisfy the write rule
+	if err := pg.canUpdate(auth, dbName, col, updated, owner); err != nil {
+		return nil, err
+	} else if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	pg.PublishDocument("db-"+col, internal.NewDocumentEvent(auth, dbName, col, internal.DocumentUpdate, previous, updated))
 
 	return updated, nil
 }
 
 func (pg *PostgreSQL) IncrementValue(auth internal.Auth, dbName, col, id, field string, n int) error {
-	where := secureWrite(auth, col)
+	where, err := pg.secureWrite(auth, dbName, col, internal.RuleWrite)
+	if err != nil {
+		return err
+	}
 
 	qry := fmt.Sprintf(`
-		UPDATE %s.%s SET
-		data = jsonb_set(data, '{%s}', (COALESCE(data->>'%s','0')::int + $4)::text::jsonb)
-		%s AND id = $3
-	`, dbName, internal.CleanCollectionName(col), field, field, where)
+		UPDATE %s.%s AS doc SET
+		data = jsonb_set(doc.data, '{%s}', (COALESCE(doc.data->>'%s','0')::int + $4)::text::jsonb)
+		%s
+	`, dbName, internal.CleanCollectionName(col), field, field, updateReturning(dbName, col, where))
 
-	if _, err := pg.DB.Exec(qry, auth.AccountID, auth.UserID, id, n); err != nil {
+	tx, err := pg.DB.Begin()
+	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	updated, err := pg.GetDocumentByID(auth, dbName, col, id)
+	previous, updated, owner, err := scanUpdate(tx.QueryRow(qry, auth.AccountID, auth.UserID, id, n))
 	if err != nil {
 		return err
 	}
 
-	pg.PublishDocument("db-"+col, internal.MsgTypeDBUpdated, updated)
+	if err := pg.canUpdate(auth, dbName, col, updated, owner); err != nil {
+		return err
+	} else if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	pg.PublishDocument("db-"+col, internal.NewDocumentEvent(auth, dbName, col, internal.DocumentUpdate, previous, updated))
 
 	return nil
 }
 
 func (pg *PostgreSQL) DeleteDocument(auth internal.Auth, dbName, col, id string) (int64, error) {
-	where := secureWrite(auth, col)
+	where, err := pg.secureWrite(auth, dbName, col, internal.RuleDelete)
+	if err != nil {
+		return 0, err
+	}
 
+	// the deleted document is the event's previous version
 	qry := fmt.Sprintf(`
 		DELETE 
 		FROM %s.%s 
 		%s AND id = $3
+		RETURNING *
 	`, dbName, internal.CleanCollectionName(col), where)
 
-	res, err := pg.DB.Exec(qry, auth.AccountID, auth.UserID, id)
-	if err != nil {
+	var doc Document
+	if err := scanDocument(pg.DB.QueryRow(qry, auth.AccountID, auth.UserID, id), &doc); err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
 		return 0, err
 	}
 
-	pg.PublishDocument("db-"+col, internal.MsgTypeDBDeleted, id)
-	return res.RowsAffected()
+	doc.Data[FieldID] = doc.ID
+	doc.Data[FieldAccountID] = doc.AccountID
+
+	evt := internal.NewDocumentEvent(auth, dbName, col, internal.DocumentDelete, doc.Data, nil)
+	evt.ID = id
+	pg.PublishDocument("db-"+col, evt)
+
+	return 1, nil
+}
+
+// updateReturning returns the FROM, WHERE and RETURNING clauses of an
+// update on the document $3 aliased doc. The row is locked and read before
+// the update so both versions are returned without another query.
+func updateReturning(dbName, col, where string) string {
+	return fmt.Sprintf(`
+		FROM (
+			SELECT id AS prev_id, data AS prev_data
+			FROM %s.%s
+			%s AND id = $3
+			FOR UPDATE
+		) AS prev
+		WHERE doc.id = prev.prev_id
+		RETURNING prev.prev_data, doc.id, doc.account_id, doc.owner_id, doc.data, doc.created
+	`, dbName, internal.CleanCollectionName(col), where)
+}
+
+// scanUpdate scans the previous and updated versions of a document and its
+// owner returned by an update using updateReturning
+func scanUpdate(row Scanner) (previous, updated map[string]interface{}, owner string, err error) {
+	var prev JSONB
+	var doc Document
+	if err = row.Scan(&prev, &doc.ID, &doc.AccountID, &doc.OwnerID, &doc.Data, &doc.Created); err != nil {
+		return
+	}
+
+	prev[FieldID] = doc.ID
+	prev[FieldAccountID] = doc.AccountID
+
+	doc.Data[FieldID] = doc.ID
+	doc.Data[FieldAccountID] = doc.AccountID
+
+	return prev, doc.Data, doc.OwnerID, nil
 }
 
 func (pg *PostgreSQL) ListCollections(dbName string) (results []string, err error) {
@@ -1,7 +1,10 @@
 package postgresql
 
 import (
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -10,12 +13,36 @@ import (
 
 func (pg *PostgreSQL) AddFunction(dbName string, data internal.ExecData) (id string, err error) {
 	qry := fmt.Sprintf(`
-		INSERT INTO %s.sb_functions(function_name, trigger_topic, code, version, last_updated, last_run)
-		VALUES($1, $2, $3, $4, $5, $6)
+		INSERT INTO %s.sb_functions(function_name, trigger_topic, code, version, last_updated, last_run, limits, kind, retry)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id;
 	`, dbName)
 
-	err = pg.DB.QueryRow(
+	limits, err := json.Marshal(data.Limits)
+	if err != nil {
+		return
+	}
+
+	retry, err := json.Marshal(data.Retry)
+	if err != nil {
+		return
+	}
+
+	if data.Version < 1 {
+		data.Version = 1
+	}
+
+	if len(data.Kind) == 0 {
+		data.Kind = internal.FunctionKindFunction
+	}
+
+	tx, err := pg.DB.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
 		qry,
 		data.FunctionName,
 		data.TriggerTopic,
@@ -23,18 +50,98 @@ func (pg *PostgreSQL) AddFunction(dbName string, data internal.ExecData) (id str
 		data.Version,
 		data.LastUpdated,
 		data.LastRun,
+		limits,
+		data.Kind,
+		retry,
 	).Scan(&id)
+	if err != nil {
+		return
+	}
+
+	if err = addFunctionVersion(tx, dbName, id); err != nil {
+		return
+	}
+
+	err = tx.Commit()
 	return
 }
+
+// UpdateFunction changes the function's code and saves it as a new version
 func (pg *PostgreSQL) UpdateFunction(dbName, id, code, trigger string) error {
 	qry := fmt.Sprintf(`
 		UPDATE %s.sb_functions SET
 			code = $3,
-			version = version + 1
+			version = version + 1,
+			last_updated = $4
 		WHERE id = $1 AND trigger_topic = $2
 	`, dbName)
 
-	if _, err := pg.DB.Exec(qry, id, trigger, code); err != nil {
+	tx, err := pg.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(qry, id, trigger, code, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return tx.Commit()
+	}
+
+	if err := addFunctionVersion(tx, dbName, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addFunctionVersion saves the current code of a function as its version
+func addFunctionVersion(tx *sql.Tx, dbName, id string) error {
+	qry := fmt.Sprintf(`
+		INSERT INTO %s.sb_function_versions(function_id, version, code, trigger_topic, created)
+		SELECT id, version, code, trigger_topic, $2 FROM %s.sb_functions
+		WHERE id = $1
+	`, dbName, dbName)
+
+	_, err := tx.Exec(qry, id, time.Now())
+	return err
+}
+
+func (pg *PostgreSQL) UpdateFunctionLimits(dbName, id string, limits internal.FunctionLimits) error {
+	qry := fmt.Sprintf(`
+		UPDATE %s.sb_functions SET
+			limits = $2
+		WHERE id = $1
+	`, dbName)
+
+	b, err := json.Marshal(limits)
+	if err != nil {
+		return err
+	}
+
+	if _, err := pg.DB.Exec(qry, id, b); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgreSQL) UpdateFunctionRetry(dbName, id string, retry internal.RetryPolicy) error {
+	qry := fmt.Sprintf(`
+		UPDATE %s.sb_functions SET
+			retry = $2
+		WHERE id = $1
+	`, dbName)
+
+	b, err := json.Marshal(retry)
+	if err != nil {
+		return err
+	}
+
+	if _, err := pg.DB.Exec(qry, id, b); err != nil {
 		return err
 	}
 	return nil
@@ -213,11 +320,20 @@ func (pg *PostgreSQL) RanFunction(dbName, id string, rh internal.ExecHistory) er
 	}
 
 	qry = fmt.Sprintf(`
-		INSERT INTO %s.sb_function_logs(function_id, version, started, completed, success, output)
-		VALUES($1, $2, $3, $4, $5, $6)
+		INSERT INTO %s.sb_function_logs(function_id, version, started, completed, success, output, reason, logs)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8)
 	`, dbName)
 
-	_, err := pg.DB.Exec(
+	if rh.Logs == nil {
+		rh.Logs = make([]internal.FunctionLog, 0)
+	}
+
+	logs, err := json.Marshal(rh.Logs)
+	if err != nil {
+		return err
+	}
+
+	_, err = pg.DB.Exec(
 		qry,
 		id,
 		rh.Version,
@@ -225,13 +341,285 @@ func (pg *PostgreSQL) RanFunction(dbName, id string, rh internal.ExecHistory) er
 		rh.Completed,
 		rh.Success,
 		pq.Array(rh.Output),
+		rh.Reason,
+		logs,
 	)
 
 	return err
 }
 
+// ListFunctionRuns returns a page of a function's runs matching the filter
+func (pg *PostgreSQL) ListFunctionRuns(dbName, id string, filter internal.RunFilter) (result internal.FunctionRuns, err error) {
+	filter = filter.WithDefaults()
+
+	where := []string{"function_id = $1"}
+	args := []interface{}{id}
+
+	add := func(clause string, v interface{}) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+
+	switch filter.Status {
+	case internal.RunStatusSuccess:
+		add("success = $%d", true)
+	case internal.RunStatusFailed:
+		add("success = $%d", false)
+	}
+
+	if !filter.From.IsZero() {
+		add("started >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("started <= $%d", filter.To)
+	}
+	if filter.Version > 0 {
+		add("version = $%d", filter.Version)
+	}
+
+	cond := strings.Join(where, " AND ")
+
+	qry := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM %s.sb_function_logs
+		WHERE %s
+	`, dbName, cond)
+
+	if err = pg.DB.QueryRow(qry, args...).Scan(&result.Total); err != nil {
+		return
+	}
+
+	result.Page = filter.Page
+	result.Size = filter.Size
+
+	qry = fmt.Sprintf(`
+		SELECT *
+		FROM %s.sb_function_logs
+		WHERE %s
+		ORDER BY started DESC
+		LIMIT %d OFFSET %d
+	`, dbName, cond, filter.Size, (filter.Page-1)*filter.Size)
+
+	rows, err := pg.DB.Query(qry, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h internal.ExecHistory
+		if err = scanExecHistory(rows, &h); err != nil {
+			return
+		}
+
+		result.Results = append(result.Results, h)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// DeleteFunctionRuns deletes the runs started before a time
+func (pg *PostgreSQL) DeleteFunctionRuns(dbName string, before time.Time) error {
+	qry := fmt.Sprintf(`
+		DELETE FROM %s.sb_function_logs
+		WHERE started < $1
+	`, dbName)
+
+	if _, err := pg.DB.Exec(qry, before); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgreSQL) ListFunctionVersions(dbName, id string) (results []internal.FunctionVersion, err error) {
+	qry := fmt.Sprintf(`
+		SELECT * 
+		FROM %s.sb_function_versions 
+		WHERE function_id = $1
+		ORDER BY version DESC
+	`, dbName)
+
+	rows, err := pg.DB.Query(qry, id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v internal.FunctionVersion
+		if err = scanFunctionVersion(rows, &v); err != nil {
+			return
+		}
+
+		results = append(results, v)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (pg *PostgreSQL) GetFunctionVersion(dbName, id string, version int) (result internal.FunctionVersion, err error) {
+	qry := fmt.Sprintf(`
+		SELECT * 
+		FROM %s.sb_function_versions 
+		WHERE function_id = $1 AND version = $2
+	`, dbName)
+
+	row := pg.DB.QueryRow(qry, id, version)
+
+	err = scanFunctionVersion(row, &result)
+	return
+}
+
+func (pg *PostgreSQL) PinFunctionVersion(dbName, id string, version int) error {
+	qry := fmt.Sprintf(`
+		UPDATE %s.sb_functions SET
+			pinned_version = $2
+		WHERE id = $1
+	`, dbName)
+
+	if _, err := pg.DB.Exec(qry, id, version); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgreSQL) AddFunctionDeadLetter(dbName string, dl internal.FunctionDeadLetter) (id string, err error) {
+	qry := fmt.Sprintf(`
+		INSERT INTO %s.sb_function_dead_letters(function_id, function_name, command, auth, attempts, error, created, pending, next_attempt)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id;
+	`, dbName)
+
+	cmd, err := json.Marshal(dl.Command)
+	if err != nil {
+		return
+	}
+
+	auth, err := json.Marshal(dl.Auth)
+	if err != nil {
+		return
+	}
+
+	err = pg.DB.QueryRow(
+		qry,
+		dl.FunctionID,
+		dl.FunctionName,
+		cmd,
+		auth,
+		dl.Attempts,
+		dl.Error,
+		dl.Created,
+		dl.Pending,
+		dl.NextAttempt,
+	).Scan(&id)
+	return
+}
+
+func (pg *PostgreSQL) UpdateFunctionDeadLetter(dbName string, dl internal.FunctionDeadLetter) error {
+	qry := fmt.Sprintf(`
+		UPDATE %s.sb_function_dead_letters SET
+			attempts = $2,
+			error = $3,
+			pending = $4,
+			next_attempt = $5
+		WHERE id = $1
+	`, dbName)
+
+	if _, err := pg.DB.Exec(qry, dl.ID, dl.Attempts, dl.Error, dl.Pending, dl.NextAttempt); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgreSQL) GetFunctionDeadLetter(dbName, id string) (dl internal.FunctionDeadLetter, err error) {
+	qry := fmt.Sprintf(`
+		SELECT *
+		FROM %s.sb_function_dead_letters
+		WHERE id = $1
+	`, dbName)
+
+	row := pg.DB.QueryRow(qry, id)
+
+	err = scanFunctionDeadLetter(row, &dl)
+	return
+}
+
+// ListFunctionDeadLetters returns the last 100 dead letters, optionally of a
+// function
+func (pg *PostgreSQL) ListFunctionDeadLetters(dbName, functionID string) (results []internal.FunctionDeadLetter, err error) {
+	qry := fmt.Sprintf(`
+		SELECT *
+		FROM %s.sb_function_dead_letters
+		WHERE pending = false AND ($1 = '' OR function_id::text = $1)
+		ORDER BY created DESC
+		LIMIT 100
+	`, dbName)
+
+	rows, err := pg.DB.Query(qry, functionID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dl internal.FunctionDeadLetter
+		if err = scanFunctionDeadLetter(rows, &dl); err != nil {
+			return
+		}
+
+		results = append(results, dl)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// ListDueFunctionDeadLetters returns the pending events to attempt again
+func (pg *PostgreSQL) ListDueFunctionDeadLetters(dbName string, now time.Time) (results []internal.FunctionDeadLetter, err error) {
+	qry := fmt.Sprintf(`
+		SELECT *
+		FROM %s.sb_function_dead_letters
+		WHERE pending = true AND next_attempt <= $1
+		ORDER BY next_attempt
+		LIMIT 100
+	`, dbName)
+
+	rows, err := pg.DB.Query(qry, now)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dl internal.FunctionDeadLetter
+		if err = scanFunctionDeadLetter(rows, &dl); err != nil {
+			return
+		}
+
+		results = append(results, dl)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (pg *PostgreSQL) DeleteFunctionDeadLetter(dbName, id string) error {
+	qry := fmt.Sprintf(`
+		DELETE FROM %s.sb_function_dead_letters
+		WHERE id = $1
+	`, dbName)
+
+	if _, err := pg.DB.Exec(qry, id); err != nil {
+		return err
+	}
+	return nil
+}
+
 func scanExecData(rows Scanner, ex *internal.ExecData) error {
-	return rows.Scan(
+	var limits, retry []byte
+	err := rows.Scan(
 		&ex.ID,
 		&ex.FunctionName,
 		&ex.TriggerTopic,
@@ -239,11 +627,24 @@ func scanExecData(rows Scanner, ex *internal.ExecData) error {
 		&ex.Version,
 		&ex.LastUpdated,
 		&ex.LastRun,
+		&limits,
+		&ex.PinnedVersion,
+		&ex.Kind,
+		&retry,
 	)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(retry, &ex.Retry); err != nil {
+		return err
+	}
+	return json.Unmarshal(limits, &ex.Limits)
 }
 
 func scanExecHistory(rows Scanner, h *internal.ExecHistory) error {
-	return rows.Scan(
+	var logs []byte
+	err := rows.Scan(
 		&h.ID,
 		&h.FunctionID,
 		&h.Version,
@@ -251,5 +652,47 @@ func scanExecHistory(rows Scanner, h *internal.ExecHistory) error {
 		&h.Completed,
 		&h.Success,
 		pq.Array(&h.Output),
+		&h.Reason,
+		&logs,
+	)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(logs, &h.Logs)
+}
+
+func scanFunctionVersion(rows Scanner, v *internal.FunctionVersion) error {
+	return rows.Scan(
+		&v.ID,
+		&v.FunctionID,
+		&v.Version,
+		&v.Code,
+		&v.TriggerTopic,
+		&v.Created,
+	)
+}
+
+func scanFunctionDeadLetter(rows Scanner, dl *internal.FunctionDeadLetter) error {
+	var cmd, auth []byte
+	err := rows.Scan(
+		&dl.ID,
+		&dl.FunctionID,
+		&dl.FunctionName,
+		&cmd,
+		&auth,
+		&dl.Attempts,
+		&dl.Error,
+		&dl.Created,
+		&dl.Pending,
+		&dl.NextAttempt,
 	)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(cmd, &dl.Command); err != nil {
+		return err
+	}
+	return json.Unmarshal(auth, &dl.Auth)
 }
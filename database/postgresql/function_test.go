@@ -60,6 +60,25 @@ func TestUpdateFunction(t *testing.T) {
 	}
 }
 
+func TestUpdateFunctionLimits(t *testing.T) {
+	id, err := createFunction("limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limits := internal.FunctionLimits{Timeout: 2, MaxCallStack: 100, MaxMemory: 8}
+	if err := datastore.UpdateFunctionLimits(confDBName, id, limits); err != nil {
+		t.Fatal(err)
+	}
+
+	fn, err := datastore.GetFunctionByID(confDBName, id)
+	if err != nil {
+		t.Fatal(err)
+	} else if fn.Limits != limits {
+		t.Errorf("expected limits to be %v got %v", limits, fn.Limits)
+	}
+}
+
 func TestGetFunctionForExecution(t *testing.T) {
 	fnName := "get-for-exec"
 	id, err := createFunction(fnName)
@@ -197,3 +216,43 @@ func TestRanFunction(t *testing.T) {
 		t.Errorf("expected history[0] to have succeeded and version at 1 got %v", fn.History[0])
 	}
 }
+
+func TestFunctionVersions(t *testing.T) {
+	id, err := createFunction("versions")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, code := range []string{"v2", "v3"} {
+		if err := datastore.UpdateFunction(confDBName, id, code, "web"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions, err := datastore.ListFunctionVersions(confDBName, id)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(versions) != 3 {
+		t.Fatalf("expected 3 versions got %d", len(versions))
+	} else if versions[0].Version != 3 || versions[0].Code != "v3" {
+		t.Errorf("expected the newest version first got %v", versions[0])
+	}
+
+	v, err := datastore.GetFunctionVersion(confDBName, id, 2)
+	if err != nil {
+		t.Fatal(err)
+	} else if v.Code != "v2" {
+		t.Errorf("expected version 2 code to be v2 got %s", v.Code)
+	}
+
+	if err := datastore.PinFunctionVersion(confDBName, id, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	fn, err := datastore.GetFunctionByID(confDBName, id)
+	if err != nil {
+		t.Fatal(err)
+	} else if fn.PinnedVersion != 2 || fn.Code != "v3" {
+		t.Errorf("expected version 2 pinned with the v3 code got %d %s", fn.PinnedVersion, fn.Code)
+	}
+}
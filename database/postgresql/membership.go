@@ -117,3 +117,88 @@ func (pg *PostgreSQL) ResetPassword(dbName, email, code, password string) error
 	}
 	return nil
 }
+
+func (pg *PostgreSQL) CreateInvitation(dbName string, inv internal.Invitation) (id string, err error) {
+	qry := fmt.Sprintf(`
+		INSERT INTO %s.sb_invitations(account_id, email, role, code, invited_by, created, expires)
+		VALUES($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id;
+	`, dbName)
+
+	err = pg.DB.QueryRow(
+		qry,
+		inv.AccountID,
+		inv.Email,
+		inv.Role,
+		inv.Code,
+		inv.InvitedBy,
+		inv.Created,
+		inv.Expires,
+	).Scan(&id)
+	return
+}
+
+func (pg *PostgreSQL) FindInvitation(dbName, code string) (inv internal.Invitation, err error) {
+	qry := fmt.Sprintf(`
+		SELECT * 
+		FROM %s.sb_invitations 
+		WHERE code = $1
+	`, dbName)
+
+	row := pg.DB.QueryRow(qry, code)
+
+	err = scanInvitation(row, &inv)
+	return
+}
+
+func (pg *PostgreSQL) ListInvitations(dbName, accountID string) (results []internal.Invitation, err error) {
+	qry := fmt.Sprintf(`
+		SELECT * 
+		FROM %s.sb_invitations 
+		WHERE account_id = $1
+		ORDER BY created DESC
+	`, dbName)
+
+	rows, err := pg.DB.Query(qry, accountID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var inv internal.Invitation
+		if err = scanInvitation(rows, &inv); err != nil {
+			return
+		}
+
+		results = append(results, inv)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (pg *PostgreSQL) DeleteInvitation(dbName, accountID, id string) error {
+	qry := fmt.Sprintf(`
+		DELETE FROM %s.sb_invitations
+		WHERE account_id = $1 AND id = $2
+	`, dbName)
+
+	if _, err := pg.DB.Exec(qry, accountID, id); err != nil {
+		return err
+	}
+	return nil
+}
+
+func scanInvitation(rows Scanner, inv *internal.Invitation) error {
+	return rows.Scan(
+		&inv.ID,
+		&inv.AccountID,
+		&inv.Email,
+		&inv.Role,
+		&inv.Code,
+		&inv.InvitedBy,
+		&inv.Created,
+		&inv.Expires,
+	)
+}
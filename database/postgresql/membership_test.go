@@ -107,3 +107,42 @@ func TestUserSetPassword(t *testing.T) {
 		t.Errorf("expected password to be %s got %s", expected, tok.Password)
 	}
 }
+
+func TestInvitations(t *testing.T) {
+	inv := internal.Invitation{
+		AccountID: adminToken.AccountID,
+		Email:     "invite@test.com",
+		Role:      0,
+		Code:      "invite_code_from_unit_test",
+		InvitedBy: adminToken.ID,
+		Created:   time.Now(),
+		Expires:   time.Now().Add(1 * time.Hour),
+	}
+
+	id, err := datastore.CreateInvitation(confDBName, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check, err := datastore.FindInvitation(confDBName, inv.Code)
+	if err != nil {
+		t.Fatal(err)
+	} else if check.ID != id || check.Email != inv.Email {
+		t.Errorf("expected invitation %s for %s got %s for %s", id, inv.Email, check.ID, check.Email)
+	}
+
+	invs, err := datastore.ListInvitations(confDBName, adminToken.AccountID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(invs) == 0 {
+		t.Errorf("expected at least 1 invitation got 0")
+	}
+
+	if err := datastore.DeleteInvitation(confDBName, adminToken.AccountID, id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := datastore.FindInvitation(confDBName, inv.Code); err == nil {
+		t.Errorf("expected invitation to be deleted")
+	}
+}
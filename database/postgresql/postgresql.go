@@ -13,6 +13,8 @@ import (
 type PostgreSQL struct {
 	DB              *sql.DB
 	PublishDocument internal.PublishDocumentEvent
+	// FindRule returns the cached rules, GetRule is used when it's nil
+	FindRule internal.RuleFinder
 }
 
 var (
@@ -20,7 +22,7 @@ var (
 	appFS         = afero.NewOsFs()
 )
 
-func New(db *sql.DB, pubdoc internal.PublishDocumentEvent, migPath string) internal.Persister {
+func New(db *sql.DB, pubdoc internal.PublishDocumentEvent, findRule internal.RuleFinder, migPath string) internal.Persister {
 	migrationPath = migPath
 
 	// run migrations
@@ -31,7 +33,15 @@ func New(db *sql.DB, pubdoc internal.PublishDocumentEvent, migPath string) inter
 		os.Exit(1)
 	}
 
-	return &PostgreSQL{DB: db, PublishDocument: pubdoc}
+	return &PostgreSQL{DB: db, PublishDocument: pubdoc, FindRule: findRule}
+}
+
+// rule returns a collection's rule, from cache when available
+func (pg *PostgreSQL) rule(dbName, col string) (internal.Rule, error) {
+	if pg.FindRule != nil {
+		return pg.FindRule(dbName, col)
+	}
+	return pg.GetRule(dbName, col)
 }
 
 func (pg *PostgreSQL) Ping() error {
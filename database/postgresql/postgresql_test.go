@@ -30,7 +30,7 @@ var (
 	adminAuth    internal.Auth
 )
 
-func fakePubDocEvent(channel, typ string, v interface{}) {
+func fakePubDocEvent(channel string, evt internal.DocumentEvent) {
 	//no event pub in those tests
 }
 
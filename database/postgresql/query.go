@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/lib/pq"
 	"github.com/staticbackendhq/core/internal"
 )
 
@@ -52,40 +53,288 @@ func applyFilter(where string, filters map[string]interface{}) string {
 	return where
 }
 
-func secureRead(auth internal.Auth, col string) string {
+func (pg *PostgreSQL) secureRead(auth internal.Auth, dbName, col string) (string, error) {
+	if where, ok, err := pg.applyRule(auth, dbName, col, internal.RuleRead); err != nil {
+		return "", err
+	} else if ok {
+		return where, nil
+	}
+
 	if strings.HasPrefix(col, "pub_") && auth.Role < 100 {
-		return "WHERE 1=1 "
+		return "WHERE 1=1 ", nil
 	}
 
 	switch internal.ReadPermission(col) {
 	case internal.PermGroup:
-		return "WHERE account_id = $1 AND $2=$2 "
+		return "WHERE account_id = $1 AND $2=$2 ", nil
 	case internal.PermOwner:
-		return "WHERE account_id = $1 AND owner_id = $2 "
+		return "WHERE account_id = $1 AND owner_id = $2 ", nil
 	default:
 		//for read permission to everyone i.e. col-name_774_
-		return "WHERE $1=$1 AND $2=$2 "
+		return "WHERE $1=$1 AND $2=$2 ", nil
 	}
 }
 
-func secureWrite(auth internal.Auth, col string) string {
+// secureWrite returns the where clause for the write or delete operation
+func (pg *PostgreSQL) secureWrite(auth internal.Auth, dbName, col, op string) (string, error) {
+	if where, ok, err := pg.applyRule(auth, dbName, col, op); err != nil {
+		return "", err
+	} else if ok {
+		return where, nil
+	}
+
 	if strings.HasPrefix(col, "pub_") && auth.Role < 100 {
-		return "WHERE 1=1 "
+		return "WHERE 1=1 ", nil
 	}
 
 	switch internal.WritePermission(col) {
 	case internal.PermGroup:
-		return "WHERE account_id = $1 AND $2=$2 "
+		return "WHERE account_id = $1 AND $2=$2 ", nil
 	case internal.PermOwner:
-		return "WHERE account_id = $1 AND owner_id = $2 "
+		return "WHERE account_id = $1 AND owner_id = $2 ", nil
 	default:
 		//for write permission to everyone i.e. col-name_776_
 		// This should probably get more warning in the doc.
 		// All logged-in users can update/delete data.
 		// There's use cases for that, and it's certainly opt-in
 		// but it's not recommended.
-		return "WHERE $1=$1 AND $2=$2 "
+		return "WHERE $1=$1 AND $2=$2 ", nil
+	}
+}
+
+// applyRule returns the where clause from the collection's rule if there's
+// one for this operation. Root users are not restricted by rules.
+func (pg *PostgreSQL) applyRule(auth internal.Auth, dbName, col, op string) (string, bool, error) {
+	if auth.Role >= 100 {
+		return "", false, nil
+	}
+
+	rule, err := pg.rule(dbName, col)
+	if err != nil {
+		return "", false, err
+	}
+
+	cond := rule.Condition(op)
+	if len(cond) == 0 {
+		return "", false, nil
+	}
+
+	e, err := internal.ParseRule(cond)
+	if err != nil {
+		return "", false, err
+	}
+
+	e, err = internal.BindRule(e, internal.RuleEnv(auth, nil))
+	if err != nil {
+		return "", false, err
+	}
+
+	clause, err := ruleToSQL(e)
+	if err != nil {
+		return "", false, err
+	}
+
+	return fmt.Sprintf("WHERE $1=$1 AND $2=$2 AND %s ", clause), true, nil
+}
+
+// canCreate evaluates the write rule against the document to be created.
+func (pg *PostgreSQL) canCreate(auth internal.Auth, dbName, col string, doc map[string]interface{}) error {
+	data := make(map[string]interface{})
+	for k, v := range doc {
+		data[k] = v
+	}
+	data[FieldAccountID] = auth.AccountID
+	data["ownerId"] = auth.UserID
+
+	return pg.checkWrite(auth, dbName, col, data, "create")
+}
+
+// canUpdate evaluates the write rule against the updated document, the
+// existing one was already filtered by secureWrite.
+func (pg *PostgreSQL) canUpdate(auth internal.Auth, dbName, col string, doc map[string]interface{}, owner string) error {
+	data := make(map[string]interface{})
+	for k, v := range doc {
+		data[k] = v
+	}
+	data["ownerId"] = owner
+
+	return pg.checkWrite(auth, dbName, col, data, "update")
+}
+
+func (pg *PostgreSQL) checkWrite(auth internal.Auth, dbName, col string, data map[string]interface{}, action string) error {
+	if auth.Role >= 100 {
+		return nil
+	}
+
+	rule, err := pg.rule(dbName, col)
+	if err != nil {
+		return err
+	}
+
+	cond := rule.Condition(internal.RuleWrite)
+	if len(cond) == 0 {
+		return nil
+	}
+
+	ok, err := internal.EvalRule(cond, internal.RuleEnv(auth, data))
+	if err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("not enough permission to %s this document", action)
+	}
+	return nil
+}
+
+func ruleToSQL(e internal.Expr) (string, error) {
+	switch x := e.(type) {
+	case internal.Literal:
+		b, ok := x.Value.(bool)
+		if !ok {
+			return "", fmt.Errorf("condition must be a boolean: %v", x.Value)
+		} else if b {
+			return "1=1", nil
+		}
+		return "1=0", nil
+	case internal.NotExpr:
+		inner, err := ruleToSQL(x.X)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("NOT (%s)", inner), nil
+	case internal.BinaryExpr:
+		if x.Op == "&&" || x.Op == "||" {
+			l, err := ruleToSQL(x.Left)
+			if err != nil {
+				return "", err
+			}
+			r, err := ruleToSQL(x.Right)
+			if err != nil {
+				return "", err
+			}
+
+			op := "AND"
+			if x.Op == "||" {
+				op = "OR"
+			}
+			return fmt.Sprintf("(%s %s %s)", l, op, r), nil
+		}
+
+		return comparisonToSQL(x)
+	case internal.Ident:
+		return "", fmt.Errorf("%s must be compared to a value", x.Name)
+	}
+	return "", fmt.Errorf("unsupported condition: %v", e)
+}
+
+func comparisonToSQL(x internal.BinaryExpr) (string, error) {
+	op := x.Op
+	left, right := x.Left, x.Right
+
+	// we want the document field on the left side
+	if _, ok := left.(internal.Literal); ok {
+		left, right = right, left
+		op = internal.FlipComparison(op)
+	}
+
+	id, ok := left.(internal.Ident)
+	if !ok || id.Root() != "doc" {
+		return "", fmt.Errorf("unknown variable in condition: %v", left)
+	}
+
+	if other, ok := right.(internal.Ident); ok {
+		if other.Root() != "doc" {
+			return "", fmt.Errorf("unknown variable in condition: %s", other.Name)
+		}
+		l, r := ruleColumn(id.Field()), ruleColumn(other.Field())
+		lj, rj := ruleJSON(id.Field()), ruleJSON(other.Field())
+		if len(lj) == 0 || len(rj) == 0 {
+			return fmt.Sprintf("%s %s %s", l, sqlOp(op), r), nil
+		}
+
+		// like internal.Compare, numbers are compared as numbers and
+		// everything else as text
+		return fmt.Sprintf(
+			"(CASE WHEN jsonb_typeof(%s) = 'number' AND jsonb_typeof(%s) = 'number' THEN (%s)::numeric %s (%s)::numeric ELSE %s %s %s END)",
+			lj, rj, l, sqlOp(op), r, l, sqlOp(op), r,
+		), nil
+	}
+
+	lit, ok := right.(internal.Literal)
+	if !ok {
+		return "", fmt.Errorf("unsupported comparison: %v", right)
+	}
+
+	col := ruleColumn(id.Field())
+
+	switch v := lit.Value.(type) {
+	case nil:
+		if op == "==" {
+			return col + " IS NULL", nil
+		} else if op == "!=" {
+			return col + " IS NOT NULL", nil
+		}
+		return "", fmt.Errorf("cannot use %s with null", op)
+	case float64:
+		// casting a string or an object to numeric is an error, those
+		// values are compared as text like internal.Compare does
+		j := ruleJSON(id.Field())
+		text := fmt.Sprintf("%s %s %s", col, sqlOp(op), pq.QuoteLiteral(fmt.Sprintf("%v", v)))
+		if len(j) == 0 {
+			return text, nil
+		}
+		return fmt.Sprintf("(CASE WHEN jsonb_typeof(%s) = 'number' THEN (%s)::numeric %s %v ELSE %s END)", j, col, sqlOp(op), v, text), nil
+	case bool:
+		j := ruleJSON(id.Field())
+		text := fmt.Sprintf("%s %s %s", col, sqlOp(op), pq.QuoteLiteral(fmt.Sprintf("%v", v)))
+		if len(j) == 0 {
+			return text, nil
+		}
+		return fmt.Sprintf("(CASE WHEN jsonb_typeof(%s) = 'boolean' THEN (%s)::boolean %s %v ELSE %s END)", j, col, sqlOp(op), v, text), nil
+	default:
+		return fmt.Sprintf("%s %s %s", col, sqlOp(op), pq.QuoteLiteral(fmt.Sprintf("%v", v))), nil
+	}
+}
+
+func ruleColumn(field string) string {
+	switch field {
+	case FieldID:
+		return "id::text"
+	case FieldAccountID:
+		return "account_id::text"
+	case "ownerId":
+		return "owner_id::text"
+	}
+
+	if strings.Contains(field, ".") {
+		path := strings.Replace(field, ".", ",", -1)
+		return fmt.Sprintf("data #>> %s", pq.QuoteLiteral("{"+path+"}"))
+	}
+	return fmt.Sprintf("data->>%s", pq.QuoteLiteral(field))
+}
+
+// ruleJSON returns the jsonb value of a document field, system columns are
+// not stored in data and return an empty string.
+func ruleJSON(field string) string {
+	switch field {
+	case FieldID, FieldAccountID, "ownerId":
+		return ""
+	}
+
+	if strings.Contains(field, ".") {
+		path := strings.Replace(field, ".", ",", -1)
+		return fmt.Sprintf("data #> %s", pq.QuoteLiteral("{"+path+"}"))
+	}
+	return fmt.Sprintf("data->%s", pq.QuoteLiteral(field))
+}
+
+func sqlOp(op string) string {
+	switch op {
+	case "==":
+		return "="
+	case "!=":
+		return "<>"
 	}
+	return op
 }
 
 func setPaging(params internal.ListParams) string {
@@ -0,0 +1,97 @@
+package postgresql
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func (pg *PostgreSQL) SaveRule(dbName string, rule internal.Rule) error {
+	qry := fmt.Sprintf(`
+		INSERT INTO %s.sb_rules(collection, read, write, del, updated)
+		VALUES($1, $2, $3, $4, $5)
+		ON CONFLICT (collection) DO UPDATE SET
+			read = $2,
+			write = $3,
+			del = $4,
+			updated = $5
+	`, dbName)
+
+	_, err := pg.DB.Exec(
+		qry,
+		internal.CleanCollectionName(rule.Collection),
+		rule.Read,
+		rule.Write,
+		rule.Delete,
+		time.Now(),
+	)
+	return err
+}
+
+// GetRule returns an empty rule when the collection does not have one
+func (pg *PostgreSQL) GetRule(dbName, col string) (rule internal.Rule, err error) {
+	qry := fmt.Sprintf(`
+		SELECT * 
+		FROM %s.sb_rules 
+		WHERE collection = $1
+	`, dbName)
+
+	row := pg.DB.QueryRow(qry, internal.CleanCollectionName(col))
+
+	err = scanRule(row, &rule)
+	if err == sql.ErrNoRows {
+		return internal.Rule{}, nil
+	}
+	return
+}
+
+func (pg *PostgreSQL) ListRules(dbName string) (results []internal.Rule, err error) {
+	qry := fmt.Sprintf(`
+		SELECT * 
+		FROM %s.sb_rules 
+		ORDER BY collection
+	`, dbName)
+
+	rows, err := pg.DB.Query(qry)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule internal.Rule
+		if err = scanRule(rows, &rule); err != nil {
+			return
+		}
+
+		results = append(results, rule)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (pg *PostgreSQL) DeleteRule(dbName, col string) error {
+	qry := fmt.Sprintf(`
+		DELETE FROM %s.sb_rules
+		WHERE collection = $1
+	`, dbName)
+
+	if _, err := pg.DB.Exec(qry, internal.CleanCollectionName(col)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func scanRule(rows Scanner, rule *internal.Rule) error {
+	return rows.Scan(
+		&rule.ID,
+		&rule.Collection,
+		&rule.Read,
+		&rule.Write,
+		&rule.Delete,
+		&rule.Updated,
+	)
+}
@@ -1,6 +1,7 @@
 package postgresql
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"strings"
@@ -38,10 +39,15 @@ func (pg *PostgreSQL) CreateBase(base internal.BaseConfig) (b internal.BaseConfi
 		return
 	}
 
+	settings, err := json.Marshal(base.Settings)
+	if err != nil {
+		return
+	}
+
 	var id string
 	err = pg.DB.QueryRow(`
-	INSERT INTO sb.apps(customer_id, name, allowed_domain, is_active, monthly_email_sent, created)
-	VALUES($1, $2, $3, $4, $5, $6)
+	INSERT INTO sb.apps(customer_id, name, allowed_domain, is_active, monthly_email_sent, created, settings)
+	VALUES($1, $2, $3, $4, $5, $6, $7)
 	RETURNING id;
 	`, base.CustomerID,
 		base.Name,
@@ -49,6 +55,7 @@ func (pg *PostgreSQL) CreateBase(base internal.BaseConfig) (b internal.BaseConfi
 		base.IsActive,
 		base.MonthlySentEmail,
 		base.Created,
+		settings,
 	).Scan(&id)
 	if err != nil {
 		return
@@ -79,6 +86,75 @@ func (pg *PostgreSQL) createSystemTables(schema string) error {
 			created timestamp NOT NULL			
 		);
 
+		CREATE TABLE IF NOT EXISTS {schema}.sb_invitations (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+			account_id uuid REFERENCES {schema}.sb_accounts(id) ON DELETE CASCADE,
+			email TEXT NOT NULL,
+			role INTEGER NOT NULL,
+			code TEXT UNIQUE NOT NULL,
+			invited_by uuid REFERENCES {schema}.sb_tokens(id) ON DELETE CASCADE,
+			created timestamp NOT NULL,
+			expires timestamp NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS sb_invitations_acctid_idx ON {schema}.sb_invitations (account_id);
+
+		CREATE TABLE IF NOT EXISTS {schema}.sb_rules (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+			collection TEXT UNIQUE NOT NULL,
+			read TEXT NOT NULL,
+			write TEXT NOT NULL,
+			del TEXT NOT NULL,
+			updated timestamp NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS {schema}.sb_apikeys (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+			account_id uuid REFERENCES {schema}.sb_accounts(id) ON DELETE CASCADE,
+			token_id uuid REFERENCES {schema}.sb_tokens(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			hash TEXT NOT NULL,
+			scopes TEXT[] NOT NULL,
+			expires timestamp NOT NULL,
+			last_used timestamp NOT NULL,
+			created timestamp NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS {schema}.sb_signing_keys (
+			id TEXT PRIMARY KEY,
+			alg TEXT NOT NULL,
+			private BYTEA NOT NULL,
+			public BYTEA,
+			created timestamp NOT NULL,
+			expires timestamp NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS {schema}.sb_webhooks (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+			name TEXT NOT NULL,
+			url TEXT NOT NULL,
+			events TEXT[] NOT NULL,
+			secret TEXT NOT NULL,
+			active BOOLEAN NOT NULL,
+			created timestamp NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS {schema}.sb_webhook_deliveries (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+			webhook_id uuid REFERENCES {schema}.sb_webhooks(id) ON DELETE CASCADE,
+			event TEXT NOT NULL,
+			channel TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			state TEXT NOT NULL,
+			attempts INTEGER NOT NULL,
+			status INTEGER NOT NULL,
+			error TEXT NOT NULL,
+			created timestamp NOT NULL,
+			updated timestamp NOT NULL,
+			next_attempt timestamp NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS sb_webhook_deliveries_webhook_idx ON {schema}.sb_webhook_deliveries (webhook_id, state);
+		CREATE INDEX IF NOT EXISTS sb_webhook_deliveries_due_idx ON {schema}.sb_webhook_deliveries (state, next_attempt);
+
 		CREATE TABLE IF NOT EXISTS {schema}.sb_forms (
 			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
 			name TEXT NOT NULL,
@@ -104,10 +180,24 @@ func (pg *PostgreSQL) createSystemTables(schema string) error {
 			code TEXT NOT NULL,
 			version INTEGER NOT NULL,
 			last_updated timestamp NOT NULL,
-			last_run timestamp NOT NULL
+			last_run timestamp NOT NULL,
+			limits jsonb NOT NULL DEFAULT '{}',
+			pinned_version INTEGER NOT NULL DEFAULT 0,
+			kind TEXT NOT NULL DEFAULT 'function',
+			retry jsonb NOT NULL DEFAULT '{}'
 		);
 		CREATE INDEX IF NOT EXISTS sb_functions_trigger_topic_idx ON {schema}.sb_functions (trigger_topic);
 
+		CREATE TABLE IF NOT EXISTS {schema}.sb_function_versions (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+			function_id uuid REFERENCES {schema}.sb_functions(id) ON DELETE CASCADE,
+			version INTEGER NOT NULL,
+			code TEXT NOT NULL,
+			trigger_topic TEXT NOT NULL,
+			created timestamp NOT NULL,
+			UNIQUE (function_id, version)
+		);
+
 		CREATE TABLE IF NOT EXISTS {schema}.sb_function_logs (
 			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
 			function_id uuid REFERENCES {schema}.sb_functions(id) ON DELETE CASCADE,
@@ -115,8 +205,26 @@ func (pg *PostgreSQL) createSystemTables(schema string) error {
 			started timestamp NOT NULL,
 			completed timestamp NOT NULL,
 			success BOOLEAN NOT NULL,
-			output TEXT[] NOT NULL
+			output TEXT[] NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			logs jsonb NOT NULL DEFAULT '[]'
 		);
+		CREATE INDEX IF NOT EXISTS sb_function_logs_fnid_started_idx ON {schema}.sb_function_logs (function_id, started);
+
+		CREATE TABLE IF NOT EXISTS {schema}.sb_function_dead_letters (
+			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+			function_id uuid REFERENCES {schema}.sb_functions(id) ON DELETE CASCADE,
+			function_name TEXT NOT NULL,
+			command jsonb NOT NULL,
+			auth jsonb NOT NULL,
+			attempts INTEGER NOT NULL,
+			error TEXT NOT NULL,
+			created timestamp NOT NULL,
+			pending BOOLEAN NOT NULL DEFAULT false,
+			next_attempt timestamp NOT NULL DEFAULT now()
+		);
+
+		CREATE INDEX IF NOT EXISTS sb_function_dead_letters_due_idx ON {schema}.sb_function_dead_letters (pending, next_attempt);
 
 		CREATE TABLE IF NOT EXISTS {schema}.sb_tasks (
 			id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
@@ -276,8 +384,23 @@ func scanCustomer(rows Scanner, c *internal.Customer) error {
 	)
 }
 
+func (pg *PostgreSQL) UpdateBaseSettings(baseID string, settings internal.BaseSettings) error {
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	_, err = pg.DB.Exec(`
+		UPDATE sb.apps SET
+			settings = $2
+		WHERE id = $1
+	`, baseID, b)
+	return err
+}
+
 func scanBase(rows Scanner, b *internal.BaseConfig) error {
-	return rows.Scan(
+	var settings []byte
+	err := rows.Scan(
 		&b.ID,
 		&b.CustomerID,
 		&b.Name,
@@ -285,5 +408,11 @@ func scanBase(rows Scanner, b *internal.BaseConfig) error {
 		&b.IsActive,
 		&b.MonthlySentEmail,
 		&b.Created,
+		&settings,
 	)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(settings, &b.Settings)
 }
@@ -1,7 +1,6 @@
 package postgresql
 
 import (
-	"fmt"
 	"testing"
 )
 
@@ -19,7 +18,7 @@ func TestFindDatabase(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	} else if b.Name != dbTest.Name {
-		fmt.Errorf("expected name to be %s got %s", dbTest.Name, b.Name)
+		t.Errorf("expected name to be %s got %s", dbTest.Name, b.Name)
 	}
 }
 
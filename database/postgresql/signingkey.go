@@ -0,0 +1,89 @@
+package postgresql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func (pg *PostgreSQL) AddSigningKey(dbName string, key internal.SigningKey) error {
+	qry := fmt.Sprintf(`
+		INSERT INTO %s.sb_signing_keys(id, alg, private, public, created, expires)
+		VALUES($1, $2, $3, $4, $5, $6)
+	`, dbName)
+
+	_, err := pg.DB.Exec(
+		qry,
+		key.ID,
+		key.Algorithm,
+		key.Private,
+		key.Public,
+		key.Created,
+		key.Expires,
+	)
+	return err
+}
+
+// ListSigningKeys returns the keys from the newest to the oldest
+func (pg *PostgreSQL) ListSigningKeys(dbName string) (results []internal.SigningKey, err error) {
+	qry := fmt.Sprintf(`
+		SELECT * 
+		FROM %s.sb_signing_keys 
+		ORDER BY created DESC
+	`, dbName)
+
+	rows, err := pg.DB.Query(qry)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key internal.SigningKey
+		if err = scanSigningKey(rows, &key); err != nil {
+			return
+		}
+
+		results = append(results, key)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (pg *PostgreSQL) ExpireSigningKey(dbName, id string, expires time.Time) error {
+	qry := fmt.Sprintf(`
+		UPDATE %s.sb_signing_keys SET
+			expires = $2
+		WHERE id = $1
+	`, dbName)
+
+	if _, err := pg.DB.Exec(qry, id, expires); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgreSQL) DeleteSigningKey(dbName, id string) error {
+	qry := fmt.Sprintf(`
+		DELETE FROM %s.sb_signing_keys
+		WHERE id = $1
+	`, dbName)
+
+	if _, err := pg.DB.Exec(qry, id); err != nil {
+		return err
+	}
+	return nil
+}
+
+func scanSigningKey(rows Scanner, key *internal.SigningKey) error {
+	return rows.Scan(
+		&key.ID,
+		&key.Algorithm,
+		&key.Private,
+		&key.Public,
+		&key.Created,
+		&key.Expires,
+	)
+}
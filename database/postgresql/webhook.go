@@ -0,0 +1,222 @@
+package postgresql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/staticbackendhq/core/internal"
+)
+
+func (pg *PostgreSQL) AddWebhook(dbName string, wh internal.Webhook) (id string, err error) {
+	qry := fmt.Sprintf(`
+		INSERT INTO %s.sb_webhooks(name, url, events, secret, active, created)
+		VALUES($1, $2, $3, $4, $5, $6)
+		RETURNING id;
+	`, dbName)
+
+	err = pg.DB.QueryRow(
+		qry,
+		wh.Name,
+		wh.URL,
+		pq.Array(wh.Events),
+		wh.Secret,
+		wh.Active,
+		wh.Created,
+	).Scan(&id)
+	return
+}
+
+func (pg *PostgreSQL) ListWebhooks(dbName string) (results []internal.Webhook, err error) {
+	qry := fmt.Sprintf(`
+		SELECT *
+		FROM %s.sb_webhooks
+		ORDER BY created DESC
+	`, dbName)
+
+	rows, err := pg.DB.Query(qry)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var wh internal.Webhook
+		if err = scanWebhook(rows, &wh); err != nil {
+			return
+		}
+
+		results = append(results, wh)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (pg *PostgreSQL) DeleteWebhook(dbName, id string) error {
+	qry := fmt.Sprintf(`
+		DELETE FROM %s.sb_webhooks
+		WHERE id = $1
+	`, dbName)
+
+	if _, err := pg.DB.Exec(qry, id); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgreSQL) UpdateWebhookSecret(dbName, id, secret string) error {
+	qry := fmt.Sprintf(`
+		UPDATE %s.sb_webhooks SET
+			secret = $2
+		WHERE id = $1
+	`, dbName)
+
+	if _, err := pg.DB.Exec(qry, id, secret); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgreSQL) AddWebhookDelivery(dbName string, d internal.WebhookDelivery) (id string, err error) {
+	qry := fmt.Sprintf(`
+		INSERT INTO %s.sb_webhook_deliveries(webhook_id, event, channel, payload, state, attempts, status, error, created, updated, next_attempt)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id;
+	`, dbName)
+
+	err = pg.DB.QueryRow(
+		qry,
+		d.WebhookID,
+		d.Event,
+		d.Channel,
+		d.Payload,
+		d.State,
+		d.Attempts,
+		d.Status,
+		d.Error,
+		d.Created,
+		d.Updated,
+		d.NextAttempt,
+	).Scan(&id)
+	return
+}
+
+func (pg *PostgreSQL) UpdateWebhookDelivery(dbName string, d internal.WebhookDelivery) error {
+	qry := fmt.Sprintf(`
+		UPDATE %s.sb_webhook_deliveries SET
+			state = $2,
+			attempts = $3,
+			status = $4,
+			error = $5,
+			updated = $6,
+			next_attempt = $7
+		WHERE id = $1
+	`, dbName)
+
+	if _, err := pg.DB.Exec(qry, d.ID, d.State, d.Attempts, d.Status, d.Error, d.Updated, d.NextAttempt); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgreSQL) GetWebhookDelivery(dbName, id string) (d internal.WebhookDelivery, err error) {
+	qry := fmt.Sprintf(`
+		SELECT *
+		FROM %s.sb_webhook_deliveries
+		WHERE id = $1
+	`, dbName)
+
+	row := pg.DB.QueryRow(qry, id)
+
+	err = scanWebhookDelivery(row, &d)
+	return
+}
+
+// ListWebhookDeliveries returns the last 100 deliveries, optionally of a
+// webhook and/or in a state
+func (pg *PostgreSQL) ListWebhookDeliveries(dbName, webhookID, state string) (results []internal.WebhookDelivery, err error) {
+	qry := fmt.Sprintf(`
+		SELECT *
+		FROM %s.sb_webhook_deliveries
+		WHERE ($1 = '' OR webhook_id::text = $1) AND ($2 = '' OR state = $2)
+		ORDER BY created DESC
+		LIMIT 100
+	`, dbName)
+
+	rows, err := pg.DB.Query(qry, webhookID, state)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d internal.WebhookDelivery
+		if err = scanWebhookDelivery(rows, &d); err != nil {
+			return
+		}
+
+		results = append(results, d)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// ListDueWebhookDeliveries returns the pending deliveries to attempt again
+func (pg *PostgreSQL) ListDueWebhookDeliveries(dbName string, now time.Time) (results []internal.WebhookDelivery, err error) {
+	qry := fmt.Sprintf(`
+		SELECT *
+		FROM %s.sb_webhook_deliveries
+		WHERE state = $1 AND next_attempt <= $2
+		ORDER BY next_attempt
+		LIMIT 100
+	`, dbName)
+
+	rows, err := pg.DB.Query(qry, internal.WebhookPending, now)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d internal.WebhookDelivery
+		if err = scanWebhookDelivery(rows, &d); err != nil {
+			return
+		}
+
+		results = append(results, d)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func scanWebhook(rows Scanner, wh *internal.Webhook) error {
+	return rows.Scan(
+		&wh.ID,
+		&wh.Name,
+		&wh.URL,
+		pq.Array(&wh.Events),
+		&wh.Secret,
+		&wh.Active,
+		&wh.Created,
+	)
+}
+
+func scanWebhookDelivery(rows Scanner, d *internal.WebhookDelivery) error {
+	return rows.Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.Event,
+		&d.Channel,
+		&d.Payload,
+		&d.State,
+		&d.Attempts,
+		&d.Status,
+		&d.Error,
+		&d.Created,
+		&d.Updated,
+		&d.NextAttempt,
+	)
+}
@@ -5,8 +5,24 @@ import (
 	"html"
 	"strings"
 	"text/template"
+
+	"github.com/staticbackendhq/core/internal"
 )
 
+// FillBodies sets the HTML and text bodies when only one of them or only
+// Body is provided
+func FillBodies(data internal.SendMailData) internal.SendMailData {
+	if len(data.Body) > 0 {
+		data.HTMLBody = data.Body
+		data.TextBody = StripHTML(data.Body)
+	} else if len(data.TextBody) == 0 && len(data.HTMLBody) > 0 {
+		data.TextBody = StripHTML(data.HTMLBody)
+	} else if len(data.HTMLBody) == 0 && len(data.TextBody) > 0 {
+		data.HTMLBody = data.TextBody
+	}
+	return data
+}
+
 // StripHTML returns a version of a string with no HTML tags.
 func StripHTML(s string) string {
 	output := ""
@@ -0,0 +1,248 @@
+package function
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// SideEffect is a write a dry run captured instead of applying it
+type SideEffect struct {
+	// Type is the helper's call, i.e. "create", "cache.set" or "sendMail"
+	Type string `json:"type"`
+	// Target is the collection, channel, key, recipient or file written to
+	Target string      `json:"target"`
+	ID     string      `json:"id,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// DryRunResult is the outcome of a dry run
+type DryRunResult struct {
+	Success     bool                   `json:"success"`
+	Error       string                 `json:"error,omitempty"`
+	Return      interface{}            `json:"return"`
+	Output      []string               `json:"output"`
+	Logs        []internal.FunctionLog `json:"logs"`
+	SideEffects []SideEffect           `json:"sideEffects"`
+	Duration    time.Duration          `json:"duration"`
+}
+
+// DryRun executes the function like Execute does, except the writes to the
+// database, cache, queues, realtime channels, emails and files are captured
+// as side effects instead of being applied and the run isn't recorded. The
+// reads see the base's data. The fetch() calls are checked against the
+// base's settings and captured, they receive an empty 200 response.
+func (env *ExecutionEnvironment) DryRun(data interface{}) DryRunResult {
+	effects := &sideEffects{}
+	env.DataStore = &dryRunStore{Persister: env.DataStore, effects: effects}
+	env.Volatile = &dryRunVolatile{PubSuber: env.Volatile, effects: effects}
+	env.Mailer = &dryRunMailer{effects: effects}
+	env.Storer = &dryRunStorer{effects: effects}
+	env.roundTrip = (&dryRunFetcher{effects: effects}).Do
+
+	rt := runtimes.get(env.BaseName)
+
+	*rt.env = *env
+	v, err := rt.env.runOn(rt.vm, data)
+	*env = *rt.env
+
+	// the returned value belongs to the runtime, it's exported before the
+	// runtime is put back
+	var ret interface{}
+	if err == nil && v != nil {
+		ret = v.Export()
+		if _, jerr := json.Marshal(ret); jerr != nil {
+			ret = v.String()
+		}
+	}
+
+	runtimes.put(env.BaseName, rt, err)
+
+	env.complete(err)
+
+	res := DryRunResult{
+		Success:     err == nil,
+		Return:      ret,
+		Output:      env.CurrentRun.Output,
+		Logs:        env.CurrentRun.Logs,
+		SideEffects: effects.list(),
+		Duration:    env.CurrentRun.Completed.Sub(env.CurrentRun.Started),
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// sideEffects are the writes captured during a dry run
+type sideEffects struct {
+	sync.Mutex
+	effects []SideEffect
+}
+
+func (s *sideEffects) add(typ, target, id string, data interface{}) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.effects = append(s.effects, SideEffect{Type: typ, Target: target, ID: id, Data: data})
+}
+
+func (s *sideEffects) list() []SideEffect {
+	s.Lock()
+	defer s.Unlock()
+
+	list := make([]SideEffect, len(s.effects))
+	copy(list, s.effects)
+	return list
+}
+
+// dryRunStore reads from the base and captures the writes
+type dryRunStore struct {
+	internal.Persister
+	effects *sideEffects
+}
+
+func (s *dryRunStore) CreateDocument(auth internal.Auth, dbName, col string, doc map[string]interface{}) (map[string]interface{}, error) {
+	created := make(map[string]interface{})
+	for k, v := range doc {
+		created[k] = v
+	}
+	// the document looks saved to the rest of the function
+	created["id"] = fmt.Sprintf("dry-run-%d", time.Now().UnixNano())
+	created["accountId"] = auth.AccountID
+
+	s.effects.add("create", col, fmt.Sprint(created["id"]), doc)
+	return created, nil
+}
+
+func (s *dryRunStore) UpdateDocument(auth internal.Auth, dbName, col, id string, doc map[string]interface{}) (map[string]interface{}, error) {
+	s.effects.add("update", col, id, doc)
+
+	// the current document with the update applied
+	updated, err := s.Persister.GetDocumentByID(auth, dbName, col, id)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range doc {
+		updated[k] = v
+	}
+	return updated, nil
+}
+
+func (s *dryRunStore) DeleteDocument(auth internal.Auth, dbName, col, id string) (int64, error) {
+	s.effects.add("del", col, id, nil)
+	return 1, nil
+}
+
+func (s *dryRunStore) AddFile(dbName string, f internal.File) (string, error) {
+	return fmt.Sprintf("dry-run-%d", time.Now().UnixNano()), nil
+}
+
+func (s *dryRunStore) DeleteFile(dbName, fileID string) error {
+	return nil
+}
+
+func (s *dryRunStore) IncrementMonthlyEmailSent(baseID string) error {
+	return nil
+}
+
+func (s *dryRunStore) RanFunction(dbName, id string, rh internal.ExecHistory) error {
+	return nil
+}
+
+// dryRunVolatile reads the cache and queues and captures the writes
+type dryRunVolatile struct {
+	internal.PubSuber
+	effects *sideEffects
+}
+
+func (v *dryRunVolatile) Set(key, value string) error {
+	v.effects.add("cache.set", key, "", value)
+	return nil
+}
+
+func (v *dryRunVolatile) Inc(key string, by int64) (int64, error) {
+	v.effects.add("cache.inc", key, "", by)
+
+	var n int64
+	if cur, err := v.PubSuber.Get(key); err == nil {
+		fmt.Sscan(cur, &n)
+	}
+	return n + by, nil
+}
+
+func (v *dryRunVolatile) QueueWork(key, value string) error {
+	v.effects.add("queue.push", key, "", value)
+	return nil
+}
+
+// DequeueWork does not remove the work from the queue, a dry run sees an
+// empty queue
+func (v *dryRunVolatile) DequeueWork(key string) (string, error) {
+	v.effects.add("queue.pop", key, "", nil)
+	return "", nil
+}
+
+func (v *dryRunVolatile) Publish(msg internal.Command) error {
+	v.effects.add("send", msg.Channel, "", msg.Data)
+	return nil
+}
+
+type dryRunMailer struct {
+	effects *sideEffects
+}
+
+func (m *dryRunMailer) Send(data internal.SendMailData) error {
+	m.effects.add("sendMail", data.To, "", data)
+	return nil
+}
+
+type dryRunStorer struct {
+	effects *sideEffects
+}
+
+func (s *dryRunStorer) Save(data internal.UploadFileData) (string, error) {
+	s.effects.add("uploadFile", data.FileKey, "", nil)
+	return fmt.Sprintf("dry-run://%s", data.FileKey), nil
+}
+
+func (s *dryRunStorer) Delete(fileKey string) error {
+	s.effects.add("deleteFile", fileKey, "", nil)
+	return nil
+}
+
+type dryRunFetcher struct {
+	effects *sideEffects
+}
+
+// Do captures the request and returns an empty response
+func (f *dryRunFetcher) Do(req *http.Request) (*http.Response, error) {
+	opt := FetchOptions{Method: req.Method, Headers: make(map[string]string)}
+	for k := range req.Header {
+		opt.Headers[k] = req.Header.Get(k)
+	}
+
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		opt.Body = string(b)
+	}
+
+	f.effects.add("fetch", req.URL.String(), "", opt)
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
@@ -0,0 +1,135 @@
+package function
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// docStore returns its documents and fails on the writes
+type docStore struct {
+	*runLog
+	docs map[string]map[string]interface{}
+}
+
+func (ds *docStore) GetDocumentByID(auth internal.Auth, dbName, col, id string) (map[string]interface{}, error) {
+	doc, ok := ds.docs[id]
+	if !ok {
+		return nil, errors.New("document not found")
+	}
+
+	cp := make(map[string]interface{})
+	for k, v := range doc {
+		cp[k] = v
+	}
+	return cp, nil
+}
+
+func (ds *docStore) CreateDocument(auth internal.Auth, dbName, col string, doc map[string]interface{}) (map[string]interface{}, error) {
+	return nil, errors.New("the dry run created a document")
+}
+
+func (ds *docStore) UpdateDocument(auth internal.Auth, dbName, col, id string, doc map[string]interface{}) (map[string]interface{}, error) {
+	return nil, errors.New("the dry run updated a document")
+}
+
+func TestDryRun(t *testing.T) {
+	ds := &docStore{
+		runLog: &runLog{runs: make(chan internal.ExecHistory, 1)},
+		docs:   map[string]map[string]interface{}{"t1": {"id": "t1", "title": "first", "done": false}},
+	}
+	vol := &memVolatile{values: map[string]string{"testdb_hits": "4"}, queues: make(map[string][]string)}
+
+	env := &ExecutionEnvironment{
+		BaseName:  "testdb",
+		DataStore: ds,
+		Volatile:  vol,
+		Data: internal.ExecData{
+			Code: `async function handle(body) {
+				const created = create("tasks", {title: body.title});
+				if (!created.ok) throw new Error(created.content);
+
+				const updated = update("tasks", "t1", {done: true});
+				if (!updated.ok) throw new Error(updated.content);
+
+				const hits = cache.inc("hits");
+				log.warn("hits", hits.content);
+				sendMail({to: "dev@example.com", subject: "new task"});
+
+				const res = await fetch("https://api.example.com/tasks", {method: "post", body: body.title});
+				if (!res.ok || res.content.status != 200) throw new Error("unexpected fetch response");
+
+				return {id: created.content.id, title: updated.content.title, done: updated.content.done, hits: hits.content};
+			}`,
+		},
+	}
+
+	res := env.DryRun(map[string]interface{}{"title": "second"})
+	if !res.Success {
+		t.Fatalf("expected the dry run to succeed got %s: %v", res.Error, res.Output)
+	}
+
+	ret, ok := res.Return.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected an object returned got %v", res.Return)
+	} else if ret["title"] != "first" || ret["done"] != true || ret["id"] == "" {
+		t.Errorf("expected the document to look created and updated got %v", ret)
+	} else if hits, _ := ret["hits"].(int64); hits != 5 {
+		t.Errorf("expected 5 hits got %v", ret["hits"])
+	}
+
+	expected := []SideEffect{
+		{Type: "create", Target: "tasks"},
+		{Type: "update", Target: "tasks", ID: "t1"},
+		{Type: "cache.inc", Target: "testdb_hits"},
+		{Type: "sendMail", Target: "dev@example.com"},
+		{Type: "fetch", Target: "https://api.example.com/tasks"},
+	}
+	if len(res.SideEffects) != len(expected) {
+		t.Fatalf("expected %d side effects got %v", len(expected), res.SideEffects)
+	}
+	for i, e := range expected {
+		se := res.SideEffects[i]
+		if se.Type != e.Type || se.Target != e.Target || (e.ID != "" && se.ID != e.ID) {
+			t.Errorf("expected side effect %v got %v", e, se)
+		}
+	}
+
+	if opt, ok := res.SideEffects[4].Data.(FetchOptions); !ok || opt.Method != "POST" || opt.Body != "second" {
+		t.Errorf("expected the POST request captured got %v", res.SideEffects[4].Data)
+	}
+
+	if vol.values["testdb_hits"] != "4" {
+		t.Errorf("expected the cache to be unchanged got %s", vol.values["testdb_hits"])
+	}
+
+	select {
+	case rh := <-ds.runs:
+		t.Errorf("expected the dry run not to be recorded got %v", rh)
+	default:
+	}
+
+	found := false
+	for _, l := range res.Logs {
+		if l.Level == internal.LogWarn {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected the warning in the logs got %v", res.Logs)
+	}
+}
+
+func TestDryRunError(t *testing.T) {
+	env := &ExecutionEnvironment{
+		BaseName:  "testdb",
+		DataStore: &runLog{runs: make(chan internal.ExecHistory, 1)},
+		Data:      internal.ExecData{Code: `function handle() { throw new Error("boom"); }`},
+	}
+
+	res := env.DryRun(internal.Command{Type: "test"})
+	if res.Success || res.Error == "" || res.Return != nil {
+		t.Errorf("expected a failed dry run got %v", res)
+	}
+}
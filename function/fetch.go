@@ -0,0 +1,136 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+const maxFetchRedirects = 5
+
+// FetchOptions are the optional fetch(url, options) parameters
+type FetchOptions struct {
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// FetchResponse is the content of a successful fetch call
+type FetchResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// newFetchClient returns a client enforcing the base's fetch settings. The
+// addresses are checked once resolved so a host cannot point to a private
+// address after passing the host checks.
+func newFetchClient(settings internal.FetchSettings) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: time.Duration(settings.Timeout) * time.Second,
+	}
+	if !settings.AllowPrivate {
+		dialer.Control = internal.DenyPrivateDial
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   dialer.Timeout,
+			ResponseHeaderTimeout: dialer.Timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFetchRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxFetchRedirects)
+			}
+			return checkFetchURL(settings, req.URL)
+		},
+	}
+}
+
+func checkFetchURL(settings internal.FetchSettings, u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	} else if len(u.Hostname()) == 0 {
+		return errors.New("the URL needs a host")
+	} else if !settings.HostAllowed(u.Hostname()) {
+		return fmt.Errorf("calling the host %s is not allowed", u.Hostname())
+	}
+	return nil
+}
+
+// fetch calls the URL, the call is cancelled at the deadline of the run
+func (env *ExecutionEnvironment) fetch(rawURL string, opt FetchOptions) (res FetchResponse, err error) {
+	settings := env.FetchSettings.WithDefaults()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	} else if err = checkFetchURL(settings, u); err != nil {
+		return
+	}
+
+	if len(opt.Method) == 0 {
+		opt.Method = http.MethodGet
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(settings.Timeout)*time.Second)
+	defer cancel()
+
+	if !env.deadline.IsZero() {
+		var stop context.CancelFunc
+		ctx, stop = context.WithDeadline(ctx, env.deadline)
+		defer stop()
+	}
+
+	var body io.Reader
+	if len(opt.Body) > 0 {
+		body = strings.NewReader(opt.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(opt.Method), u.String(), body)
+	if err != nil {
+		return
+	}
+
+	req.Header.Set("User-Agent", "StaticBackend-Function")
+	for k, v := range opt.Headers {
+		req.Header.Set(k, v)
+	}
+
+	do := newFetchClient(settings).Do
+	if env.roundTrip != nil {
+		do = env.roundTrip
+	}
+
+	resp, err := do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, settings.MaxResponseSize+1))
+	if err != nil {
+		return
+	} else if int64(len(b)) > settings.MaxResponseSize {
+		err = fmt.Errorf("the response exceeds %d bytes", settings.MaxResponseSize)
+		return
+	}
+
+	res.Status = resp.StatusCode
+	res.Body = string(b)
+	res.Headers = make(map[string]string)
+	for k := range resp.Header {
+		res.Headers[strings.ToLower(k)] = resp.Header.Get(k)
+	}
+	return
+}
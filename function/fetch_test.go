@@ -0,0 +1,93 @@
+package function
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func fetchRun(t *testing.T, code string, settings internal.FetchSettings) internal.ExecHistory {
+	t.Helper()
+
+	rl := &runLog{runs: make(chan internal.ExecHistory, 1)}
+	env := &ExecutionEnvironment{
+		BaseName:      "testdb",
+		DataStore:     rl,
+		Data:          internal.ExecData{ID: "fn1", Code: code},
+		BaseLimits:    internal.FunctionLimits{Timeout: 2},
+		FetchSettings: settings,
+	}
+
+	if err := env.Execute(internal.Command{Type: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case rh := <-rl.runs:
+		return rh
+	case <-time.After(5 * time.Second):
+		t.Fatal("the run was never recorded")
+	}
+	return internal.ExecHistory{}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/echo":
+			b, _ := io.ReadAll(r.Body)
+			w.Header().Set("X-Method", r.Method)
+			w.Write(b)
+		case "/big":
+			w.Write([]byte(strings.Repeat("a", 2048)))
+		case "/slow":
+			time.Sleep(3 * time.Second)
+		}
+	}))
+	defer srv.Close()
+
+	allowed := internal.FetchSettings{AllowPrivate: true, MaxResponseSize: 1024}
+
+	tables := []struct {
+		name     string
+		path     string
+		settings internal.FetchSettings
+		expected string
+	}{
+		{"ok", "/echo", allowed, "ok POST hello"},
+		{"private blocked by default", "/echo", internal.FetchSettings{}, "error calling fetch()"},
+		{"denied host", "/echo", internal.FetchSettings{AllowPrivate: true, DeniedHosts: []string{"127.0.0.1"}}, "not allowed"},
+		{"not in allow list", "/echo", internal.FetchSettings{AllowPrivate: true, AllowedHosts: []string{"example.com"}}, "not allowed"},
+		{"response too large", "/big", allowed, "exceeds 1024 bytes"},
+		{"timeout", "/slow", internal.FetchSettings{AllowPrivate: true, Timeout: 1}, "failed after"},
+	}
+
+	for _, tt := range tables {
+		t.Run(tt.name, func(t *testing.T) {
+			code := fmt.Sprintf(`
+			async function handle() {
+				var res = await fetch("%s%s", {method: "post", body: "hello"});
+				if (!res.ok) {
+					log(res.content);
+					return;
+				}
+				log("ok " + res.content.headers["x-method"] + " " + res.content.body);
+			}`, srv.URL, tt.path)
+
+			rh := fetchRun(t, code, tt.settings)
+
+			out := strings.Join(rh.Output, "\n")
+			if !strings.Contains(out, tt.expected) {
+				t.Errorf("expected %q in the output got %s", tt.expected, out)
+			} else if !strings.Contains(out, "fetch POST "+srv.URL+tt.path) {
+				t.Errorf("expected the call to be recorded got %s", out)
+			}
+		})
+	}
+}
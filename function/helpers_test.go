@@ -0,0 +1,186 @@
+package function
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// memVolatile only implements the cache and queue part of the PubSuber
+type memVolatile struct {
+	internal.PubSuber
+	values map[string]string
+	queues map[string][]string
+}
+
+func (m *memVolatile) Get(key string) (string, error) {
+	v, ok := m.values[key]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return v, nil
+}
+
+func (m *memVolatile) Set(key, value string) error {
+	m.values[key] = value
+	return nil
+}
+
+func (m *memVolatile) Inc(key string, by int64) (n int64, err error) {
+	fmt.Sscan(m.values[key], &n)
+	n += by
+	m.values[key] = fmt.Sprint(n)
+	return
+}
+
+func (m *memVolatile) QueueWork(key, value string) error {
+	m.queues[key] = append(m.queues[key], value)
+	return nil
+}
+
+func (m *memVolatile) DequeueWork(key string) (string, error) {
+	q := m.queues[key]
+	if len(q) == 0 {
+		return "", nil
+	}
+	m.queues[key] = q[1:]
+	return q[0], nil
+}
+
+// fileStore records the files and emails of a run
+type fileStore struct {
+	*runLog
+	files  map[string]internal.File
+	emails int
+}
+
+func (fs *fileStore) AddFile(dbName string, f internal.File) (string, error) {
+	f.ID = fmt.Sprintf("f%d", len(fs.files)+1)
+	fs.files[f.ID] = f
+	return f.ID, nil
+}
+
+func (fs *fileStore) GetFileByID(dbName, fileID string) (internal.File, error) {
+	f, ok := fs.files[fileID]
+	if !ok {
+		return f, errors.New("file not found")
+	}
+	return f, nil
+}
+
+func (fs *fileStore) DeleteFile(dbName, fileID string) error {
+	delete(fs.files, fileID)
+	return nil
+}
+
+func (fs *fileStore) IncrementMonthlyEmailSent(baseID string) error {
+	fs.emails++
+	return nil
+}
+
+type memStorer struct {
+	saved map[string]string
+}
+
+func (s *memStorer) Save(data internal.UploadFileData) (string, error) {
+	b, err := io.ReadAll(data.File)
+	if err != nil {
+		return "", err
+	}
+	s.saved[data.FileKey] = string(b)
+	return "https://cdn/" + data.FileKey, nil
+}
+
+func (s *memStorer) Delete(fileKey string) error {
+	delete(s.saved, fileKey)
+	return nil
+}
+
+type memMailer struct {
+	sent []internal.SendMailData
+}
+
+func (m *memMailer) Send(data internal.SendMailData) error {
+	m.sent = append(m.sent, data)
+	return nil
+}
+
+func TestHelpers(t *testing.T) {
+	volatile := &memVolatile{values: make(map[string]string), queues: make(map[string][]string)}
+	store := &fileStore{
+		runLog: &runLog{runs: make(chan internal.ExecHistory, 1)},
+		files:  make(map[string]internal.File),
+	}
+	storer := &memStorer{saved: make(map[string]string)}
+	mailer := &memMailer{}
+
+	code := `
+	function check(res) {
+		if (!res.ok) { throw new Error(res.content); }
+		return res.content;
+	}
+
+	function handle() {
+		check(cache.set("greeting", "hello"));
+		check(cache.inc("visits"));
+		log(check(cache.get("greeting")), check(cache.inc("visits", 2)));
+
+		check(queue.push("jobs", "a"));
+		check(queue.push("jobs", "b"));
+		log(check(queue.pop("jobs")), check(queue.pop("jobs")), check(queue.pop("jobs")) === "");
+
+		check(sendMail({to: "a@b.com", subject: "hi", body: "<p>hello</p>"}));
+
+		var f = check(uploadFile("../../notes.txt", "aGVsbG8="));
+		log(f.url);
+		check(deleteFile(f.id));
+	}`
+
+	env := &ExecutionEnvironment{
+		Auth:      internal.Auth{AccountID: "acct1"},
+		BaseName:  "testdb",
+		BaseID:    "base1",
+		DataStore: store,
+		Volatile:  volatile,
+		Storer:    storer,
+		Mailer:    mailer,
+		Data:      internal.ExecData{ID: "fn1", Code: code},
+	}
+
+	if err := env.Execute(internal.Command{Type: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var rh internal.ExecHistory
+	select {
+	case rh = <-store.runs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the run was never recorded")
+	}
+
+	out := strings.Join(rh.Output, "\n")
+	expected := []string{"hello3", "abtrue", "https://cdn/acct1/testdb/notes.txt"}
+	for _, s := range expected {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected %q in the output got %s", s, out)
+		}
+	}
+
+	// the keys are scoped to the base
+	if v := volatile.values["testdb_greeting"]; v != "hello" {
+		t.Errorf("expected the key to be prefixed by the base name got %v", volatile.values)
+	}
+
+	if len(mailer.sent) != 1 || strings.TrimSpace(mailer.sent[0].TextBody) != "hello" || store.emails != 1 {
+		t.Errorf("expected 1 counted email with a text body got %v", mailer.sent)
+	}
+
+	if len(storer.saved) != 0 || len(store.files) != 0 {
+		t.Errorf("expected the file to be deleted got %v %v", storer.saved, store.files)
+	}
+}
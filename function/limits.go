@@ -0,0 +1,277 @@
+package function
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+
+	"github.com/dop251/goja"
+)
+
+// limitError interrupts a run exceeding one of its limits
+type limitError struct {
+	reason string
+	msg    string
+}
+
+func (e limitError) Error() string {
+	return e.msg
+}
+
+// guard interrupts the runtime and stops its event loop when the run exceeds
+// its wall time or memory budget. Call stop once the run completes.
+type guard struct {
+	loop  *eventLoop
+	timer *time.Timer
+
+	// the bytes charged by the helpers, the run is interrupted past maxMB
+	used  int64
+	maxMB int64
+
+	// a stopped guard cannot interrupt the runtime, its value might still
+	// be read once the run completed
+	mu      sync.Mutex
+	stopped bool
+}
+
+func newGuard(loop *eventLoop, limits internal.FunctionLimits) *guard {
+	loop.vm.SetMaxCallStackSize(limits.MaxCallStack)
+
+	g := &guard{loop: loop, maxMB: limits.MaxMemory}
+
+	g.timer = time.AfterFunc(limits.TimeoutDuration(), func() {
+		g.interrupt(limitError{
+			reason: internal.FunctionFailedTimeout,
+			msg:    fmt.Sprintf("function exceeded its %ds timeout", limits.Timeout),
+		})
+	})
+
+	heap.add(g)
+
+	return g
+}
+
+// interrupt stops the code running and the event loop waiting for timers
+// or asynchronous helpers
+func (g *guard) interrupt(err limitError) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.stopped {
+		return
+	}
+
+	g.loop.stop(err)
+	g.loop.vm.Interrupt(err)
+}
+
+func (g *guard) stop() {
+	g.mu.Lock()
+	g.stopped = true
+	g.mu.Unlock()
+
+	g.timer.Stop()
+	heap.remove(g)
+}
+
+// charge adds n bytes to the run's memory. Only the data returned by the
+// helpers is charged, unlike the server's heap, the budget does not depend
+// on the other runs, a run exceeds it the same way each time.
+func (g *guard) charge(n int) {
+	if atomic.AddInt64(&g.used, int64(n)) <= g.maxMB<<20 {
+		return
+	}
+
+	g.exceeded()
+}
+
+func (g *guard) exceeded() {
+	g.interrupt(limitError{
+		reason: internal.FunctionFailedMemory,
+		msg:    fmt.Sprintf("function exceeded its %dMB memory limit", g.maxMB),
+	})
+}
+
+// heapWatch catches what the helpers' charges cannot see: the allocations
+// of the JavaScript code itself, i.e. a loop growing an array. goja does not
+// account for its allocations so the watch samples the server's heap while
+// runs are in progress. Once it exceeds twice the runs' memory budgets, the
+// heap is collected and the runs are interrupted if it's still over. The
+// heap is shared, a run allocating past its budget also stops the ones
+// running at the same time.
+type heapWatch struct {
+	mu       sync.Mutex
+	guards   map[*guard]bool
+	base     uint64
+	stale    bool
+	watching bool
+}
+
+var (
+	heap         = &heapWatch{guards: make(map[*guard]bool)}
+	heapInterval = 10 * time.Millisecond
+
+	// the collections forced by the watch are spaced by at least this
+	heapGCInterval = 50 * time.Millisecond
+)
+
+func (h *heapWatch) add(g *guard) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// the heap marked live by the last collection, unlike the current one
+	// it does not include the garbage. The interrupted runs were still
+	// live at the last collection, the heap is collected without them.
+	if len(h.guards) == 0 {
+		if h.stale {
+			runtime.GC()
+			h.stale = false
+		}
+		h.base = liveBytes()
+		if h.base == 0 {
+			// nothing was collected yet
+			h.base = heapBytes()
+		}
+	}
+	h.guards[g] = true
+
+	if !h.watching {
+		h.watching = true
+		go h.watch()
+	}
+}
+
+func (h *heapWatch) remove(g *guard) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.guards, g)
+}
+
+// watch samples the heap until no runs are in progress
+func (h *heapWatch) watch() {
+	ticker := time.NewTicker(heapInterval)
+	defer ticker.Stop()
+
+	var collected time.Time
+	for range ticker.C {
+		guards, limit := h.limit()
+		if len(guards) == 0 {
+			return
+		} else if heapBytes() <= limit || time.Since(collected) < heapGCInterval {
+			continue
+		}
+
+		// the garbage is not the runs' memory
+		runtime.GC()
+		collected = time.Now()
+
+		if heapBytes() <= limit {
+			continue
+		}
+
+		// the runs started since are not part of the limit
+		for _, g := range guards {
+			g.exceeded()
+		}
+
+		h.mu.Lock()
+		h.stale = true
+		h.mu.Unlock()
+	}
+}
+
+// limit returns the runs in progress and the heap allowed for them, the
+// watch ends when there's none
+func (h *heapWatch) limit() ([]*guard, uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.guards) == 0 {
+		h.watching = false
+		return nil, 0
+	}
+
+	var guards []*guard
+	var budget uint64
+	for g := range h.guards {
+		guards = append(guards, g)
+		budget += uint64(g.maxMB) << 20
+	}
+	return guards, h.base + 2*budget
+}
+
+// heapBytes returns the bytes of the heap's objects, the garbage not yet
+// collected included
+func heapBytes() uint64 {
+	return readMetric("/memory/classes/heap/objects:bytes")
+}
+
+// liveBytes returns the bytes of the heap marked live by the last collection
+func liveBytes() uint64 {
+	return readMetric("/gc/heap/live:bytes")
+}
+
+func readMetric(name string) uint64 {
+	sample := []metrics.Sample{{Name: name}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
+
+// sizeOf returns the approximate bytes of a value returned by a helper
+func sizeOf(v interface{}) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	case map[string]interface{}:
+		n := 0
+		for k, e := range v {
+			n += len(k) + sizeOf(e)
+		}
+		return n
+	case []interface{}:
+		n := 0
+		for _, e := range v {
+			n += sizeOf(e)
+		}
+		return n
+	case []map[string]interface{}:
+		n := 0
+		for _, e := range v {
+			n += sizeOf(e)
+		}
+		return n
+	}
+	return 8
+}
+
+// failureReason returns why a run failed
+func failureReason(err error) string {
+	var le limitError
+	if errors.As(err, &le) {
+		return le.reason
+	}
+
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		if le, ok := interrupted.Value().(limitError); ok {
+			return le.reason
+		}
+	}
+
+	var overflow *goja.StackOverflowError
+	if errors.As(err, &overflow) {
+		return internal.FunctionFailedCallStack
+	}
+	return internal.FunctionFailedError
+}
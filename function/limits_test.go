@@ -0,0 +1,128 @@
+package function
+
+import (
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// runLog records the runs, it only implements RanFunction
+type runLog struct {
+	internal.Persister
+	runs chan internal.ExecHistory
+}
+
+func (rl *runLog) RanFunction(dbName, id string, rh internal.ExecHistory) error {
+	rl.runs <- rh
+	return nil
+}
+
+func execute(t *testing.T, code string, limits internal.FunctionLimits) internal.ExecHistory {
+	t.Helper()
+
+	rl := &runLog{runs: make(chan internal.ExecHistory, 1)}
+	env := &ExecutionEnvironment{
+		BaseName:   "testdb",
+		DataStore:  rl,
+		Data:       internal.ExecData{ID: "fn1", Code: code},
+		BaseLimits: limits,
+	}
+
+	start := time.Now()
+	err := env.Execute(internal.Command{Type: "test"})
+
+	select {
+	case rh := <-rl.runs:
+		if (err == nil) != rh.Success {
+			t.Errorf("expected the run success to match the error %v", err)
+		} else if time.Since(start) > 5*time.Second {
+			t.Errorf("the run took too long: %v", time.Since(start))
+		}
+		return rh
+	case <-time.After(5 * time.Second):
+		t.Fatal("the run was never recorded")
+	}
+	return internal.ExecHistory{}
+}
+
+func TestFunctionLimits(t *testing.T) {
+	tables := []struct {
+		name   string
+		code   string
+		limits internal.FunctionLimits
+		reason string
+	}{
+		{
+			"ok",
+			`function handle() { log("hi"); }`,
+			internal.FunctionLimits{},
+			"",
+		},
+		{
+			"timeout",
+			`function handle() { while(true) {} }`,
+			internal.FunctionLimits{Timeout: 1},
+			internal.FunctionFailedTimeout,
+		},
+		{
+			"timeout while loading",
+			`while(true) {} function handle() {}`,
+			internal.FunctionLimits{Timeout: 1},
+			internal.FunctionFailedTimeout,
+		},
+		{
+			"call stack",
+			`function f(n) { return f(n + 1); } function handle() { f(0); }`,
+			internal.FunctionLimits{MaxCallStack: 100},
+			internal.FunctionFailedCallStack,
+		},
+		{
+			"memory",
+			`function handle() { var line = "x".repeat(1024); while(true) { log(line); } }`,
+			internal.FunctionLimits{MaxMemory: 1},
+			internal.FunctionFailedMemory,
+		},
+		{
+			"memory in JavaScript",
+			`function handle() { var a = []; while(true) { a.push("x".repeat(1e6)); } }`,
+			internal.FunctionLimits{MaxMemory: 16},
+			internal.FunctionFailedMemory,
+		},
+		{
+			"error",
+			`function handle() { throw new Error("oops"); }`,
+			internal.FunctionLimits{},
+			internal.FunctionFailedError,
+		},
+	}
+
+	for _, tt := range tables {
+		t.Run(tt.name, func(t *testing.T) {
+			rh := execute(t, tt.code, tt.limits)
+			if rh.Reason != tt.reason {
+				t.Errorf("expected reason %q got %q: %v", tt.reason, rh.Reason, rh.Output)
+			} else if len(tt.reason) > 0 && rh.Success {
+				t.Errorf("expected the run to fail")
+			}
+		})
+	}
+}
+
+func TestFunctionMemoryBudget(t *testing.T) {
+	code := `function handle() { var line = "x".repeat(1024); for (var i = 0; i < 2000; i++) { log(line); } }`
+
+	// the budget is the run's own, it's exceeded at the same line each time
+	first := execute(t, code, internal.FunctionLimits{MaxMemory: 1})
+	second := execute(t, code, internal.FunctionLimits{MaxMemory: 1})
+
+	if first.Reason != internal.FunctionFailedMemory {
+		t.Fatalf("expected the memory limit to be exceeded got %q", first.Reason)
+	} else if len(first.Output) != len(second.Output) {
+		t.Errorf("expected the runs to stop after the same output got %d and %d lines", len(first.Output), len(second.Output))
+	}
+
+	if rh := execute(t, code, internal.FunctionLimits{MaxMemory: 8}); !rh.Success {
+		t.Errorf("expected the run to fit in 8MB got %q: %v", rh.Reason, rh.Output[len(rh.Output)-1])
+	}
+}
@@ -0,0 +1,178 @@
+package function
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// eventLoop runs the timers and the callbacks of the asynchronous helpers on
+// the runtime's goroutine. A run completes once nothing is pending or when
+// the loop is stopped, i.e. by the guard.
+type eventLoop struct {
+	vm   *goja.Runtime
+	jobs chan func()
+
+	// those are only used on the runtime's goroutine
+	pending int
+	lastID  int64
+	timers  map[int64]*time.Timer
+
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func newEventLoop(vm *goja.Runtime) *eventLoop {
+	return &eventLoop{
+		vm:     vm,
+		jobs:   make(chan func()),
+		timers: make(map[int64]*time.Timer),
+		done:   make(chan struct{}),
+	}
+}
+
+// addTimers adds the timers of the run's event loop
+func (env *ExecutionEnvironment) addTimers(vm *goja.Runtime) {
+	vm.Set("setTimeout", func(call goja.FunctionCall) goja.Value {
+		return env.loop.setTimer(call, false)
+	})
+	vm.Set("setInterval", func(call goja.FunctionCall) goja.Value {
+		return env.loop.setTimer(call, true)
+	})
+	vm.Set("clearTimeout", func(call goja.FunctionCall) goja.Value {
+		return env.loop.clearTimer(call)
+	})
+	vm.Set("clearInterval", func(call goja.FunctionCall) goja.Value {
+		return env.loop.clearTimer(call)
+	})
+}
+
+// stop ends the run with err, the jobs posted afterward are dropped. It's
+// safe to call from any goroutine.
+func (l *eventLoop) stop(err error) {
+	l.once.Do(func() {
+		l.err = err
+		close(l.done)
+	})
+}
+
+// close stops the loop and its timers once the run completes
+func (l *eventLoop) close() {
+	for id, t := range l.timers {
+		t.Stop()
+		delete(l.timers, id)
+	}
+	l.stop(nil)
+}
+
+// post queues a job for the runtime's goroutine
+func (l *eventLoop) post(job func()) {
+	select {
+	case l.jobs <- job:
+	case <-l.done:
+	}
+}
+
+// wait runs the jobs until nothing is pending or the loop is stopped
+func (l *eventLoop) wait() error {
+	for {
+		select {
+		case <-l.done:
+			return l.err
+		default:
+		}
+
+		if l.pending == 0 {
+			return nil
+		}
+
+		select {
+		case job := <-l.jobs:
+			job()
+		case <-l.done:
+			return l.err
+		}
+	}
+}
+
+// async runs work in the background and returns a promise. The function
+// returned by work runs on the loop and its value resolves the promise.
+func (l *eventLoop) async(work func() func() interface{}) *goja.Promise {
+	p, resolve, _ := l.vm.NewPromise()
+
+	l.pending++
+	go func() {
+		settle := work()
+		l.post(func() {
+			l.pending--
+			resolve(settle())
+		})
+	}()
+	return p
+}
+
+// resolved returns a promise resolved with v
+func (l *eventLoop) resolved(v interface{}) *goja.Promise {
+	p, resolve, _ := l.vm.NewPromise()
+	resolve(v)
+	return p
+}
+
+func (l *eventLoop) setTimer(call goja.FunctionCall, repeat bool) goja.Value {
+	fn, ok := goja.AssertFunction(call.Argument(0))
+	if !ok {
+		panic(l.vm.NewTypeError("the first argument should be a function"))
+	}
+
+	delay := time.Duration(call.Argument(1).ToInteger()) * time.Millisecond
+	if delay < time.Millisecond {
+		delay = time.Millisecond
+	}
+
+	// the arguments are copied, the runtime reuses their slice
+	var args []goja.Value
+	if len(call.Arguments) > 2 {
+		args = append(args, call.Arguments[2:]...)
+	}
+
+	l.lastID++
+	id := l.lastID
+
+	var fire func()
+	fire = func() {
+		// it was cleared after it fired
+		if _, ok := l.timers[id]; !ok {
+			return
+		}
+
+		if !repeat {
+			delete(l.timers, id)
+			l.pending--
+		}
+
+		if _, err := fn(goja.Undefined(), args...); err != nil {
+			l.stop(err)
+			return
+		}
+
+		if _, ok := l.timers[id]; ok && repeat {
+			l.timers[id] = time.AfterFunc(delay, func() { l.post(fire) })
+		}
+	}
+
+	l.timers[id] = time.AfterFunc(delay, func() { l.post(fire) })
+	l.pending++
+	return l.vm.ToValue(id)
+}
+
+func (l *eventLoop) clearTimer(call goja.FunctionCall) goja.Value {
+	id := call.Argument(0).ToInteger()
+	if t, ok := l.timers[id]; ok {
+		t.Stop()
+		delete(l.timers, id)
+		l.pending--
+	}
+	return goja.Undefined()
+}
@@ -0,0 +1,84 @@
+package function
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestEventLoop(t *testing.T) {
+	tables := []struct {
+		name     string
+		code     string
+		reason   string
+		expected string
+	}{
+		{
+			"timers",
+			`function handle() {
+				setTimeout(function(s) { log(s); }, 20, "second");
+				var n = 0;
+				var id = setInterval(function() {
+					if (++n == 3) { clearInterval(id); log("interval"); }
+				}, 1);
+				clearTimeout(setTimeout(function() { log("cleared"); }, 1));
+				log("first");
+			}`,
+			"",
+			"first interval second",
+		},
+		{
+			"async handle",
+			`function wait(ms) { return new Promise(function(resolve) { setTimeout(resolve, ms); }); }
+			async function handle() {
+				await wait(10);
+				log("waited");
+				var res = await fetch("ftp://example.com");
+				log(res.ok);
+			}`,
+			"",
+			"unsupported scheme: ftp false",
+		},
+		{
+			"rejected",
+			`async function handle() { await null; throw new Error("oops"); }`,
+			internal.FunctionFailedError,
+			"Error: oops",
+		},
+		{
+			"never settled",
+			`function handle() { return new Promise(function() {}); }`,
+			internal.FunctionFailedError,
+			"never settled",
+		},
+		{
+			"error in a timer",
+			`function handle() { setTimeout(function() { throw new Error("late"); }, 1); }`,
+			internal.FunctionFailedError,
+			"Error: late",
+		},
+		{
+			"timeout waiting on the loop",
+			`function handle() { setInterval(function() {}, 10); }`,
+			internal.FunctionFailedTimeout,
+			"timeout",
+		},
+	}
+
+	for _, tt := range tables {
+		t.Run(tt.name, func(t *testing.T) {
+			rh := execute(t, tt.code, internal.FunctionLimits{Timeout: 1})
+			if rh.Reason != tt.reason {
+				t.Errorf("expected reason %q got %q: %v", tt.reason, rh.Reason, rh.Output)
+			}
+
+			// skip "Function started" and "Function completed"
+			out := strings.Join(rh.Output[1:], " ")
+			out = strings.Replace(out, "Function completed", "", 1)
+			if !strings.Contains(out, tt.expected) {
+				t.Errorf("expected %q in the output got %q", tt.expected, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package function
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// runtimes keeps the prepared runtimes of each base
+var runtimes = newRuntimePool()
+
+// pooledRuntime is a goja runtime with the helpers registered. The helpers
+// use env, the environment of the run currently using the runtime.
+type pooledRuntime struct {
+	vm  *goja.Runtime
+	env *ExecutionEnvironment
+
+	// the globals defined by the runtime, the others are removed between
+	// the runs
+	globals     map[string]bool
+	globalProto *goja.Object
+
+	// the builtin prototypes and their values checked after each run, the
+	// runtime is dropped if a run changed them
+	protos map[*goja.Object]*protoSnapshot
+	// dirty is set when a run redefines a property of the global object or
+	// a builtin prototype
+	dirty bool
+	// when the runtime was put back in the pool
+	idle time.Time
+}
+
+type protoSnapshot struct {
+	names     []string
+	values    []goja.Value
+	symbols   []*goja.Symbol
+	symValues []goja.Value
+}
+
+// sealProgram locks the globals and freezes the helpers, the namespaces
+// and the constructors of a new runtime, a run cannot override them for the
+// next ones. The builtin prototypes cannot be extended but their properties
+// stay writable: freezing them would stop the objects inheriting from them
+// from assigning their own toString or constructor. Their values are
+// recorded and checked after each run instead.
+var sealProgram = goja.MustCompile("seal.js", `
+(function (global, record, watch) {
+	var getProto = Object.getPrototypeOf, ownKeys = Reflect.ownKeys,
+		describe = Object.getOwnPropertyDescriptor, define = Object.defineProperty,
+		freeze = Object.freeze, preventExtensions = Object.preventExtensions;
+
+	function isObject(v) {
+		return v !== null && (typeof v === "object" || typeof v === "function");
+	}
+
+	var protos = new Set();
+	function track(p) {
+		for (; isObject(p) && !protos.has(p); p = getProto(p)) {
+			protos.add(p);
+		}
+	}
+
+	ownKeys(global).forEach(function (k) {
+		var v = describe(global, k).value;
+		if (typeof v === "function") {
+			track(v.prototype);
+		}
+	});
+
+	// the prototypes without a global constructor
+	track(getProto(function* () {}));
+	track(getProto(function* () {}).prototype);
+	track(getProto(async function () {}));
+	track(getProto(Int8Array).prototype);
+	track(getProto([][Symbol.iterator]()));
+	track(getProto(new Map()[Symbol.iterator]()));
+	track(getProto(new Set()[Symbol.iterator]()));
+	track(getProto(""[Symbol.iterator]()));
+
+	// the functions changing a property without assigning it
+	watch(Object, ["defineProperty", "defineProperties", "setPrototypeOf", "preventExtensions", "freeze", "seal"]);
+	watch(Reflect, ["defineProperty", "setPrototypeOf", "preventExtensions"]);
+
+	function seal(v) {
+		if (isObject(v) && v !== global && !protos.has(v)) {
+			freeze(v);
+		}
+	}
+
+	ownKeys(global).forEach(function (k) {
+		var d = describe(global, k);
+		define(global, k, "value" in d ? {writable: false, configurable: false} : {configurable: false});
+		seal(d.value);
+	});
+
+	protos.forEach(function (p) {
+		record(p);
+		ownKeys(p).forEach(function (k) {
+			var d = describe(p, k);
+			if (k === "constructor") {
+				seal(d.value);
+			}
+			if (d.writable) {
+				record(p, k, d.value);
+			}
+		});
+		preventExtensions(p);
+	});
+})
+`, false)
+
+func newRuntime() *pooledRuntime {
+	vm := goja.New()
+	vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
+
+	env := &ExecutionEnvironment{}
+	env.addFunctions(vm)
+
+	rt := &pooledRuntime{
+		vm:          vm,
+		env:         env,
+		globals:     make(map[string]bool),
+		globalProto: vm.GlobalObject().Prototype(),
+		protos:      make(map[*goja.Object]*protoSnapshot),
+	}
+
+	v, err := vm.RunProgram(sealProgram)
+	if err != nil {
+		panic(err)
+	}
+
+	seal, ok := goja.AssertFunction(v)
+	if !ok {
+		panic("the seal program is not a function")
+	}
+
+	if _, err := seal(goja.Undefined(), vm.GlobalObject(), vm.ToValue(rt.record), vm.ToValue(rt.watch)); err != nil {
+		panic(err)
+	}
+
+	for _, k := range vm.GlobalObject().Keys() {
+		rt.globals[k] = true
+	}
+	return rt
+}
+
+// record adds a prototype or one of its writable values to the snapshot
+func (rt *pooledRuntime) record(call goja.FunctionCall) goja.Value {
+	p := call.Argument(0).ToObject(rt.vm)
+
+	s, ok := rt.protos[p]
+	if !ok {
+		s = &protoSnapshot{}
+		rt.protos[p] = s
+	}
+
+	if len(call.Arguments) < 3 {
+		return goja.Undefined()
+	}
+
+	if sym, ok := call.Argument(1).(*goja.Symbol); ok {
+		s.symbols = append(s.symbols, sym)
+		s.symValues = append(s.symValues, call.Argument(2))
+	} else {
+		s.names = append(s.names, call.Argument(1).String())
+		s.values = append(s.values, call.Argument(2))
+	}
+	return goja.Undefined()
+}
+
+// watch replaces the functions of a namespace to mark the runtime dirty
+// when they change the global object or a builtin prototype
+func (rt *pooledRuntime) watch(ns *goja.Object, names []string) {
+	global := rt.vm.GlobalObject()
+
+	for _, name := range names {
+		f, ok := goja.AssertFunction(ns.Get(name))
+		if !ok {
+			continue
+		}
+
+		ns.Set(name, func(call goja.FunctionCall) goja.Value {
+			if o, ok := call.Argument(0).(*goja.Object); ok {
+				if _, proto := rt.protos[o]; proto || o == global {
+					rt.dirty = true
+				}
+			}
+
+			v, err := f(call.This, call.Arguments...)
+			if err != nil {
+				panic(err)
+			}
+			return v
+		})
+	}
+}
+
+// reset removes what the last run left on the runtime, it returns false if
+// the runtime cannot be reused
+func (rt *pooledRuntime) reset() bool {
+	*rt.env = ExecutionEnvironment{}
+	rt.vm.ClearInterrupt()
+
+	global := rt.vm.GlobalObject()
+	if rt.dirty || global.Prototype() != rt.globalProto {
+		return false
+	}
+
+	for _, k := range global.Keys() {
+		if rt.globals[k] {
+			continue
+		} else if err := global.Delete(k); err != nil {
+			return false
+		}
+	}
+
+	// a deleted property has no value
+	for p, s := range rt.protos {
+		for i, name := range s.names {
+			if v := p.Get(name); v == nil || !v.SameAs(s.values[i]) {
+				return false
+			}
+		}
+
+		for i, sym := range s.symbols {
+			if v := p.GetSymbol(sym); v == nil || !v.SameAs(s.symValues[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+const (
+	// maxIdleRuntimes is the number of idle runtimes kept per base
+	maxIdleRuntimes = 8
+	// runtimeIdleTTL is how long an idle runtime is kept
+	runtimeIdleTTL = 5 * time.Minute
+)
+
+// runtimePool keeps the idle runtimes per base, a base never receives a
+// runtime used by another one. Preparing a runtime takes a few
+// milliseconds, unlike a sync.Pool the idle runtimes are not dropped by
+// the garbage collection but once unused for runtimeIdleTTL.
+type runtimePool struct {
+	sync.Mutex
+	bases map[string][]*pooledRuntime
+	swept time.Time
+}
+
+func newRuntimePool() *runtimePool {
+	return &runtimePool{bases: make(map[string][]*pooledRuntime), swept: time.Now()}
+}
+
+func (p *runtimePool) get(base string) *pooledRuntime {
+	p.Lock()
+	idle := p.bases[base]
+	if n := len(idle); n > 0 {
+		rt := idle[n-1]
+		idle[n-1] = nil
+		p.bases[base] = idle[:n-1]
+		p.Unlock()
+		return rt
+	}
+	p.Unlock()
+
+	return newRuntime()
+}
+
+// put returns the runtime of a successful run to the pool, the runtimes
+// of the failed runs might be interrupted mid-way and are dropped like the
+// ones whose builtin prototypes were changed
+func (p *runtimePool) put(base string, rt *pooledRuntime, err error) {
+	if err != nil || !rt.reset() {
+		return
+	}
+	rt.idle = time.Now()
+
+	p.Lock()
+	defer p.Unlock()
+
+	// the oldest runtimes are first
+	idle := append(p.bases[base], rt)
+	if len(idle) > maxIdleRuntimes {
+		idle[0] = nil
+		idle = idle[1:]
+	}
+	p.bases[base] = idle
+
+	if time.Since(p.swept) > runtimeIdleTTL {
+		p.sweep()
+	}
+}
+
+// sweep drops the runtimes idle for longer than runtimeIdleTTL
+func (p *runtimePool) sweep() {
+	p.swept = time.Now()
+
+	for base, idle := range p.bases {
+		i := 0
+		for ; i < len(idle) && time.Since(idle[i].idle) > runtimeIdleTTL; i++ {
+			idle[i] = nil
+		}
+
+		if i == len(idle) {
+			delete(p.bases, base)
+		} else {
+			p.bases[base] = idle[i:]
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package function
+
+import "testing"
+
+func TestRuntimeReset(t *testing.T) {
+	// whether the runtime can be reused after running the code
+	tables := make(map[string]bool)
+	tables[`var a = [1, 2]; a.map(function(x) { return x * 2; })`] = true
+	tables[`leaked = 1`] = true
+	tables[`JSON.parse = null; log.info = null; cache.get = null; fetch = null`] = true
+	tables[`var a = []; a.toString = function() { return "a"; }`] = true
+	tables[`function F() {} F.prototype.toString = function() { return "f"; }`] = true
+	tables[`Object.defineProperty(globalThis, "hidden", {value: 1})`] = false
+	tables[`Array.prototype.first = function() { return this[0]; }`] = true
+	tables[`Array.prototype.map = function() { return []; }`] = false
+	tables[`delete Array.prototype.map`] = false
+	tables[`Object.prototype.toString = function() { return "x"; }`] = false
+	tables[`Object.setPrototypeOf(globalThis, {})`] = false
+	tables[`globalThis.__proto__ = {}`] = false
+	tables[`Object.preventExtensions(String.prototype)`] = false
+
+	for code, expected := range tables {
+		rt := newRuntime()
+
+		// the functions' code runs in a function scope
+		if _, err := rt.vm.RunString("(function() {" + code + "})()"); err != nil {
+			t.Fatalf("%s: %v", code, err)
+		}
+
+		if ok := rt.reset(); ok != expected {
+			t.Errorf("%s: expected reset to return %v got %v", code, expected, ok)
+		}
+	}
+}
+
+func TestRuntimeSealedBuiltins(t *testing.T) {
+	rt := newRuntime()
+
+	// strict code sees the sealed builtins as read-only
+	code := `(function() {
+	"use strict";
+	var failed = 0;
+	[
+		function() { JSON.parse = null; },
+		function() { Math.max = null; },
+		function() { log.info = null; },
+		function() { fetch = null; },
+		function() { Object.keys = null; },
+	].forEach(function(f) {
+		try { f(); } catch (e) { failed++; }
+	});
+	return failed;
+	})()`
+
+	v, err := rt.vm.RunString(code)
+	if err != nil {
+		t.Fatal(err)
+	} else if v.ToInteger() != 5 {
+		t.Errorf("expected the 5 assignments to fail got %d", v.ToInteger())
+	}
+
+	if !rt.reset() {
+		t.Errorf("expected the runtime to be reusable")
+	}
+}
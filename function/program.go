@@ -0,0 +1,72 @@
+package function
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/staticbackendhq/core/internal"
+
+	"github.com/dop251/goja"
+)
+
+// programs caches the compiled code of the functions and modules
+var programs = newProgramCache(500)
+
+// programCache keeps the most recently used compiled programs. The keys
+// include the code's version so an update is compiled again.
+type programCache struct {
+	sync.Mutex
+	max   int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type cachedProgram struct {
+	key string
+	prg *goja.Program
+}
+
+func newProgramCache(max int) *programCache {
+	return &programCache{
+		max:   max,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// programKey returns the cache key of a function's code at a version
+func programKey(base string, fn internal.ExecData, version int) string {
+	return fmt.Sprintf("%s:%s:%d", base, fn.ID, version)
+}
+
+// get returns the cached program or compiles and caches it
+func (c *programCache) get(key string, compile func() (*goja.Program, error)) (*goja.Program, error) {
+	c.Lock()
+	if e, ok := c.items[key]; ok {
+		c.order.MoveToFront(e)
+		c.Unlock()
+		return e.Value.(cachedProgram).prg, nil
+	}
+	c.Unlock()
+
+	// compiling is slow, two runs might compile the same code at once
+	prg, err := compile()
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if _, ok := c.items[key]; !ok {
+		c.items[key] = c.order.PushFront(cachedProgram{key: key, prg: prg})
+	}
+
+	for c.order.Len() > c.max {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.items, e.Value.(cachedProgram).key)
+	}
+	return prg, nil
+}
@@ -0,0 +1,160 @@
+package function
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+
+	"github.com/dop251/goja"
+)
+
+// discardRuns ignores the runs, the benchmarks would otherwise block
+type discardRuns struct {
+	internal.Persister
+}
+
+func (discardRuns) RanFunction(dbName, id string, rh internal.ExecHistory) error {
+	return nil
+}
+
+func TestRunIsolation(t *testing.T) {
+	rl := &runLog{runs: make(chan internal.ExecHistory, 1)}
+
+	// the declarations, implicit globals and modules of a run do not leak
+	// into the next one
+	code := `
+	const count = typeof leaked === "undefined" ? 0 : leaked;
+	function handle() {
+		leaked = count + 1;
+		var m = require("base64");
+		m.extra = m.extra || 0;
+		log(count, m.extra++);
+	}`
+
+	for i := 0; i < 3; i++ {
+		if out := runOnce(t, rl, "fn1", code); !strings.Contains(out, "0 0") {
+			t.Errorf("run %d: expected a clean runtime got %s", i, out)
+		}
+	}
+}
+
+func TestBuiltinsOverrideIsolation(t *testing.T) {
+	rl := &runLog{runs: make(chan internal.ExecHistory, 1)}
+
+	override := `
+	function handle() {
+		log.info = null;
+		cache.get = null;
+		Object.prototype.x = 1;
+		JSON.parse = function() { return 42; };
+		fetch = "overridden";
+		create = null;
+		log = null;
+	}`
+	runOnce(t, rl, "fnA", override)
+
+	check := `
+	function handle() {
+		var seen = [typeof log.info, typeof cache.get, typeof fetch, typeof create, ({}).x, JSON.parse("1")];
+		log(seen.join(" "));
+	}`
+	out := runOnce(t, rl, "fnB", check)
+	if !strings.Contains(out, "function function function function  1") {
+		t.Errorf("expected pristine builtins got %s", out)
+	}
+}
+
+// runOnce executes the function on the runsdb base and returns its output
+func runOnce(t *testing.T, rl *runLog, id, code string) string {
+	t.Helper()
+
+	env := &ExecutionEnvironment{
+		BaseName:  "runsdb",
+		DataStore: rl,
+		Data:      internal.ExecData{ID: id, Code: code, Version: 1},
+	}
+
+	if err := env.Execute(internal.Command{Type: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case rh := <-rl.runs:
+		return strings.Join(rh.Output, "\n")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the run was never recorded")
+	}
+	return ""
+}
+
+func BenchmarkDBCreatedTrigger(b *testing.B) {
+	doc, err := json.Marshal(internal.DocumentEvent{
+		Collection: "tasks",
+		ID:         "123",
+		Op:         internal.DocumentCreate,
+		Document:   map[string]interface{}{"id": "123", "title": "benchmark", "done": false},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	msg := internal.Command{Type: internal.MsgTypeDBCreated, Data: string(doc)}
+
+	code := `
+	function handle(evt) {
+		if (evt.document.done) { return; }
+		log("new task", evt.document.title);
+	}`
+
+	newEnv := func() *ExecutionEnvironment {
+		return &ExecutionEnvironment{
+			BaseName:  "benchdb",
+			DataStore: discardRuns{},
+			Data:      internal.ExecData{ID: "fn1", Code: code, Version: 1},
+		}
+	}
+
+	execute := func(b *testing.B) {
+		if err := newEnv().Execute(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.Run("cold", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			programs = newProgramCache(500)
+			runtimes = newRuntimePool()
+			execute(b)
+		}
+	})
+
+	b.Run("warm", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				execute(b)
+			}
+		})
+	})
+
+	// a new runtime for each run, what the pool saves
+	b.Run("fresh", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				vm := goja.New()
+				vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
+
+				env := newEnv()
+				env.addFunctions(vm)
+
+				_, err := env.runOn(vm, msg)
+				go env.complete(err)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
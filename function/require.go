@@ -0,0 +1,70 @@
+package function
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// addRequire adds require() resolving "./name" to the base's modules and
+// the other names to the standard library. A module is loaded once per run.
+func (env *ExecutionEnvironment) addRequire(vm *goja.Runtime) {
+	var require func(call goja.FunctionCall) goja.Value
+	require = func(call goja.FunctionCall) goja.Value {
+		name := call.Argument(0).String()
+
+		if m, ok := env.modules[name]; ok {
+			return m.Get("exports")
+		}
+
+		if !strings.HasPrefix(name, "./") {
+			exports, ok := builtinModule(vm, name)
+			if !ok {
+				panic(vm.NewGoError(fmt.Errorf("cannot find module %q", name)))
+			}
+
+			m := vm.NewObject()
+			m.Set("exports", exports)
+			env.modules[name] = m
+			return exports
+		}
+
+		fn, err := env.DataStore.GetFunctionForExecution(env.BaseName, strings.TrimPrefix(name, "./"))
+		if err != nil || !fn.IsModule() {
+			panic(vm.NewGoError(fmt.Errorf("cannot find module %q", name)))
+		}
+
+		// CommonJS modules see their own exports, require and module
+		prg, err := programs.get(programKey(env.BaseName, fn, fn.Version), func() (*goja.Program, error) {
+			src := "(function(exports, require, module) {" + fn.Code + "\n})"
+			return goja.Compile(name, src, false)
+		})
+		if err != nil {
+			panic(vm.NewGoError(fmt.Errorf("cannot compile module %q: %v", name, err)))
+		}
+
+		wrapper, err := vm.RunProgram(prg)
+		if err != nil {
+			panic(err)
+		}
+
+		load, ok := goja.AssertFunction(wrapper)
+		if !ok {
+			panic(vm.NewGoError(fmt.Errorf("cannot load module %q", name)))
+		}
+
+		// the module is cached before it's loaded for circular requires
+		m := vm.NewObject()
+		m.Set("exports", vm.NewObject())
+		env.modules[name] = m
+
+		if _, err := load(goja.Undefined(), m.Get("exports"), vm.ToValue(require), m); err != nil {
+			delete(env.modules, name)
+			panic(err)
+		}
+		return m.Get("exports")
+	}
+
+	vm.Set("require", require)
+}
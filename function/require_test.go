@@ -0,0 +1,149 @@
+package function
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+
+	"github.com/dop251/goja"
+)
+
+// moduleStore returns the base's modules by name
+type moduleStore struct {
+	*runLog
+	modules map[string]string
+}
+
+func (ms *moduleStore) GetFunctionForExecution(dbName, name string) (internal.ExecData, error) {
+	code, ok := ms.modules[name]
+	if !ok {
+		return internal.ExecData{}, errors.New("function not found")
+	}
+
+	kind := internal.FunctionKindModule
+	if name == "fn" {
+		kind = internal.FunctionKindFunction
+	}
+	return internal.ExecData{ID: "mod_" + name, FunctionName: name, Code: code, Version: 1, Kind: kind}, nil
+}
+
+func TestRequire(t *testing.T) {
+	ms := &moduleStore{
+		runLog: &runLog{runs: make(chan internal.ExecHistory, 1)},
+		modules: map[string]string{
+			"greet": `
+				var count = 0;
+				exports.hello = function(name) { count++; return "hello " + name + " " + count; };`,
+			"shout": `
+				var greet = require("./greet");
+				module.exports = function(name) { return greet.hello(name).toUpperCase(); };`,
+			"loop": `while (true) {}`,
+			"fn":   `function handle() {}`,
+		},
+	}
+
+	tables := []struct {
+		name     string
+		code     string
+		limits   internal.FunctionLimits
+		expected string
+	}{
+		{
+			"module",
+			`function handle() { log(require("./greet").hello("a")); log(require("./shout")("b")); }`,
+			internal.FunctionLimits{},
+			"hello a 1\nHELLO B 2",
+		},
+		{
+			"standard library",
+			`function handle() {
+				log(require("crypto").sha256("abc"));
+				log(require("base64").decode(require("base64").encode("hé")));
+				log(require("date").format(0, "YYYY-MM-DD HH:mm", "UTC"));
+				log(require("uuid").v4().length);
+			}`,
+			internal.FunctionLimits{},
+			"ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad\nhé\n1970-01-01 00:00\n36",
+		},
+		{
+			"missing module",
+			`function handle() { require("./nope"); }`,
+			internal.FunctionLimits{},
+			`cannot find module "./nope"`,
+		},
+		{
+			"not a module",
+			`function handle() { require("./fn"); }`,
+			internal.FunctionLimits{},
+			`cannot find module "./fn"`,
+		},
+		{
+			"unknown builtin",
+			`function handle() { require("fs"); }`,
+			internal.FunctionLimits{},
+			`cannot find module "fs"`,
+		},
+		{
+			"timeout in a module",
+			`function handle() { require("./loop"); }`,
+			internal.FunctionLimits{Timeout: 1},
+			"exceeded its 1s timeout at ./loop",
+		},
+	}
+
+	for _, tt := range tables {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &ExecutionEnvironment{
+				BaseName:   "testdb",
+				DataStore:  ms,
+				Data:       internal.ExecData{ID: "fn1", Code: tt.code},
+				BaseLimits: tt.limits,
+			}
+
+			env.Execute(internal.Command{Type: "test"})
+
+			var rh internal.ExecHistory
+			select {
+			case rh = <-ms.runs:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the run was never recorded")
+			}
+
+			if out := strings.Join(rh.Output, "\n"); !strings.Contains(out, tt.expected) {
+				t.Errorf("expected %q in the output got %s", tt.expected, out)
+			}
+		})
+	}
+}
+
+func TestProgramCache(t *testing.T) {
+	c := newProgramCache(2)
+
+	compiled := 0
+	get := func(key string) {
+		_, err := c.get(key, func() (*goja.Program, error) {
+			compiled++
+			return goja.Compile(key, "1", false)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get("a")
+	get("b")
+	get("a")
+	// b is the least recently used
+	get("c")
+	get("a")
+	get("b")
+
+	if compiled != 4 {
+		t.Errorf("expected 4 compilations got %d", compiled)
+	} else if c.order.Len() != 2 {
+		t.Errorf("expected 2 cached programs got %d", c.order.Len())
+	}
+}
@@ -1,14 +1,18 @@
 package function
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/staticbackendhq/core/email"
 	"github.com/staticbackendhq/core/internal"
 
 	"github.com/dop251/goja"
@@ -19,9 +23,29 @@ type ExecutionEnvironment struct {
 	BaseName  string
 	DataStore internal.Persister
 	Volatile  internal.PubSuber
+	Storer    internal.Storer
+	Mailer    internal.Mailer
 	Data      internal.ExecData
+	// BaseID identifies the base for its monthly sent emails count
+	BaseID string
+	// BaseLimits are the base's function limits, the function's own limits
+	// can only lower them
+	BaseLimits internal.FunctionLimits
+	// FetchSettings restricts the hosts and responses of fetch()
+	FetchSettings internal.FetchSettings
 
 	CurrentRun internal.ExecHistory
+
+	// the run is interrupted at its deadline, the blocking calls must not
+	// outlive it
+	deadline time.Time
+	loop     *eventLoop
+	guard    *guard
+	// the modules loaded by require() during the run
+	modules map[string]*goja.Object
+	// roundTrip makes the fetch() calls instead of the HTTP client, a dry
+	// run captures them
+	roundTrip func(req *http.Request) (*http.Response, error)
 }
 
 type Result struct {
@@ -30,42 +54,189 @@ type Result struct {
 }
 
 func (env *ExecutionEnvironment) Execute(data interface{}) error {
-	vm := goja.New()
-	vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
+	_, err := env.run(data)
+	return err
+}
+
+// Authorize executes the function and returns its boolean result. It's
+// used by functions deciding if an action is allowed, i.e. joining a
+// channel.
+func (env *ExecutionEnvironment) Authorize(data interface{}) (bool, error) {
+	return env.run(data)
+}
+
+// run executes the function on a pooled runtime and returns whether the
+// value returned by handle is truthy, the value itself belongs to the
+// runtime.
+func (env *ExecutionEnvironment) run(data interface{}) (bool, error) {
+	rt := runtimes.get(env.BaseName)
+
+	// the runtime's helpers use its environment, the run's one is copied
+	// in and back once completed
+	*rt.env = *env
+	v, err := rt.env.runOn(rt.vm, data)
+	*env = *rt.env
+
+	ok := err == nil && v.ToBoolean()
+	runtimes.put(env.BaseName, rt, err)
+
+	go env.complete(err)
+	if err != nil {
+		return false, fmt.Errorf("error executing your function: %v", err)
+	}
+
+	return ok, nil
+}
+
+func (env *ExecutionEnvironment) runOn(vm *goja.Runtime, data interface{}) (goja.Value, error) {
+	env.loop = newEventLoop(vm)
+	env.modules = make(map[string]*goja.Object)
+
+	env.CurrentRun = internal.ExecHistory{
+		Version: env.Data.Version,
+		Started: time.Now(),
+		Output:  make([]string, 0),
+		Logs:    make([]internal.FunctionLog, 0),
+	}
+
+	// the limits cover the function's code loading as well
+	limits := env.Data.Limits.Within(env.BaseLimits)
+	env.deadline = time.Now().Add(limits.TimeoutDuration())
+	env.guard = newGuard(env.loop, limits)
 
+	env.logf(internal.LogInfo, "Function started")
+
+	v, err := env.call(vm, data)
+	env.guard.stop()
+	env.loop.close()
+
+	return v, err
+}
+
+// addFunctions adds the helpers to a new runtime, they use the environment
+// of the run using the runtime
+func (env *ExecutionEnvironment) addFunctions(vm *goja.Runtime) {
+	env.addTimers(vm)
 	env.addHelpers(vm)
 	env.addDatabaseFunctions(vm)
 	env.addVolatileFunctions(vm)
+	env.addFetchFunctions(vm)
+	env.addEmailFunctions(vm)
+	env.addStorageFunctions(vm)
+	env.addRequire(vm)
+}
+
+func (env *ExecutionEnvironment) call(vm *goja.Runtime, data interface{}) (goja.Value, error) {
+	if env.Data.IsModule() {
+		return nil, errors.New("modules are loaded with require() and cannot be executed")
+	}
+
+	prg, err := env.program()
+	if err != nil {
+		return nil, err
+	}
 
-	if _, err := vm.RunString(env.Data.Code); err != nil {
-		return err
+	// the code runs in a function scope, a pooled runtime does not keep
+	// its declarations
+	wrapper, err := vm.RunProgram(prg)
+	if err != nil {
+		return nil, err
 	}
 
-	handler, ok := goja.AssertFunction(vm.Get("handle"))
+	scope, ok := goja.AssertFunction(wrapper)
 	if !ok {
-		return errors.New(`unable to find function "handle"`)
+		return nil, errors.New("unable to load the function")
+	}
+
+	h, err := scope(goja.Undefined())
+	if err != nil {
+		return nil, err
+	}
+
+	handler, ok := goja.AssertFunction(h)
+	if !ok {
+		return nil, errors.New(`unable to find function "handle"`)
 	}
 
 	args, err := env.prepareArguments(vm, data)
 	if err != nil {
-		return fmt.Errorf("error preparing argument: %v", err)
+		return nil, fmt.Errorf("error preparing argument: %v", err)
 	}
 
-	env.CurrentRun = internal.ExecHistory{
-		Version: env.Data.Version,
-		Started: time.Now(),
-		Output:  make([]string, 0),
+	v, err := handler(goja.Undefined(), args...)
+	if err != nil {
+		return nil, err
 	}
 
-	env.CurrentRun.Output = append(env.CurrentRun.Output, "Function started")
+	// the run completes once the timers and asynchronous calls are done
+	if err := env.loop.wait(); err != nil {
+		return nil, err
+	}
+	return settled(v)
+}
 
-	_, err = handler(goja.Undefined(), args...)
-	go env.complete(err)
+// program returns the compiled code of the function. The programs of the
+// saved functions are cached by version.
+func (env *ExecutionEnvironment) program() (*goja.Program, error) {
+	compile := func() (*goja.Program, error) {
+		code, err := env.code()
+		if err != nil {
+			return nil, err
+		}
+
+		src := "(function() {" + code + "\nreturn typeof handle === 'function' ? handle : undefined;\n})"
+		return goja.Compile(env.Data.FunctionName, src, false)
+	}
+
+	// the unsaved code has no version to cache
+	if len(env.Data.ID) == 0 || env.Data.Version == 0 {
+		return compile()
+	}
+
+	version := env.Data.Version
+	if pinned := env.Data.PinnedVersion; pinned > 0 {
+		version = pinned
+	}
+
+	prg, err := programs.get(programKey(env.BaseName, env.Data, version), compile)
 	if err != nil {
-		return fmt.Errorf("error executing your function: %v", err)
+		return nil, err
 	}
 
-	return nil
+	env.CurrentRun.Version = version
+	return prg, nil
+}
+
+// code returns the code of the pinned version when the function has one,
+// the newer versions are staged until it's unpinned
+func (env *ExecutionEnvironment) code() (string, error) {
+	pinned := env.Data.PinnedVersion
+	if pinned == 0 || pinned == env.Data.Version {
+		return env.Data.Code, nil
+	}
+
+	v, err := env.DataStore.GetFunctionVersion(env.BaseName, env.Data.ID, pinned)
+	if err != nil {
+		return "", fmt.Errorf("cannot load the pinned version %d: %v", pinned, err)
+	}
+
+	return v.Code, nil
+}
+
+// settled returns the value of the promise returned by an async handle
+func settled(v goja.Value) (goja.Value, error) {
+	p, ok := v.Export().(*goja.Promise)
+	if !ok {
+		return v, nil
+	}
+
+	switch p.State() {
+	case goja.PromiseStateFulfilled:
+		return p.Result(), nil
+	case goja.PromiseStateRejected:
+		return nil, errors.New(p.Result().String())
+	}
+	return nil, errors.New("the promise returned by handle never settled")
 }
 
 func (env *ExecutionEnvironment) prepareArguments(vm *goja.Runtime, data interface{}) ([]goja.Value, error) {
@@ -102,24 +273,44 @@ func (env *ExecutionEnvironment) prepareArguments(vm *goja.Runtime, data interfa
 		return args, nil
 	}
 
+	// database events receive their document event
+	if msg, ok := data.(internal.Command); ok && msg.IsDBEvent() {
+		var evt internal.DocumentEvent
+		if err := json.Unmarshal([]byte(msg.Data), &evt); err != nil {
+			return nil, err
+		}
+
+		args = append(args, vm.ToValue(evt))
+		return args, nil
+	}
+
 	// system or custom event/topic, we send only the 1st argument (body)
 	args = append(args, vm.ToValue(data))
 	return args, nil
 }
 
 func (env *ExecutionEnvironment) addHelpers(vm *goja.Runtime) {
-	vm.Set("log", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) == 0 {
+	logger := func(level string) func(call goja.FunctionCall) goja.Value {
+		return func(call goja.FunctionCall) goja.Value {
+			if len(call.Arguments) == 0 {
+				return goja.Undefined()
+			}
+
+			var params []interface{}
+			for _, v := range call.Arguments {
+				params = append(params, v.Export())
+			}
+			env.logf(level, "%s", fmt.Sprint(params...))
 			return goja.Undefined()
 		}
+	}
 
-		var params []interface{}
-		for _, v := range call.Arguments {
-			params = append(params, v.Export())
-		}
-		env.CurrentRun.Output = append(env.CurrentRun.Output, fmt.Sprint(params...))
-		return goja.Undefined()
-	})
+	// log() logs at the info level like log.info()
+	l := vm.ToValue(logger(internal.LogInfo)).ToObject(vm)
+	l.Set("info", logger(internal.LogInfo))
+	l.Set("warn", logger(internal.LogWarn))
+	l.Set("error", logger(internal.LogError))
+	vm.Set("log", l)
 }
 
 func (env *ExecutionEnvironment) addDatabaseFunctions(vm *goja.Runtime) {
@@ -140,6 +331,7 @@ func (env *ExecutionEnvironment) addDatabaseFunctions(vm *goja.Runtime) {
 		if err != nil {
 			return vm.ToValue(Result{Content: fmt.Sprintf("error calling create(): %s", err.Error())})
 		}
+		env.charge(sizeOf(doc))
 
 		if err := env.clean(doc); err != nil {
 			return vm.ToValue(Result{Content: err.Error()})
@@ -170,6 +362,7 @@ func (env *ExecutionEnvironment) addDatabaseFunctions(vm *goja.Runtime) {
 		if err != nil {
 			return vm.ToValue(Result{Content: fmt.Sprintf("error executing list: %v", err)})
 		}
+		env.charge(sizeOf(result.Results))
 
 		for _, v := range result.Results {
 			if err := env.clean(v); err != nil {
@@ -195,6 +388,7 @@ func (env *ExecutionEnvironment) addDatabaseFunctions(vm *goja.Runtime) {
 		if err != nil {
 			return vm.ToValue(Result{Content: fmt.Sprintf("error calling get(): %s", err.Error())})
 		}
+		env.charge(sizeOf(doc))
 
 		if err := env.clean(doc); err != nil {
 			return vm.ToValue(Result{Content: err.Error()})
@@ -240,6 +434,7 @@ func (env *ExecutionEnvironment) addDatabaseFunctions(vm *goja.Runtime) {
 		if err != nil {
 			return vm.ToValue(Result{Content: fmt.Sprintf("error executing query: %v", err)})
 		}
+		env.charge(sizeOf(result.Results))
 
 		for _, v := range result.Results {
 			if err := env.clean(v); err != nil {
@@ -271,6 +466,7 @@ func (env *ExecutionEnvironment) addDatabaseFunctions(vm *goja.Runtime) {
 		if err != nil {
 			return vm.ToValue(Result{Content: fmt.Sprintf("error executing update: %v", err)})
 		}
+		env.charge(sizeOf(updated))
 
 		if err := env.clean(updated); err != nil {
 			return vm.ToValue(Result{Content: fmt.Sprintf("error cleaning doc: %v", err)})
@@ -300,6 +496,13 @@ func (env *ExecutionEnvironment) addDatabaseFunctions(vm *goja.Runtime) {
 	})
 }
 
+// charge adds the bytes of the data a helper returns to the run's memory
+func (env *ExecutionEnvironment) charge(n int) {
+	if env.guard != nil {
+		env.guard.charge(n)
+	}
+}
+
 func (*ExecutionEnvironment) clean(doc map[string]interface{}) error {
 	//TODONOW: not sure what was the exact used for this clean-up
 	/*
@@ -332,12 +535,15 @@ func (env *ExecutionEnvironment) addVolatileFunctions(vm *goja.Runtime) {
 			return vm.ToValue(Result{Content: "the first argument should be a string"})
 		} else if err := vm.ExportTo(call.Argument(2), &channel); err != nil {
 			return vm.ToValue(Result{Content: "the third argument should be a string"})
+		} else if strings.HasPrefix(channel, internal.TailChannelPrefix) {
+			return vm.ToValue(Result{Content: "the function logs channels are reserved"})
 		}
 
 		b, err := json.Marshal(call.Argument(1).Export())
 		if err != nil {
 			return vm.ToValue(Result{Content: fmt.Sprintf("error converting your data: %v", err)})
 		}
+		env.charge(len(b))
 
 		msg := internal.Command{
 			SID:     env.Data.ID,
@@ -345,6 +551,7 @@ func (env *ExecutionEnvironment) addVolatileFunctions(vm *goja.Runtime) {
 			Data:    string(b),
 			Channel: channel,
 			Token:   env.Auth.ReconstructToken(),
+			Base:    env.BaseName,
 		}
 
 		if err := env.Volatile.Publish(msg); err != nil {
@@ -353,17 +560,247 @@ func (env *ExecutionEnvironment) addVolatileFunctions(vm *goja.Runtime) {
 
 		return vm.ToValue(Result{OK: true})
 	})
+
+	// the keys are prefixed with the base name like the /sudo/cache ones
+	key := func(v goja.Value) string {
+		return fmt.Sprintf("%s_%s", env.BaseName, v.String())
+	}
+
+	cache := vm.NewObject()
+	cache.Set("get", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) != 1 {
+			return vm.ToValue(Result{Content: "argument missmatch: you need 1 argument for cache.get(key)"})
+		}
+
+		val, err := env.Volatile.Get(key(call.Argument(0)))
+		if err != nil {
+			return vm.ToValue(Result{Content: fmt.Sprintf("error calling cache.get(): %v", err)})
+		}
+		env.charge(len(val))
+		return vm.ToValue(Result{OK: true, Content: val})
+	})
+	cache.Set("set", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) != 2 {
+			return vm.ToValue(Result{Content: "argument missmatch: you need 2 arguments for cache.set(key, value)"})
+		}
+
+		var val string
+		if err := vm.ExportTo(call.Argument(1), &val); err != nil {
+			return vm.ToValue(Result{Content: "the second argument should be a string"})
+		}
+
+		if err := env.Volatile.Set(key(call.Argument(0)), val); err != nil {
+			return vm.ToValue(Result{Content: fmt.Sprintf("error calling cache.set(): %v", err)})
+		}
+		return vm.ToValue(Result{OK: true})
+	})
+	cache.Set("inc", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 1 {
+			return vm.ToValue(Result{Content: "argument missmatch: you need at least 1 argument for cache.inc(key, [by])"})
+		}
+
+		by := int64(1)
+		if v := call.Argument(1); !goja.IsUndefined(v) {
+			by = v.ToInteger()
+		}
+
+		n, err := env.Volatile.Inc(key(call.Argument(0)), by)
+		if err != nil {
+			return vm.ToValue(Result{Content: fmt.Sprintf("error calling cache.inc(): %v", err)})
+		}
+		return vm.ToValue(Result{OK: true, Content: n})
+	})
+	vm.Set("cache", cache)
+
+	queue := vm.NewObject()
+	queue.Set("push", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) != 2 {
+			return vm.ToValue(Result{Content: "argument missmatch: you need 2 arguments for queue.push(key, value)"})
+		}
+
+		var val string
+		if err := vm.ExportTo(call.Argument(1), &val); err != nil {
+			return vm.ToValue(Result{Content: "the second argument should be a string"})
+		}
+
+		if err := env.Volatile.QueueWork(key(call.Argument(0)), val); err != nil {
+			return vm.ToValue(Result{Content: fmt.Sprintf("error calling queue.push(): %v", err)})
+		}
+		return vm.ToValue(Result{OK: true})
+	})
+	queue.Set("pop", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) != 1 {
+			return vm.ToValue(Result{Content: "argument missmatch: you need 1 argument for queue.pop(key)"})
+		}
+
+		// an empty queue returns an empty string
+		val, err := env.Volatile.DequeueWork(key(call.Argument(0)))
+		if err != nil {
+			return vm.ToValue(Result{Content: fmt.Sprintf("error calling queue.pop(): %v", err)})
+		}
+		env.charge(len(val))
+		return vm.ToValue(Result{OK: true, Content: val})
+	})
+	vm.Set("queue", queue)
+}
+
+func (env *ExecutionEnvironment) addEmailFunctions(vm *goja.Runtime) {
+	vm.Set("sendMail", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) != 1 {
+			return vm.ToValue(Result{Content: "argument missmatch: you need 1 argument for sendMail(data)"})
+		} else if env.Mailer == nil {
+			return vm.ToValue(Result{Content: "sending emails is not available"})
+		}
+
+		var data internal.SendMailData
+		if err := vm.ExportTo(call.Argument(0), &data); err != nil {
+			return vm.ToValue(Result{Content: "the first argument should be an object"})
+		} else if len(data.To) == 0 || len(data.Subject) == 0 {
+			return vm.ToValue(Result{Content: "the email needs a to and a subject"})
+		}
+
+		if err := env.Mailer.Send(email.FillBodies(data)); err != nil {
+			return vm.ToValue(Result{Content: fmt.Sprintf("error calling sendMail(): %v", err)})
+		}
+
+		if err := env.DataStore.IncrementMonthlyEmailSent(env.BaseID); err != nil {
+			log.Println("error increasing monthly email sent: ", err)
+		}
+		return vm.ToValue(Result{OK: true})
+	})
+}
+
+func (env *ExecutionEnvironment) addStorageFunctions(vm *goja.Runtime) {
+	vm.Set("uploadFile", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) != 2 {
+			return vm.ToValue(Result{Content: "argument missmatch: you need 2 arguments for uploadFile(name, base64Content)"})
+		} else if env.Storer == nil {
+			return vm.ToValue(Result{Content: "the file storage is not available"})
+		}
+
+		var name, content string
+		if err := vm.ExportTo(call.Argument(0), &name); err != nil {
+			return vm.ToValue(Result{Content: "the first argument should be a string"})
+		} else if err := vm.ExportTo(call.Argument(1), &content); err != nil {
+			return vm.ToValue(Result{Content: "the second argument should be a string"})
+		}
+
+		// the name cannot escape the account and base directory
+		name = filepath.Base(name)
+		if name == "." || name == "/" {
+			return vm.ToValue(Result{Content: "the file needs a name"})
+		}
+
+		b, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			return vm.ToValue(Result{Content: fmt.Sprintf("the content should be base64 encoded: %v", err)})
+		}
+		env.charge(len(b))
+
+		fileKey := fmt.Sprintf("%s/%s/%s", env.Auth.AccountID, env.BaseName, name)
+
+		url, err := env.Storer.Save(internal.UploadFileData{FileKey: fileKey, File: bytes.NewReader(b)})
+		if err != nil {
+			return vm.ToValue(Result{Content: fmt.Sprintf("error calling uploadFile(): %v", err)})
+		}
+
+		f := internal.File{
+			AccountID: env.Auth.AccountID,
+			Key:       fileKey,
+			URL:       url,
+			Size:      int64(len(b)),
+			Uploaded:  time.Now(),
+		}
+
+		f.ID, err = env.DataStore.AddFile(env.BaseName, f)
+		if err != nil {
+			return vm.ToValue(Result{Content: fmt.Sprintf("error calling uploadFile(): %v", err)})
+		}
+		return vm.ToValue(Result{OK: true, Content: f})
+	})
+	vm.Set("deleteFile", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) != 1 {
+			return vm.ToValue(Result{Content: "argument missmatch: you need 1 argument for deleteFile(id)"})
+		} else if env.Storer == nil {
+			return vm.ToValue(Result{Content: "the file storage is not available"})
+		}
+
+		var id string
+		if err := vm.ExportTo(call.Argument(0), &id); err != nil {
+			return vm.ToValue(Result{Content: "the first argument should be a string"})
+		}
+
+		f, err := env.DataStore.GetFileByID(env.BaseName, id)
+		if err != nil {
+			return vm.ToValue(Result{Content: fmt.Sprintf("error calling deleteFile(): %v", err)})
+		}
+
+		if err := env.Storer.Delete(f.Key); err != nil {
+			return vm.ToValue(Result{Content: fmt.Sprintf("error calling deleteFile(): %v", err)})
+		}
+
+		if err := env.DataStore.DeleteFile(env.BaseName, f.ID); err != nil {
+			return vm.ToValue(Result{Content: fmt.Sprintf("error calling deleteFile(): %v", err)})
+		}
+		return vm.ToValue(Result{OK: true})
+	})
+}
+
+func (env *ExecutionEnvironment) addFetchFunctions(vm *goja.Runtime) {
+	vm.Set("fetch", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 1 {
+			return vm.ToValue(env.loop.resolved(Result{Content: "argument missmatch: you need at least 1 argument for fetch(url, [options])"}))
+		}
+
+		var rawURL string
+		if err := vm.ExportTo(call.Argument(0), &rawURL); err != nil {
+			return vm.ToValue(env.loop.resolved(Result{Content: "the first argument should be a string"}))
+		}
+
+		var opt FetchOptions
+		if v := call.Argument(1); !goja.IsNull(v) && !goja.IsUndefined(v) {
+			if err := vm.ExportTo(v, &opt); err != nil {
+				return vm.ToValue(env.loop.resolved(Result{Content: "the second argument should be an object"}))
+			}
+		}
+
+		method := strings.ToUpper(opt.Method)
+		if len(method) == 0 {
+			method = http.MethodGet
+		}
+
+		// the call runs in the background, its result is recorded on the
+		// runtime's goroutine
+		p := env.loop.async(func() func() interface{} {
+			start := time.Now()
+			res, err := env.fetch(rawURL, opt)
+			elapsed := time.Since(start).Milliseconds()
+
+			return func() interface{} {
+				if err != nil {
+					env.logf(internal.LogWarn, "fetch %s %s failed after %dms: %v", method, rawURL, elapsed, err)
+					return Result{Content: fmt.Sprintf("error calling fetch(): %v", err)}
+				}
+
+				env.logf(internal.LogInfo, "fetch %s %s %d in %dms (%d bytes)", method, rawURL, res.Status, elapsed, len(res.Body))
+				env.charge(len(res.Body))
+				return Result{OK: true, Content: res}
+			}
+		})
+		return vm.ToValue(p)
+	})
 }
 
 func (env *ExecutionEnvironment) complete(err error) {
 	env.CurrentRun.Completed = time.Now()
 	env.CurrentRun.Success = err == nil
 
-	env.CurrentRun.Output = append(env.CurrentRun.Output, "Function completed")
+	env.logf(internal.LogInfo, "Function completed")
 
 	// add the error in the last output entry
 	if err != nil {
-		env.CurrentRun.Output = append(env.CurrentRun.Output, err.Error())
+		env.CurrentRun.Reason = failureReason(err)
+		env.logf(internal.LogError, "%s", err)
 	}
 
 	//TODO: this needs to be regrouped and ran un batch
@@ -0,0 +1,72 @@
+package function
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// versionLog also returns the function versions
+type versionLog struct {
+	*runLog
+	versions map[int]string
+}
+
+func (vl *versionLog) GetFunctionVersion(dbName, id string, version int) (internal.FunctionVersion, error) {
+	code, ok := vl.versions[version]
+	if !ok {
+		return internal.FunctionVersion{}, errors.New("version not found")
+	}
+	return internal.FunctionVersion{FunctionID: id, Version: version, Code: code}, nil
+}
+
+func TestPinnedVersion(t *testing.T) {
+	vl := &versionLog{
+		runLog:   &runLog{runs: make(chan internal.ExecHistory, 1)},
+		versions: map[int]string{1: `function handle() { log("v1"); }`},
+	}
+
+	tables := []struct {
+		name     string
+		pinned   int
+		version  int
+		expected string
+	}{
+		{"latest", 0, 2, "v2"},
+		{"pinned", 1, 1, "v1"},
+		{"missing version", 3, 2, "cannot load the pinned version 3"},
+	}
+
+	for _, tt := range tables {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &ExecutionEnvironment{
+				BaseName:  "testdb",
+				DataStore: vl,
+				Data: internal.ExecData{
+					ID:            "fn1",
+					Code:          `function handle() { log("v2"); }`,
+					Version:       2,
+					PinnedVersion: tt.pinned,
+				},
+			}
+
+			env.Execute(internal.Command{Type: "test"})
+
+			var rh internal.ExecHistory
+			select {
+			case rh = <-vl.runs:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the run was never recorded")
+			}
+
+			if out := strings.Join(rh.Output, "\n"); !strings.Contains(out, tt.expected) {
+				t.Errorf("expected %q in the output got %s", tt.expected, out)
+			} else if rh.Version != tt.version {
+				t.Errorf("expected the run of version %d got %d", tt.version, rh.Version)
+			}
+		})
+	}
+}
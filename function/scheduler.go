@@ -102,6 +102,7 @@ func (ts *TaskScheduler) sendMessage(auth internal.Auth, task internal.Task) {
 		Data:    meta.Data,
 		Channel: meta.Channel,
 		Token:   token,
+		Base:    task.BaseName,
 	}
 
 	if err := ts.Volatile.Publish(msg); err != nil {
@@ -0,0 +1,154 @@
+package function
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/google/uuid"
+)
+
+// builtinModule returns the exports of a standard library module
+func builtinModule(vm *goja.Runtime, name string) (*goja.Object, bool) {
+	switch name {
+	case "crypto":
+		return cryptoModule(vm), true
+	case "uuid":
+		return uuidModule(vm), true
+	case "date":
+		return dateModule(vm), true
+	case "base64":
+		return base64Module(vm), true
+	}
+	return nil, false
+}
+
+func cryptoModule(vm *goja.Runtime) *goja.Object {
+	digest := func(h func() hash.Hash) func(string) string {
+		return func(s string) string {
+			sum := h()
+			sum.Write([]byte(s))
+			return hex.EncodeToString(sum.Sum(nil))
+		}
+	}
+
+	m := vm.NewObject()
+	m.Set("md5", digest(md5.New))
+	m.Set("sha1", digest(sha1.New))
+	m.Set("sha256", digest(sha256.New))
+	m.Set("sha512", digest(sha512.New))
+	m.Set("hmacSHA256", func(key, s string) string {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(s))
+		return hex.EncodeToString(mac.Sum(nil))
+	})
+	return m
+}
+
+func uuidModule(vm *goja.Runtime) *goja.Object {
+	m := vm.NewObject()
+	m.Set("v4", func() string {
+		return uuid.New().String()
+	})
+	return m
+}
+
+func base64Module(vm *goja.Runtime) *goja.Object {
+	decode := func(enc *base64.Encoding) func(string) string {
+		return func(s string) string {
+			b, err := enc.DecodeString(s)
+			if err != nil {
+				panic(vm.NewGoError(err))
+			}
+			return string(b)
+		}
+	}
+
+	m := vm.NewObject()
+	m.Set("encode", func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	})
+	m.Set("decode", decode(base64.StdEncoding))
+	m.Set("encodeURL", func(s string) string {
+		return base64.URLEncoding.EncodeToString([]byte(s))
+	})
+	m.Set("decodeURL", decode(base64.URLEncoding))
+	return m
+}
+
+// dateTokens converts the usual date format tokens to Go's layout, the
+// longest tokens first
+var dateTokens = strings.NewReplacer(
+	"YYYY", "2006",
+	"YY", "06",
+	"MMMM", "January",
+	"MMM", "Jan",
+	"MM", "01",
+	"dddd", "Monday",
+	"ddd", "Mon",
+	"DD", "02",
+	"D", "2",
+	"HH", "15",
+	"hh", "03",
+	"h", "3",
+	"mm", "04",
+	"ss", "05",
+	"SSS", "000",
+	"A", "PM",
+	"ZZ", "-0700",
+	"Z", "-07:00",
+)
+
+func dateModule(vm *goja.Runtime) *goja.Object {
+	location := func(v goja.Value) *time.Location {
+		if goja.IsUndefined(v) {
+			return time.UTC
+		}
+
+		loc, err := time.LoadLocation(v.String())
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return loc
+	}
+
+	m := vm.NewObject()
+
+	// format(date, layout, [timezone]) accepts a Date or milliseconds
+	m.Set("format", func(call goja.FunctionCall) goja.Value {
+		var t time.Time
+		switch v := call.Argument(0).Export().(type) {
+		case time.Time:
+			t = v
+		case int64:
+			t = time.Unix(0, v*int64(time.Millisecond))
+		case float64:
+			t = time.Unix(0, int64(v)*int64(time.Millisecond))
+		default:
+			panic(vm.NewTypeError("the first argument should be a Date or milliseconds"))
+		}
+
+		layout := dateTokens.Replace(call.Argument(1).String())
+		return vm.ToValue(t.In(location(call.Argument(2))).Format(layout))
+	})
+
+	// parse(value, layout, [timezone]) returns the milliseconds
+	m.Set("parse", func(call goja.FunctionCall) goja.Value {
+		layout := dateTokens.Replace(call.Argument(1).String())
+
+		t, err := time.ParseInLocation(layout, call.Argument(0).String(), location(call.Argument(2)))
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return vm.ToValue(t.UnixNano() / int64(time.Millisecond))
+	})
+	return m
+}
@@ -3,13 +3,37 @@ package function
 import (
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/staticbackendhq/core/internal"
 )
 
+// how long the functions of a trigger are kept in memory before they're
+// read again, an update runs once it expires
+var triggerCacheTTL = 10 * time.Second
+
 type Subscriber struct {
 	PubSub     internal.PubSuber
 	GetExecEnv func(token string) (ExecutionEnvironment, error)
+	// Backoff returns the wait after a failed attempt, defaults to the
+	// function's internal.RetryPolicy Delay
+	Backoff func(retry internal.RetryPolicy, attempts int) time.Duration
+	// Store lists the bases and their pending events resumed by
+	// ScheduleRetries
+	Store internal.Persister
+	// GetBaseEnv returns the environment of a base's pending events
+	GetBaseEnv func(conf internal.BaseConfig) ExecutionEnvironment
+	// Locker ensures a pending event is attempted by one instance
+	Locker internal.Locker
+
+	mu       sync.Mutex
+	triggers map[string]triggerFunctions
+}
+
+type triggerFunctions struct {
+	funcs   []internal.ExecData
+	expires time.Time
 }
 
 // Start starts the system event subscription.
@@ -49,40 +73,208 @@ func (sub *Subscriber) handleRealtimeEvents(msg internal.Command) {
 		return
 	}
 
-	var ids []string
+	// the functions run as the publisher but don't see its token
+	msg.Token = ""
 
-	key := fmt.Sprintf("%s:%s", exe.BaseName, msg.Type)
-	if err := sub.PubSub.GetTyped(key, &ids); err != nil {
-		funcs, err := exe.DataStore.ListFunctionsByTrigger(exe.BaseName, msg.Type)
-		if err != nil {
-			log.Println("error getting functions by trigger: ", err)
+	funcs, err := sub.functionsByTrigger(exe, msg.Type)
+	if err != nil {
+		log.Println("error getting functions by trigger: ", err)
+		return
+	}
+
+	for _, fn := range funcs {
+		exe.Data = fn
+		go sub.Run(exe, msg)
+	}
+}
+
+// Run executes a function for an event with its retry policy. The event is
+// saved as pending once an attempt failed and as a dead letter once all the
+// attempts failed.
+func (sub *Subscriber) Run(exe ExecutionEnvironment, msg internal.Command) {
+	dl := internal.FunctionDeadLetter{
+		FunctionID:   exe.Data.ID,
+		FunctionName: exe.Data.FunctionName,
+		Command:      msg,
+		Auth:         exe.Auth,
+		Created:      time.Now(),
+	}
+	sub.attempt(exe, dl)
+}
+
+// attempt runs the function until the event succeeds, is a dead letter or
+// its next attempt is claimed by another instance. The pending event is
+// saved before waiting for its next attempt.
+func (sub *Subscriber) attempt(exe ExecutionEnvironment, dl internal.FunctionDeadLetter) {
+	backoff := sub.Backoff
+	if backoff == nil {
+		backoff = func(retry internal.RetryPolicy, attempts int) time.Duration {
+			return retry.Delay(attempts)
+		}
+	}
+
+	max := exe.Data.Retry.Attempts()
+	for {
+		// each attempt has its own environment, the last run is still
+		// being saved
+		ex := exe
+
+		err := ex.Execute(dl.Command)
+		if err == nil {
+			if len(dl.ID) > 0 {
+				if err := exe.DataStore.DeleteFunctionDeadLetter(exe.BaseName, dl.ID); err != nil {
+					log.Println("error deleting function dead letter: ", err)
+				}
+			}
 			return
 		}
 
-		for _, fn := range funcs {
-			if err := sub.PubSub.SetTyped("fn_"+fn.ID, fn); err != nil {
-				log.Println("error adding function  to cache: ", err)
+		dl.Attempts++
+		dl.Error = err.Error()
+		dl.Pending = dl.Attempts < max
+		if dl.Pending {
+			dl.NextAttempt = time.Now().Add(backoff(exe.Data.Retry, dl.Attempts))
+		}
+
+		log.Printf(`executing "%s" function failed (attempt %d of %d): %v`, ex.Data.FunctionName, dl.Attempts, max, err)
+
+		if len(dl.ID) == 0 {
+			id, err := exe.DataStore.AddFunctionDeadLetter(exe.BaseName, dl)
+			if err != nil {
+				log.Println("error adding function dead letter: ", err)
 				return
 			}
+			dl.ID = id
+		} else if err := exe.DataStore.UpdateFunctionDeadLetter(exe.BaseName, dl); err != nil {
+			log.Println("error updating function dead letter: ", err)
+			return
+		}
 
-			ids = append(ids, fn.ID)
+		if !dl.Pending {
+			return
 		}
 
-		sub.PubSub.SetTyped(key, ids)
+		time.Sleep(time.Until(dl.NextAttempt))
+
+		var ok bool
+		if dl, ok = sub.claim(exe, dl.ID); !ok {
+			return
+		}
 	}
+}
 
-	for _, id := range ids {
-		var fn internal.ExecData
-		if err := sub.PubSub.GetTyped("fn_"+id, &fn); err != nil {
-			log.Println("error getting function out of cache: ", err)
+// claim returns the pending event once its next attempt is due unless
+// another instance attempts it. The next attempt is pushed back past the
+// run's timeout, the event is resumed then if the instance stopped.
+func (sub *Subscriber) claim(exe ExecutionEnvironment, id string) (internal.FunctionDeadLetter, bool) {
+	limits := exe.Data.Limits.Within(exe.BaseLimits)
+	timeout := limits.TimeoutDuration() + time.Minute
+
+	key := "function_dead_letter_" + id
+	if sub.Locker != nil {
+		ok, err := sub.Locker.TryLock(key, timeout)
+		if err != nil {
+			log.Println("error locking function dead letter: ", err)
+			return internal.FunctionDeadLetter{}, false
+		} else if !ok {
+			return internal.FunctionDeadLetter{}, false
+		}
+		defer sub.Locker.Unlock(key)
+	}
+
+	// the event might have been attempted or replayed since
+	dl, err := exe.DataStore.GetFunctionDeadLetter(exe.BaseName, id)
+	if err != nil || !dl.Pending || dl.NextAttempt.After(time.Now()) {
+		return dl, false
+	}
+
+	claimed := dl
+	claimed.NextAttempt = time.Now().Add(timeout)
+	if err := exe.DataStore.UpdateFunctionDeadLetter(exe.BaseName, claimed); err != nil {
+		log.Println("error updating function dead letter: ", err)
+		return dl, false
+	}
+	return dl, true
+}
+
+// ScheduleRetries resumes the pending events of all bases, i.e. the ones
+// waiting for their next attempt when the server stopped, right away and on
+// every interval until stop receives.
+func (sub *Subscriber) ScheduleRetries(interval time.Duration, stop chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		bases, err := sub.Store.ListDatabases()
+		if err != nil {
+			log.Println("error listing bases for function retries: ", err)
+		}
+
+		for _, conf := range bases {
+			if err := sub.RetryDue(conf); err != nil {
+				log.Println("error retrying function events: ", err)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
 			return
 		}
+	}
+}
 
+// RetryDue attempts the base's pending events whose next attempt is due
+func (sub *Subscriber) RetryDue(conf internal.BaseConfig) error {
+	due, err := sub.Store.ListDueFunctionDeadLetters(conf.Name, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, dl := range due {
+		fn, err := sub.Store.GetFunctionByID(conf.Name, dl.FunctionID)
+		if err != nil {
+			log.Printf("cannot find function %s of the pending event %s: %v", dl.FunctionID, dl.ID, err)
+			continue
+		}
+
+		exe := sub.GetBaseEnv(conf)
+		exe.Auth = dl.Auth
 		exe.Data = fn
-		go func(ex ExecutionEnvironment) {
-			if err := ex.Execute(msg); err != nil {
-				log.Printf(`executing "%s" function failed: %v"`, ex.Data.FunctionName, err)
+
+		go func(id string) {
+			if dl, ok := sub.claim(exe, id); ok {
+				sub.attempt(exe, dl)
 			}
-		}(exe)
+		}(dl.ID)
+	}
+	return nil
+}
+
+// functionsByTrigger returns the functions of a trigger. They're kept in
+// memory, the high-frequency events would otherwise read them each time.
+func (sub *Subscriber) functionsByTrigger(exe ExecutionEnvironment, trigger string) ([]internal.ExecData, error) {
+	key := fmt.Sprintf("%s:%s", exe.BaseName, trigger)
+
+	sub.mu.Lock()
+	tf, ok := sub.triggers[key]
+	sub.mu.Unlock()
+
+	if ok && time.Now().Before(tf.expires) {
+		return tf.funcs, nil
+	}
+
+	funcs, err := exe.DataStore.ListFunctionsByTrigger(exe.BaseName, trigger)
+	if err != nil {
+		return nil, err
+	}
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.triggers == nil {
+		sub.triggers = make(map[string]triggerFunctions)
 	}
+	sub.triggers[key] = triggerFunctions{funcs: funcs, expires: time.Now().Add(triggerCacheTTL)}
+	return funcs, nil
 }
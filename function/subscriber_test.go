@@ -0,0 +1,214 @@
+package function
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// deadLetterStore records the runs and dead letters
+type deadLetterStore struct {
+	internal.Persister
+
+	mu          sync.Mutex
+	runs        int
+	deadLetters map[string]internal.FunctionDeadLetter
+	fn          internal.ExecData
+}
+
+func (ds *deadLetterStore) RanFunction(dbName, id string, rh internal.ExecHistory) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.runs++
+	return nil
+}
+
+func (ds *deadLetterStore) AddFunctionDeadLetter(dbName string, dl internal.FunctionDeadLetter) (string, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	dl.ID = fmt.Sprintf("dl%d", len(ds.deadLetters)+1)
+	ds.deadLetters[dl.ID] = dl
+	return dl.ID, nil
+}
+
+func (ds *deadLetterStore) UpdateFunctionDeadLetter(dbName string, dl internal.FunctionDeadLetter) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.deadLetters[dl.ID] = dl
+	return nil
+}
+
+func (ds *deadLetterStore) GetFunctionDeadLetter(dbName, id string) (internal.FunctionDeadLetter, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	dl, ok := ds.deadLetters[id]
+	if !ok {
+		return dl, errors.New("dead letter not found")
+	}
+	return dl, nil
+}
+
+func (ds *deadLetterStore) ListDueFunctionDeadLetters(dbName string, now time.Time) ([]internal.FunctionDeadLetter, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	var due []internal.FunctionDeadLetter
+	for _, dl := range ds.deadLetters {
+		if dl.Pending && !dl.NextAttempt.After(now) {
+			due = append(due, dl)
+		}
+	}
+	return due, nil
+}
+
+func (ds *deadLetterStore) DeleteFunctionDeadLetter(dbName, id string) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	delete(ds.deadLetters, id)
+	return nil
+}
+
+func (ds *deadLetterStore) ListDatabases() ([]internal.BaseConfig, error) {
+	return []internal.BaseConfig{{Name: "testdb"}}, nil
+}
+
+func (ds *deadLetterStore) GetFunctionByID(dbName, id string) (internal.ExecData, error) {
+	return ds.fn, nil
+}
+
+// letters returns the saved events once the runs completed
+func (ds *deadLetterStore) letters() []internal.FunctionDeadLetter {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	var list []internal.FunctionDeadLetter
+	for _, dl := range ds.deadLetters {
+		list = append(list, dl)
+	}
+	return list
+}
+
+func TestRunRetries(t *testing.T) {
+	sub := &Subscriber{
+		Backoff: func(internal.RetryPolicy, int) time.Duration { return time.Millisecond },
+	}
+
+	tables := []struct {
+		name        string
+		code        string
+		runs        int
+		deadLetters int
+	}{
+		{"succeeds", `function handle() {}`, 1, 0},
+		{"succeeds on retry", `function handle() { if (check(cache.inc("runs")) < 2) { throw new Error("again"); } }`, 2, 0},
+		{"dead letter", `function handle() { throw new Error("always"); }`, 3, 1},
+	}
+
+	for _, tt := range tables {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := &deadLetterStore{deadLetters: make(map[string]internal.FunctionDeadLetter)}
+			exe := ExecutionEnvironment{
+				Auth:      internal.Auth{AccountID: "acct1"},
+				BaseName:  "testdb",
+				DataStore: ds,
+				Volatile:  &memVolatile{values: make(map[string]string)},
+				Data: internal.ExecData{
+					ID:    "fn1",
+					Code:  `function check(res) { return res.content; }` + tt.code,
+					Retry: internal.RetryPolicy{MaxAttempts: 3},
+				},
+			}
+
+			msg := internal.Command{Type: "custom", Data: "payload"}
+			sub.Run(exe, msg)
+
+			// the runs are saved in the background
+			time.Sleep(50 * time.Millisecond)
+
+			ds.mu.Lock()
+			runs := ds.runs
+			ds.mu.Unlock()
+
+			if runs != tt.runs {
+				t.Errorf("expected %d runs got %d", tt.runs, runs)
+			}
+
+			list := ds.letters()
+			if len(list) != tt.deadLetters {
+				t.Fatalf("expected %d dead letters got %v", tt.deadLetters, list)
+			} else if tt.deadLetters == 0 {
+				return
+			}
+
+			dl := list[0]
+			if dl.Attempts != 3 || dl.Pending || dl.Command.Data != msg.Data || dl.Auth.AccountID != "acct1" {
+				t.Errorf("expected the command and auth after 3 attempts got %v", dl)
+			}
+		})
+	}
+}
+
+func TestScheduleRetriesResumesPendingEvents(t *testing.T) {
+	ds := &deadLetterStore{
+		deadLetters: make(map[string]internal.FunctionDeadLetter),
+		fn: internal.ExecData{
+			ID:    "fn1",
+			Code:  `function handle(evt) { if (evt.data === "fail") { throw new Error("always"); } }`,
+			Retry: internal.RetryPolicy{MaxAttempts: 3},
+		},
+	}
+
+	// the events left pending by a stopped server
+	ds.deadLetters["dl1"] = internal.FunctionDeadLetter{
+		ID:          "dl1",
+		FunctionID:  "fn1",
+		Command:     internal.Command{Type: "custom", Data: "ok"},
+		Attempts:    1,
+		Pending:     true,
+		NextAttempt: time.Now(),
+	}
+	ds.deadLetters["dl2"] = internal.FunctionDeadLetter{
+		ID:          "dl2",
+		FunctionID:  "fn1",
+		Command:     internal.Command{Type: "custom", Data: "fail"},
+		Attempts:    1,
+		Pending:     true,
+		NextAttempt: time.Now(),
+	}
+
+	sub := &Subscriber{
+		Backoff: func(internal.RetryPolicy, int) time.Duration { return time.Millisecond },
+		Store:   ds,
+		GetBaseEnv: func(conf internal.BaseConfig) ExecutionEnvironment {
+			return ExecutionEnvironment{BaseName: conf.Name, DataStore: ds}
+		},
+	}
+
+	stop := make(chan bool)
+	defer close(stop)
+
+	go sub.ScheduleRetries(time.Hour, stop)
+
+	var list []internal.FunctionDeadLetter
+	for i := 0; i < 50; i++ {
+		time.Sleep(20 * time.Millisecond)
+
+		list = ds.letters()
+		if len(list) == 1 && !list[0].Pending {
+			break
+		}
+	}
+
+	if len(list) != 1 || list[0].ID != "dl2" || list[0].Pending || list[0].Attempts != 3 {
+		t.Errorf("expected the succeeding event to be removed and the failing one to be a dead letter after 3 attempts got %v", list)
+	}
+}
@@ -0,0 +1,183 @@
+package function
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// tails streams the logs of the functions' runs
+var tails = newTailHub(nil)
+
+// tailHub sends the logs to the tails of this server. With a pubsub, the
+// logs go through it and the tails receive the runs of all the servers.
+type tailHub struct {
+	sync.RWMutex
+	subs map[string]map[chan internal.FunctionLog]bool
+
+	pubsub internal.PubSuber
+	// closes the pubsub subscription of each tailed function
+	closes map[string]chan bool
+	// the logs are published in order by a single goroutine
+	out chan internal.Command
+}
+
+func newTailHub(pubsub internal.PubSuber) *tailHub {
+	h := &tailHub{
+		subs:   make(map[string]map[chan internal.FunctionLog]bool),
+		pubsub: pubsub,
+		closes: make(map[string]chan bool),
+	}
+
+	if pubsub != nil {
+		h.out = make(chan internal.Command, 1024)
+		go h.send()
+	}
+	return h
+}
+
+// ShareTails sends the logs through the pubsub so the tails of a server
+// receive the runs of the other servers, like the realtime events.
+func ShareTails(pubsub internal.PubSuber) {
+	tails = newTailHub(pubsub)
+}
+
+// Tail returns the logs of a function's runs as they're written, until
+// stop is called. The logs are dropped when the receiver is too slow.
+func Tail(base, functionID string) (logs <-chan internal.FunctionLog, stop func()) {
+	return tails.tail(base, functionID)
+}
+
+func (h *tailHub) tail(base, functionID string) (<-chan internal.FunctionLog, func()) {
+	key := tailChannel(base, functionID)
+	c := make(chan internal.FunctionLog, 256)
+
+	h.Lock()
+	if _, ok := h.subs[key]; !ok {
+		h.subs[key] = make(map[chan internal.FunctionLog]bool)
+
+		if h.pubsub != nil {
+			h.closes[key] = make(chan bool)
+			go h.receive(key, h.closes[key])
+		}
+	}
+	h.subs[key][c] = true
+	h.Unlock()
+
+	stop := func() {
+		h.Lock()
+		defer h.Unlock()
+
+		delete(h.subs[key], c)
+		if len(h.subs[key]) == 0 {
+			delete(h.subs, key)
+
+			if done, ok := h.closes[key]; ok {
+				delete(h.closes, key)
+				close(done)
+			}
+		}
+	}
+	return c, stop
+}
+
+// tailChannel is the pubsub channel of a function's logs, the realtime
+// clients cannot join it
+func tailChannel(base, functionID string) string {
+	return fmt.Sprintf("%s%s:%s", internal.TailChannelPrefix, base, functionID)
+}
+
+func (h *tailHub) publish(base, functionID string, l internal.FunctionLog) {
+	if h.pubsub == nil {
+		h.deliver(tailChannel(base, functionID), l)
+		return
+	}
+
+	b, err := json.Marshal(l)
+	if err != nil {
+		log.Println("error converting log to JSON: ", err)
+		return
+	}
+
+	msg := internal.Command{
+		Type:    internal.MsgTypeFunctionLog,
+		Channel: tailChannel(base, functionID),
+		Data:    string(b),
+	}
+
+	// the run does not wait for the pubsub
+	select {
+	case h.out <- msg:
+	default:
+	}
+}
+
+func (h *tailHub) send() {
+	for msg := range h.out {
+		if err := h.pubsub.Broadcast(msg); err != nil {
+			log.Println("error publishing function log: ", err)
+		}
+	}
+}
+
+// receive sends the logs of the pubsub to the function's tails until close
+// is closed
+func (h *tailHub) receive(key string, close chan bool) {
+	receiver := make(chan internal.Command)
+	go h.pubsub.Subscribe(receiver, "", key, close)
+
+	for {
+		select {
+		case msg := <-receiver:
+			if msg.Type != internal.MsgTypeFunctionLog {
+				continue
+			}
+
+			var l internal.FunctionLog
+			if err := json.Unmarshal([]byte(msg.Data), &l); err != nil {
+				log.Println("error parsing function log: ", err)
+				continue
+			}
+
+			h.deliver(key, l)
+		case <-close:
+			return
+		}
+	}
+}
+
+func (h *tailHub) deliver(key string, l internal.FunctionLog) {
+	h.RLock()
+	defer h.RUnlock()
+
+	for c := range h.subs[key] {
+		select {
+		case c <- l:
+		default:
+		}
+	}
+}
+
+// logf adds a line to the run's output and sends it to the live tails
+func (env *ExecutionEnvironment) logf(level, format string, a ...interface{}) {
+	l := internal.FunctionLog{
+		Time:    time.Now(),
+		Level:   level,
+		Message: fmt.Sprintf(format, a...),
+	}
+
+	line := l.Message
+	if level != internal.LogInfo {
+		line = fmt.Sprintf("[%s] %s", level, l.Message)
+	}
+
+	env.CurrentRun.Output = append(env.CurrentRun.Output, line)
+	env.CurrentRun.Logs = append(env.CurrentRun.Logs, l)
+	env.charge(len(line) + len(l.Message))
+
+	tails.publish(env.BaseName, env.Data.ID, l)
+}
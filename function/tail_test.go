@@ -0,0 +1,155 @@
+package function
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestLogLevels(t *testing.T) {
+	rl := &runLog{runs: make(chan internal.ExecHistory, 1)}
+
+	logs, stop := Tail("testdb", "fn-tail")
+	defer stop()
+
+	env := &ExecutionEnvironment{
+		BaseName:  "testdb",
+		DataStore: rl,
+		Data: internal.ExecData{
+			ID: "fn-tail",
+			Code: `function handle() {
+				log("plain");
+				log.info("info");
+				log.warn("careful");
+				log.error("oops");
+			}`,
+		},
+	}
+
+	env.Execute(internal.Command{Type: "test"})
+
+	var rh internal.ExecHistory
+	select {
+	case rh = <-rl.runs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the run was never recorded")
+	}
+
+	expected := []internal.FunctionLog{
+		{Level: internal.LogInfo, Message: "plain"},
+		{Level: internal.LogInfo, Message: "info"},
+		{Level: internal.LogWarn, Message: "careful"},
+		{Level: internal.LogError, Message: "oops"},
+	}
+
+	var got []internal.FunctionLog
+	for _, l := range rh.Logs {
+		for _, e := range expected {
+			if l.Level == e.Level && l.Message == e.Message {
+				got = append(got, l)
+			}
+		}
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected the %d logged lines got %v", len(expected), rh.Logs)
+	}
+
+	found := false
+	for _, line := range rh.Output {
+		if line == "[warn] careful" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected the warning in the output got %v", rh.Output)
+	}
+
+	if len(logs) != len(rh.Logs) {
+		t.Errorf("expected %d tailed logs got %d", len(rh.Logs), len(logs))
+	}
+}
+
+func TestTailStop(t *testing.T) {
+	logs, stop := Tail("testdb", "fn-stop")
+	stop()
+
+	env := &ExecutionEnvironment{BaseName: "testdb", Data: internal.ExecData{ID: "fn-stop"}}
+	env.logf(internal.LogInfo, "after stop")
+
+	if len(logs) != 0 {
+		t.Errorf("expected no logs after stop got %d", len(logs))
+	}
+}
+
+// tailPubSub only implements the pubsub part of the PubSuber shared by
+// the test servers
+type tailPubSub struct {
+	internal.PubSuber
+
+	sync.Mutex
+	subs map[string][]chan internal.Command
+}
+
+func (ps *tailPubSub) Subscribe(send chan internal.Command, token, channel string, close chan bool) {
+	ch := make(chan internal.Command, 10)
+
+	ps.Lock()
+	ps.subs[channel] = append(ps.subs[channel], ch)
+	ps.Unlock()
+
+	for {
+		select {
+		case msg := <-ch:
+			select {
+			case send <- msg:
+			case <-close:
+				return
+			}
+		case <-close:
+			return
+		}
+	}
+}
+
+func (ps *tailPubSub) Broadcast(msg internal.Command) error {
+	ps.Lock()
+	defer ps.Unlock()
+
+	for _, ch := range ps.subs[msg.Channel] {
+		ch <- msg
+	}
+	return nil
+}
+
+func TestTailOtherServers(t *testing.T) {
+	ps := &tailPubSub{subs: make(map[string][]chan internal.Command)}
+	runner, tailer := newTailHub(ps), newTailHub(ps)
+
+	logs, stop := tailer.tail("testdb", "fn-shared")
+	defer stop()
+
+	// the subscription starts in the background
+	for i := 0; i < 100; i++ {
+		ps.Lock()
+		n := len(ps.subs[tailChannel("testdb", "fn-shared")])
+		ps.Unlock()
+
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	runner.publish("testdb", "fn-shared", internal.FunctionLog{Level: internal.LogInfo, Message: "from the runner"})
+
+	select {
+	case l := <-logs:
+		if l.Message != "from the runner" {
+			t.Errorf("expected the runner's log got %v", l)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the log of the other server was never tailed")
+	}
+}
@@ -1,7 +1,16 @@
 package staticbackend
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/staticbackendhq/core/function"
 	"github.com/staticbackendhq/core/internal"
@@ -26,11 +35,24 @@ func (f *functions) add(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	switch data.Kind {
+	case "", internal.FunctionKindFunction:
+	case internal.FunctionKindModule:
+		// modules are only loaded by require()
+		data.TriggerTopic = ""
+	default:
+		http.Error(w, fmt.Sprintf("invalid kind %q", data.Kind), http.StatusBadRequest)
+		return
+	}
+
 	if _, err := datastore.AddFunction(conf.Name, data); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// channel_auth functions are cached with the channel rules
+	channelAuths.forget(conf.Name)
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -45,6 +67,9 @@ func (f *functions) update(w http.ResponseWriter, r *http.Request) {
 		ID      string `json:"id"`
 		Code    string `json:"code"`
 		Trigger string `json:"trigger"`
+		// the limits and retry policy are kept when not specified
+		Limits *internal.FunctionLimits `json:"limits"`
+		Retry  *internal.RetryPolicy    `json:"retry"`
 	})
 	if err := parseBody(r.Body, &data); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -56,6 +81,22 @@ func (f *functions) update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if data.Limits != nil {
+		if err := datastore.UpdateFunctionLimits(conf.Name, data.ID, *data.Limits); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if data.Retry != nil {
+		if err := datastore.UpdateFunctionRetry(conf.Name, data.ID, *data.Retry); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	channelAuths.forget(conf.Name)
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -72,6 +113,8 @@ func (f *functions) del(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	channelAuths.forget(conf.Name)
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -95,13 +138,22 @@ func (f *functions) exec(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
+	} else if fn.IsModule() {
+		http.Error(w, "modules cannot be executed", http.StatusBadRequest)
+		return
 	}
 
 	env := &function.ExecutionEnvironment{
-		Auth:      auth,
-		BaseName:  conf.Name,
-		DataStore: datastore,
-		Data:      fn,
+		Auth:          auth,
+		BaseName:      conf.Name,
+		BaseID:        conf.ID,
+		DataStore:     datastore,
+		Volatile:      volatile,
+		Storer:        storer,
+		Mailer:        emailer,
+		Data:          fn,
+		BaseLimits:    conf.Settings.Functions,
+		FetchSettings: conf.Settings.Fetch,
 	}
 
 	if err := env.Execute(r); err != nil {
@@ -112,6 +164,91 @@ func (f *functions) exec(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// functionTest is the code of a function and the payload to dry run it with
+type functionTest struct {
+	Code string `json:"code"`
+	// Trigger is the topic the function is tested for, "web" by default
+	Trigger string          `json:"trigger"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// test dry runs the submitted code, the writes are returned as side effects
+// instead of being applied
+func (f *functions) test(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var data functionTest
+	if err := parseBody(r.Body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := testFunction(conf, auth, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respond(w, http.StatusOK, res)
+}
+
+// testFunction dry runs the code with the payload as its trigger would
+// send it
+func testFunction(conf internal.BaseConfig, auth internal.Auth, data functionTest) (function.DryRunResult, error) {
+	if len(strings.TrimSpace(data.Code)) == 0 {
+		return function.DryRunResult{}, errors.New("the code is required")
+	}
+
+	if len(data.Trigger) == 0 {
+		data.Trigger = "web"
+	}
+
+	var payload interface{}
+	if data.Trigger == "web" {
+		req, err := http.NewRequest(http.MethodPost, "/fn/exec/test", bytes.NewReader(data.Payload))
+		if err != nil {
+			return function.DryRunResult{}, err
+		}
+		if len(data.Payload) > 0 {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		payload = req
+	} else {
+		msg := internal.Command{Type: data.Trigger, Data: string(data.Payload)}
+		if msg.IsDBEvent() {
+			var evt internal.DocumentEvent
+			if err := json.Unmarshal(data.Payload, &evt); err != nil {
+				return function.DryRunResult{}, fmt.Errorf("the payload of a database event should be a document event: %v", err)
+			}
+		}
+		payload = msg
+	}
+
+	env := &function.ExecutionEnvironment{
+		Auth:     auth,
+		BaseName: conf.Name,
+		BaseID:   conf.ID,
+		// the writes are captured by the dry run
+		DataStore: datastore,
+		Volatile:  volatile,
+		// the code is neither saved nor versioned, it's compiled for this
+		// run only
+		Data: internal.ExecData{
+			FunctionName: "test",
+			TriggerTopic: data.Trigger,
+			Code:         data.Code,
+		},
+		BaseLimits:    conf.Settings.Functions,
+		FetchSettings: conf.Settings.Fetch,
+	}
+
+	return env.DryRun(payload), nil
+}
+
 func (f *functions) list(w http.ResponseWriter, r *http.Request) {
 	conf, _, err := middleware.Extract(r, false)
 	if err != nil {
@@ -145,3 +282,394 @@ func (f *functions) info(w http.ResponseWriter, r *http.Request) {
 
 	respond(w, http.StatusOK, fn)
 }
+
+func (f *functions) versions(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	id := getURLPart(r.URL.Path, 3)
+
+	versions, err := datastore.ListFunctionVersions(conf.Name, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if versions == nil {
+		versions = make([]internal.FunctionVersion, 0)
+	}
+
+	respond(w, http.StatusOK, versions)
+}
+
+// diff returns the changes between the "from" and "to" versions, the
+// current version is used when "to" is not specified
+func (f *functions) diff(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	id := getURLPart(r.URL.Path, 3)
+
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "invalid from version", http.StatusBadRequest)
+		return
+	}
+
+	to, _ := strconv.Atoi(r.URL.Query().Get("to"))
+
+	lines, err := functionDiff(conf.Name, id, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respond(w, http.StatusOK, lines)
+}
+
+func (f *functions) rollback(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	data := new(struct {
+		ID      string `json:"id"`
+		Version int    `json:"version"`
+	})
+	if err := parseBody(r.Body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := rollbackFunction(conf.Name, data.ID, data.Version); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respond(w, http.StatusOK, true)
+}
+
+// pin makes the trigger run a specific version, version 0 unpins it
+func (f *functions) pin(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	data := new(struct {
+		ID      string `json:"id"`
+		Version int    `json:"version"`
+	})
+	if err := parseBody(r.Body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := pinFunction(conf.Name, data.ID, data.Version); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respond(w, http.StatusOK, true)
+}
+
+// runs returns a page of the function's runs. The "status", "from", "to"
+// (RFC 3339) and "version" query string parameters filter them, "page" and
+// "size" paginate them.
+func (f *functions) runs(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := parseRunFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	runs, err := datastore.ListFunctionRuns(conf.Name, getURLPart(r.URL.Path, 3), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if runs.Results == nil {
+		runs.Results = make([]internal.ExecHistory, 0)
+	}
+
+	respond(w, http.StatusOK, runs)
+}
+
+// tail streams the logs of the function's runs as Server-Sent Events
+func (f *functions) tail(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	tailFunction(w, r, conf.Name, getURLPart(r.URL.Path, 3))
+}
+
+// tailFunction streams the logs of a function until the client disconnects.
+// The logs of the runs on the other servers go through the cache's pubsub.
+func tailFunction(w http.ResponseWriter, r *http.Request, dbName, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is unsupported with your connection.", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	logs, stop := function.Tail(dbName, id)
+	defer stop()
+
+	// the client knows the stream is open before the first log
+	fmt.Fprint(w, ": tailing\n\n")
+	flusher.Flush()
+
+	for {
+		select {
+		case l := <-logs:
+			b, err := json.Marshal(l)
+			if err != nil {
+				log.Println("error converting log to JSON: ", err)
+				continue
+			}
+
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// parseRunFilter returns the run filter of the query string parameters
+func parseRunFilter(q url.Values) (filter internal.RunFilter, err error) {
+	filter.Status = q.Get("status")
+	switch filter.Status {
+	case "", internal.RunStatusSuccess, internal.RunStatusFailed:
+	default:
+		return filter, fmt.Errorf("invalid status %q", filter.Status)
+	}
+
+	if v := q.Get("from"); len(v) > 0 {
+		if filter.From, err = parseRunTime(v, false); err != nil {
+			return filter, fmt.Errorf("invalid from date: %v", err)
+		}
+	}
+	if v := q.Get("to"); len(v) > 0 {
+		if filter.To, err = parseRunTime(v, true); err != nil {
+			return filter, fmt.Errorf("invalid to date: %v", err)
+		}
+	}
+
+	filter.Version, _ = strconv.Atoi(q.Get("version"))
+	filter.Page, _ = strconv.ParseInt(q.Get("page"), 10, 64)
+	filter.Size, _ = strconv.ParseInt(q.Get("size"), 10, 64)
+	return filter.WithDefaults(), nil
+}
+
+// parseRunTime parses a RFC 3339 time or a date as sent by the web UI's date
+// inputs. A date used as an upper bound includes the whole day.
+func parseRunTime(v string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		if endOfDay {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// pruneFunctionRuns deletes the function runs older than their base's
+// retention
+func pruneFunctionRuns() error {
+	bases, err := datastore.ListDatabases()
+	if err != nil {
+		return err
+	}
+
+	for _, base := range bases {
+		retention := base.Settings.FunctionLogs.WithDefaults().Retention()
+		if err := datastore.DeleteFunctionRuns(base.Name, time.Now().Add(-retention)); err != nil {
+			log.Printf("error deleting the function runs of %s: %v", base.Name, err)
+		}
+	}
+	return nil
+}
+
+// scheduleFunctionRunsRetention prunes the function runs every interval
+func scheduleFunctionRunsRetention(interval time.Duration, stop chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := pruneFunctionRuns(); err != nil {
+				log.Println("error pruning function runs: ", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// deadLetters lists the events whose runs failed all their attempts, the
+// "fn" query string parameter filters them by function. A DELETE discards
+// the dead letter "id".
+func (f *functions) deadLetters(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := datastore.DeleteFunctionDeadLetter(conf.Name, r.URL.Query().Get("id")); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		respond(w, http.StatusOK, true)
+		return
+	}
+
+	list, err := datastore.ListFunctionDeadLetters(conf.Name, r.URL.Query().Get("fn"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if list == nil {
+		list = make([]internal.FunctionDeadLetter, 0)
+	}
+
+	respond(w, http.StatusOK, list)
+}
+
+func (f *functions) replayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := replayDeadLetter(conf, r.URL.Query().Get("id")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respond(w, http.StatusOK, true)
+}
+
+// replayDeadLetter runs the current version of the function for the dead
+// letter's event with a fresh set of attempts. The event is a new dead
+// letter if they all fail again.
+func replayDeadLetter(conf internal.BaseConfig, id string) error {
+	dl, err := datastore.GetFunctionDeadLetter(conf.Name, id)
+	if err != nil {
+		return err
+	}
+
+	fn, err := datastore.GetFunctionByID(conf.Name, dl.FunctionID)
+	if err != nil {
+		return fmt.Errorf("cannot find the function of this dead letter: %v", err)
+	}
+
+	if err := datastore.DeleteFunctionDeadLetter(conf.Name, dl.ID); err != nil {
+		return err
+	}
+
+	exe := functionEnv(conf)
+	exe.Auth = dl.Auth
+	exe.Data = fn
+
+	go functionsSubscriber.Run(exe, dl.Command)
+	return nil
+}
+
+// functionEnv returns the environment of the base's functions, the run sets
+// its auth and function
+func functionEnv(conf internal.BaseConfig) function.ExecutionEnvironment {
+	return function.ExecutionEnvironment{
+		BaseName:      conf.Name,
+		BaseID:        conf.ID,
+		DataStore:     datastore,
+		Volatile:      volatile,
+		Storer:        storer,
+		Mailer:        emailer,
+		BaseLimits:    conf.Settings.Functions,
+		FetchSettings: conf.Settings.Fetch,
+	}
+}
+
+// functionDiff returns the changes between two versions of a function, to
+// defaults to the current version
+func functionDiff(dbName, id string, from, to int) ([]internal.DiffLine, error) {
+	fn, err := datastore.GetFunctionByID(dbName, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if to == 0 {
+		to = fn.Version
+	}
+
+	fromVersion, err := datastore.GetFunctionVersion(dbName, id, from)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find version %d: %v", from, err)
+	}
+
+	toVersion, err := datastore.GetFunctionVersion(dbName, id, to)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find version %d: %v", to, err)
+	}
+
+	return internal.DiffLines(fromVersion.Code, toVersion.Code), nil
+}
+
+// rollbackFunction saves the code and trigger of a previous version as a new
+// version
+func rollbackFunction(dbName, id string, version int) error {
+	v, err := datastore.GetFunctionVersion(dbName, id, version)
+	if err != nil {
+		return fmt.Errorf("cannot find version %d: %v", version, err)
+	}
+
+	return datastore.UpdateFunction(dbName, id, v.Code, v.TriggerTopic)
+}
+
+// pinFunction pins a function to one of its versions, 0 unpins it
+func pinFunction(dbName, id string, version int) error {
+	if version > 0 {
+		if _, err := datastore.GetFunctionVersion(dbName, id, version); err != nil {
+			return fmt.Errorf("cannot find version %d: %v", version, err)
+		}
+	}
+
+	return datastore.PinFunctionVersion(dbName, id, version)
+}
@@ -1,12 +1,15 @@
 package staticbackend
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/staticbackendhq/core/function"
 	"github.com/staticbackendhq/core/internal"
 )
 
@@ -134,3 +137,246 @@ func TestFunctionsExecuteDBOperations(t *testing.T) {
 		t.Errorf("found error in function exec log: %v", errorLines)
 	}
 }
+
+func TestFunctionVersionsRollbackAndPin(t *testing.T) {
+	data := internal.ExecData{
+		FunctionName: "versioned",
+		Code:         "function handle() { log('v1'); }",
+		TriggerTopic: "web",
+	}
+	if resp := dbReq(t, funexec.add, "POST", "/", data, true); resp.StatusCode != http.StatusOK {
+		t.Fatalf("add: expected status 200 got %s", resp.Status)
+	}
+
+	fn, err := datastore.GetFunctionByName(dbName, "versioned")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := datastore.UpdateFunction(dbName, fn.ID, "function handle() { log('v2'); }", "db_created"); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, err := functionDiff(dbName, fn.ID, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(lines) != 2 || lines[0].Op != internal.DiffRemoved || lines[1].Op != internal.DiffAdded {
+		t.Errorf("expected 1 removed and 1 added line got %v", lines)
+	}
+
+	rollback := map[string]interface{}{"id": fn.ID, "version": 1}
+	if resp := dbReq(t, funexec.rollback, "POST", "/fn/rollback", rollback, true); resp.StatusCode != http.StatusOK {
+		t.Fatalf("rollback: expected status 200 got %s", resp.Status)
+	}
+
+	pin := map[string]interface{}{"id": fn.ID, "version": 2}
+	if resp := dbReq(t, funexec.pin, "POST", "/fn/pin", pin, true); resp.StatusCode != http.StatusOK {
+		t.Fatalf("pin: expected status 200 got %s", resp.Status)
+	}
+
+	fn, err = datastore.GetFunctionByID(dbName, fn.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if fn.Version != 3 || !strings.Contains(fn.Code, "v1") {
+		t.Errorf("expected the v1 code as version 3 got %d %s", fn.Version, fn.Code)
+	} else if fn.TriggerTopic != "web" {
+		t.Errorf("expected the v1 trigger web got %s", fn.TriggerTopic)
+	} else if fn.PinnedVersion != 2 {
+		t.Errorf("expected version 2 to be pinned got %d", fn.PinnedVersion)
+	}
+
+	versions, err := datastore.ListFunctionVersions(dbName, fn.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(versions) != 3 {
+		t.Errorf("expected 3 versions got %d", len(versions))
+	}
+}
+
+func TestFunctionDeadLetters(t *testing.T) {
+	data := internal.ExecData{
+		FunctionName: "failing",
+		Code:         "function handle() { throw new Error('always failing'); }",
+		TriggerTopic: "custom-event",
+		Retry:        internal.RetryPolicy{MaxAttempts: 2},
+	}
+	if resp := dbReq(t, funexec.add, "POST", "/", data, true); resp.StatusCode != http.StatusOK {
+		t.Fatalf("add: expected status 200 got %s", resp.Status)
+	}
+
+	fn, err := datastore.GetFunctionByName(dbName, "failing")
+	if err != nil {
+		t.Fatal(err)
+	} else if fn.Retry.MaxAttempts != 2 {
+		t.Fatalf("expected 2 max attempts got %d", fn.Retry.MaxAttempts)
+	}
+
+	exe := function.ExecutionEnvironment{
+		BaseName:  dbName,
+		DataStore: datastore,
+		Volatile:  volatile,
+		Data:      fn,
+	}
+
+	msg := internal.Command{Type: "custom-event", Data: `"payload"`}
+	functionsSubscriber.Run(exe, msg)
+
+	deadLetters := func() []internal.FunctionDeadLetter {
+		resp := dbReq(t, funexec.deadLetters, "GET", "/fn/deadletters?fn="+fn.ID, nil, true)
+		defer resp.Body.Close()
+
+		var list []internal.FunctionDeadLetter
+		if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+
+	list := deadLetters()
+	if len(list) != 1 || list[0].Attempts != 2 || list[0].Command.Data != msg.Data {
+		t.Fatalf("expected 1 dead letter after 2 attempts got %v", list)
+	}
+
+	resp := dbReq(t, funexec.replayDeadLetter, "POST", "/fn/deadletters/replay?id="+list[0].ID, nil, true)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	// the replay fails again and is a new dead letter
+	var replayed []internal.FunctionDeadLetter
+	for i := 0; i < 50; i++ {
+		time.Sleep(20 * time.Millisecond)
+
+		replayed = deadLetters()
+		if len(replayed) == 1 && replayed[0].ID != list[0].ID {
+			break
+		}
+	}
+
+	if len(replayed) != 1 || replayed[0].ID == list[0].ID {
+		t.Fatalf("expected the replayed event to be a new dead letter got %v", replayed)
+	}
+
+	resp = dbReq(t, funexec.deadLetters, "DELETE", "/fn/deadletters?id="+replayed[0].ID, nil, true)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	if list := deadLetters(); len(list) != 0 {
+		t.Errorf("expected the dead letter to be discarded got %v", list)
+	}
+}
+
+func TestFunctionRunsFilter(t *testing.T) {
+	data := internal.ExecData{
+		FunctionName: "runs-filter",
+		Code:         "function handle() { log.warn('hello'); }",
+		TriggerTopic: "web",
+	}
+	if resp := dbReq(t, funexec.add, "POST", "/", data, true); resp.StatusCode != http.StatusOK {
+		t.Fatalf("add: expected status 200 got %s", resp.Status)
+	}
+
+	fn, err := datastore.GetFunctionByName(dbName, "runs-filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		rh := internal.ExecHistory{
+			FunctionID: fn.ID,
+			Version:    fn.Version,
+			Started:    now.Add(time.Duration(-i) * time.Hour),
+			Completed:  now.Add(time.Duration(-i) * time.Hour),
+			Success:    i != 1,
+			Output:     []string{"[warn] hello"},
+			Logs:       []internal.FunctionLog{{Time: now, Level: internal.LogWarn, Message: "hello"}},
+		}
+		if err := datastore.RanFunction(dbName, fn.ID, rh); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs := func(qs string) internal.FunctionRuns {
+		resp := dbReq(t, funexec.runs, "GET", "/fn/runs/"+fn.ID+"?"+qs, nil, true)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected status 200 got %s", qs, GetResponseBody(t, resp))
+		}
+
+		var page internal.FunctionRuns
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		return page
+	}
+
+	if page := runs("status=failed"); page.Total != 1 || len(page.Results) != 1 || page.Results[0].Success {
+		t.Errorf("expected 1 failed run got %v", page)
+	} else if logs := page.Results[0].Logs; len(logs) != 1 || logs[0].Level != internal.LogWarn {
+		t.Errorf("expected the run's warning got %v", logs)
+	}
+
+	from := now.Add(-90 * time.Minute).UTC().Format(time.RFC3339)
+	if page := runs("from=" + from); page.Total != 2 {
+		t.Errorf("expected 2 runs since %s got %d", from, page.Total)
+	}
+
+	page := runs("size=2&page=2")
+	if page.Total != 3 || len(page.Results) != 1 || !page.Results[0].Started.Before(now.Add(-90*time.Minute)) {
+		t.Errorf("expected the oldest run on the second page got %v", page)
+	}
+
+	if resp := dbReq(t, funexec.runs, "GET", "/fn/runs/"+fn.ID+"?status=unknown", nil, true); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid status got %s", resp.Status)
+	}
+
+	if err := datastore.DeleteFunctionRuns(dbName, now.Add(-30*time.Minute)); err != nil {
+		t.Fatal(err)
+	} else if page := runs(""); page.Total != 1 {
+		t.Errorf("expected 1 run after the retention got %d", page.Total)
+	}
+}
+
+func TestFunctionDryRun(t *testing.T) {
+	data := functionTest{
+		Code: `function handle(body) {
+			const res = create("dryrun_tasks", {title: body.title});
+			if (!res.ok) throw new Error(res.content);
+			log.info("created", res.content.id);
+			return res.content;
+		}`,
+		Trigger: "web",
+		Payload: json.RawMessage(`{"title": "from a test"}`),
+	}
+
+	resp := dbReq(t, funexec.test, "POST", "/fn/test", data, true)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var res function.DryRunResult
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Success {
+		t.Fatalf("expected the dry run to succeed got %s: %v", res.Error, res.Output)
+	} else if len(res.SideEffects) != 1 || res.SideEffects[0].Type != "create" || res.SideEffects[0].Target != "dryrun_tasks" {
+		t.Fatalf("expected the create as side effect got %v", res.SideEffects)
+	}
+
+	doc, ok := res.Return.(map[string]interface{})
+	if !ok || doc["title"] != "from a test" {
+		t.Errorf("expected the created document returned got %v", res.Return)
+	}
+
+	data.Code = ""
+	if resp := dbReq(t, funexec.test, "POST", "/fn/test", data, true); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 without code got %s", resp.Status)
+	}
+}
@@ -65,3 +65,19 @@ type Customer struct {
 	MonthlyEmailSent int       `bson:"mes" json:"-"`
 	Created          time.Time `bson:"created" json:"created"`
 }
+
+// Invitation lets an account member invite someone to join their account
+type Invitation struct {
+	ID        string    `json:"id"`
+	AccountID string    `json:"accountId"`
+	Email     string    `json:"email"`
+	Role      int       `json:"role"`
+	Code      string    `json:"-"`
+	InvitedBy string    `json:"invitedBy"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+}
+
+func (inv Invitation) IsExpired() bool {
+	return time.Now().After(inv.Expires)
+}
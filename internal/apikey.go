@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+const (
+	// APIKeyPrefix identifies API keys in the Authorization header
+	APIKeyPrefix = "sbk_"
+
+	ScopeDBRead        = "db:read"
+	ScopeDBWrite       = "db:write"
+	ScopeDBDelete      = "db:delete"
+	ScopeStorageUpload = "storage:upload"
+	ScopeFnExec        = "fn:exec"
+)
+
+// APIKey is a named key minted by a root user for server-to-server access.
+//
+// Scopes are colon separated, i.e. "db:read:orders". A scope grants
+// everything below it, so "db:read" grants reads on all collections, and
+// a "*" segment matches any value.
+type APIKey struct {
+	ID        string    `json:"id"`
+	AccountID string    `json:"accountId"`
+	TokenID   string    `json:"tokenId"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"-"`
+	Scopes    []string  `json:"scopes"`
+	Expires   time.Time `json:"expires"`
+	LastUsed  time.Time `json:"lastUsed"`
+	Created   time.Time `json:"created"`
+}
+
+// IsExpired returns true if the key has an expiry date in the past. A zero
+// expiry means the key never expires.
+func (k APIKey) IsExpired() bool {
+	return !k.Expires.IsZero() && time.Now().After(k.Expires)
+}
+
+// Allows returns true if one of the key's scopes grants the requested scope
+func (k APIKey) Allows(scope string) bool {
+	if len(scope) == 0 {
+		return false
+	}
+
+	req := splitScope(scope)
+	for _, s := range k.Scopes {
+		if scopeMatch(splitScope(s), req) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitScope returns the scope's segments, a db collection is compared
+// without its permission suffix, i.e. orders_770_ is orders.
+func splitScope(scope string) []string {
+	parts := strings.Split(scope, ":")
+	if parts[0] == "db" && len(parts) > 2 && parts[2] != "*" {
+		parts[2] = CleanCollectionName(parts[2])
+	}
+	return parts
+}
+
+func scopeMatch(granted, req []string) bool {
+	if len(granted) > len(req) {
+		return false
+	}
+
+	for i, g := range granted {
+		if g != "*" && g != req[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// HashAPIKeySecret returns the value stored for an API key secret. Only the
+// hash is persisted, the secret is shown once at creation.
+func HashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseAPIKey splits a "sbk_{id}_{secret}" key into its id and secret
+func ParseAPIKey(key string) (id, secret string, ok bool) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(key, APIKeyPrefix), "_", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return
+	}
+	return parts[0], parts[1], true
+}
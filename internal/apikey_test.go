@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAPIKeyAllows(t *testing.T) {
+	key := APIKey{Scopes: []string{"db:read:orders", "db:*:logs", "storage", "db:read:invoices_700_"}}
+
+	tables := make(map[string]bool)
+	tables["db:read:orders"] = true
+	tables["db:write:orders"] = false
+	tables["db:read:users"] = false
+	tables["db:delete:logs"] = true
+	tables["storage:upload"] = true
+	tables["fn:exec:daily"] = false
+	tables["db:read:orders_770_"] = true
+	tables["db:write:logs_740_"] = true
+	tables[""] = false
+	tables["db:read:invoices"] = true
+
+	for scope, expected := range tables {
+		if ok := key.Allows(scope); ok != expected {
+			t.Errorf("%s: expected %v got %v", scope, expected, ok)
+		}
+	}
+}
+
+func TestAPIKeyExpiry(t *testing.T) {
+	key := APIKey{}
+	if key.IsExpired() {
+		t.Errorf("expected key without expiry to be valid")
+	}
+
+	key.Expires = time.Now().Add(-1 * time.Minute)
+	if !key.IsExpired() {
+		t.Errorf("expected key to be expired")
+	}
+}
+
+func TestParseAPIKey(t *testing.T) {
+	id, secret, ok := ParseAPIKey("sbk_abc123_s3cr3t_with_underscore")
+	if !ok {
+		t.Fatal("expected key to be valid")
+	} else if id != "abc123" || secret != "s3cr3t_with_underscore" {
+		t.Errorf("expected abc123 / s3cr3t_with_underscore got %s / %s", id, secret)
+	}
+
+	for _, invalid := range []string{"abc123_secret", "sbk_", "sbk_abc123", "sbk__secret"} {
+		if _, _, ok := ParseAPIKey(invalid); ok {
+			t.Errorf("expected %s to be invalid", invalid)
+		}
+	}
+}
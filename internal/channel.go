@@ -0,0 +1,31 @@
+package internal
+
+const (
+	ChannelJoin    = "join"
+	ChannelPublish = "publish"
+
+	// TriggerChannelAuth is the trigger of the functions deciding who can
+	// join and publish on channels. Their handle function receives
+	// {channel, op, auth} and returns true to allow the operation.
+	TriggerChannelAuth = "channel_auth"
+
+	// channelRulePrefix prefixes the rule name of channels, the rule's read
+	// condition is for joining and the write condition for publishing.
+	channelRulePrefix = "chan:"
+	// ChannelRuleDefault is the rule of channels without their own rule
+	ChannelRuleDefault = channelRulePrefix + "*"
+)
+
+// ChannelRuleName returns the rule name holding the channel's conditions
+func ChannelRuleName(channel string) string {
+	return channelRulePrefix + channel
+}
+
+// ChannelRuleEnv returns the variables available to channel rule conditions,
+// the channel name is available as doc.name.
+func ChannelRuleEnv(auth Auth, channel, op string) map[string]interface{} {
+	return RuleEnv(auth, map[string]interface{}{
+		"name": channel,
+		"op":   op,
+	})
+}
@@ -0,0 +1,26 @@
+package internal
+
+import "testing"
+
+func TestChannelRule(t *testing.T) {
+	auth := Auth{AccountID: "acct1", UserID: "user1", Role: 10}
+
+	if name := ChannelRuleName("room-42"); name != "chan:room-42" {
+		t.Errorf("expected chan:room-42 got %s", name)
+	}
+
+	tables := make(map[string]bool)
+	tables["doc.name == 'room-1'"] = false
+	tables["doc.name == 'room-42' && doc.op == 'join'"] = true
+	tables["doc.op == 'publish' || auth.role >= 100"] = false
+
+	env := ChannelRuleEnv(auth, "room-42", ChannelJoin)
+	for cond, expected := range tables {
+		ok, err := EvalRule(cond, env)
+		if err != nil {
+			t.Fatalf("%s: %v", cond, err)
+		} else if ok != expected {
+			t.Errorf("%s: expected %v got %v", cond, expected, ok)
+		}
+	}
+}
@@ -11,13 +11,14 @@ import (
 )
 
 type BaseConfig struct {
-	ID               string    `json:"id"`
-	CustomerID       string    `json:"-"`
-	Name             string    `json:"name"`
-	AllowedDomain    []string  `json:"whitelist"`
-	IsActive         bool      `json:"-"`
-	MonthlySentEmail int       `json:"-"`
-	Created          time.Time `json:"created"`
+	ID               string       `json:"id"`
+	CustomerID       string       `json:"-"`
+	Name             string       `json:"name"`
+	AllowedDomain    []string     `json:"whitelist"`
+	IsActive         bool         `json:"-"`
+	MonthlySentEmail int          `json:"-"`
+	Settings         BaseSettings `json:"settings"`
+	Created          time.Time    `json:"created"`
 }
 
 type PagedResult struct {
@@ -37,7 +38,10 @@ type ListParams struct {
 var (
 	//Tokens     map[string]Auth       = make(map[string]Auth)
 	//Bases      map[string]BaseConfig = make(map[string]BaseConfig)
+	// HashSecret verifies tokens issued before per-base signing keys
 	HashSecret *jwt.HMACSHA
+	// Keys signs and verifies the tokens of each base
+	Keys *Keyring
 )
 
 func init() {
@@ -51,29 +55,54 @@ func init() {
 const (
 	SystemID = "sb"
 
-	MsgTypeError     = "error"
-	MsgTypeOk        = "ok"
-	MsgTypeEcho      = "echo"
-	MsgTypeInit      = "init"
-	MsgTypeAuth      = "auth"
-	MsgTypeToken     = "token"
-	MsgTypeJoin      = "join"
-	MsgTypeJoined    = "joined"
-	MsgTypePresence  = "presence"
-	MsgTypeChanIn    = "chan_in"
-	MsgTypeChanOut   = "chan_out"
-	MsgTypeDBCreated = "db_created"
-	MsgTypeDBUpdated = "db_updated"
-	MsgTypeDBDeleted = "db_deleted"
+	MsgTypeError         = "error"
+	MsgTypeOk            = "ok"
+	MsgTypeEcho          = "echo"
+	MsgTypeInit          = "init"
+	MsgTypeAuth          = "auth"
+	MsgTypeToken         = "token"
+	MsgTypeJoin          = "join"
+	MsgTypeJoined        = "joined"
+	MsgTypeLeave         = "leave"
+	MsgTypeLeft          = "left"
+	MsgTypeListChannels  = "list_channels"
+	MsgTypeChannels      = "channels"
+	MsgTypePresence      = "presence"
+	MsgTypePresenceJoin  = "presence_join"
+	MsgTypePresenceLeave = "presence_leave"
+	MsgTypeChanIn        = "chan_in"
+	MsgTypeChanOut       = "chan_out"
+	MsgTypeDBCreated     = "db_created"
+	MsgTypeDBUpdated     = "db_updated"
+	MsgTypeDBDeleted     = "db_deleted"
+	MsgTypeDBLeft        = "db_left"
+	MsgTypeDBEntered     = "db_entered"
+	MsgTypeFunctionLog   = "fn_log"
 )
 
+// TailChannelPrefix starts the channels of the functions' logs, they're
+// reserved to the servers
+const TailChannelPrefix = "sbtail:"
+
 type Command struct {
-	SID           string `json:"sid"`
-	Type          string `json:"type"`
-	Data          string `json:"data"`
-	Channel       string `json:"channel"`
-	Token         string `json:"token"`
-	IsSystemEvent bool   `json:"-"`
+	SID     string `json:"sid"`
+	Type    string `json:"type"`
+	Data    string `json:"data"`
+	Channel string `json:"channel"`
+	Token   string `json:"token"`
+	// Base is the database name of the base publishing the event, for the
+	// system channel only
+	Base string `json:"base,omitempty"`
+	// ID of the message in the channel's history
+	ID string `json:"id,omitempty"`
+	// Since replays the channel's history after this message ID on join
+	Since string `json:"since,omitempty"`
+	// EventID identifies an event of the system channel, every server
+	// receives it and the ones handling it once use it to claim it
+	EventID string `json:"eventId,omitempty"`
+	// Filter only sends the database events matching these query clauses
+	Filter        [][]interface{} `json:"filter,omitempty"`
+	IsSystemEvent bool            `json:"-"`
 }
 
 func (msg Command) IsDBEvent() bool {
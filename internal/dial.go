@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// privateNets are the RFC 1918 and carrier-grade NAT IPv4 ranges and the
+// IPv6 unique local addresses (RFC 4193)
+var privateNets = []*net.IPNet{
+	{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(172, 16, 0, 0), Mask: net.CIDRMask(12, 32)},
+	{IP: net.IPv4(192, 168, 0, 0), Mask: net.CIDRMask(16, 32)},
+	{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)},
+	{IP: net.IP{0xfc, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, Mask: net.CIDRMask(7, 128)},
+}
+
+// IsPrivateIP returns true for the addresses of the local host and networks
+func IsPrivateIP(ip net.IP) bool {
+	if ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsUnspecified() {
+		return true
+	}
+
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// DenyPrivateDial is a net.Dialer Control refusing the connections to
+// private addresses. The address is checked once resolved so a host cannot
+// point to a private address after passing the URL checks.
+func DenyPrivateDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || IsPrivateIP(ip) {
+		return fmt.Errorf("calling the private address %s is not allowed", host)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPrivateIP(t *testing.T) {
+	tables := make(map[string]bool)
+	tables["10.1.2.3"] = true
+	tables["172.16.0.1"] = true
+	tables["172.31.255.255"] = true
+	tables["172.32.0.1"] = false
+	tables["192.168.1.1"] = true
+	tables["100.64.0.1"] = true
+	tables["127.0.0.1"] = true
+	tables["169.254.169.254"] = true
+	tables["0.0.0.0"] = true
+	tables["fd00::1"] = true
+	tables["fe80::1"] = true
+	tables["::1"] = true
+	tables["8.8.8.8"] = false
+	tables["2606:4700::1111"] = false
+
+	for addr, expected := range tables {
+		if ok := IsPrivateIP(net.ParseIP(addr)); ok != expected {
+			t.Errorf("%s: expected %v got %v", addr, expected, ok)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package internal
+
+import "strings"
+
+const (
+	DiffEqual   = " "
+	DiffAdded   = "+"
+	DiffRemoved = "-"
+)
+
+// DiffLine is a line of a diff with its operation, one of the Diff
+// constants
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// DiffLines returns the line by line changes from one code to another. It
+// uses the longest common subsequence of the lines once the common prefix
+// and suffix are trimmed, which is enough for the size of functions.
+func DiffLines(from, to string) []DiffLine {
+	a, b := strings.Split(from, "\n"), strings.Split(to, "\n")
+
+	var prefix []DiffLine
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, DiffLine{Op: DiffEqual, Text: a[0]})
+		a, b = a[1:], b[1:]
+	}
+
+	var suffix []DiffLine
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append([]DiffLine{{Op: DiffEqual, Text: a[len(a)-1]}}, suffix...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	// lcs[i][j] is the length of the common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := prefix
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			lines = append(lines, DiffLine{Op: DiffEqual, Text: a[i]})
+			i++
+			j++
+		} else if lcs[i+1][j] >= lcs[i][j+1] {
+			lines = append(lines, DiffLine{Op: DiffRemoved, Text: a[i]})
+			i++
+		} else {
+			lines = append(lines, DiffLine{Op: DiffAdded, Text: b[j]})
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		lines = append(lines, DiffLine{Op: DiffRemoved, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, DiffLine{Op: DiffAdded, Text: b[j]})
+	}
+
+	return append(lines, suffix...)
+}
@@ -0,0 +1,25 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	from := "function handle() {\n\tlog(1);\n\tlog(2);\n}"
+	to := "function handle() {\n\tlog(2);\n\tlog(3);\n}"
+
+	var sb strings.Builder
+	for _, l := range DiffLines(from, to) {
+		sb.WriteString(l.Op + l.Text + "\n")
+	}
+
+	expected := " function handle() {\n-\tlog(1);\n \tlog(2);\n+\tlog(3);\n }\n"
+	if sb.String() != expected {
+		t.Errorf("expected diff\n%s\ngot\n%s", expected, sb.String())
+	}
+
+	if lines := DiffLines("same", "same"); len(lines) != 1 || lines[0].Op != DiffEqual {
+		t.Errorf("expected no changes got %v", lines)
+	}
+}
@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DocumentCreate = "create"
+	DocumentUpdate = "update"
+	DocumentDelete = "delete"
+)
+
+// Actor is the user causing a database event
+type Actor struct {
+	UserID    string `json:"userId"`
+	AccountID string `json:"accountId"`
+}
+
+// DocumentEvent is the data of the db_created, db_updated and db_deleted
+// events. Previous is the document before an update or a delete, Document
+// the document after a create or an update.
+type DocumentEvent struct {
+	Collection string                 `json:"collection"`
+	ID         string                 `json:"id"`
+	Op         string                 `json:"op"`
+	Previous   map[string]interface{} `json:"previous,omitempty"`
+	Document   map[string]interface{} `json:"document,omitempty"`
+	Actor      Actor                  `json:"actor"`
+	Timestamp  time.Time              `json:"timestamp"`
+	// Token of the actor, for server-side functions only
+	Token string `json:"-"`
+	// Base is the database name of the document's base
+	Base string `json:"-"`
+}
+
+// NewDocumentEvent returns the event of an operation made by auth
+func NewDocumentEvent(auth Auth, dbName, col, op string, previous, doc map[string]interface{}) DocumentEvent {
+	evt := DocumentEvent{
+		Collection: CleanCollectionName(col),
+		Op:         op,
+		Previous:   previous,
+		Document:   doc,
+		Actor:      Actor{UserID: auth.UserID, AccountID: auth.AccountID},
+		Timestamp:  time.Now(),
+		Token:      auth.ReconstructToken(),
+		Base:       dbName,
+	}
+
+	if id, ok := evt.Doc()["id"]; ok {
+		evt.ID = fmt.Sprintf("%v", id)
+	}
+	return evt
+}
+
+// Doc returns the document for permission checks, the previous one for
+// deletes.
+func (evt DocumentEvent) Doc() map[string]interface{} {
+	if evt.Document != nil {
+		return evt.Document
+	}
+	return evt.Previous
+}
+
+// EventType returns the message type of the operation
+func (evt DocumentEvent) EventType() string {
+	switch evt.Op {
+	case DocumentCreate:
+		return MsgTypeDBCreated
+	case DocumentUpdate:
+		return MsgTypeDBUpdated
+	}
+	return MsgTypeDBDeleted
+}
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDocumentEvent(t *testing.T) {
+	auth := Auth{AccountID: "acct1", UserID: "user1", Token: "tok"}
+	previous := map[string]interface{}{"id": "doc1", "done": false}
+
+	evt := NewDocumentEvent(auth, "testdb", "tasks_760_", DocumentDelete, previous, nil)
+	if evt.ID != "doc1" || evt.Collection != "tasks" {
+		t.Errorf("expected doc1 in tasks got %s in %s", evt.ID, evt.Collection)
+	} else if evt.EventType() != MsgTypeDBDeleted {
+		t.Errorf("expected %s got %s", MsgTypeDBDeleted, evt.EventType())
+	} else if evt.Doc()["id"] != "doc1" {
+		t.Errorf("expected the previous document for a delete got %v", evt.Doc())
+	}
+
+	b, err := json.Marshal(evt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := decoded["document"]; ok {
+		t.Error("expected no document for a delete")
+	} else if actor, ok := decoded["actor"].(map[string]interface{}); !ok || actor["userId"] != "user1" {
+		t.Errorf("expected the actor user1 got %v", decoded["actor"])
+	} else if evt.Token != "user1|tok" {
+		t.Errorf("expected the actor token got %s", evt.Token)
+	}
+
+	for k := range decoded {
+		if k == "token" || k == "Token" {
+			t.Error("the actor token must not be published")
+		}
+	}
+}
@@ -7,15 +7,43 @@ import (
 // ExecData represents a server-side function with its name, code and execution
 // history
 type ExecData struct {
-	ID           string        `json:"id"`
-	AccountID    string        `json:"accountId"`
-	FunctionName string        `json:"name"`
-	TriggerTopic string        `json:"trigger"`
-	Code         string        `json:"code"`
-	Version      int           `json:"version"`
-	LastUpdated  time.Time     `json:"lastUpdated"`
-	LastRun      time.Time     `json:"lastRun"`
-	History      []ExecHistory `json:"history"`
+	ID           string         `json:"id"`
+	AccountID    string         `json:"accountId"`
+	FunctionName string         `json:"name"`
+	TriggerTopic string         `json:"trigger"`
+	Code         string         `json:"code"`
+	Version      int            `json:"version"`
+	LastUpdated  time.Time      `json:"lastUpdated"`
+	LastRun      time.Time      `json:"lastRun"`
+	Limits       FunctionLimits `json:"limits"`
+	// Retry applies to the runs triggered by events
+	Retry RetryPolicy `json:"retry"`
+	// PinnedVersion is the version the trigger runs when set, the newer
+	// versions are staged until it's unpinned
+	PinnedVersion int `json:"pinnedVersion"`
+	// Kind is either a function or a module shared with require()
+	Kind    string        `json:"kind"`
+	History []ExecHistory `json:"history"`
+}
+
+const (
+	FunctionKindFunction = "function"
+	FunctionKindModule   = "module"
+)
+
+// IsModule returns true for the code shared between functions
+func (ex ExecData) IsModule() bool {
+	return ex.Kind == FunctionKindModule
+}
+
+// FunctionVersion is the immutable code of a function at one version
+type FunctionVersion struct {
+	ID           string    `json:"id"`
+	FunctionID   string    `json:"functionId"`
+	Version      int       `json:"version"`
+	Code         string    `json:"code"`
+	TriggerTopic string    `json:"trigger"`
+	Created      time.Time `json:"created"`
 }
 
 // ExecHistory represents a function run ending result
@@ -27,6 +55,186 @@ type ExecHistory struct {
 	Completed  time.Time `json:"completed"`
 	Success    bool      `json:"success"`
 	Output     []string  `json:"output"`
+	// Reason of a failed run, one of the FunctionFailed constants
+	Reason string `json:"reason"`
+	// Logs are the output lines with their level
+	Logs []FunctionLog `json:"logs"`
+}
+
+const (
+	LogInfo  = "info"
+	LogWarn  = "warn"
+	LogError = "error"
+)
+
+// FunctionLog is an output line of a run, one of the Log levels
+type FunctionLog struct {
+	Time    time.Time `bson:"t" json:"time"`
+	Level   string    `bson:"lv" json:"level"`
+	Message string    `bson:"msg" json:"message"`
+}
+
+const (
+	RunStatusSuccess = "success"
+	RunStatusFailed  = "failed"
+)
+
+// RunFilter filters a function's runs by status, one of the RunStatus
+// constants, by start time and by version. The zero values don't filter.
+type RunFilter struct {
+	Status  string
+	From    time.Time
+	To      time.Time
+	Version int
+	Page    int64
+	Size    int64
+}
+
+// WithDefaults returns the filter starting at the first page of 25 runs,
+// a page has up to 100 runs
+func (f RunFilter) WithDefaults() RunFilter {
+	if f.Page < 1 {
+		f.Page = 1
+	}
+
+	if f.Size <= 0 {
+		f.Size = 25
+	} else if f.Size > 100 {
+		f.Size = 100
+	}
+	return f
+}
+
+// FunctionRuns is a page of runs, the most recent first
+type FunctionRuns struct {
+	Page    int64         `json:"page"`
+	Size    int64         `json:"size"`
+	Total   int64         `json:"total"`
+	Results []ExecHistory `json:"results"`
+}
+
+const (
+	FunctionFailedError     = "error"
+	FunctionFailedTimeout   = "timeout"
+	FunctionFailedCallStack = "call_stack"
+	FunctionFailedMemory    = "memory"
+)
+
+const (
+	// MaxFunctionTimeout is the longest timeout in seconds a base can allow
+	MaxFunctionTimeout = 300
+	// MaxFunctionMemory is the most memory in MB a base can allow
+	MaxFunctionMemory = 1024
+)
+
+// FunctionLimits bounds the resources of a function run: the wall time in
+// seconds, the call stack depth and the memory allocated in MB.
+//
+// The memory is the run's budget for the data its helpers return, i.e.
+// documents, cache values and fetch responses, and for its output. The
+// values the code creates are bounded by its timeout.
+type FunctionLimits struct {
+	Timeout      int   `bson:"timeout" json:"timeout"`
+	MaxCallStack int   `bson:"maxCallStack" json:"maxCallStack"`
+	MaxMemory    int64 `bson:"maxMemory" json:"maxMemory"`
+}
+
+// WithDefaults returns the limits with the zero values set to defaults
+func (l FunctionLimits) WithDefaults() FunctionLimits {
+	if l.Timeout <= 0 {
+		l.Timeout = 10
+	} else if l.Timeout > MaxFunctionTimeout {
+		l.Timeout = MaxFunctionTimeout
+	}
+
+	if l.MaxCallStack <= 0 {
+		l.MaxCallStack = 1000
+	}
+
+	if l.MaxMemory <= 0 {
+		l.MaxMemory = 64
+	} else if l.MaxMemory > MaxFunctionMemory {
+		l.MaxMemory = MaxFunctionMemory
+	}
+	return l
+}
+
+// Within returns a function's limits bounded by its base's limits, the
+// zero values use the base's ones.
+func (l FunctionLimits) Within(base FunctionLimits) FunctionLimits {
+	base = base.WithDefaults()
+
+	if l.Timeout > 0 && l.Timeout < base.Timeout {
+		base.Timeout = l.Timeout
+	}
+	if l.MaxCallStack > 0 && l.MaxCallStack < base.MaxCallStack {
+		base.MaxCallStack = l.MaxCallStack
+	}
+	if l.MaxMemory > 0 && l.MaxMemory < base.MaxMemory {
+		base.MaxMemory = l.MaxMemory
+	}
+	return base
+}
+
+// TimeoutDuration returns the timeout as a time.Duration
+func (l FunctionLimits) TimeoutDuration() time.Duration {
+	return time.Duration(l.Timeout) * time.Second
+}
+
+// MaxRetryAttempts is the most runs of an event a function can retry
+const MaxRetryAttempts = 10
+
+// RetryPolicy retries the failed runs of an event-triggered function. The
+// wait after a failed attempt starts at Backoff seconds and doubles up to an
+// hour. The zero value runs the function once.
+type RetryPolicy struct {
+	MaxAttempts int `bson:"maxAttempts" json:"maxAttempts"`
+	Backoff     int `bson:"backoff" json:"backoff"`
+}
+
+// Attempts returns the number of runs before an event is a dead letter
+func (p RetryPolicy) Attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	} else if p.MaxAttempts > MaxRetryAttempts {
+		return MaxRetryAttempts
+	}
+	return p.MaxAttempts
+}
+
+// Delay returns the wait before the next attempt, the backoff defaults to
+// one second
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	d := time.Second
+	if p.Backoff > 0 {
+		d = time.Duration(p.Backoff) * time.Second
+	}
+
+	for i := 1; i < attempts && d < time.Hour; i++ {
+		d *= 2
+	}
+
+	if d > time.Hour {
+		return time.Hour
+	}
+	return d
+}
+
+// FunctionDeadLetter is an event whose runs failed all their attempts. It
+// keeps the triggering command and the publisher's auth to be replayed.
+// The event is saved once its first attempt fails, it's pending until the
+// last attempt so the retries survive a restart.
+type FunctionDeadLetter struct {
+	ID           string    `json:"id"`
+	FunctionID   string    `json:"functionId"`
+	FunctionName string    `json:"functionName"`
+	Command      Command   `json:"command"`
+	Auth         Auth      `json:"-"`
+	Attempts     int       `json:"attempts"`
+	Error        string    `json:"error"`
+	Created      time.Time `json:"created"`
+	Pending      bool      `json:"pending"`
+	NextAttempt  time.Time `json:"nextAttempt"`
 }
 
 const (
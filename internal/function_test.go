@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	tables := []struct {
+		policy   RetryPolicy
+		attempts int
+		delays   []time.Duration
+	}{
+		{RetryPolicy{}, 1, []time.Duration{time.Second, 2 * time.Second}},
+		{RetryPolicy{MaxAttempts: 3, Backoff: 5}, 3, []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second}},
+		{RetryPolicy{MaxAttempts: 50, Backoff: 3000}, MaxRetryAttempts, []time.Duration{3000 * time.Second, time.Hour}},
+	}
+
+	for _, tt := range tables {
+		if n := tt.policy.Attempts(); n != tt.attempts {
+			t.Errorf("%v: expected %d attempts got %d", tt.policy, tt.attempts, n)
+		}
+
+		for i, expected := range tt.delays {
+			if d := tt.policy.Delay(i + 1); d != expected {
+				t.Errorf("%v: expected a %v delay after attempt %d got %v", tt.policy, expected, i+1, d)
+			}
+		}
+	}
+}
+
+func TestRunFilterDefaults(t *testing.T) {
+	tables := []struct {
+		filter     RunFilter
+		page, size int64
+	}{
+		{RunFilter{}, 1, 25},
+		{RunFilter{Page: 3, Size: 10}, 3, 10},
+		{RunFilter{Page: -1, Size: 1000}, 1, 100},
+	}
+
+	for _, tt := range tables {
+		f := tt.filter.WithDefaults()
+		if f.Page != tt.page || f.Size != tt.size {
+			t.Errorf("%v: expected page %d of %d got page %d of %d", tt.filter, tt.page, tt.size, f.Page, f.Size)
+		}
+	}
+}
@@ -0,0 +1,432 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/gbrlsnchs/jwt/v3/jwtutil"
+)
+
+const (
+	// keyringRefresh is how long keys are cached before being reloaded,
+	// this is how fast a rotation done on a node reaches the others
+	keyringRefresh = 1 * time.Minute
+	// rotationLockTTL releases the rotation lock of a node that died
+	// while rotating
+	rotationLockTTL = 30 * time.Second
+	// rotationLockWait is how long a rotation waits for another one
+	rotationLockWait = 10 * time.Second
+	// unknownKeyReload is the minimum time between the reloads caused by
+	// tokens with an unknown kid, they cannot hit the data store on each
+	// request
+	unknownKeyReload = 5 * time.Second
+)
+
+var (
+	ErrUnknownSigningKey = errors.New("unknown signing key")
+	ErrLegacyToken       = errors.New("this token was issued before the per-base signing keys and is not accepted anymore, please log in again")
+)
+
+// Locker holds locks shared by all the nodes, i.e. a Redis SETNX
+type Locker interface {
+	// TryLock returns false if the key is already locked
+	TryLock(key string, ttl time.Duration) (bool, error)
+	Unlock(key string) error
+}
+
+// Keyring signs and verifies the JWT of each base with their own signing
+// keys, loading them from the data store.
+type Keyring struct {
+	Store Persister
+	// Algorithm used when a base needs a new key
+	Algorithm string
+	// Locker prevents the nodes from rotating the same base at once, only
+	// this node's rotations are serialized when it's nil
+	Locker Locker
+	// LegacyUntil is when the tokens without a kid, signed with the global
+	// HashSecret before the per-base keys, stop being accepted. They're
+	// refused when it's zero.
+	LegacyUntil time.Time
+
+	mu    sync.RWMutex
+	bases map[string]baseKeys
+	// rotating is held while a rotation replaces the keys, Active waits for
+	// it rather than reading half-rotated keys
+	rotating sync.RWMutex
+}
+
+type baseKeys struct {
+	keys   []SigningKey
+	loaded time.Time
+}
+
+// NewKeyring returns a Keyring creating keys with the JWT_ALGORITHM
+// environment variable algorithm, EdDSA by default. The tokens issued before
+// the per-base keys are accepted until the JWT_LEGACY_UNTIL date (UTC), i.e.
+// 2022-06-30.
+func NewKeyring(store Persister) *Keyring {
+	alg := os.Getenv("JWT_ALGORITHM")
+	if len(alg) == 0 {
+		alg = SigningAlgEdDSA
+	}
+
+	var legacyUntil time.Time
+	if s := os.Getenv("JWT_LEGACY_UNTIL"); len(s) > 0 {
+		var err error
+		if legacyUntil, err = time.Parse("2006-01-02", s); err != nil {
+			log.Println("invalid JWT_LEGACY_UNTIL date, the tokens without a kid are refused: ", err)
+		}
+	}
+
+	if keyEncryption == nil {
+		log.Println("JWT_SECRET is not set, the signing keys are stored unencrypted")
+	}
+
+	return &Keyring{
+		Store:       store,
+		Algorithm:   alg,
+		LegacyUntil: legacyUntil,
+		bases:       make(map[string]baseKeys),
+	}
+}
+
+func (kr *Keyring) keys(dbName string, reload bool) ([]SigningKey, error) {
+	kr.mu.RLock()
+	bk, ok := kr.bases[dbName]
+	kr.mu.RUnlock()
+
+	if ok && !reload && time.Since(bk.loaded) < keyringRefresh {
+		return bk.keys, nil
+	}
+
+	keys, err := kr.Store.ListSigningKeys(dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range keys {
+		if keys[i].Private, err = openPrivateKey(keys[i].Private); err != nil {
+			return nil, fmt.Errorf("cannot decrypt the signing key %s: %v", keys[i].ID, err)
+		}
+	}
+
+	kr.mu.Lock()
+	kr.bases[dbName] = baseKeys{keys: keys, loaded: time.Now()}
+	kr.mu.Unlock()
+
+	return keys, nil
+}
+
+func (kr *Keyring) find(dbName, kid string) (SigningKey, error) {
+	keys, err := kr.keys(dbName, false)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	for _, k := range keys {
+		if k.ID == kid {
+			return k, nil
+		}
+	}
+
+	// the key might have been created by another node, the keys are not
+	// reloaded again for random kids
+	kr.mu.RLock()
+	loaded := kr.bases[dbName].loaded
+	kr.mu.RUnlock()
+
+	if time.Since(loaded) < unknownKeyReload {
+		return SigningKey{}, ErrUnknownSigningKey
+	}
+
+	keys, err = kr.keys(dbName, true)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	for _, k := range keys {
+		if k.ID == kid {
+			return k, nil
+		}
+	}
+	return SigningKey{}, ErrUnknownSigningKey
+}
+
+// Active returns the key signing new tokens for this base, a key is created
+// if the base does not have one yet.
+func (kr *Keyring) Active(dbName string) (SigningKey, error) {
+	kr.rotating.RLock()
+	keys, err := kr.keys(dbName, false)
+	kr.rotating.RUnlock()
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	if k, ok := activeKey(keys); ok {
+		return k, nil
+	}
+
+	unlock, err := kr.lock(dbName)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	defer unlock()
+
+	// another node might have created it while we waited for the lock
+	keys, err = kr.keys(dbName, true)
+	if err != nil {
+		return SigningKey{}, err
+	} else if k, ok := activeKey(keys); ok {
+		return k, nil
+	}
+
+	return kr.rotate(dbName, kr.Algorithm, 0)
+}
+
+// activeKey returns the most recent active key. There's only one once a
+// rotation completes, the new key wins while the previous one is expired.
+func activeKey(keys []SigningKey) (active SigningKey, ok bool) {
+	for _, k := range keys {
+		if k.IsActive() && (!ok || k.Created.After(active.Created)) {
+			active, ok = k, true
+		}
+	}
+	return
+}
+
+// lock prevents other rotations of the base, on this node and the others
+func (kr *Keyring) lock(dbName string) (unlock func(), err error) {
+	kr.rotating.Lock()
+	if kr.Locker == nil {
+		return kr.rotating.Unlock, nil
+	}
+
+	key := "keyring_rotate_" + dbName
+	deadline := time.Now().Add(rotationLockWait)
+	for {
+		ok, err := kr.Locker.TryLock(key, rotationLockTTL)
+		if err != nil {
+			kr.rotating.Unlock()
+			return nil, err
+		} else if ok {
+			break
+		} else if time.Now().After(deadline) {
+			kr.rotating.Unlock()
+			return nil, fmt.Errorf("the signing keys of %s are being rotated by another node", dbName)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return func() {
+		if err := kr.Locker.Unlock(key); err != nil {
+			log.Println("error releasing the rotation lock: ", err)
+		}
+		kr.rotating.Unlock()
+	}, nil
+}
+
+// Sign signs the payload with the base active key and sets the kid header
+func (kr *Keyring) Sign(dbName string, payload interface{}) ([]byte, error) {
+	key, err := kr.Active(dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	alg, err := key.Signer()
+	if err != nil {
+		return nil, err
+	}
+
+	return jwt.Sign(payload, alg, jwt.KeyID(key.ID))
+}
+
+// Verify verifies the token with the base key matching its kid header.
+// Tokens without a kid were issued before per-base keys, they're verified
+// with the global HashSecret until LegacyUntil.
+func (kr *Keyring) Verify(dbName string, token []byte, payload interface{}) error {
+	rv := &jwtutil.Resolver{
+		New: func(hd jwt.Header) (jwt.Algorithm, error) {
+			if len(hd.KeyID) == 0 {
+				if time.Now().After(kr.LegacyUntil) {
+					return nil, ErrLegacyToken
+				}
+				return HashSecret, nil
+			}
+
+			key, err := kr.find(dbName, hd.KeyID)
+			if err != nil {
+				return nil, err
+			} else if key.IsExpired() {
+				return nil, errors.New("the signing key of this token has expired")
+			}
+
+			return key.Signer()
+		},
+	}
+
+	_, err := jwt.Verify(token, rv, payload, jwt.ValidateHeader)
+	return err
+}
+
+// Rotate creates a new active key for the base. The previous keys keep
+// verifying tokens for the grace period.
+func (kr *Keyring) Rotate(dbName, alg string, grace time.Duration) (SigningKey, error) {
+	unlock, err := kr.lock(dbName)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	defer unlock()
+
+	return kr.rotate(dbName, alg, grace)
+}
+
+// rotate creates the new key, the rotation lock must be held
+func (kr *Keyring) rotate(dbName, alg string, grace time.Duration) (SigningKey, error) {
+	keys, err := kr.keys(dbName, true)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	key, err := GenerateSigningKey(alg)
+	if err != nil {
+		return key, err
+	}
+
+	stored := key
+	if stored.Private, err = sealPrivateKey(key.Private); err != nil {
+		return key, err
+	}
+
+	if err := kr.Store.AddSigningKey(dbName, stored); err != nil {
+		return key, err
+	}
+
+	expires := time.Now().Add(grace)
+	for _, k := range keys {
+		if !k.IsActive() {
+			continue
+		}
+
+		if err := kr.Store.ExpireSigningKey(dbName, k.ID, expires); err != nil {
+			return key, err
+		}
+	}
+
+	if _, err := kr.keys(dbName, true); err != nil {
+		return key, err
+	}
+	return key, nil
+}
+
+// JWKS returns the public keys still valid for the base
+func (kr *Keyring) JWKS(dbName string) (JWKS, error) {
+	set := JWKS{Keys: make([]JWK, 0)}
+
+	keys, err := kr.keys(dbName, false)
+	if err != nil {
+		return set, err
+	}
+
+	for _, k := range keys {
+		if k.IsExpired() {
+			continue
+		}
+
+		if jwk, ok := k.JWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set, nil
+}
+
+// RotateKeys rotates the active key of all bases older than maxAge and
+// removes the expired keys.
+func (kr *Keyring) RotateKeys(maxAge, grace time.Duration) error {
+	bases, err := kr.Store.ListDatabases()
+	if err != nil {
+		return err
+	}
+
+	for _, base := range bases {
+		if err := kr.rotateBase(base.Name, maxAge, grace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotateBase rotates the base's active key if it's older than maxAge. The
+// keys are checked again once locked, a node that waited for another's
+// rotation does not rotate a second time.
+func (kr *Keyring) rotateBase(dbName string, maxAge, grace time.Duration) error {
+	keys, err := kr.keys(dbName, true)
+	if err != nil {
+		return err
+	}
+
+	if !needsRotation(keys, maxAge) {
+		return nil
+	}
+
+	unlock, err := kr.lock(dbName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	keys, err = kr.keys(dbName, true)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if k.IsExpired() {
+			if err := kr.Store.DeleteSigningKey(dbName, k.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if active, ok := activeKey(keys); ok && time.Since(active.Created) > maxAge {
+		if _, err := kr.rotate(dbName, active.Algorithm, grace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// needsRotation returns true if a key expired or the active one is older
+// than maxAge
+func needsRotation(keys []SigningKey, maxAge time.Duration) bool {
+	for _, k := range keys {
+		if k.IsExpired() {
+			return true
+		}
+	}
+
+	active, ok := activeKey(keys)
+	return ok && time.Since(active.Created) > maxAge
+}
+
+// ScheduleRotation runs RotateKeys every interval until stop is closed
+func (kr *Keyring) ScheduleRotation(interval, maxAge, grace time.Duration, stop chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := kr.RotateKeys(maxAge, grace); err != nil {
+				log.Println("error rotating signing keys: ", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
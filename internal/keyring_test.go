@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gbrlsnchs/jwt/v3"
+)
+
+// keyStore only implements the signing keys part of the Persister
+type keyStore struct {
+	Persister
+	sync.Mutex
+	keys  []SigningKey
+	loads int
+}
+
+func (ks *keyStore) AddSigningKey(dbName string, key SigningKey) error {
+	ks.Lock()
+	defer ks.Unlock()
+
+	ks.keys = append(ks.keys, key)
+	return nil
+}
+
+func (ks *keyStore) ListSigningKeys(dbName string) ([]SigningKey, error) {
+	ks.Lock()
+	defer ks.Unlock()
+
+	ks.loads++
+	keys := make([]SigningKey, len(ks.keys))
+	copy(keys, ks.keys)
+	return keys, nil
+}
+
+func (ks *keyStore) ExpireSigningKey(dbName, id string, expires time.Time) error {
+	ks.Lock()
+	defer ks.Unlock()
+
+	for i, k := range ks.keys {
+		if k.ID == id {
+			ks.keys[i].Expires = expires
+		}
+	}
+	return nil
+}
+
+func (ks *keyStore) DeleteSigningKey(dbName, id string) error {
+	return nil
+}
+
+func (ks *keyStore) ListDatabases() ([]BaseConfig, error) {
+	return []BaseConfig{{Name: "testdb"}}, nil
+}
+
+// memLocker is a Locker shared by the keyrings of a test
+type memLocker struct {
+	mu    sync.Mutex
+	locks map[string]bool
+}
+
+func (ml *memLocker) TryLock(key string, ttl time.Duration) (bool, error) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	if ml.locks[key] {
+		return false, nil
+	}
+	ml.locks[key] = true
+	return true, nil
+}
+
+func (ml *memLocker) Unlock(key string) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	delete(ml.locks, key)
+	return nil
+}
+
+func TestConcurrentRotations(t *testing.T) {
+	ks := &keyStore{}
+	locker := &memLocker{locks: make(map[string]bool)}
+
+	old, err := GenerateSigningKey(SigningAlgHS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.Created = time.Now().Add(-48 * time.Hour)
+	ks.keys = append(ks.keys, old)
+
+	// the nodes share the data store and the locker
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		kr := NewKeyring(ks)
+		kr.Locker = locker
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := kr.RotateKeys(24*time.Hour, time.Hour); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	keys, _ := ks.ListSigningKeys("testdb")
+	active := 0
+	for _, k := range keys {
+		if k.IsActive() {
+			active++
+		}
+	}
+
+	if len(keys) != 2 || active != 1 {
+		t.Errorf("expected 1 rotation and 1 active key got %d keys and %d active", len(keys), active)
+	}
+}
+
+func TestSealedPrivateKeys(t *testing.T) {
+	prev := keyEncryption
+	defer func() { keyEncryption = prev }()
+
+	keyEncryption = newKeyEncryption("unit-test-secret")
+
+	ks := &keyStore{}
+	kr := NewKeyring(ks)
+
+	key, err := kr.Active("testdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, _ := ks.ListSigningKeys("testdb")
+	if len(stored) != 1 || !bytes.HasPrefix(stored[0].Private, sealedKeyPrefix) {
+		t.Fatal("expected the private key to be stored encrypted")
+	} else if bytes.Contains(stored[0].Private, key.Private) {
+		t.Error("expected the stored key not to contain the private key")
+	}
+
+	// another node decrypts it
+	other := NewKeyring(ks)
+	token, err := kr.Sign("testdb", JWTPayload{Token: "id|token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pl JWTPayload
+	if err := other.Verify("testdb", token, &pl); err != nil {
+		t.Fatal(err)
+	} else if pl.Token != "id|token" {
+		t.Errorf("expected token id|token got %s", pl.Token)
+	}
+
+	// the keys stored before the encryption are still read
+	if b, err := openPrivateKey([]byte("plain")); err != nil || string(b) != "plain" {
+		t.Errorf("expected the unencrypted key as is got %s, %v", b, err)
+	}
+}
+
+func TestVerifyLegacyTokens(t *testing.T) {
+	token, err := jwt.Sign(JWTPayload{Token: "id|token"}, HashSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kr := NewKeyring(&keyStore{})
+
+	var pl JWTPayload
+	if err := kr.Verify("testdb", token, &pl); !errors.Is(err, ErrLegacyToken) {
+		t.Errorf("expected the legacy token refused got %v", err)
+	}
+
+	kr.LegacyUntil = time.Now().Add(time.Hour)
+	if err := kr.Verify("testdb", token, &pl); err != nil {
+		t.Fatal(err)
+	} else if pl.Token != "id|token" {
+		t.Errorf("expected token id|token got %s", pl.Token)
+	}
+}
+
+func TestUnknownKeyReloads(t *testing.T) {
+	ks := &keyStore{}
+	kr := NewKeyring(ks)
+
+	if _, err := kr.Active("testdb"); err != nil {
+		t.Fatal(err)
+	}
+
+	ks.Lock()
+	loads := ks.loads
+	ks.Unlock()
+
+	for i := 0; i < 10; i++ {
+		if _, err := kr.find("testdb", fmt.Sprintf("unknown%d", i)); err != ErrUnknownSigningKey {
+			t.Fatalf("expected an unknown key got %v", err)
+		}
+	}
+
+	ks.Lock()
+	defer ks.Unlock()
+
+	if ks.loads != loads {
+		t.Errorf("expected the keys loaded just now not to be reloaded got %d loads", ks.loads-loads)
+	}
+}
@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// LiveQuery filters the database events of a channel with clauses in the
+// same format as the /query/ endpoint: [field, operator, value].
+type LiveQuery struct {
+	clauses [][]interface{}
+}
+
+// NewLiveQuery validates the clauses and returns the live query
+func NewLiveQuery(clauses [][]interface{}) (*LiveQuery, error) {
+	for i, clause := range clauses {
+		if len(clause) != 3 {
+			return nil, fmt.Errorf("the %d query clause did not contains the required 3 parameters (field, operator, value)", i+1)
+		}
+
+		if _, ok := clause[0].(string); !ok {
+			return nil, fmt.Errorf("The %d query clause's field parameter must be a string: %v", i+1, clause[0])
+		}
+
+		op, ok := clause[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("The %d query clause's operator must be a string: %v", i+1, clause[1])
+		}
+
+		switch op {
+		case "=", "==", "!=", "<>", ">", "<", ">=", "<=":
+		case "in", "!in", "nin":
+			if _, ok := clause[2].([]interface{}); !ok {
+				return nil, fmt.Errorf("The %d query clause's value must be an array for %s", i+1, op)
+			}
+		default:
+			return nil, fmt.Errorf("The %d query clause's operator: %s is not supported at the moment.", i+1, op)
+		}
+	}
+
+	return &LiveQuery{clauses: clauses}, nil
+}
+
+// Matches returns true if the document satisfies all clauses
+func (lq *LiveQuery) Matches(doc map[string]interface{}) bool {
+	for _, clause := range lq.clauses {
+		field, op := clause[0].(string), clause[1].(string)
+		if !matchClause(doc[field], op, clause[2]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns the message to send for a database event, if any. Updated
+// documents entering the result set are sent as db_entered and the ones
+// leaving it as db_left.
+//
+// Without the previous version of a document, when the actor or the
+// subscriber could not read it, a matching update is sent as db_updated and
+// a non-matching one as db_left. Clients add the updated documents they
+// don't have and ignore the ones leaving.
+func (lq *LiveQuery) Apply(msg Command) (Command, bool) {
+	var evt DocumentEvent
+	if err := json.Unmarshal([]byte(msg.Data), &evt); err != nil {
+		return msg, false
+	}
+
+	was := evt.Previous == nil || lq.Matches(evt.Previous)
+
+	switch msg.Type {
+	case MsgTypeDBDeleted:
+		return msg, was
+	case MsgTypeDBUpdated:
+		if lq.Matches(evt.Document) {
+			if !was {
+				msg.Type = MsgTypeDBEntered
+			}
+			return msg, true
+		} else if !was {
+			return msg, false
+		}
+
+		msg.Type = MsgTypeDBLeft
+		return msg, true
+	}
+	return msg, lq.Matches(evt.Document)
+}
+
+func matchClause(v interface{}, op string, value interface{}) bool {
+	switch op {
+	case "=", "==":
+		return compare(v, value) == 0
+	case "!=", "<>":
+		return compare(v, value) != 0
+	case ">":
+		return ordered(v, value) && compare(v, value) > 0
+	case "<":
+		return ordered(v, value) && compare(v, value) < 0
+	case ">=":
+		return ordered(v, value) && compare(v, value) >= 0
+	case "<=":
+		return ordered(v, value) && compare(v, value) <= 0
+	case "in", "!in", "nin":
+		found := false
+		for _, item := range value.([]interface{}) {
+			if compare(v, item) == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (op == "in")
+	}
+	return false
+}
+
+// ordered returns true if both values are numbers or strings
+func ordered(a, b interface{}) bool {
+	switch a.(type) {
+	case float64:
+		_, ok := b.(float64)
+		return ok
+	case string:
+		_, ok := b.(string)
+		return ok
+	}
+	return false
+}
+
+// compare returns 0 when a equals b, numbers and strings are also ordered
+func compare(a, b interface{}) int {
+	if x, ok := a.(float64); ok {
+		if y, ok := b.(float64); ok {
+			if x < y {
+				return -1
+			} else if x > y {
+				return 1
+			}
+			return 0
+		}
+	}
+
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	}
+
+	if fmt.Sprintf("%v", a) == fmt.Sprintf("%v", b) {
+		return 0
+	}
+	return 1
+}
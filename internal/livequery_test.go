@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestLiveQueryMatches(t *testing.T) {
+	doc := map[string]interface{}{
+		"id":     "doc1",
+		"status": "open",
+		"votes":  float64(5),
+		"done":   false,
+	}
+
+	tables := make(map[string]bool)
+	tables[`[["status", "==", "open"]]`] = true
+	tables[`[["status", "!=", "open"]]`] = false
+	tables[`[["votes", ">", 4], ["votes", "<=", 5]]`] = true
+	tables[`[["votes", ">=", 6]]`] = false
+	tables[`[["votes", ">", "4"]]`] = false
+	tables[`[["status", "in", ["open", "closed"]]]`] = true
+	tables[`[["status", "!in", ["open", "closed"]]]`] = false
+	tables[`[["done", "=", false]]`] = true
+	tables[`[["missing", "=", "x"]]`] = false
+
+	for q, expected := range tables {
+		var clauses [][]interface{}
+		if err := json.Unmarshal([]byte(q), &clauses); err != nil {
+			t.Fatal(err)
+		}
+
+		lq, err := NewLiveQuery(clauses)
+		if err != nil {
+			t.Fatalf("%s: %v", q, err)
+		} else if ok := lq.Matches(doc); ok != expected {
+			t.Errorf("%s: expected %v got %v", q, expected, ok)
+		}
+	}
+}
+
+func TestLiveQueryInvalid(t *testing.T) {
+	invalids := [][][]interface{}{
+		{{"status", "=="}},
+		{{1, "==", "open"}},
+		{{"status", "like", "open"}},
+		{{"status", "in", "open"}},
+	}
+
+	for _, clauses := range invalids {
+		if _, err := NewLiveQuery(clauses); err == nil {
+			t.Errorf("expected an error for %v", clauses)
+		}
+	}
+}
+
+func TestLiveQueryApply(t *testing.T) {
+	lq, err := NewLiveQuery([][]interface{}{{"status", "==", "open"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := func(typ, previous, doc string) Command {
+		data := fmt.Sprintf(`{"collection": "tasks", "previous": %s, "document": %s}`, previous, doc)
+		return Command{Type: typ, Channel: "db-tasks", Data: data}
+	}
+
+	if _, ok := lq.Apply(event(MsgTypeDBCreated, `null`, `{"id": "1", "status": "closed"}`)); ok {
+		t.Error("expected a non-matching created document to be filtered")
+	}
+
+	if msg, ok := lq.Apply(event(MsgTypeDBCreated, `null`, `{"id": "2", "status": "open"}`)); !ok || msg.Type != MsgTypeDBCreated {
+		t.Errorf("expected the matching document to be sent got %v", msg)
+	}
+
+	if msg, ok := lq.Apply(event(MsgTypeDBUpdated, `{"id": "2", "status": "open"}`, `{"id": "2", "status": "closed"}`)); !ok || msg.Type != MsgTypeDBLeft {
+		t.Errorf("expected the document to leave the result set got %v", msg)
+	}
+
+	if _, ok := lq.Apply(event(MsgTypeDBUpdated, `{"id": "2", "status": "closed"}`, `{"id": "2", "status": "done"}`)); ok {
+		t.Error("expected no event for a document already out of the result set")
+	}
+
+	if msg, ok := lq.Apply(event(MsgTypeDBUpdated, `null`, `{"id": "3", "status": "done"}`)); !ok || msg.Type != MsgTypeDBLeft {
+		t.Errorf("expected an update without previous document to be sent as left got %v", msg)
+	}
+
+	if msg, ok := lq.Apply(event(MsgTypeDBUpdated, `{"id": "1", "status": "closed"}`, `{"id": "1", "status": "open"}`)); !ok || msg.Type != MsgTypeDBEntered {
+		t.Errorf("expected the document entering the result set to be sent as entered got %v", msg)
+	}
+
+	if msg, ok := lq.Apply(event(MsgTypeDBUpdated, `{"id": "1", "status": "open"}`, `{"id": "1", "status": "open", "title": "t"}`)); !ok || msg.Type != MsgTypeDBUpdated {
+		t.Errorf("expected the document staying in the result set to be sent as updated got %v", msg)
+	}
+
+	if _, ok := lq.Apply(event(MsgTypeDBDeleted, `{"id": "2", "status": "done"}`, `null`)); ok {
+		t.Error("expected the delete of a non-matching document to be filtered")
+	}
+
+	if msg, ok := lq.Apply(event(MsgTypeDBDeleted, `{"id": "1", "status": "open"}`, `null`)); !ok || msg.Type != MsgTypeDBDeleted {
+		t.Errorf("expected the delete of a matching document to be sent got %v", msg)
+	}
+}
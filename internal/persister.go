@@ -1,5 +1,7 @@
 package internal
 
+import "time"
+
 const (
 	DataStorePostgreSQL = "postgresql"
 	DataStoreMongoDB    = "mongo"
@@ -18,6 +20,7 @@ type Persister interface {
 	DatabaseExists(name string) (bool, error)
 	ListDatabases() ([]BaseConfig, error)
 	IncrementMonthlyEmailSent(baseID string) error
+	UpdateBaseSettings(baseID string, settings BaseSettings) error
 	GetCustomerByStripeID(stripeID string) (cus Customer, err error)
 	ActivateCustomer(customerID string) error
 	NewID() string
@@ -39,6 +42,36 @@ type Persister interface {
 	SetUserRole(dbName, email string, role int) error
 	UserSetPassword(dbName, tokenID, password string) error
 
+	// account invitations
+	CreateInvitation(dbName string, inv Invitation) (id string, err error)
+	FindInvitation(dbName, code string) (Invitation, error)
+	ListInvitations(dbName, accountID string) ([]Invitation, error)
+	DeleteInvitation(dbName, accountID, id string) error
+
+	// scoped API keys
+	CreateAPIKey(dbName string, key APIKey) (id string, err error)
+	FindAPIKey(dbName, id string) (APIKey, error)
+	ListAPIKeys(dbName string) ([]APIKey, error)
+	APIKeyUsed(dbName, id string, at time.Time) error
+	DeleteAPIKey(dbName, id string) error
+
+	// JWT signing keys
+	AddSigningKey(dbName string, key SigningKey) error
+	ListSigningKeys(dbName string) ([]SigningKey, error)
+	ExpireSigningKey(dbName, id string, expires time.Time) error
+	DeleteSigningKey(dbName, id string) error
+
+	// outgoing webhooks and their deliveries
+	AddWebhook(dbName string, wh Webhook) (id string, err error)
+	ListWebhooks(dbName string) ([]Webhook, error)
+	DeleteWebhook(dbName, id string) error
+	UpdateWebhookSecret(dbName, id, secret string) error
+	AddWebhookDelivery(dbName string, d WebhookDelivery) (id string, err error)
+	UpdateWebhookDelivery(dbName string, d WebhookDelivery) error
+	GetWebhookDelivery(dbName, id string) (WebhookDelivery, error)
+	ListWebhookDeliveries(dbName, webhookID, state string) ([]WebhookDelivery, error)
+	ListDueWebhookDeliveries(dbName string, now time.Time) ([]WebhookDelivery, error)
+
 	// base CRUD
 	CreateDocument(auth Auth, dbName, col string, doc map[string]interface{}) (map[string]interface{}, error)
 	BulkCreateDocument(auth Auth, dbName, col string, docs []interface{}) error
@@ -51,6 +84,12 @@ type Persister interface {
 	ListCollections(dbName string) ([]string, error)
 	ParseQuery(clauses [][]interface{}) (map[string]interface{}, error)
 
+	// collection permission rules
+	SaveRule(dbName string, rule Rule) error
+	GetRule(dbName, col string) (Rule, error)
+	ListRules(dbName string) ([]Rule, error)
+	DeleteRule(dbName, col string) error
+
 	// form functions
 	AddFormSubmission(dbName, form string, doc map[string]interface{}) error
 	ListFormSubmissions(dbName, name string) ([]map[string]interface{}, error)
@@ -59,6 +98,7 @@ type Persister interface {
 	// Function functions
 	AddFunction(dbName string, data ExecData) (string, error)
 	UpdateFunction(dbName, id, code, trigger string) error
+	UpdateFunctionLimits(dbName, id string, limits FunctionLimits) error
 	GetFunctionForExecution(dbName, name string) (ExecData, error)
 	GetFunctionByID(dbName, id string) (ExecData, error)
 	GetFunctionByName(dbName, name string) (ExecData, error)
@@ -66,6 +106,18 @@ type Persister interface {
 	ListFunctionsByTrigger(dbName, trigger string) ([]ExecData, error)
 	DeleteFunction(dbName, name string) error
 	RanFunction(dbName, id string, rh ExecHistory) error
+	ListFunctionRuns(dbName, id string, filter RunFilter) (FunctionRuns, error)
+	DeleteFunctionRuns(dbName string, before time.Time) error
+	ListFunctionVersions(dbName, id string) ([]FunctionVersion, error)
+	GetFunctionVersion(dbName, id string, version int) (FunctionVersion, error)
+	PinFunctionVersion(dbName, id string, version int) error
+	UpdateFunctionRetry(dbName, id string, retry RetryPolicy) error
+	AddFunctionDeadLetter(dbName string, dl FunctionDeadLetter) (id string, err error)
+	UpdateFunctionDeadLetter(dbName string, dl FunctionDeadLetter) error
+	GetFunctionDeadLetter(dbName, id string) (FunctionDeadLetter, error)
+	ListFunctionDeadLetters(dbName, functionID string) ([]FunctionDeadLetter, error)
+	ListDueFunctionDeadLetters(dbName string, now time.Time) ([]FunctionDeadLetter, error)
+	DeleteFunctionDeadLetter(dbName, id string) error
 
 	// schedule tasks
 	ListTasks() ([]Task, error)
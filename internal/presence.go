@@ -0,0 +1,13 @@
+package internal
+
+import "time"
+
+// PresenceMember is a connection present in a channel. Members refresh their
+// presence periodically, the ones that stop are considered gone once their
+// TTL expires.
+type PresenceMember struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"userId"`
+	AccountID string    `json:"accountId"`
+	Joined    time.Time `json:"joined"`
+}
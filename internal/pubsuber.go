@@ -1,5 +1,7 @@
 package internal
 
+import "time"
+
 // PubSuber contains functions to make realtime communication distributed
 type PubSuber interface {
 	Get(key string) (string, error)
@@ -8,7 +10,17 @@ type PubSuber interface {
 	SetTyped(key string, v interface{}) error
 	Inc(key string, by int64) (int64, error)
 	Dec(key string, by int64) (int64, error)
+	QueueWork(key, value string) error
+	DequeueWork(key string) (string, error)
 	Subscribe(send chan Command, token, channel string, close chan bool)
 	Publish(msg Command) error
-	PublishDocument(channel, typ string, v interface{})
+	// Broadcast publishes to the channel's subscribers only, the system
+	// channel does not receive the message
+	Broadcast(msg Command) error
+	PublishDocument(channel string, evt DocumentEvent)
+	JoinPresence(channel string, member PresenceMember, ttl time.Duration) error
+	LeavePresence(channel, id string) (bool, error)
+	PresenceMembers(channel string) ([]PresenceMember, error)
+	AppendHistory(channel string, msg Command, maxLen int64) (string, error)
+	History(channel, since string, limit int64) ([]Command, error)
 }
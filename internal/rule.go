@@ -0,0 +1,643 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RuleRead   = "read"
+	RuleWrite  = "write"
+	RuleDelete = "delete"
+)
+
+// Rule holds the declarative permission conditions of a collection.
+//
+// Conditions are expressions like:
+//
+//	auth.role >= 50 || doc.ownerId == auth.userId
+//
+// When a condition is empty, the collection name permission (i.e. _770_)
+// is used.
+type Rule struct {
+	ID         string    `json:"id"`
+	Collection string    `json:"collection"`
+	Read       string    `json:"read"`
+	Write      string    `json:"write"`
+	Delete     string    `json:"delete"`
+	Updated    time.Time `json:"updated"`
+}
+
+// RuleFinder returns a collection's rule, an empty rule when it has none
+type RuleFinder func(dbName, col string) (Rule, error)
+
+// Condition returns the condition for an operation. The delete operation
+// falls back on the write condition if not specified.
+func (r Rule) Condition(op string) string {
+	switch op {
+	case RuleRead:
+		return r.Read
+	case RuleWrite:
+		return r.Write
+	case RuleDelete:
+		if len(r.Delete) > 0 {
+			return r.Delete
+		}
+		return r.Write
+	}
+	return ""
+}
+
+// Validate makes sure all conditions can be parsed.
+func (r Rule) Validate() error {
+	if len(r.Collection) == 0 {
+		return errors.New("a rule needs a collection")
+	}
+
+	for _, op := range []string{RuleRead, RuleWrite, RuleDelete} {
+		cond := r.Condition(op)
+		if len(cond) == 0 {
+			continue
+		}
+
+		e, err := ParseRule(cond)
+		if err != nil {
+			return fmt.Errorf("invalid %s condition: %v", op, err)
+		}
+
+		if err := checkIdents(e); err != nil {
+			return fmt.Errorf("invalid %s condition: %v", op, err)
+		}
+	}
+	return nil
+}
+
+// ruleAuthFields are the auth fields available to the conditions, see
+// RuleEnv
+var ruleAuthFields = map[string]bool{
+	"userId":    true,
+	"accountId": true,
+	"email":     true,
+	"role":      true,
+}
+
+// checkIdents makes sure the identifiers are auth or doc fields, they would
+// otherwise always be null once evaluated.
+func checkIdents(e Expr) error {
+	switch x := e.(type) {
+	case Ident:
+		switch x.Root() {
+		case "auth":
+			if !ruleAuthFields[x.Field()] {
+				return fmt.Errorf("unknown auth field %q", x.Field())
+			}
+		case "doc":
+			if len(x.Field()) == 0 {
+				return errors.New("doc needs a field, i.e. doc.ownerId")
+			}
+		default:
+			return fmt.Errorf("unknown identifier %q, it should start with auth. or doc.", x.Name)
+		}
+	case NotExpr:
+		return checkIdents(x.X)
+	case BinaryExpr:
+		if err := checkIdents(x.Left); err != nil {
+			return err
+		}
+		return checkIdents(x.Right)
+	}
+	return nil
+}
+
+// RuleEnv returns the variables available to rule conditions.
+func RuleEnv(auth Auth, doc map[string]interface{}) map[string]interface{} {
+	env := make(map[string]interface{})
+	env["auth"] = map[string]interface{}{
+		"userId":    auth.UserID,
+		"accountId": auth.AccountID,
+		"email":     auth.Email,
+		"role":      float64(auth.Role),
+	}
+
+	if doc != nil {
+		env["doc"] = doc
+	}
+	return env
+}
+
+// Expr is a parsed rule condition node.
+type Expr interface{}
+
+// BinaryExpr represents logical (&&, ||) and comparison operations.
+type BinaryExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+// NotExpr negates its expression.
+type NotExpr struct {
+	X Expr
+}
+
+// Ident is a variable reference like auth.userId or doc.status.
+type Ident struct {
+	Name string
+}
+
+// Root returns the first part of the identifier (auth or doc).
+func (id Ident) Root() string {
+	return strings.Split(id.Name, ".")[0]
+}
+
+// Field returns the identifier without its root.
+func (id Ident) Field() string {
+	idx := strings.Index(id.Name, ".")
+	if idx == -1 {
+		return ""
+	}
+	return id.Name[idx+1:]
+}
+
+// Literal is a string, number (float64), bool or nil value.
+type Literal struct {
+	Value interface{}
+}
+
+// IsComparison returns true for the comparison operators.
+func IsComparison(op string) bool {
+	switch op {
+	case "==", "!=", "<", ">", "<=", ">=":
+		return true
+	}
+	return false
+}
+
+// FlipComparison returns the operator to use when swapping operands.
+func FlipComparison(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case ">":
+		return "<"
+	case "<=":
+		return ">="
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+// ParseRule parses a rule condition.
+func ParseRule(s string) (Expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ruleParser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s", p.tokens[p.pos].val)
+	}
+	return e, nil
+}
+
+// EvalRule parses and evaluates a condition, it must return a boolean.
+func EvalRule(cond string, env map[string]interface{}) (bool, error) {
+	e, err := ParseRule(cond)
+	if err != nil {
+		return false, err
+	}
+
+	v, err := Eval(e, env)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition did not return a boolean: %v", v)
+	}
+	return b, nil
+}
+
+// Eval evaluates an expression with the variables from env.
+func Eval(e Expr, env map[string]interface{}) (interface{}, error) {
+	switch x := e.(type) {
+	case Literal:
+		return x.Value, nil
+	case Ident:
+		return lookup(env, x.Name), nil
+	case NotExpr:
+		v, err := Eval(x.X, env)
+		if err != nil {
+			return nil, err
+		}
+
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("cannot negate a non boolean value: %v", v)
+		}
+		return !b, nil
+	case BinaryExpr:
+		l, err := Eval(x.Left, env)
+		if err != nil {
+			return nil, err
+		}
+
+		if x.Op == "&&" || x.Op == "||" {
+			lb, ok := l.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%s expects boolean values", x.Op)
+			}
+
+			// short-circuit
+			if x.Op == "&&" && !lb {
+				return false, nil
+			} else if x.Op == "||" && lb {
+				return true, nil
+			}
+
+			r, err := Eval(x.Right, env)
+			if err != nil {
+				return nil, err
+			}
+
+			rb, ok := r.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%s expects boolean values", x.Op)
+			}
+			return rb, nil
+		}
+
+		r, err := Eval(x.Right, env)
+		if err != nil {
+			return nil, err
+		}
+
+		return Compare(x.Op, l, r)
+	}
+	return nil, fmt.Errorf("unknown expression %v", e)
+}
+
+// BindRule replaces identifiers available in env by their values and
+// simplifies the expression. Identifiers not found in env (like doc.*) are
+// kept, so a database can translate the remaining expression into a filter.
+func BindRule(e Expr, env map[string]interface{}) (Expr, error) {
+	switch x := e.(type) {
+	case Ident:
+		if _, ok := env[x.Root()]; ok {
+			return Literal{Value: lookup(env, x.Name)}, nil
+		}
+		return x, nil
+	case NotExpr:
+		inner, err := BindRule(x.X, env)
+		if err != nil {
+			return nil, err
+		}
+
+		if lit, ok := inner.(Literal); ok {
+			b, ok := lit.Value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("cannot negate a non boolean value: %v", lit.Value)
+			}
+			return Literal{Value: !b}, nil
+		}
+		return NotExpr{X: inner}, nil
+	case BinaryExpr:
+		l, err := BindRule(x.Left, env)
+		if err != nil {
+			return nil, err
+		}
+		r, err := BindRule(x.Right, env)
+		if err != nil {
+			return nil, err
+		}
+
+		ll, lok := l.(Literal)
+		rl, rok := r.(Literal)
+
+		if x.Op == "&&" || x.Op == "||" {
+			// a known side can short-circuit or vanish
+			for _, side := range []struct {
+				lit   Literal
+				ok    bool
+				other Expr
+			}{{ll, lok, r}, {rl, rok, l}} {
+				if !side.ok {
+					continue
+				}
+
+				b, ok := side.lit.Value.(bool)
+				if !ok {
+					return nil, fmt.Errorf("%s expects boolean values", x.Op)
+				}
+
+				if x.Op == "&&" && !b {
+					return Literal{Value: false}, nil
+				} else if x.Op == "||" && b {
+					return Literal{Value: true}, nil
+				}
+				return side.other, nil
+			}
+			return BinaryExpr{Op: x.Op, Left: l, Right: r}, nil
+		}
+
+		if lok && rok {
+			v, err := Compare(x.Op, ll.Value, rl.Value)
+			if err != nil {
+				return nil, err
+			}
+			return Literal{Value: v}, nil
+		}
+		return BinaryExpr{Op: x.Op, Left: l, Right: r}, nil
+	}
+	return e, nil
+}
+
+// Compare applies a comparison operator on two values.
+func Compare(op string, l, r interface{}) (bool, error) {
+	lf, lnum := toFloat(l)
+	rf, rnum := toFloat(r)
+
+	switch op {
+	case "==", "!=":
+		eq := false
+		if l == nil || r == nil {
+			eq = l == nil && r == nil
+		} else if lnum && rnum {
+			eq = lf == rf
+		} else {
+			eq = fmt.Sprintf("%v", l) == fmt.Sprintf("%v", r)
+		}
+
+		if op == "!=" {
+			return !eq, nil
+		}
+		return eq, nil
+	case "<", ">", "<=", ">=":
+		if l == nil || r == nil {
+			return false, nil
+		}
+
+		var c int
+		if lnum && rnum {
+			if lf < rf {
+				c = -1
+			} else if lf > rf {
+				c = 1
+			}
+		} else {
+			c = strings.Compare(fmt.Sprintf("%v", l), fmt.Sprintf("%v", r))
+		}
+
+		switch op {
+		case "<":
+			return c < 0, nil
+		case ">":
+			return c > 0, nil
+		case "<=":
+			return c <= 0, nil
+		default:
+			return c >= 0, nil
+		}
+	}
+	return false, fmt.Errorf("unsupported operator %s", op)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func lookup(env map[string]interface{}, name string) interface{} {
+	var cur interface{} = env
+	for _, part := range strings.Split(name, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		cur, ok = m[part]
+		if !ok {
+			return nil
+		}
+	}
+	return cur
+}
+
+type ruleToken struct {
+	kind string // ident, string, number, op
+	val  string
+}
+
+func tokenize(s string) ([]ruleToken, error) {
+	var tokens []ruleToken
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, ruleToken{kind: "op", val: string(c)})
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(s[i+1:], c)
+			if end == -1 {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, ruleToken{kind: "string", val: s[i+1 : i+1+end]})
+			i += end + 2
+		case isDigit(c) || (c == '-' && i+1 < len(s) && isDigit(s[i+1])):
+			start := i
+			i++
+			for i < len(s) && (isDigit(s[i]) || s[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, ruleToken{kind: "number", val: s[start:i]})
+		case isIdentStart(c):
+			start := i
+			for i < len(s) && (isIdentStart(s[i]) || isDigit(s[i]) || s[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, ruleToken{kind: "ident", val: s[start:i]})
+		default:
+			matched := false
+			for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!"} {
+				if strings.HasPrefix(s[i:], op) {
+					tokens = append(tokens, ruleToken{kind: "op", val: op})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+type ruleParser struct {
+	tokens []ruleToken
+	pos    int
+}
+
+func (p *ruleParser) peek() (ruleToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return ruleToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *ruleParser) acceptOp(ops ...string) (string, bool) {
+	t, ok := p.peek()
+	if !ok || t.kind != "op" {
+		return "", false
+	}
+
+	for _, op := range ops {
+		if t.val == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *ruleParser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := p.acceptOp("||"); !ok {
+			return left, nil
+		}
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = BinaryExpr{Op: "||", Left: left, Right: right}
+	}
+}
+
+func (p *ruleParser) parseAnd() (Expr, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := p.acceptOp("&&"); !ok {
+			return left, nil
+		}
+
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = BinaryExpr{Op: "&&", Left: left, Right: right}
+	}
+}
+
+func (p *ruleParser) parseComparison() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	op, ok := p.acceptOp("==", "!=", "<=", ">=", "<", ">")
+	if !ok {
+		return left, nil
+	}
+
+	right, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return BinaryExpr{Op: op, Left: left, Right: right}, nil
+}
+
+func (p *ruleParser) parseUnary() (Expr, error) {
+	if _, ok := p.acceptOp("!"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return NotExpr{X: x}, nil
+	}
+
+	if _, ok := p.acceptOp("("); ok {
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := p.acceptOp(")"); !ok {
+			return nil, errors.New("missing closing parenthesis")
+		}
+		return e, nil
+	}
+
+	t, ok := p.peek()
+	if !ok {
+		return nil, errors.New("unexpected end of condition")
+	}
+	p.pos++
+
+	switch t.kind {
+	case "string":
+		return Literal{Value: t.val}, nil
+	case "number":
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, err
+		}
+		return Literal{Value: f}, nil
+	case "ident":
+		switch t.val {
+		case "true":
+			return Literal{Value: true}, nil
+		case "false":
+			return Literal{Value: false}, nil
+		case "null":
+			return Literal{Value: nil}, nil
+		}
+		return Ident{Name: t.val}, nil
+	}
+	return nil, fmt.Errorf("unexpected %s", t.val)
+}
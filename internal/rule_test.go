@@ -0,0 +1,101 @@
+package internal
+
+import "testing"
+
+func TestEvalRule(t *testing.T) {
+	auth := Auth{AccountID: "acct1", UserID: "user1", Email: "a@b.com", Role: 50}
+
+	doc := map[string]interface{}{
+		"ownerId": "user1",
+		"status":  "published",
+		"likes":   float64(10),
+	}
+
+	tables := make(map[string]bool)
+	tables["true"] = true
+	tables["auth.role >= 50"] = true
+	tables["auth.role > 50"] = false
+	tables["doc.ownerId == auth.userId"] = true
+	tables["doc.status == 'draft' || auth.role >= 100"] = false
+	tables[`doc.status == "published" && doc.likes > 5`] = true
+	tables["!(doc.likes < 5)"] = true
+	tables["doc.missing == null"] = true
+	tables["(auth.email != 'a@b.com' || doc.likes == 10) && auth.accountId == 'acct1'"] = true
+
+	env := RuleEnv(auth, doc)
+	for cond, expected := range tables {
+		ok, err := EvalRule(cond, env)
+		if err != nil {
+			t.Fatalf("%s: %v", cond, err)
+		} else if ok != expected {
+			t.Errorf("%s: expected %v got %v", cond, expected, ok)
+		}
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	invalids := []string{
+		"auth.role >=",
+		"(auth.role == 1",
+		"doc.name == 'unterminated",
+		"auth.role # 1",
+	}
+
+	for _, cond := range invalids {
+		if _, err := ParseRule(cond); err == nil {
+			t.Errorf("%s: expected a parsing error", cond)
+		}
+	}
+}
+
+func TestBindRule(t *testing.T) {
+	auth := Auth{AccountID: "acct1", UserID: "user1", Role: 0}
+
+	e, err := ParseRule("auth.role >= 100 || doc.ownerId == auth.userId")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bound, err := BindRule(e, RuleEnv(auth, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bin, ok := bound.(BinaryExpr)
+	if !ok {
+		t.Fatalf("expected a comparison got %v", bound)
+	} else if bin.Op != "==" {
+		t.Errorf("expected == got %s", bin.Op)
+	} else if id, ok := bin.Left.(Ident); !ok || id.Field() != "ownerId" {
+		t.Errorf("expected left to be doc.ownerId got %v", bin.Left)
+	} else if lit, ok := bin.Right.(Literal); !ok || lit.Value != "user1" {
+		t.Errorf("expected right to be user1 got %v", bin.Right)
+	}
+
+	auth.Role = 100
+	bound, err = BindRule(e, RuleEnv(auth, nil))
+	if err != nil {
+		t.Fatal(err)
+	} else if lit, ok := bound.(Literal); !ok || lit.Value != true {
+		t.Errorf("expected root to always be true got %v", bound)
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	tables := make(map[string]bool)
+	tables["doc.ownerId == auth.userId"] = true
+	tables["auth.role >= 50 && !(doc.status == 'draft')"] = true
+	tables["user.id == doc.ownerId"] = false
+	tables["auth.name == 'x'"] = false
+	tables["doc == null"] = false
+	tables["true || session.role > 1"] = false
+
+	for cond, valid := range tables {
+		err := Rule{Collection: "tasks", Read: cond}.Validate()
+		if valid && err != nil {
+			t.Errorf("%s: expected a valid rule got %v", cond, err)
+		} else if !valid && err == nil {
+			t.Errorf("%s: expected an invalid rule", cond)
+		}
+	}
+}
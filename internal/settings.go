@@ -0,0 +1,233 @@
+package internal
+
+import (
+	"strings"
+	"time"
+)
+
+// BaseSettings holds the configuration a base can change
+type BaseSettings struct {
+	RateLimit RateLimitSettings `bson:"rateLimit" json:"rateLimit"`
+	History   HistorySettings   `bson:"history" json:"history"`
+	Realtime  RealtimeSettings  `bson:"realtime" json:"realtime"`
+	Functions FunctionLimits    `bson:"functions" json:"functions"`
+	Fetch     FetchSettings     `bson:"fetch" json:"fetch"`
+	// FunctionLogs is the retention of the functions' runs
+	FunctionLogs FunctionLogSettings `bson:"functionLogs" json:"functionLogs"`
+}
+
+// RateLimit allows Requests per Window seconds
+type RateLimit struct {
+	Requests int64 `bson:"requests" json:"requests"`
+	Window   int   `bson:"window" json:"window"`
+}
+
+// Duration returns the window as a time.Duration
+func (rl RateLimit) Duration() time.Duration {
+	return time.Duration(rl.Window) * time.Second
+}
+
+// RateLimitSettings are the budgets of the rate limited routes. Zero values
+// use the defaults.
+//
+// After MaxFailures failed requests on a route for the same identity or from
+// the same IP, it gets locked out of the route for Lockout seconds. The lockout doubles each time it happens again
+// within a day, up to MaxLockout seconds.
+type RateLimitSettings struct {
+	PerIP       RateLimit `bson:"perIp" json:"perIp"`
+	PerIdentity RateLimit `bson:"perIdentity" json:"perIdentity"`
+	MaxFailures int64     `bson:"maxFailures" json:"maxFailures"`
+	Lockout     int       `bson:"lockout" json:"lockout"`
+	MaxLockout  int       `bson:"maxLockout" json:"maxLockout"`
+}
+
+// WithDefaults returns the settings with the zero values set to defaults
+func (s RateLimitSettings) WithDefaults() RateLimitSettings {
+	if s.PerIP.Requests <= 0 || s.PerIP.Window <= 0 {
+		s.PerIP = RateLimit{Requests: 30, Window: 60}
+	}
+	if s.PerIdentity.Requests <= 0 || s.PerIdentity.Window <= 0 {
+		s.PerIdentity = RateLimit{Requests: 10, Window: 60}
+	}
+	if s.MaxFailures <= 0 {
+		s.MaxFailures = 5
+	}
+	if s.Lockout <= 0 {
+		s.Lockout = 60
+	}
+	if s.MaxLockout <= 0 {
+		s.MaxLockout = 3600
+	}
+	return s
+}
+
+// LockoutFor returns the lockout duration of the nth lockout
+func (s RateLimitSettings) LockoutFor(n int64) time.Duration {
+	d := time.Duration(s.Lockout) * time.Second
+	max := time.Duration(s.MaxLockout) * time.Second
+	for i := int64(1); i < n && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		return max
+	}
+	return d
+}
+
+// HistorySettings lists the realtime channels keeping their last MaxLen
+// messages so clients can replay what they missed. A channel ending with *
+// matches all channels starting with its prefix.
+type HistorySettings struct {
+	Channels []string `bson:"channels" json:"channels"`
+	MaxLen   int64    `bson:"maxLen" json:"maxLen"`
+}
+
+// WithDefaults returns the settings with the zero values set to defaults
+func (s HistorySettings) WithDefaults() HistorySettings {
+	if s.MaxLen <= 0 {
+		s.MaxLen = 100
+	}
+	return s
+}
+
+// Keeps returns true if the channel keeps an history
+func (s HistorySettings) Keeps(channel string) bool {
+	for _, name := range s.Channels {
+		if strings.HasSuffix(name, "*") {
+			if strings.HasPrefix(channel, strings.TrimSuffix(name, "*")) {
+				return true
+			}
+		} else if name == channel {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// SlowConsumerDisconnect disconnects the clients not reading fast enough
+	SlowConsumerDisconnect = "disconnect"
+	// SlowConsumerDropOldest drops the oldest queued message of slow clients
+	SlowConsumerDropOldest = "drop_oldest"
+	// SlowConsumerDropNewest drops the new messages of slow clients
+	SlowConsumerDropNewest = "drop_newest"
+)
+
+// MaxRealtimeMessageSize is the largest message size a base can allow
+const MaxRealtimeMessageSize = 1 << 20
+
+// RealtimeSettings configures the realtime connections. QueueSize messages
+// can wait to be sent to a client, after that the SlowConsumer policy
+// applies. Clients can send WebSocket messages up to MaxMessageSize bytes.
+type RealtimeSettings struct {
+	QueueSize      int    `bson:"queueSize" json:"queueSize"`
+	SlowConsumer   string `bson:"slowConsumer" json:"slowConsumer"`
+	MaxMessageSize int64  `bson:"maxMessageSize" json:"maxMessageSize"`
+}
+
+// WithDefaults returns the settings with the zero values set to defaults
+func (s RealtimeSettings) WithDefaults() RealtimeSettings {
+	if s.QueueSize <= 0 {
+		s.QueueSize = 256
+	}
+
+	switch s.SlowConsumer {
+	case SlowConsumerDisconnect, SlowConsumerDropOldest, SlowConsumerDropNewest:
+	default:
+		s.SlowConsumer = SlowConsumerDisconnect
+	}
+
+	if s.MaxMessageSize <= 0 {
+		s.MaxMessageSize = 512
+	} else if s.MaxMessageSize > MaxRealtimeMessageSize {
+		s.MaxMessageSize = MaxRealtimeMessageSize
+	}
+	return s
+}
+
+// MaxFunctionLogRetention is the most days a base can keep its function runs
+const MaxFunctionLogRetention = 365
+
+// FunctionLogSettings keeps the functions' runs and their logs for
+// RetentionDays days.
+type FunctionLogSettings struct {
+	RetentionDays int `bson:"retentionDays" json:"retentionDays"`
+}
+
+// WithDefaults returns the settings with the zero values set to defaults
+func (s FunctionLogSettings) WithDefaults() FunctionLogSettings {
+	if s.RetentionDays <= 0 {
+		s.RetentionDays = 30
+	} else if s.RetentionDays > MaxFunctionLogRetention {
+		s.RetentionDays = MaxFunctionLogRetention
+	}
+	return s
+}
+
+// Retention returns the retention as a time.Duration
+func (s FunctionLogSettings) Retention() time.Duration {
+	return time.Duration(s.RetentionDays) * 24 * time.Hour
+}
+
+// MaxFetchResponseSize is the largest response a base can allow functions to
+// fetch
+const MaxFetchResponseSize = 10 << 20
+
+// FetchSettings restricts the HTTP calls of the functions' fetch helper.
+//
+// Hosts in DeniedHosts are never called and when AllowedHosts is not empty
+// only its hosts can be called. A host starting with *. matches all its
+// subdomains. Private, loopback and link-local addresses are blocked unless
+// AllowPrivate is set.
+type FetchSettings struct {
+	AllowedHosts    []string `bson:"allowedHosts" json:"allowedHosts"`
+	DeniedHosts     []string `bson:"deniedHosts" json:"deniedHosts"`
+	AllowPrivate    bool     `bson:"allowPrivate" json:"allowPrivate"`
+	Timeout         int      `bson:"timeout" json:"timeout"`
+	MaxResponseSize int64    `bson:"maxResponseSize" json:"maxResponseSize"`
+}
+
+// WithDefaults returns the settings with the zero values set to defaults
+func (s FetchSettings) WithDefaults() FetchSettings {
+	if s.Timeout <= 0 {
+		s.Timeout = 10
+	}
+
+	if s.MaxResponseSize <= 0 {
+		s.MaxResponseSize = 1 << 20
+	} else if s.MaxResponseSize > MaxFetchResponseSize {
+		s.MaxResponseSize = MaxFetchResponseSize
+	}
+	return s
+}
+
+// HostAllowed returns true if the host can be called
+func (s FetchSettings) HostAllowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, h := range s.DeniedHosts {
+		if hostMatch(h, host) {
+			return false
+		}
+	}
+
+	if len(s.AllowedHosts) == 0 {
+		return true
+	}
+
+	for _, h := range s.AllowedHosts {
+		if hostMatch(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func hostMatch(pattern, host string) bool {
+	pattern = strings.ToLower(pattern)
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return pattern == host
+}
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitLockoutBackoff(t *testing.T) {
+	s := RateLimitSettings{Lockout: 60, MaxLockout: 300}.WithDefaults()
+
+	tables := make(map[int64]time.Duration)
+	tables[1] = 60 * time.Second
+	tables[2] = 120 * time.Second
+	tables[3] = 240 * time.Second
+	tables[4] = 300 * time.Second
+	tables[10] = 300 * time.Second
+
+	for n, expected := range tables {
+		if d := s.LockoutFor(n); d != expected {
+			t.Errorf("lockout %d: expected %v got %v", n, expected, d)
+		}
+	}
+}
+
+func TestRateLimitDefaults(t *testing.T) {
+	s := RateLimitSettings{PerIP: RateLimit{Requests: 5, Window: 10}}.WithDefaults()
+	if s.PerIP.Requests != 5 || s.PerIP.Duration() != 10*time.Second {
+		t.Errorf("expected custom per IP limit to be kept got %v", s.PerIP)
+	} else if s.PerIdentity.Requests == 0 || s.MaxFailures == 0 {
+		t.Errorf("expected defaults to be set got %v", s)
+	}
+}
+
+func TestHistoryKeeps(t *testing.T) {
+	s := HistorySettings{Channels: []string{"chat-*", "news"}}
+
+	tables := make(map[string]bool)
+	tables["chat-42"] = true
+	tables["chat-"] = true
+	tables["news"] = true
+	tables["newsletter"] = false
+	tables["db-tasks"] = false
+
+	for channel, expected := range tables {
+		if ok := s.Keeps(channel); ok != expected {
+			t.Errorf("%s: expected %v got %v", channel, expected, ok)
+		}
+	}
+
+	if s.WithDefaults().MaxLen != 100 {
+		t.Errorf("expected a default max length of 100 got %d", s.WithDefaults().MaxLen)
+	}
+}
+
+func TestRealtimeDefaults(t *testing.T) {
+	s := RealtimeSettings{SlowConsumer: "unknown"}.WithDefaults()
+	if s.QueueSize != 256 || s.SlowConsumer != SlowConsumerDisconnect {
+		t.Errorf("expected a 256 queue and the disconnect policy got %v", s)
+	}
+
+	s = RealtimeSettings{QueueSize: 10, SlowConsumer: SlowConsumerDropOldest}.WithDefaults()
+	if s.QueueSize != 10 || s.SlowConsumer != SlowConsumerDropOldest {
+		t.Errorf("expected the custom settings to be kept got %v", s)
+	}
+}
+
+func TestFunctionLimitsWithin(t *testing.T) {
+	base := FunctionLimits{Timeout: 30, MaxMemory: 5000}
+
+	l := FunctionLimits{}.Within(base)
+	if l.Timeout != 30 || l.MaxCallStack != 1000 || l.MaxMemory != MaxFunctionMemory {
+		t.Errorf("expected the base limits with defaults got %v", l)
+	}
+
+	l = FunctionLimits{Timeout: 5, MaxCallStack: 50000, MaxMemory: 16}.Within(base)
+	if l.Timeout != 5 || l.MaxCallStack != 1000 || l.MaxMemory != 16 {
+		t.Errorf("expected the function limits bounded by the base got %v", l)
+	}
+
+	if d := l.TimeoutDuration(); d != 5*time.Second {
+		t.Errorf("expected 5s got %v", d)
+	}
+}
+
+func TestFetchHostAllowed(t *testing.T) {
+	s := FetchSettings{
+		AllowedHosts: []string{"api.stripe.com", "*.slack.com"},
+		DeniedHosts:  []string{"evil.slack.com"},
+	}
+
+	tables := make(map[string]bool)
+	tables["api.stripe.com"] = true
+	tables["API.Stripe.com."] = true
+	tables["hooks.slack.com"] = true
+	tables["slack.com"] = false
+	tables["evil.slack.com"] = false
+	tables["example.com"] = false
+
+	for host, expected := range tables {
+		if ok := s.HostAllowed(host); ok != expected {
+			t.Errorf("%s: expected %v got %v", host, expected, ok)
+		}
+	}
+
+	if !(FetchSettings{}).HostAllowed("example.com") {
+		t.Error("expected all hosts to be allowed without an allow list")
+	}
+}
+
+func TestFunctionLogSettingsDefaults(t *testing.T) {
+	tables := make(map[int]time.Duration)
+	tables[0] = 30 * 24 * time.Hour
+	tables[7] = 7 * 24 * time.Hour
+	tables[5000] = MaxFunctionLogRetention * 24 * time.Hour
+
+	for days, expected := range tables {
+		s := FunctionLogSettings{RetentionDays: days}.WithDefaults()
+		if d := s.Retention(); d != expected {
+			t.Errorf("%d days: expected %v got %v", days, expected, d)
+		}
+	}
+}
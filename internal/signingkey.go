@@ -0,0 +1,240 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gbrlsnchs/jwt/v3"
+)
+
+const (
+	SigningAlgHS256 = "HS256"
+	SigningAlgRS256 = "RS256"
+	SigningAlgEdDSA = "EdDSA"
+)
+
+// SigningKey is a per-base key used to sign and verify JWT. The key ID is
+// sent in the "kid" header of the tokens it signs.
+//
+// A key with a zero Expires is the active key. Once rotated, a key keeps
+// verifying tokens until Expires.
+type SigningKey struct {
+	ID        string    `json:"id"`
+	Algorithm string    `json:"alg"`
+	Private   []byte    `json:"-"`
+	Public    []byte    `json:"-"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+}
+
+// IsActive returns true if this key can sign new tokens
+func (k SigningKey) IsActive() bool {
+	return k.Expires.IsZero()
+}
+
+// IsExpired returns true if this key cannot verify tokens anymore
+func (k SigningKey) IsExpired() bool {
+	return !k.Expires.IsZero() && time.Now().After(k.Expires)
+}
+
+// GenerateSigningKey creates a new key for the algorithm
+func GenerateSigningKey(alg string) (SigningKey, error) {
+	key := SigningKey{Algorithm: alg, Created: time.Now()}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return key, err
+	}
+	key.ID = hex.EncodeToString(id)
+
+	switch alg {
+	case SigningAlgHS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return key, err
+		}
+		key.Private = secret
+	case SigningAlgRS256:
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return key, err
+		}
+		key.Private = x509.MarshalPKCS1PrivateKey(priv)
+		key.Public = x509.MarshalPKCS1PublicKey(&priv.PublicKey)
+	case SigningAlgEdDSA:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return key, err
+		}
+		key.Private = priv
+		key.Public = pub
+	default:
+		return key, fmt.Errorf("unsupported signing algorithm: %s", alg)
+	}
+	return key, nil
+}
+
+// Signer returns the jwt.Algorithm for this key
+func (k SigningKey) Signer() (jwt.Algorithm, error) {
+	switch k.Algorithm {
+	case SigningAlgHS256:
+		return jwt.NewHS256(k.Private), nil
+	case SigningAlgRS256:
+		pub, err := x509.ParsePKCS1PublicKey(k.Public)
+		if err != nil {
+			return nil, err
+		}
+
+		opts := []func(*jwt.RSASHA){jwt.RSAPublicKey(pub)}
+		if len(k.Private) > 0 {
+			priv, err := x509.ParsePKCS1PrivateKey(k.Private)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, jwt.RSAPrivateKey(priv))
+		}
+		return jwt.NewRS256(opts...), nil
+	case SigningAlgEdDSA:
+		if len(k.Public) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+
+		opts := []func(*jwt.Ed25519){jwt.Ed25519PublicKey(ed25519.PublicKey(k.Public))}
+		if len(k.Private) == ed25519.PrivateKeySize {
+			opts = append(opts, jwt.Ed25519PrivateKey(ed25519.PrivateKey(k.Private)))
+		}
+		return jwt.NewEd25519(opts...), nil
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm: %s", k.Algorithm)
+}
+
+// JWK is the public part of a signing key as defined in RFC 7517
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS is the JSON Web Key Set served to third-party services
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public key. Symmetric keys cannot be published and
+// return false.
+func (k SigningKey) JWK() (JWK, bool) {
+	enc := base64.RawURLEncoding
+
+	jwk := JWK{KeyID: k.ID, Algorithm: k.Algorithm, Use: "sig"}
+	switch k.Algorithm {
+	case SigningAlgRS256:
+		pub, err := x509.ParsePKCS1PublicKey(k.Public)
+		if err != nil {
+			return jwk, false
+		}
+
+		jwk.KeyType = "RSA"
+		jwk.N = enc.EncodeToString(pub.N.Bytes())
+		jwk.E = enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		return jwk, true
+	case SigningAlgEdDSA:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = enc.EncodeToString(k.Public)
+		return jwk, true
+	}
+	return jwk, false
+}
+
+// PeekJWTPayload decodes the payload of a token WITHOUT verifying its
+// signature. It's used to find which base issued a token before verifying
+// it with the base's keys.
+func PeekJWTPayload(token []byte, v interface{}) error {
+	parts := strings.Split(string(token), ".")
+	if len(parts) != 3 {
+		return jwt.ErrMalformed
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// sealedKeyPrefix marks the private keys encrypted at rest, the keys
+// stored before the encryption are read as is
+var sealedKeyPrefix = []byte("sbenc1:")
+
+// keyEncryption encrypts the private keys at rest with a key derived from
+// JWT_SECRET. It's nil when JWT_SECRET is not set since a random secret
+// would not decrypt the keys after a restart.
+var keyEncryption cipher.AEAD
+
+func init() {
+	if secret := os.Getenv("JWT_SECRET"); len(secret) > 0 {
+		keyEncryption = newKeyEncryption(secret)
+	}
+}
+
+func newKeyEncryption(secret string) cipher.AEAD {
+	sum := sha256.Sum256([]byte("signing-keys:" + secret))
+
+	// a 32 bytes key is always a valid AES-256 key
+	block, _ := aes.NewCipher(sum[:])
+	gcm, _ := cipher.NewGCM(block)
+	return gcm
+}
+
+// sealPrivateKey returns the private key encrypted for storage
+func sealPrivateKey(key []byte) ([]byte, error) {
+	if keyEncryption == nil {
+		return key, nil
+	}
+
+	nonce := make([]byte, keyEncryption.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := append([]byte{}, sealedKeyPrefix...)
+	sealed = append(sealed, nonce...)
+	return keyEncryption.Seal(sealed, nonce, key, nil), nil
+}
+
+// openPrivateKey returns the stored private key decrypted
+func openPrivateKey(stored []byte) ([]byte, error) {
+	if !bytes.HasPrefix(stored, sealedKeyPrefix) {
+		return stored, nil
+	} else if keyEncryption == nil {
+		return nil, errors.New("the key is encrypted and JWT_SECRET is not set")
+	}
+
+	sealed := stored[len(sealedKeyPrefix):]
+	if len(sealed) < keyEncryption.NonceSize() {
+		return nil, errors.New("invalid encrypted key")
+	}
+
+	n := keyEncryption.NonceSize()
+	return keyEncryption.Open(nil, sealed[:n], sealed[n:], nil)
+}
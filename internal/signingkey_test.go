@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/gbrlsnchs/jwt/v3"
+)
+
+func TestSigningKeySignAndVerify(t *testing.T) {
+	for _, alg := range []string{SigningAlgHS256, SigningAlgRS256, SigningAlgEdDSA} {
+		key, err := GenerateSigningKey(alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signer, err := key.Signer()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := jwt.Sign(JWTPayload{Token: "id|token"}, signer, jwt.KeyID(key.ID))
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+
+		var pl JWTPayload
+		hd, err := jwt.Verify(token, signer, &pl, jwt.ValidateHeader)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		} else if hd.KeyID != key.ID || pl.Token != "id|token" {
+			t.Errorf("%s: expected kid %s and token id|token got %s and %s", alg, key.ID, hd.KeyID, pl.Token)
+		}
+
+		other, err := GenerateSigningKey(alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		otherSigner, err := other.Signer()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := jwt.Verify(token, otherSigner, &pl); err == nil {
+			t.Errorf("%s: expected verification with another key to fail", alg)
+		}
+
+		var peek JWTPayload
+		if err := PeekJWTPayload(token, &peek); err != nil {
+			t.Fatal(err)
+		} else if peek.Token != "id|token" {
+			t.Errorf("%s: expected peeked token id|token got %s", alg, peek.Token)
+		}
+	}
+}
+
+func TestSigningKeyJWK(t *testing.T) {
+	tables := make(map[string]string)
+	tables[SigningAlgRS256] = "RSA"
+	tables[SigningAlgEdDSA] = "OKP"
+	tables[SigningAlgHS256] = ""
+
+	for alg, kty := range tables {
+		key, err := GenerateSigningKey(alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		jwk, ok := key.JWK()
+		if len(kty) == 0 {
+			if ok {
+				t.Errorf("%s: symmetric key should not be published", alg)
+			}
+			continue
+		}
+
+		if !ok {
+			t.Fatalf("%s: expected a JWK", alg)
+		} else if jwk.KeyType != kty || jwk.KeyID != key.ID {
+			t.Errorf("%s: expected kty %s kid %s got %s %s", alg, kty, key.ID, jwk.KeyType, jwk.KeyID)
+		}
+	}
+}
@@ -1,3 +1,3 @@
 package internal
 
-type PublishDocumentEvent func(channel, typ string, v interface{})
+type PublishDocumentEvent func(channel string, evt DocumentEvent)
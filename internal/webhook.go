@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookDead      = "dead"
+)
+
+// Webhook receives HTTP POSTs for the events matching one of its Events.
+//
+// An event filter is a message type, optionally followed by a channel, i.e.
+// "db_created:db-orders". A filter ending with * matches all values starting
+// with its prefix, "db_*" or "chan_out:chat-*".
+//
+// The Secret is only returned when the webhook is created or its secret is
+// rotated.
+type Webhook struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	URL     string    `json:"url"`
+	Events  []string  `json:"events"`
+	Secret  string    `json:"secret,omitempty"`
+	Active  bool      `json:"active"`
+	Created time.Time `json:"created"`
+}
+
+// Matches returns true if the event matches one of the webhook's filters
+func (wh Webhook) Matches(msg Command) bool {
+	for _, filter := range wh.Events {
+		parts := strings.SplitN(filter, ":", 2)
+		if !wildcardMatch(parts[0], msg.Type) {
+			continue
+		}
+
+		if len(parts) == 1 || wildcardMatch(parts[1], msg.Channel) {
+			return true
+		}
+	}
+	return false
+}
+
+func wildcardMatch(pattern, v string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(v, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == v
+}
+
+// WebhookDelivery is a webhook call with its attempts. A pending delivery is
+// attempted again at NextAttempt, the ones failing WebhookMaxAttempts times
+// are dead letters and can be replayed.
+type WebhookDelivery struct {
+	ID          string    `json:"id"`
+	WebhookID   string    `json:"webhookId"`
+	Event       string    `json:"event"`
+	Channel     string    `json:"channel"`
+	Payload     string    `json:"payload"`
+	State       string    `json:"state"`
+	Attempts    int       `json:"attempts"`
+	Status      int       `json:"status"`
+	Error       string    `json:"error"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	Created     time.Time `json:"created"`
+	Updated     time.Time `json:"updated"`
+}
+
+// WebhookMaxAttempts is the number of calls before a delivery is dead
+const WebhookMaxAttempts = 6
+
+// WebhookBackoff returns the wait before the next attempt, doubling from 10
+// seconds up to an hour.
+func WebhookBackoff(attempts int) time.Duration {
+	d := 10 * time.Second
+	for i := 1; i < attempts && d < time.Hour; i++ {
+		d *= 2
+	}
+
+	if d > time.Hour {
+		return time.Hour
+	}
+	return d
+}
+
+// SignWebhook returns the signature sent in the X-SB-Signature header. It's
+// the hex HMAC-SHA256 of "{timestamp}.{body}" with the webhook's secret.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d.", timestamp)))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWebhookMatches(t *testing.T) {
+	wh := Webhook{Events: []string{"db_*:db-orders", "chan_out:chat-*", "presence_join"}}
+
+	tables := []struct {
+		msg      Command
+		expected bool
+	}{
+		{Command{Type: MsgTypeDBCreated, Channel: "db-orders"}, true},
+		{Command{Type: MsgTypeDBDeleted, Channel: "db-orders"}, true},
+		{Command{Type: MsgTypeDBCreated, Channel: "db-users"}, false},
+		{Command{Type: MsgTypeChanOut, Channel: "chat-42"}, true},
+		{Command{Type: MsgTypeChanOut, Channel: "news"}, false},
+		{Command{Type: MsgTypePresenceJoin, Channel: "anything"}, true},
+	}
+
+	for _, tt := range tables {
+		if ok := wh.Matches(tt.msg); ok != tt.expected {
+			t.Errorf("%s on %s: expected %v got %v", tt.msg.Type, tt.msg.Channel, tt.expected, ok)
+		}
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tables := make(map[int]time.Duration)
+	tables[1] = 10 * time.Second
+	tables[2] = 20 * time.Second
+	tables[5] = 160 * time.Second
+	tables[20] = time.Hour
+
+	for n, expected := range tables {
+		if d := WebhookBackoff(n); d != expected {
+			t.Errorf("attempt %d: expected %v got %v", n, expected, d)
+		}
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"event":"db_created"}`)
+
+	sig := SignWebhook("secret", 1700000000, body)
+	if sig != SignWebhook("secret", 1700000000, body) {
+		t.Error("expected the signature to be stable")
+	} else if sig == SignWebhook("other", 1700000000, body) {
+		t.Error("expected the signature to depend on the secret")
+	} else if sig == SignWebhook("secret", 1700000001, body) {
+		t.Error("expected the signature to depend on the timestamp")
+	}
+}
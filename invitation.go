@@ -0,0 +1,234 @@
+package staticbackend
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	emailFuncs "github.com/staticbackendhq/core/email"
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+)
+
+const (
+	invitationValidFor = 7 * 24 * time.Hour
+)
+
+func (m *membership) invitations(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		m.invite(w, r)
+	} else if r.Method == http.MethodDelete {
+		m.cancelInvitation(w, r)
+	} else if r.Method == http.MethodGet {
+		m.listInvitations(w, r)
+	} else {
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func (m *membership) invite(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var data = new(struct {
+		Email string `json:"email"`
+		Role  int    `json:"role"`
+		URL   string `json:"url"`
+	})
+	if err := parseBody(r.Body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data.Email = strings.ToLower(data.Email)
+
+	// TODO: cheap email validation
+	if len(data.Email) < 4 || strings.Index(data.Email, "@") == -1 {
+		http.Error(w, "invalid email", http.StatusBadRequest)
+		return
+	}
+
+	// users cannot invite someone with more permission than themselves
+	if data.Role > auth.Role {
+		http.Error(w, "insufficient priviledges to invite with this role", http.StatusUnauthorized)
+		return
+	}
+
+	exists, err := datastore.UserEmailExists(conf.Name, data.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if exists {
+		http.Error(w, "this email is already a user", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	inv := internal.Invitation{
+		AccountID: auth.AccountID,
+		Email:     data.Email,
+		Role:      data.Role,
+		Code:      randStringRunes(32),
+		InvitedBy: auth.UserID,
+		Created:   now,
+		Expires:   now.Add(invitationValidFor),
+	}
+
+	id, err := datastore.CreateInvitation(conf.Name, inv)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	inv.ID = id
+
+	if err := sendInvitation(conf, auth, inv, data.URL); err != nil {
+		log.Println("error sending invitation email", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, http.StatusCreated, inv)
+}
+
+func sendInvitation(conf internal.BaseConfig, auth internal.Auth, inv internal.Invitation, acceptURL string) error {
+	// the app can provide their own page to accept the invitation
+	// we append the code so they can call /invitation/accept
+	link := ""
+	if len(acceptURL) > 0 {
+		sep := "?"
+		if strings.Contains(acceptURL, "?") {
+			sep = "&"
+		}
+		link = fmt.Sprintf(`<p><a href="%s%scode=%s">Accept the invitation</a></p>`,
+			acceptURL,
+			sep,
+			url.QueryEscape(inv.Code),
+		)
+	}
+
+	body := fmt.Sprintf(`
+	<p>Hey there,</p>
+	<p>%s invited you to join their account.</p>
+	%s
+	<p>Your invitation code: <strong>%s</strong></p>
+	<p>This invitation expires on %s.</p>
+	`, auth.Email, link, inv.Code, inv.Expires.Format("2006/01/02 15:04"))
+
+	ed := internal.SendMailData{
+		From:     FromEmail,
+		FromName: FromName,
+		To:       inv.Email,
+		ToName:   "",
+		Subject:  "You've been invited to join an account",
+		HTMLBody: body,
+		TextBody: emailFuncs.StripHTML(body),
+	}
+
+	if err := emailer.Send(ed); err != nil {
+		return err
+	}
+
+	if err := datastore.IncrementMonthlyEmailSent(conf.ID); err != nil {
+		//TODO: do something better with this error
+		log.Println("error increasing monthly email sent: ", err)
+	}
+	return nil
+}
+
+func (m *membership) listInvitations(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	invs, err := datastore.ListInvitations(conf.Name, auth.AccountID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if invs == nil {
+		invs = make([]internal.Invitation, 0)
+	}
+
+	respond(w, http.StatusOK, invs)
+}
+
+func (m *membership) cancelInvitation(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if err := datastore.DeleteInvitation(conf.Name, auth.AccountID, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, http.StatusOK, true)
+}
+
+func (m *membership) acceptInvitation(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, "invalid StaticBackend key", http.StatusUnauthorized)
+		return
+	}
+
+	var data = new(struct {
+		Code     string `json:"code"`
+		Password string `json:"password"`
+	})
+	if err := parseBody(r.Body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	inv, err := datastore.FindInvitation(conf.Name, data.Code)
+	if err != nil {
+		http.Error(w, "invalid invitation code", http.StatusNotFound)
+		return
+	} else if inv.IsExpired() {
+		http.Error(w, "this invitation has expired", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := datastore.UserEmailExists(conf.Name, inv.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if exists {
+		http.Error(w, "invalid email", http.StatusBadRequest)
+		return
+	}
+
+	// the new user is created under the inviter's account
+	jwtBytes, tok, err := m.createUser(conf.Name, inv.AccountID, inv.Email, data.Password, inv.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := datastore.DeleteInvitation(conf.Name, inv.AccountID, inv.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token := fmt.Sprintf("%s|%s", tok.ID, tok.Token)
+	if err := m.volatile.SetTyped("base:"+token, conf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, http.StatusOK, string(jwtBytes))
+}
@@ -0,0 +1,77 @@
+package staticbackend
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInviteAndAcceptInvitation(t *testing.T) {
+	m := &membership{volatile: volatile}
+
+	data := new(struct {
+		Email string `json:"email"`
+		Role  int    `json:"role"`
+	})
+	data.Email = "invited@test.com"
+	data.Role = 0
+
+	resp := dbReq(t, m.invitations, "POST", "/invitation", data)
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	// the admin user and the invited user should share the same account
+	acctID := strings.Split(rootToken, "|")[1]
+
+	invs, err := datastore.ListInvitations(dbName, acctID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(invs) != 1 {
+		t.Fatalf("expected 1 invitation got %d", len(invs))
+	}
+
+	accept := new(struct {
+		Code     string `json:"code"`
+		Password string `json:"password"`
+	})
+	accept.Code = invs[0].Code
+	accept.Password = "invited_pw"
+
+	resp2 := dbReq(t, m.acceptInvitation, "POST", "/invitation/accept", accept)
+	defer resp2.Body.Close()
+
+	if resp2.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp2))
+	}
+
+	tok, err := datastore.FindTokenByEmail(dbName, data.Email)
+	if err != nil {
+		t.Fatal(err)
+	} else if tok.AccountID != acctID {
+		t.Errorf("expected invited user account id to be %s got %s", acctID, tok.AccountID)
+	}
+
+	if _, err := datastore.FindInvitation(dbName, accept.Code); err == nil {
+		t.Errorf("expected invitation to be deleted once accepted")
+	}
+}
+
+func TestInviteWithHigherRoleFails(t *testing.T) {
+	m := &membership{volatile: volatile}
+
+	data := new(struct {
+		Email string `json:"email"`
+		Role  int    `json:"role"`
+	})
+	data.Email = "too-high@test.com"
+	data.Role = 101
+
+	resp := dbReq(t, m.invitations, "POST", "/invitation", data)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 401 {
+		t.Errorf("expected status 401 got %d", resp.StatusCode)
+	}
+}
@@ -14,8 +14,12 @@ import (
 	"github.com/staticbackendhq/core/database/mongo"
 	"github.com/staticbackendhq/core/database/postgresql"
 	"github.com/staticbackendhq/core/email"
+	"github.com/staticbackendhq/core/function"
 	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+	"github.com/staticbackendhq/core/realtime"
 	"github.com/staticbackendhq/core/storage"
+	"github.com/staticbackendhq/core/webhook"
 )
 
 const (
@@ -49,16 +53,21 @@ func TestMain(m *testing.M) {
 			log.Fatal(err)
 		}
 
-		datastore = mongo.New(cl, volatile.PublishDocument)
+		datastore = mongo.New(cl, volatile.PublishDocument, volatile.Rule)
 	} else {
 		dbConn, err := openPGDatabase("user=postgres password=postgres dbname=postgres sslmode=disable")
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		datastore = postgresql.New(dbConn, volatile.PublishDocument, "./sql/")
+		datastore = postgresql.New(dbConn, volatile.PublishDocument, volatile.Rule, "./sql/")
 	}
 
+	volatile.FindRule = datastore.GetRule
+
+	internal.Keys = internal.NewKeyring(datastore)
+	internal.Keys.Locker = volatile
+
 	database = &Database{cache: volatile}
 
 	mp := os.Getenv("MAIL_PROVIDER")
@@ -70,20 +79,37 @@ func TestMain(m *testing.M) {
 
 	deleteAndSetupTestAccount()
 
-	hub := newHub(volatile)
-	go hub.run()
+	rt := realtime.NewEngine(realtimeAuth, realtimeAuthorize, volatile)
 
-	ws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		serveWs(hub, w, r)
-	}))
+	ws := httptest.NewServer(middleware.Chain(http.HandlerFunc(rt.ServeWS), middleware.WithDB(datastore, volatile)))
 	defer ws.Close()
 
-	wsURL = "ws" + strings.TrimPrefix(ws.URL, "http")
+	wsURL = "ws" + strings.TrimPrefix(ws.URL, "http") + "?sbpk=" + pubKey
 
 	funexec = &functions{datastore: datastore, dbName: dbName}
 
 	extexec = &extras{}
 
+	// the test webhooks listen on the loopback address
+	hooks = &webhook.Dispatcher{
+		PubSub:  volatile,
+		Store:   datastore,
+		Locker:  volatile,
+		Client:  http.DefaultClient,
+		Backoff: func(int) time.Duration { return 10 * time.Millisecond },
+	}
+	go hooks.ScheduleRetries(10*time.Millisecond, nil)
+
+	functionsSubscriber = &function.Subscriber{
+		PubSub: volatile,
+		Backoff: func(internal.RetryPolicy, int) time.Duration {
+			return 10 * time.Millisecond
+		},
+		Store:      datastore,
+		GetBaseEnv: functionEnv,
+		Locker:     volatile,
+	}
+
 	os.Exit(m.Run())
 }
 
@@ -68,7 +68,7 @@ func (m *membership) login(w http.ResponseWriter, r *http.Request) {
 	token := fmt.Sprintf("%s|%s", tok.ID, tok.Token)
 
 	// get their JWT
-	jwtBytes, err := m.getJWT(token)
+	jwtBytes, err := m.getJWT(conf.Name, token)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -201,7 +201,7 @@ func (m *membership) createUser(dbName, accountID, email, password string, role
 	token := fmt.Sprintf("%s|%s", tokID, tok.Token)
 
 	// Get their JWT
-	jwtBytes, err := m.getJWT(token)
+	jwtBytes, err := m.getJWT(dbName, token)
 	if err != nil {
 		return nil, tok, err
 	}
@@ -345,7 +345,7 @@ func (m *membership) setPassword(w http.ResponseWriter, r *http.Request) {
 	respond(w, http.StatusOK, true)
 }
 
-func (m *membership) getJWT(token string) ([]byte, error) {
+func (m *membership) getJWT(dbName, token string) ([]byte, error) {
 	now := time.Now()
 	pl := internal.JWTPayload{
 		Payload: jwt.Payload{
@@ -358,8 +358,7 @@ func (m *membership) getJWT(token string) ([]byte, error) {
 		Token: token,
 	}
 
-	return jwt.Sign(pl, internal.HashSecret)
-
+	return internal.Keys.Sign(dbName, pl)
 }
 
 func (m *membership) sudoGetTokenFromAccountID(w http.ResponseWriter, r *http.Request) {
@@ -382,7 +381,7 @@ func (m *membership) sudoGetTokenFromAccountID(w http.ResponseWriter, r *http.Re
 
 	token := fmt.Sprintf("%s|%s", tok.ID, tok.Token)
 
-	jwtBytes, err := m.getJWT(token)
+	jwtBytes, err := m.getJWT(conf.Name, token)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+const (
+	// APIKeyRole is the role of the requests made with an API key. The
+	// scopes restrict the routes a key can call, it has the rights of the
+	// root users on those, i.e. reading all the accounts' documents of a
+	// collection it can read.
+	APIKeyRole = RootRole
+
+	// apiKeyUsedEvery limits how often the last used date is persisted
+	apiKeyUsedEvery = 1 * time.Minute
+)
+
+// RequireAPIKey validates scoped API keys sent as a Bearer token. Requests
+// without an API key continue untouched so RequireAuth can validate user
+// tokens.
+func RequireAPIKey(datastore internal.Persister) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !strings.HasPrefix(key, internal.APIKeyPrefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			conf, ok := ctx.Value(ContextBase).(internal.BaseConfig)
+			if !ok {
+				http.Error(w, "invalid StaticBackend public key", http.StatusBadRequest)
+				return
+			}
+
+			apiKey, err := ValidateAPIKey(datastore, conf.Name, key)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			scope := APIKeyScope(r)
+			if !apiKey.Allows(scope) {
+				http.Error(w, fmt.Sprintf("this API key does not have the %s scope", scope), http.StatusForbidden)
+				return
+			}
+
+			if time.Since(apiKey.LastUsed) > apiKeyUsedEvery {
+				if err := datastore.APIKeyUsed(conf.Name, apiKey.ID, time.Now()); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+
+			// the key acts as the root user who created it within its
+			// scopes
+			a := internal.Auth{
+				AccountID: apiKey.AccountID,
+				UserID:    apiKey.TokenID,
+				Email:     "",
+				Role:      APIKeyRole,
+				Token:     apiKey.ID,
+			}
+
+			ctx = context.WithValue(ctx, ContextAuth, a)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func ValidateAPIKey(datastore internal.Persister, base, key string) (internal.APIKey, error) {
+	id, secret, ok := internal.ParseAPIKey(key)
+	if !ok {
+		return internal.APIKey{}, fmt.Errorf("invalid API key")
+	}
+
+	apiKey, err := datastore.FindAPIKey(base, id)
+	if err != nil {
+		return apiKey, fmt.Errorf("invalid API key")
+	} else if subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(internal.HashAPIKeySecret(secret))) != 1 {
+		return apiKey, fmt.Errorf("invalid API key")
+	} else if apiKey.IsExpired() {
+		return apiKey, fmt.Errorf("this API key has expired")
+	}
+	return apiKey, nil
+}
+
+// APIKeyScope returns the scope required by the request, i.e. a GET on
+// /db/orders requires db:read:orders. An empty scope is never granted.
+func APIKeyScope(r *http.Request) string {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 0 {
+		return ""
+	}
+
+	name := ""
+	if len(parts) > 1 {
+		name = parts[1]
+	}
+
+	switch parts[0] {
+	case "db", "query", "inc":
+		// the scopes name the collection without its permission suffix
+		name = internal.CleanCollectionName(name)
+	}
+
+	switch parts[0] {
+	case "db":
+		switch r.Method {
+		case http.MethodGet:
+			return internal.ScopeDBRead + ":" + name
+		case http.MethodDelete:
+			return internal.ScopeDBDelete + ":" + name
+		case http.MethodPost, http.MethodPut:
+			return internal.ScopeDBWrite + ":" + name
+		}
+	case "query":
+		return internal.ScopeDBRead + ":" + name
+	case "inc":
+		return internal.ScopeDBWrite + ":" + name
+	case "storage":
+		if name == "upload" {
+			return internal.ScopeStorageUpload
+		}
+	case "fn":
+		if name == "exec" && len(parts) > 2 {
+			return internal.ScopeFnExec + ":" + parts[2]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// keyStore only implements the API key part of the Persister
+type keyStore struct {
+	internal.Persister
+	keys map[string]internal.APIKey
+}
+
+func (ks *keyStore) FindAPIKey(dbName, id string) (internal.APIKey, error) {
+	key, ok := ks.keys[id]
+	if !ok {
+		return key, errors.New("not found")
+	}
+	return key, nil
+}
+
+func (ks *keyStore) APIKeyUsed(dbName, id string, at time.Time) error {
+	return nil
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	ks := &keyStore{keys: map[string]internal.APIKey{
+		"k1": {
+			ID:        "k1",
+			AccountID: "acct1",
+			TokenID:   "tok1",
+			Hash:      internal.HashAPIKeySecret("secret"),
+			Scopes:    []string{"db:read:orders"},
+			LastUsed:  time.Now(),
+		},
+	}}
+
+	var got internal.Auth
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = r.Context().Value(ContextAuth).(internal.Auth)
+	})
+	h := RequireAPIKey(ks)(next)
+
+	tables := make(map[string]int)
+	tables["/db/orders"] = http.StatusOK
+	tables["/db/orders_770_"] = http.StatusOK
+	tables["/db/users_770_"] = http.StatusForbidden
+
+	for path, expected := range tables {
+		got = internal.Auth{}
+
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer sbk_k1_secret")
+		req = req.WithContext(context.WithValue(req.Context(), ContextBase, internal.BaseConfig{Name: "testdb"}))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != expected {
+			t.Errorf("%s: expected status %d got %d", path, expected, w.Code)
+		} else if expected == http.StatusOK {
+			if got.Role != RootRole || got.AccountID != "acct1" {
+				t.Errorf("%s: expected a root auth of acct1 got %v", path, got)
+			}
+		}
+	}
+}
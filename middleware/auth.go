@@ -7,8 +7,6 @@ import (
 	"strings"
 
 	"github.com/staticbackendhq/core/internal"
-
-	"github.com/gbrlsnchs/jwt/v3"
 )
 
 const (
@@ -18,6 +16,12 @@ const (
 func RequireAuth(datastore internal.Persister, volatile internal.PubSuber) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// already authenticated via an API key
+			if _, ok := r.Context().Value(ContextAuth).(internal.Auth); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			key := r.Header.Get("Authorization")
 
 			if len(key) == 0 {
@@ -68,16 +72,16 @@ func RequireAuth(datastore internal.Persister, volatile internal.PubSuber) Middl
 func ValidateAuthKey(datastore internal.Persister, volatile internal.PubSuber, ctx context.Context, key string) (internal.Auth, error) {
 	a := internal.Auth{}
 
-	var pl internal.JWTPayload
-	if _, err := jwt.Verify([]byte(key), internal.HashSecret, &pl); err != nil {
-		return a, fmt.Errorf("could not verify your authentication token: %s", err.Error())
-	}
-
 	conf, ok := ctx.Value(ContextBase).(internal.BaseConfig)
 	if !ok {
 		return a, fmt.Errorf("invalid StaticBackend public token")
 	}
 
+	var pl internal.JWTPayload
+	if err := internal.Keys.Verify(conf.Name, []byte(key), &pl); err != nil {
+		return a, fmt.Errorf("could not verify your authentication token: %s", err.Error())
+	}
+
 	var auth internal.Auth
 	if err := volatile.GetTyped(pl.Token, &auth); err == nil {
 		return auth, nil
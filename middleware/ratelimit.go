@@ -0,0 +1,239 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+const (
+	// failures of an identity are forgotten after this period
+	failureWindow = 15 * time.Minute
+	// lockouts double if they happen again within this period
+	lockoutLevelWindow = 24 * time.Hour
+)
+
+// RateLimiter stores the rate limiting counters, cache.Cache implements it
+type RateLimiter interface {
+	IncWindow(key string, window time.Duration) (int64, time.Duration, error)
+	SetEx(key, value string, ttl time.Duration) error
+	TTL(key string) (time.Duration, error)
+	Del(keys ...string) error
+}
+
+// IdentityFunc returns who a request is acting for, i.e. the email of a
+// login request. An empty identity only applies the per-IP budget.
+type IdentityFunc func(r *http.Request) string
+
+// maxIdentityBody is the size of the bodies read for their identity
+const maxIdentityBody = 64 << 10
+
+// IdentityFromRequest looks for the field in the query string, then in the
+// JSON or form body. The body is restored for the next handler, it reads the
+// same error if the body exceeds maxIdentityBody.
+func IdentityFromRequest(field string) IdentityFunc {
+	return func(r *http.Request) string {
+		if v := r.URL.Query().Get(field); len(v) > 0 {
+			return strings.ToLower(v)
+		}
+
+		if r.Body == nil {
+			return ""
+		}
+
+		body := http.MaxBytesReader(nil, r.Body, maxIdentityBody)
+		b, err := io.ReadAll(body)
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(b), body), body}
+		if err != nil {
+			return ""
+		}
+
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			r2 := r.Clone(r.Context())
+			r2.Body = io.NopCloser(bytes.NewReader(b))
+			if err := r2.ParseForm(); err != nil {
+				return ""
+			}
+			return strings.ToLower(r2.PostForm.Get(field))
+		}
+
+		values := make(map[string]interface{})
+		if err := json.Unmarshal(b, &values); err != nil {
+			return ""
+		}
+
+		v, ok := values[field].(string)
+		if !ok {
+			return ""
+		}
+		return strings.ToLower(v)
+	}
+}
+
+// RateLimit limits the requests per IP and per identity using the base's
+// rate limit settings. With an identity func, the IPs and identities with
+// too many failed requests (HTTP status >= 400) on the route are locked out
+// with an exponential backoff: an IP trying many identities is locked like
+// an identity tried from many IPs.
+func RateLimit(limiter RateLimiter, identity IdentityFunc) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conf, _ := r.Context().Value(ContextBase).(internal.BaseConfig)
+			settings := conf.Settings.RateLimit.WithDefaults()
+
+			prefix := fmt.Sprintf("rl_%s", conf.Name)
+			route := r.URL.Path
+			ip := clientIP(r)
+
+			ipKey := fmt.Sprintf("%s_ip_%s_%s", prefix, route, ip)
+			ok, retry, err := allow(limiter, ipKey, settings.PerIP)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			} else if !ok {
+				tooManyRequests(w, retry)
+				return
+			}
+
+			if identity == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			id := identity(r)
+
+			subjects := []string{"ip_" + ip}
+			if len(id) > 0 {
+				subjects = append(subjects, "id_"+id)
+			}
+
+			for _, subject := range subjects {
+				locked, err := limiter.TTL(lockKey(prefix, route, subject))
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				} else if locked > 0 {
+					tooManyRequests(w, locked)
+					return
+				}
+			}
+
+			if len(id) > 0 {
+				idKey := fmt.Sprintf("%s_id_%s_%s", prefix, route, id)
+				ok, retry, err = allow(limiter, idKey, settings.PerIdentity)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				} else if !ok {
+					tooManyRequests(w, retry)
+					return
+				}
+			}
+
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+
+			if sw.status < 400 {
+				// an identity's failures are reset once it succeeds, the
+				// IP's are kept or it could reset them with its own account
+				if len(id) > 0 {
+					if err := limiter.Del(failKey(prefix, route, "id_"+id)); err != nil {
+						fmt.Println("error resetting rate limit failures", err)
+					}
+				}
+				return
+			}
+
+			for _, subject := range subjects {
+				if err := recordFailure(limiter, prefix, route, subject, settings); err != nil {
+					fmt.Println("error recording rate limit failure", err)
+				}
+			}
+		})
+	}
+}
+
+func allow(limiter RateLimiter, key string, rl internal.RateLimit) (bool, time.Duration, error) {
+	n, ttl, err := limiter.IncWindow(key, rl.Duration())
+	if err != nil {
+		return false, 0, err
+	}
+	return n <= rl.Requests, ttl, nil
+}
+
+func recordFailure(limiter RateLimiter, prefix, route, subject string, settings internal.RateLimitSettings) error {
+	fails, _, err := limiter.IncWindow(failKey(prefix, route, subject), failureWindow)
+	if err != nil {
+		return err
+	} else if fails < settings.MaxFailures {
+		return nil
+	}
+
+	lvlKey := fmt.Sprintf("%s_lvl_%s_%s", prefix, route, subject)
+	lvl, _, err := limiter.IncWindow(lvlKey, lockoutLevelWindow)
+	if err != nil {
+		return err
+	}
+
+	if err := limiter.SetEx(lockKey(prefix, route, subject), "1", settings.LockoutFor(lvl)); err != nil {
+		return err
+	}
+	return limiter.Del(failKey(prefix, route, subject))
+}
+
+// lockKey is set while the IP or identity is locked out of the route
+func lockKey(prefix, route, subject string) string {
+	return fmt.Sprintf("%s_lock_%s_%s", prefix, route, subject)
+}
+
+func failKey(prefix, route, subject string) string {
+	return fmt.Sprintf("%s_fail_%s_%s", prefix, route, subject)
+}
+
+func tooManyRequests(w http.ResponseWriter, retry time.Duration) {
+	secs := int(math.Ceil(retry.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", secs))
+	http.Error(w, "too many requests, please try again later", http.StatusTooManyRequests)
+}
+
+// clientIP returns the request IP. The X-Forwarded-For header is only
+// trusted when TRUST_PROXY is set, otherwise clients could spoof it.
+func clientIP(r *http.Request) string {
+	if len(os.Getenv("TRUST_PROXY")) > 0 {
+		if fwd := r.Header.Get("X-Forwarded-For"); len(fwd) > 0 {
+			return strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
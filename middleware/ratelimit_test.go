@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+type memLimiter struct {
+	counters map[string]int64
+	locks    map[string]time.Duration
+}
+
+func (m *memLimiter) IncWindow(key string, window time.Duration) (int64, time.Duration, error) {
+	m.counters[key]++
+	return m.counters[key], window, nil
+}
+
+func (m *memLimiter) SetEx(key, value string, ttl time.Duration) error {
+	m.locks[key] = ttl
+	return nil
+}
+
+func (m *memLimiter) TTL(key string) (time.Duration, error) {
+	return m.locks[key], nil
+}
+
+func (m *memLimiter) Del(keys ...string) error {
+	for _, k := range keys {
+		delete(m.counters, k)
+	}
+	return nil
+}
+
+func TestRateLimitLocksOutIdentity(t *testing.T) {
+	limiter := &memLimiter{counters: make(map[string]int64), locks: make(map[string]time.Duration)}
+
+	conf := internal.BaseConfig{Name: "unittest"}
+	conf.Settings.RateLimit = internal.RateLimitSettings{MaxFailures: 3}
+
+	failing := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid password", http.StatusUnauthorized)
+	})
+	h := Chain(failing, RateLimit(limiter, IdentityFromRequest("email")))
+
+	do := func() *httptest.ResponseRecorder {
+		body := strings.NewReader(`{"email": "Locked@Test.com", "password": "wrong"}`)
+		req := httptest.NewRequest("POST", "/login", body)
+		req = req.WithContext(context.WithValue(req.Context(), ContextBase, conf))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := do(); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401 got %d", i+1, w.Code)
+		}
+	}
+
+	w := do()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 after max failures got %d", w.Code)
+	} else if w.Header().Get("Retry-After") != "60" {
+		t.Errorf("expected Retry-After 60 got %s", w.Header().Get("Retry-After"))
+	}
+}
+
+func TestRateLimitPerIP(t *testing.T) {
+	limiter := &memLimiter{counters: make(map[string]int64), locks: make(map[string]time.Duration)}
+
+	conf := internal.BaseConfig{Name: "unittest"}
+	conf.Settings.RateLimit = internal.RateLimitSettings{PerIP: internal.RateLimit{Requests: 2, Window: 60}}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := Chain(ok, RateLimit(limiter, nil))
+
+	codes := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	for i, expected := range codes {
+		req := httptest.NewRequest("GET", "/email?e=a@b.com", nil)
+		req = req.WithContext(context.WithValue(req.Context(), ContextBase, conf))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != expected {
+			t.Errorf("request %d: expected %d got %d", i+1, expected, w.Code)
+		}
+	}
+}
+
+func TestRateLimitLocksOutIPAndRoute(t *testing.T) {
+	limiter := &memLimiter{counters: make(map[string]int64), locks: make(map[string]time.Duration)}
+
+	conf := internal.BaseConfig{Name: "unittest"}
+	conf.Settings.RateLimit = internal.RateLimitSettings{MaxFailures: 3}
+
+	failing := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid password", http.StatusUnauthorized)
+	})
+	h := Chain(failing, RateLimit(limiter, IdentityFromRequest("email")))
+
+	do := func(path, email string) int {
+		body := strings.NewReader(`{"email": "` + email + `", "password": "wrong"}`)
+		req := httptest.NewRequest("POST", path, body)
+		req = req.WithContext(context.WithValue(req.Context(), ContextBase, conf))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// a different email each time
+	for i := 0; i < 3; i++ {
+		if code := do("/login", fmt.Sprintf("user%d@test.com", i)); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401 got %d", i+1, code)
+		}
+	}
+
+	if code := do("/login", "other@test.com"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the IP locked out got %d", code)
+	} else if code := do("/password/reset", "other@test.com"); code != http.StatusUnauthorized {
+		t.Errorf("expected the other routes not locked got %d", code)
+	}
+}
+
+func TestIdentityFromRequestLimitsBody(t *testing.T) {
+	body := `{"email": "a@b.com", "bio": "` + strings.Repeat("a", maxIdentityBody) + `"}`
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(body))
+
+	if id := IdentityFromRequest("email")(req); id != "" {
+		t.Errorf("expected no identity for a large body got %s", id)
+	}
+
+	// the next handler reads the error
+	var mbe *http.MaxBytesError
+	if _, err := io.ReadAll(req.Body); !errors.As(err, &mbe) {
+		t.Errorf("expected a max bytes error got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package staticbackend
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+	"github.com/staticbackendhq/core/realtime"
+)
+
+// realtimeAuth validates the token of a realtime auth command and returns
+// the cache token of the user.
+func realtimeAuth(ctx context.Context, key string) (internal.Auth, string, error) {
+	//TODO: Experimental, let un-authenticated user connect
+	// useful for an Intercom-like SaaS I'm building.
+	if strings.HasPrefix(key, "__tmp__experimental_public") {
+		// let's create the most minimal authentication possible
+		a := internal.Auth{
+			AccountID: randStringRunes(30),
+			UserID:    randStringRunes(30),
+			Email:     "exp@tmp.com",
+			Role:      0,
+			Token:     key,
+		}
+
+		if err := volatile.SetTyped(key, a); err != nil {
+			return a, key, err
+		}
+
+		// database events check the read rule of the subscriber's base
+		if conf, ok := ctx.Value(middleware.ContextBase).(internal.BaseConfig); ok {
+			if err := volatile.SetTyped("base:"+key, conf); err != nil {
+				return a, key, err
+			}
+		}
+
+		return a, key, nil
+	}
+
+	auth, err := middleware.ValidateAuthKey(datastore, volatile, ctx, key)
+	if err != nil {
+		return auth, "", err
+	}
+
+	// the payload was verified by ValidateAuthKey
+	var pl internal.JWTPayload
+	if err := internal.PeekJWTPayload([]byte(key), &pl); err != nil {
+		return auth, "", err
+	}
+
+	return auth, pl.Token, nil
+}
+
+// realtimeAuthorize decides if the user can join or publish on a channel of
+// the connection's base.
+func realtimeAuthorize(ctx context.Context, auth internal.Auth, channel, op string) error {
+	conf, ok := ctx.Value(middleware.ContextBase).(internal.BaseConfig)
+	if !ok {
+		return errors.New("could not find base config")
+	}
+
+	return authorizeChannel(conf, auth, channel, op)
+}
+
+// realtimeStats returns the realtime counters of this server
+func realtimeStats(rt *realtime.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, rt.Stats())
+	}
+}
@@ -0,0 +1,75 @@
+package realtime
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/staticbackendhq/core/internal"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// SubprotocolJSON is the default encoding of WebSocket messages
+	SubprotocolJSON = "sb.json"
+	// SubprotocolMsgPack encodes WebSocket messages in MessagePack binary
+	// frames
+	SubprotocolMsgPack = "sb.msgpack"
+)
+
+// codec encodes the WebSocket messages
+type codec interface {
+	// frameType is the WebSocket message type, text or binary
+	frameType() int
+	encode(msg internal.Command) ([]byte, error)
+	decode(b []byte, msg *internal.Command) error
+}
+
+// codecFor returns the codec of the negotiated subprotocol, JSON when the
+// client did not ask for one.
+func codecFor(subprotocol string) codec {
+	if subprotocol == SubprotocolMsgPack {
+		return msgpackCodec{}
+	}
+	return jsonCodec{}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) frameType() int {
+	return websocket.TextMessage
+}
+
+func (jsonCodec) encode(msg internal.Command) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (jsonCodec) decode(b []byte, msg *internal.Command) error {
+	return json.Unmarshal(b, msg)
+}
+
+// msgpackCodec uses the JSON field names so both encodings have the same
+// messages.
+type msgpackCodec struct{}
+
+func (msgpackCodec) frameType() int {
+	return websocket.BinaryMessage
+}
+
+func (msgpackCodec) encode(msg internal.Command) ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(msg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) decode(b []byte, msg *internal.Command) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(msg)
+}
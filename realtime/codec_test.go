@@ -0,0 +1,95 @@
+package realtime
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialWS(t *testing.T, url string, subprotocols ...string) *websocket.Conn {
+	dialer := websocket.Dialer{
+		EnableCompression: true,
+		Subprotocols:      subprotocols,
+	}
+
+	ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal("cannot connect WebSocket", err)
+	}
+	return ws
+}
+
+func TestWebSocketMsgPack(t *testing.T) {
+	_, transports := newTestEngine(t)
+
+	ws := dialWS(t, transports[0].url, SubprotocolMsgPack)
+	defer ws.Close()
+
+	if ws.Subprotocol() != SubprotocolMsgPack {
+		t.Fatalf("expected the %s subprotocol got %s", SubprotocolMsgPack, ws.Subprotocol())
+	}
+
+	cdc := msgpackCodec{}
+	receive := func() internal.Command {
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+		typ, b, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		} else if typ != websocket.BinaryMessage {
+			t.Fatalf("expected a binary frame got %d", typ)
+		}
+
+		var msg internal.Command
+		if err := cdc.decode(b, &msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	init := receive()
+
+	// larger than the default limit, the base allows 4KB
+	data := strings.Repeat("x", 2048)
+
+	b, err := cdc.encode(internal.Command{SID: init.Data, Type: internal.MsgTypeEcho, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ws.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg := receive(); msg.Data != "echo: "+data {
+		t.Errorf("expected the echo of the large message got %d bytes", len(msg.Data))
+	}
+}
+
+func TestWebSocketMessageLimit(t *testing.T) {
+	_, transports := newTestEngine(t)
+
+	ws := dialWS(t, transports[0].url)
+	defer ws.Close()
+
+	var init internal.Command
+	if err := ws.ReadJSON(&init); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := internal.Command{SID: init.Data, Type: internal.MsgTypeEcho, Data: strings.Repeat("x", 8192)}
+	if err := ws.WriteJSON(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := ws.ReadJSON(&msg); err == nil {
+		t.Error("expected the connection to be closed for a message over the limit")
+	} else if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("expected a message too big close error got %v", err)
+	}
+}
@@ -0,0 +1,511 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// connections refresh their channels' presence at this period, they're
+	// considered gone after missing a few of them
+	presenceHeartbeat = 30 * time.Second
+	presenceTTL       = 3 * presenceHeartbeat
+)
+
+// Validator authenticates the token of an auth command. It returns the user
+// and the token identifying them in the cache.
+type Validator func(ctx context.Context, key string) (internal.Auth, string, error)
+
+// Authorizer returns an error when the user cannot join or publish on a
+// channel, op is internal.ChannelJoin or internal.ChannelPublish.
+type Authorizer func(ctx context.Context, auth internal.Auth, channel, op string) error
+
+// Conn is a client connection whatever its transport
+type Conn struct {
+	ID string
+
+	// secret identifies the Server-Sent Events clients posting commands, it's
+	// only sent to the client in the init message
+	secret string
+
+	// base the client connected to
+	base string
+
+	// Send is the bounded queue of the messages the transport delivers to
+	// the client.
+	Send chan internal.Command
+
+	// what happens when Send is full, see internal.RealtimeSettings
+	policy string
+
+	// closed when the engine drops the connection
+	done chan struct{}
+
+	// request context holding the base the client connected to
+	ctx context.Context
+
+	// user the connection authenticated as, token is empty until then
+	auth  internal.Auth
+	token string
+
+	// subscribed channels by name
+	subs map[string]subscription
+
+	// channels the connection was authorized to publish to, the following
+	// messages are not authorized again
+	publishes map[string]bool
+}
+
+type subscription struct {
+	channel string
+	close   chan bool
+	member  internal.PresenceMember
+	// filters the database events, nil sends them all
+	query *internal.LiveQuery
+}
+
+// Done is closed when the engine dropped the connection
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+type channelAuth struct {
+	conn *Conn
+	msg  internal.Command
+	// token the connection was authenticated with when authorized
+	token   string
+	allowed bool
+	sub     subscription
+	members []internal.PresenceMember
+	history []internal.Command
+	err     error
+}
+
+// Engine handles the realtime protocol. The WebSocket and Server-Sent Events
+// transports register their connections and send the client's commands to
+// Broadcast.
+type Engine struct {
+	// Broadcast receives the clients' commands
+	Broadcast chan internal.Command
+
+	register   chan *Conn
+	unregister chan *Conn
+	authorized chan channelAuth
+	conns      map[string]*Conn
+	// the connections by secret, see Receive
+	secrets  map[string]*Conn
+	received chan received
+
+	validateAuth Validator
+	authorize    Authorizer
+
+	pubsub internal.PubSuber
+
+	stats Stats
+}
+
+// NewEngine returns a started realtime engine
+func NewEngine(v Validator, a Authorizer, pubsub internal.PubSuber) *Engine {
+	e := &Engine{
+		Broadcast:    make(chan internal.Command, 1),
+		register:     make(chan *Conn),
+		unregister:   make(chan *Conn),
+		authorized:   make(chan channelAuth),
+		conns:        make(map[string]*Conn),
+		secrets:      make(map[string]*Conn),
+		received:     make(chan received),
+		validateAuth: v,
+		authorize:    a,
+		pubsub:       pubsub,
+	}
+
+	go e.start()
+
+	return e
+}
+
+// Connect registers a new connection, its first message is the init command
+// holding its secret.
+func (e *Engine) Connect(ctx context.Context) *Conn {
+	conf, _ := ctx.Value(middleware.ContextBase).(internal.BaseConfig)
+	settings := conf.Settings.Realtime.WithDefaults()
+
+	c := &Conn{
+		ID:     uuid.New().String(),
+		secret: uuid.New().String(),
+		base:   conf.Name,
+		Send:   make(chan internal.Command, settings.QueueSize),
+		policy: settings.SlowConsumer,
+		done:   make(chan struct{}),
+		ctx:    ctx,
+		subs:   make(map[string]subscription),
+
+		publishes: make(map[string]bool),
+	}
+	e.register <- c
+	return c
+}
+
+// Disconnect removes the connection and its subscriptions
+func (e *Engine) Disconnect(c *Conn) {
+	e.unregister <- c
+}
+
+func (e *Engine) start() {
+	heartbeat := time.NewTicker(presenceHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case c := <-e.register:
+			e.conns[c.ID] = c
+			e.secrets[c.secret] = c
+			atomic.AddInt64(&e.stats.Connections, 1)
+			e.send(c, internal.Command{Type: internal.MsgTypeInit, Data: c.secret})
+		case c := <-e.unregister:
+			e.drop(c)
+		case msg := <-e.Broadcast:
+			e.handle(msg)
+		case r := <-e.received:
+			r.err <- e.receive(r)
+		case res := <-e.authorized:
+			// the client might have disconnected in the meantime
+			if _, ok := e.conns[res.conn.ID]; !ok {
+				if res.err == nil && res.msg.Type == internal.MsgTypeJoin {
+					go e.leavePresence([]subscription{res.sub})
+				}
+				continue
+			}
+
+			e.send(res.conn, e.channelAuthorized(res))
+
+			// the missed messages are replayed after the join reply
+			for _, msg := range res.history {
+				e.send(res.conn, msg)
+			}
+		case <-heartbeat.C:
+			var subs []subscription
+			for _, c := range e.conns {
+				for _, sub := range c.subs {
+					subs = append(subs, sub)
+				}
+			}
+			go e.refreshPresence(subs)
+		}
+	}
+}
+
+func (e *Engine) send(c *Conn, msg internal.Command) {
+	if _, ok := e.conns[c.ID]; !ok {
+		return
+	}
+
+	if !e.enqueue(c, msg) {
+		log.Println("dropping realtime connection, its send queue is full", c.ID)
+		e.drop(c)
+	}
+}
+
+func (e *Engine) drop(c *Conn) {
+	if _, ok := e.conns[c.ID]; !ok {
+		return
+	}
+
+	subs := make([]subscription, 0, len(c.subs))
+	for _, sub := range c.subs {
+		close(sub.close)
+		subs = append(subs, sub)
+	}
+	go e.leavePresence(subs)
+
+	delete(e.conns, c.ID)
+	delete(e.secrets, c.secret)
+	atomic.AddInt64(&e.stats.Connections, -1)
+	close(c.done)
+}
+
+func (e *Engine) handle(msg internal.Command) {
+	sender, ok := e.conns[msg.SID]
+	if !ok {
+		log.Println("cannot find sender connection", msg.SID)
+		return
+	}
+
+	switch msg.Type {
+	case internal.MsgTypeEcho:
+		payload := msg
+		payload.Data = "echo: " + msg.Data
+		e.send(sender, payload)
+	case internal.MsgTypeAuth:
+		auth, token, err := e.validateAuth(sender.ctx, msg.Data)
+		if err != nil {
+			e.send(sender, internal.Command{Type: internal.MsgTypeError, Data: "invalid token"})
+			return
+		}
+
+		sender.auth = auth
+		sender.token = token
+		sender.publishes = make(map[string]bool)
+
+		e.send(sender, internal.Command{Type: internal.MsgTypeToken, Data: token})
+	case internal.MsgTypeJoin, internal.MsgTypeChanIn, internal.MsgTypePresence:
+		if len(sender.token) == 0 {
+			e.send(sender, internal.Command{Type: internal.MsgTypeError, Data: "you must authenticate first"})
+			return
+		}
+
+		if _, ok := sender.subs[msg.Data]; ok && msg.Type == internal.MsgTypeJoin {
+			e.send(sender, internal.Command{Type: internal.MsgTypeJoined, Data: msg.Data, Channel: msg.Data})
+			return
+		}
+
+		// rules and functions may query the database, the reply is sent
+		// once the channel is authorized. A connection publishing on a
+		// channel is authorized once.
+		allowed := msg.Type == internal.MsgTypeChanIn && sender.publishes[msg.Channel]
+		go e.authorizeChannel(sender, sender.auth, sender.token, msg, allowed)
+	case internal.MsgTypeLeave:
+		sub, ok := sender.subs[msg.Data]
+		if !ok {
+			e.send(sender, internal.Command{Type: internal.MsgTypeError, Data: "you are not subscribed to this channel"})
+			return
+		}
+
+		close(sub.close)
+		delete(sender.subs, msg.Data)
+		go e.leavePresence([]subscription{sub})
+
+		e.send(sender, internal.Command{Type: internal.MsgTypeLeft, Data: msg.Data, Channel: msg.Data})
+	case internal.MsgTypeListChannels:
+		channels := make([]string, 0, len(sender.subs))
+		for name := range sender.subs {
+			channels = append(channels, name)
+		}
+		sort.Strings(channels)
+
+		b, err := json.Marshal(channels)
+		if err != nil {
+			e.send(sender, internal.Command{Type: internal.MsgTypeError, Data: err.Error()})
+			return
+		}
+
+		e.send(sender, internal.Command{Type: internal.MsgTypeChannels, Data: string(b)})
+	default:
+		e.send(sender, internal.Command{
+			Type: internal.MsgTypeError,
+			Data: fmt.Sprintf(`%s command not found`, msg.Type),
+		})
+	}
+}
+
+func (e *Engine) authorizeChannel(c *Conn, auth internal.Auth, token string, msg internal.Command, allowed bool) {
+	channel, op := msg.Data, internal.ChannelJoin
+	if msg.Type == internal.MsgTypeChanIn {
+		channel, op = msg.Channel, internal.ChannelPublish
+	}
+
+	res := channelAuth{conn: c, msg: msg, token: token}
+	if len(channel) == 0 {
+		res.err = errors.New("no channel was specified")
+	} else if !allowed {
+		res.err = e.authorize(c.ctx, auth, channel, op)
+	}
+
+	if res.err != nil {
+		e.authorized <- res
+		return
+	}
+	res.allowed = true
+
+	switch msg.Type {
+	case internal.MsgTypeJoin:
+		var query *internal.LiveQuery
+		if len(msg.Filter) > 0 {
+			if !strings.HasPrefix(strings.ToLower(channel), "db-") {
+				res.err = errors.New("filters are only supported on database channels")
+				break
+			}
+
+			if query, res.err = internal.NewLiveQuery(msg.Filter); res.err != nil {
+				break
+			}
+		}
+
+		// the member is present before the join reply so presence queries
+		// include it
+		res.sub = subscription{
+			query:   query,
+			channel: channel,
+			close:   make(chan bool),
+			// the member's ID is not the connection's, it's sent to the
+			// channel
+			member: internal.PresenceMember{
+				ID:        uuid.New().String(),
+				UserID:    auth.UserID,
+				AccountID: auth.AccountID,
+				Joined:    time.Now(),
+			},
+		}
+		if res.err = e.pubsub.JoinPresence(channel, res.sub.member, presenceTTL); res.err != nil {
+			break
+		}
+
+		// SSE clients reconnect with the last message ID they received
+		since := msg.Since
+		if len(since) == 0 {
+			since, _ = c.ctx.Value(lastEventIDKey{}).(string)
+		}
+
+		history := historySettings(c.ctx)
+		if len(since) > 0 && history.Keeps(channel) {
+			res.history, res.err = e.pubsub.History(channel, since, history.MaxLen)
+		}
+	case internal.MsgTypePresence:
+		// the members of a channel are visible to who can join it
+		res.members, res.err = e.pubsub.PresenceMembers(channel)
+	case internal.MsgTypeChanIn:
+		res.err = e.publish(c.ctx, token, msg)
+	}
+
+	e.authorized <- res
+}
+
+func (e *Engine) channelAuthorized(res channelAuth) internal.Command {
+	c, msg := res.conn, res.msg
+
+	// unless the connection authenticated again in the meantime
+	if res.allowed && msg.Type == internal.MsgTypeChanIn && c.token == res.token {
+		c.publishes[msg.Channel] = true
+	}
+
+	if res.err != nil {
+		return internal.Command{Type: internal.MsgTypeError, Data: res.err.Error()}
+	}
+	switch msg.Type {
+	case internal.MsgTypeJoin:
+		sub := res.sub
+		// a join for the same channel completed in the meantime
+		if _, ok := c.subs[sub.channel]; ok {
+			return internal.Command{Type: internal.MsgTypeJoined, Data: msg.Data, Channel: msg.Data}
+		}
+		c.subs[sub.channel] = sub
+
+		// the subscription's messages go through the connection's queue
+		events := make(chan internal.Command)
+		go e.pubsub.Subscribe(events, c.token, sub.channel, sub.close)
+		go e.forward(c, sub, events)
+		go e.publishPresence(internal.MsgTypePresenceJoin, sub)
+
+		return internal.Command{Type: internal.MsgTypeJoined, Data: msg.Data, Channel: msg.Data}
+	case internal.MsgTypePresence:
+		b, err := json.Marshal(res.members)
+		if err != nil {
+			return internal.Command{Type: internal.MsgTypeError, Data: err.Error()}
+		}
+		return internal.Command{Type: internal.MsgTypePresence, Channel: msg.Data, Data: string(b)}
+	}
+
+	return internal.Command{Type: internal.MsgTypeOk}
+}
+
+// publish sends the message to the channel, the message is added to the
+// channel's history first if the base keeps one.
+func (e *Engine) publish(ctx context.Context, token string, msg internal.Command) error {
+	// the token is the one the connection authenticated with, not the client's
+	msg.Token = token
+
+	conf, _ := ctx.Value(middleware.ContextBase).(internal.BaseConfig)
+	msg.Base = conf.Name
+
+	history := historySettings(ctx)
+	if history.Keeps(msg.Channel) {
+		id, err := e.pubsub.AppendHistory(msg.Channel, msg, history.MaxLen)
+		if err != nil {
+			log.Println("error adding message to history", err)
+			return errors.New("unable to send your message")
+		}
+		msg.ID = id
+	}
+
+	if err := e.pubsub.Publish(msg); err != nil {
+		return errors.New("unable to send your message")
+	}
+	return nil
+}
+
+func historySettings(ctx context.Context) internal.HistorySettings {
+	conf, _ := ctx.Value(middleware.ContextBase).(internal.BaseConfig)
+	return conf.Settings.History.WithDefaults()
+}
+
+// forward queues the messages of a subscription to its connection. With a
+// live query, database events are sent only if they match.
+func (e *Engine) forward(c *Conn, sub subscription, events <-chan internal.Command) {
+	for {
+		select {
+		case msg := <-events:
+			if sub.query != nil && msg.IsDBEvent() {
+				var ok bool
+				if msg, ok = sub.query.Apply(msg); !ok {
+					continue
+				}
+			}
+
+			if !e.enqueue(c, msg) {
+				log.Println("dropping realtime connection, its send queue is full", c.ID)
+				// the engine closes this subscription
+				go e.Disconnect(c)
+				return
+			}
+		case <-sub.close:
+			return
+		}
+	}
+}
+
+func (e *Engine) leavePresence(subs []subscription) {
+	for _, sub := range subs {
+		ok, err := e.pubsub.LeavePresence(sub.channel, sub.member.ID)
+		if err != nil {
+			log.Println("error leaving presence", err)
+			continue
+		} else if !ok {
+			continue
+		}
+
+		e.publishPresence(internal.MsgTypePresenceLeave, sub)
+	}
+}
+
+func (e *Engine) refreshPresence(subs []subscription) {
+	for _, sub := range subs {
+		if err := e.pubsub.JoinPresence(sub.channel, sub.member, presenceTTL); err != nil {
+			log.Println("error refreshing presence", err)
+		}
+	}
+}
+
+func (e *Engine) publishPresence(typ string, sub subscription) {
+	b, err := json.Marshal(sub.member)
+	if err != nil {
+		log.Println("error converting presence member to JSON", err)
+		return
+	}
+
+	msg := internal.Command{Type: typ, Channel: sub.channel, Data: string(b)}
+	if err := e.pubsub.Publish(msg); err != nil {
+		log.Println("error publishing presence", err)
+	}
+}
@@ -0,0 +1,824 @@
+package realtime
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// memPubSub is an in-memory internal.PubSuber
+type memPubSub struct {
+	sync.Mutex
+	values   map[string]string
+	subs     map[string][]chan internal.Command
+	presence map[string]map[string]internal.PresenceMember
+	history  map[string][]internal.Command
+}
+
+func newMemPubSub() *memPubSub {
+	return &memPubSub{
+		values:   make(map[string]string),
+		subs:     make(map[string][]chan internal.Command),
+		presence: make(map[string]map[string]internal.PresenceMember),
+		history:  make(map[string][]internal.Command),
+	}
+}
+
+func (ps *memPubSub) Get(key string) (string, error) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	v, ok := ps.values[key]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return v, nil
+}
+
+func (ps *memPubSub) Set(key string, value string) error {
+	ps.Lock()
+	defer ps.Unlock()
+
+	ps.values[key] = value
+	return nil
+}
+
+func (ps *memPubSub) GetTyped(key string, v interface{}) error {
+	s, err := ps.Get(key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(s), v)
+}
+
+func (ps *memPubSub) SetTyped(key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ps.Set(key, string(b))
+}
+
+func (ps *memPubSub) Inc(key string, by int64) (int64, error) { return 0, nil }
+func (ps *memPubSub) Dec(key string, by int64) (int64, error) { return 0, nil }
+
+func (ps *memPubSub) QueueWork(key, value string) error { return nil }
+
+func (ps *memPubSub) DequeueWork(key string) (string, error) { return "", nil }
+
+func (ps *memPubSub) Subscribe(send chan internal.Command, token, channel string, close chan bool) {
+	ch := make(chan internal.Command, 10)
+
+	ps.Lock()
+	ps.subs[channel] = append(ps.subs[channel], ch)
+	ps.Unlock()
+
+	defer ps.unsubscribe(channel, ch)
+
+	for {
+		select {
+		case msg := <-ch:
+			if msg.Type == internal.MsgTypeChanIn {
+				msg.Type = internal.MsgTypeChanOut
+			}
+			msg.Token = ""
+			msg.Base = ""
+
+			select {
+			case send <- msg:
+			case <-close:
+				return
+			}
+		case <-close:
+			return
+		}
+	}
+}
+
+func (ps *memPubSub) unsubscribe(channel string, ch chan internal.Command) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	subs := ps.subs[channel]
+	for i, sub := range subs {
+		if sub == ch {
+			ps.subs[channel] = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+}
+
+func (ps *memPubSub) subscribers(channel string) int {
+	ps.Lock()
+	defer ps.Unlock()
+
+	return len(ps.subs[channel])
+}
+
+func (ps *memPubSub) Publish(msg internal.Command) error {
+	ps.Lock()
+	defer ps.Unlock()
+
+	for _, ch := range ps.subs[msg.Channel] {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+	return nil
+}
+
+func (ps *memPubSub) Broadcast(msg internal.Command) error {
+	return ps.Publish(msg)
+}
+
+func (ps *memPubSub) PublishDocument(channel string, evt internal.DocumentEvent) {}
+
+func (ps *memPubSub) JoinPresence(channel string, member internal.PresenceMember, ttl time.Duration) error {
+	ps.Lock()
+	defer ps.Unlock()
+
+	if _, ok := ps.presence[channel]; !ok {
+		ps.presence[channel] = make(map[string]internal.PresenceMember)
+	}
+	ps.presence[channel][member.ID] = member
+	return nil
+}
+
+func (ps *memPubSub) LeavePresence(channel, id string) (bool, error) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	_, ok := ps.presence[channel][id]
+	delete(ps.presence[channel], id)
+	return ok, nil
+}
+
+func (ps *memPubSub) AppendHistory(channel string, msg internal.Command, maxLen int64) (string, error) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	msg.Token = ""
+	msg.Base = ""
+	msg.ID = fmt.Sprintf("%d-0", len(ps.history[channel])+1)
+	ps.history[channel] = append(ps.history[channel], msg)
+	return msg.ID, nil
+}
+
+func (ps *memPubSub) History(channel, since string, limit int64) ([]internal.Command, error) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	var msgs []internal.Command
+	for _, msg := range ps.history[channel] {
+		if msg.ID > since && int64(len(msgs)) < limit {
+			msg.Type = internal.MsgTypeChanOut
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, nil
+}
+
+func (ps *memPubSub) PresenceMembers(channel string) ([]internal.PresenceMember, error) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	members := make([]internal.PresenceMember, 0)
+	for _, m := range ps.presence[channel] {
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// client is a realtime connection over one of the transports
+type client interface {
+	id() string
+	send(t *testing.T, msg internal.Command)
+	receive(t *testing.T) internal.Command
+	close()
+}
+
+type wsClient struct {
+	ws  *websocket.Conn
+	sid string
+}
+
+func (c *wsClient) id() string { return c.sid }
+func (c *wsClient) close()     { c.ws.Close() }
+
+func (c *wsClient) send(t *testing.T, msg internal.Command) {
+	if err := c.ws.WriteJSON(msg); err != nil {
+		t.Fatal("error writing JSON to WebSocket", err)
+	}
+}
+
+func (c *wsClient) receive(t *testing.T) internal.Command {
+	c.ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var msg internal.Command
+	if err := c.ws.ReadJSON(&msg); err != nil {
+		t.Fatal("error reading JSON from WebSocket", err)
+	}
+	return msg
+}
+
+type sseClient struct {
+	url      string
+	sid      string
+	resp     *http.Response
+	messages chan internal.Command
+
+	// the token received once authenticated
+	mu    sync.Mutex
+	token string
+}
+
+func (c *sseClient) id() string { return c.sid }
+func (c *sseClient) close()     { c.resp.Body.Close() }
+
+func (c *sseClient) send(t *testing.T, msg internal.Command) {
+	msg.SID = c.sid
+
+	c.mu.Lock()
+	msg.Token = c.token
+	c.mu.Unlock()
+
+	if status := c.post(t, msg); status != http.StatusOK {
+		t.Fatalf("expected status 200 posting SSE message got %d", status)
+	}
+}
+
+// post sends the command as is and returns the response status
+func (c *sseClient) post(t *testing.T, msg internal.Command) int {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(c.url+"/sse/msg", "application/json", bytes.NewReader(b))
+	if err != nil {
+		t.Fatal("error posting SSE message", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func (c *sseClient) receive(t *testing.T) internal.Command {
+	select {
+	case msg := <-c.messages:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for SSE message")
+	}
+	return internal.Command{}
+}
+
+// receiveType skips the messages until one of type typ matches
+func receiveType(t *testing.T, c client, typ string, match func(internal.Command) bool) internal.Command {
+	for {
+		msg := c.receive(t)
+		if msg.Type == typ && (match == nil || match(msg)) {
+			return msg
+		}
+	}
+}
+
+func presenceOf(id string) func(internal.Command) bool {
+	return func(msg internal.Command) bool {
+		return memberOf(msg).ID == id
+	}
+}
+
+// memberOf returns the member of a presence event
+func memberOf(msg internal.Command) internal.PresenceMember {
+	var m internal.PresenceMember
+	json.Unmarshal([]byte(msg.Data), &m)
+	return m
+}
+
+type transport struct {
+	name    string
+	url     string
+	connect func(t *testing.T) client
+}
+
+// authorizations counts the authorize calls by channel
+var authorizations = struct {
+	sync.Mutex
+	calls map[string]int
+}{calls: make(map[string]int)}
+
+func authorizeCalls(channel string) int {
+	authorizations.Lock()
+	defer authorizations.Unlock()
+
+	return authorizations.calls[channel]
+}
+
+func newTestEngine(t *testing.T) (*memPubSub, []transport) {
+	validate := func(ctx context.Context, key string) (internal.Auth, string, error) {
+		if key != "valid-jwt" {
+			return internal.Auth{}, "", errors.New("invalid token")
+		}
+		return internal.Auth{AccountID: "acct1", UserID: "user1"}, "user1|token", nil
+	}
+
+	authorize := func(ctx context.Context, auth internal.Auth, channel, op string) error {
+		authorizations.Lock()
+		authorizations.calls[channel]++
+		authorizations.Unlock()
+
+		if strings.HasPrefix(channel, "private") {
+			return errors.New("you are not allowed on this channel")
+		}
+		return nil
+	}
+
+	ps := newMemPubSub()
+	e := NewEngine(validate, authorize, ps)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", e.ServeWS)
+	mux.HandleFunc("/sse/connect", e.ServeSSE)
+	mux.HandleFunc("/sse/msg", e.Receive)
+
+	// the base's settings are in the request context, see middleware.WithDB
+	conf := internal.BaseConfig{Name: "unittest"}
+	conf.Settings.History = internal.HistorySettings{Channels: []string{"hist-*"}}
+	conf.Settings.Realtime = internal.RealtimeSettings{MaxMessageSize: 4096}
+
+	withBase := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), middleware.ContextBase, conf)
+		mux.ServeHTTP(w, r.WithContext(ctx))
+	})
+
+	ts := httptest.NewServer(withBase)
+	t.Cleanup(ts.Close)
+
+	connectWS := func(t *testing.T) client {
+		url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+		ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal("cannot connect WebSocket", err)
+		}
+
+		c := &wsClient{ws: ws}
+		init := c.receive(t)
+		c.sid = init.Data
+		return c
+	}
+
+	connectSSE := func(t *testing.T) client {
+		return dialSSE(t, ts.URL, "")
+	}
+
+	return ps, []transport{{"websocket", ts.URL, connectWS}, {"sse", ts.URL, connectSSE}}
+}
+
+// dialSSE connects an SSE client, the ID of its messages are the ones from
+// the event's id field.
+func dialSSE(t *testing.T, url, lastEventID string) *sseClient {
+	req, err := http.NewRequest(http.MethodGet, url+"/sse/connect", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lastEventID) > 0 {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("cannot connect SSE", err)
+	}
+
+	c := &sseClient{url: url, resp: resp, messages: make(chan internal.Command, 10)}
+	go func() {
+		id := ""
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "id: ") {
+				id = strings.TrimPrefix(line, "id: ")
+				continue
+			} else if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+
+			var msg internal.Command
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &msg); err != nil {
+				continue
+			}
+
+			msg.ID, id = id, ""
+			if msg.Type == internal.MsgTypeToken {
+				c.mu.Lock()
+				c.token = msg.Data
+				c.mu.Unlock()
+			}
+			c.messages <- msg
+		}
+	}()
+
+	init := c.receive(t)
+	c.sid = init.Data
+	return c
+}
+
+func TestRealtimeProtocol(t *testing.T) {
+	_, transports := newTestEngine(t)
+
+	for _, tr := range transports {
+		t.Run(tr.name, func(t *testing.T) {
+			c := tr.connect(t)
+			defer c.close()
+
+			if len(c.id()) == 0 {
+				t.Fatal("expected an init message with the connection id")
+			}
+
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeEcho, Data: "test"})
+			if msg := c.receive(t); msg.Data != "echo: test" {
+				t.Errorf(`expected "echo: test" got %s`, msg.Data)
+			}
+
+			room := "room-" + tr.name
+
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeJoin, Data: room})
+			if msg := c.receive(t); msg.Type != internal.MsgTypeError {
+				t.Errorf("expected an error joining before auth got %v", msg)
+			}
+
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeAuth, Data: "invalid"})
+			if msg := c.receive(t); msg.Type != internal.MsgTypeError {
+				t.Errorf("expected an error for an invalid token got %v", msg)
+			}
+
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeAuth, Data: "valid-jwt"})
+			if msg := c.receive(t); msg.Type != internal.MsgTypeToken || msg.Data != "user1|token" {
+				t.Errorf("expected token user1|token got %v", msg)
+			}
+
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeJoin, Data: "private-room"})
+			if msg := c.receive(t); msg.Type != internal.MsgTypeError {
+				t.Errorf("expected an error joining a private channel got %v", msg)
+			}
+
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeJoin, Data: room})
+			if msg := c.receive(t); msg.Type != internal.MsgTypeJoined || msg.Data != room {
+				t.Errorf("expected joined %s got %v", room, msg)
+			}
+
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypePresence, Data: room})
+			msg := receiveType(t, c, internal.MsgTypePresence, nil)
+
+			var members []internal.PresenceMember
+			if err := json.Unmarshal([]byte(msg.Data), &members); err != nil {
+				t.Fatal(err)
+			} else if len(members) != 1 || members[0].UserID != "user1" {
+				t.Errorf("expected the connection as only member got %v", members)
+			} else if len(members[0].ID) == 0 || members[0].ID == c.id() {
+				t.Errorf("expected a member ID other than the connection's got %s", members[0].ID)
+			}
+
+			c.send(t, internal.Command{SID: c.id(), Type: "unknown"})
+			if msg := c.receive(t); msg.Type != internal.MsgTypeError {
+				t.Errorf("expected an error for an unknown command got %v", msg)
+			}
+		})
+	}
+}
+
+func TestRealtimeChannelAcrossTransports(t *testing.T) {
+	_, transports := newTestEngine(t)
+
+	ws := transports[0].connect(t)
+	defer ws.close()
+
+	sse := transports[1].connect(t)
+	defer sse.close()
+
+	for _, c := range []client{ws, sse} {
+		c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeAuth, Data: "valid-jwt"})
+		c.receive(t)
+	}
+
+	ws.send(t, internal.Command{SID: ws.id(), Type: internal.MsgTypeJoin, Data: "room"})
+	receiveType(t, ws, internal.MsgTypeJoined, nil)
+
+	first := memberOf(receiveType(t, ws, internal.MsgTypePresenceJoin, nil))
+
+	sse.send(t, internal.Command{SID: sse.id(), Type: internal.MsgTypeJoin, Data: "room"})
+	receiveType(t, sse, internal.MsgTypeJoined, nil)
+
+	// the first member is notified of the second's join
+	second := memberOf(receiveType(t, ws, internal.MsgTypePresenceJoin, func(msg internal.Command) bool {
+		return memberOf(msg).ID != first.ID
+	}))
+
+	ws.send(t, internal.Command{SID: ws.id(), Type: internal.MsgTypeChanIn, Channel: "room", Data: "hello"})
+	receiveType(t, ws, internal.MsgTypeOk, nil)
+
+	msg := receiveType(t, sse, internal.MsgTypeChanOut, nil)
+	if msg.Data != "hello" {
+		t.Errorf("expected chan_out hello got %v", msg)
+	} else if len(msg.Token) > 0 {
+		t.Errorf("the publisher's token was sent to the members: %s", msg.Token)
+	}
+
+	sse.close()
+	receiveType(t, ws, internal.MsgTypePresenceLeave, presenceOf(second.ID))
+}
+
+func TestRealtimePublishAuthorizedOnce(t *testing.T) {
+	_, transports := newTestEngine(t)
+
+	for _, tr := range transports {
+		t.Run(tr.name, func(t *testing.T) {
+			c := tr.connect(t)
+			defer c.close()
+
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeAuth, Data: "valid-jwt"})
+			receiveType(t, c, internal.MsgTypeToken, nil)
+
+			room, private := "publish-"+tr.name, "private-"+tr.name
+			calls, denied := authorizeCalls(room), authorizeCalls(private)
+
+			for i := 0; i < 3; i++ {
+				c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeChanIn, Channel: room, Data: "hello"})
+				receiveType(t, c, internal.MsgTypeOk, nil)
+			}
+
+			if n := authorizeCalls(room) - calls; n != 1 {
+				t.Errorf("expected the publishes to be authorized once got %d", n)
+			}
+
+			// authenticating again authorizes the channel again
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeAuth, Data: "valid-jwt"})
+			receiveType(t, c, internal.MsgTypeToken, nil)
+
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeChanIn, Channel: room, Data: "hello"})
+			receiveType(t, c, internal.MsgTypeOk, nil)
+
+			if n := authorizeCalls(room) - calls; n != 2 {
+				t.Errorf("expected a second authorization after auth got %d", n)
+			}
+
+			for i := 0; i < 2; i++ {
+				c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeChanIn, Channel: private, Data: "hello"})
+				receiveType(t, c, internal.MsgTypeError, nil)
+			}
+
+			if n := authorizeCalls(private) - denied; n != 2 {
+				t.Errorf("expected denied publishes to be authorized each time got %d", n)
+			}
+		})
+	}
+}
+
+func TestRealtimeLeaveAndListChannels(t *testing.T) {
+	ps, transports := newTestEngine(t)
+
+	for _, tr := range transports {
+		t.Run(tr.name, func(t *testing.T) {
+			c := tr.connect(t)
+			defer c.close()
+
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeAuth, Data: "valid-jwt"})
+			receiveType(t, c, internal.MsgTypeToken, nil)
+
+			channels := []string{"b-" + tr.name, "a-" + tr.name}
+			for _, channel := range append(channels, channels[0]) {
+				c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeJoin, Data: channel})
+				receiveType(t, c, internal.MsgTypeJoined, nil)
+			}
+
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeListChannels})
+			msg := receiveType(t, c, internal.MsgTypeChannels, nil)
+
+			var names []string
+			if err := json.Unmarshal([]byte(msg.Data), &names); err != nil {
+				t.Fatal(err)
+			} else if len(names) != 2 || names[0] != channels[1] || names[1] != channels[0] {
+				t.Errorf("expected %v once each, sorted, got %v", channels, names)
+			}
+
+			waitFor(t, func() bool { return ps.subscribers(channels[0]) == 1 })
+
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeLeave, Data: channels[0]})
+			if msg := receiveType(t, c, internal.MsgTypeLeft, nil); msg.Data != channels[0] {
+				t.Errorf("expected left %s got %v", channels[0], msg)
+			}
+
+			waitFor(t, func() bool { return ps.subscribers(channels[0]) == 0 })
+
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeLeave, Data: channels[0]})
+			receiveType(t, c, internal.MsgTypeError, nil)
+
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeListChannels})
+			msg = receiveType(t, c, internal.MsgTypeChannels, nil)
+			if msg.Data != fmt.Sprintf(`["%s"]`, channels[1]) {
+				t.Errorf("expected only %s got %s", channels[1], msg.Data)
+			}
+		})
+	}
+}
+
+func TestRealtimeSubscriptionsDoNotLeak(t *testing.T) {
+	_, transports := newTestEngine(t)
+
+	c := transports[0].connect(t)
+	c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeAuth, Data: "valid-jwt"})
+	receiveType(t, c, internal.MsgTypeToken, nil)
+
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 50; i++ {
+		channel := fmt.Sprintf("leak-%d", i)
+		c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeJoin, Data: channel})
+		receiveType(t, c, internal.MsgTypeJoined, nil)
+	}
+
+	if n := runtime.NumGoroutine(); n < before+50 {
+		t.Fatalf("expected at least %d goroutines got %d", before+50, n)
+	}
+
+	for i := 0; i < 25; i++ {
+		channel := fmt.Sprintf("leak-%d", i)
+		c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeLeave, Data: channel})
+		receiveType(t, c, internal.MsgTypeLeft, nil)
+	}
+
+	// the other subscriptions end with the connection
+	c.close()
+
+	waitFor(t, func() bool { return runtime.NumGoroutine() <= before })
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRealtimeHistoryReplay(t *testing.T) {
+	ps, transports := newTestEngine(t)
+
+	pub := transports[0].connect(t)
+	defer pub.close()
+
+	pub.send(t, internal.Command{SID: pub.id(), Type: internal.MsgTypeAuth, Data: "valid-jwt"})
+	receiveType(t, pub, internal.MsgTypeToken, nil)
+
+	pub.send(t, internal.Command{SID: pub.id(), Type: internal.MsgTypeJoin, Data: "hist-room"})
+	receiveType(t, pub, internal.MsgTypeJoined, nil)
+	waitFor(t, func() bool { return ps.subscribers("hist-room") == 1 })
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		data := fmt.Sprintf("msg %d", i)
+		pub.send(t, internal.Command{SID: pub.id(), Type: internal.MsgTypeChanIn, Channel: "hist-room", Data: data})
+
+		// the message can be received before the ok reply
+		var msg internal.Command
+		for gotOk := false; !gotOk || len(msg.Type) == 0; {
+			switch m := pub.receive(t); m.Type {
+			case internal.MsgTypeOk:
+				gotOk = true
+			case internal.MsgTypeChanOut:
+				msg = m
+			}
+		}
+		if len(msg.ID) == 0 {
+			t.Fatalf("expected a message ID for %s", data)
+		}
+		ids = append(ids, msg.ID)
+	}
+
+	expectReplay := func(t *testing.T, c client) {
+		for _, id := range ids[1:] {
+			msg := receiveType(t, c, internal.MsgTypeChanOut, nil)
+			if msg.ID != id {
+				t.Errorf("expected replayed message %s got %v", id, msg)
+			}
+		}
+	}
+
+	t.Run("since", func(t *testing.T) {
+		c := transports[0].connect(t)
+		defer c.close()
+
+		c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeAuth, Data: "valid-jwt"})
+		receiveType(t, c, internal.MsgTypeToken, nil)
+
+		c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeJoin, Data: "hist-room", Since: ids[0]})
+		receiveType(t, c, internal.MsgTypeJoined, nil)
+		expectReplay(t, c)
+	})
+
+	t.Run("Last-Event-ID", func(t *testing.T) {
+		c := dialSSE(t, transports[1].url, ids[0])
+		defer c.close()
+
+		c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeAuth, Data: "valid-jwt"})
+		receiveType(t, c, internal.MsgTypeToken, nil)
+
+		c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeJoin, Data: "hist-room"})
+		receiveType(t, c, internal.MsgTypeJoined, nil)
+		expectReplay(t, c)
+	})
+}
+
+func TestRealtimeFilteredDatabaseChannel(t *testing.T) {
+	ps, transports := newTestEngine(t)
+
+	for _, tr := range transports {
+		t.Run(tr.name, func(t *testing.T) {
+			channel := "db-tasks-" + tr.name
+
+			c := tr.connect(t)
+			defer c.close()
+
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeAuth, Data: "valid-jwt"})
+			receiveType(t, c, internal.MsgTypeToken, nil)
+
+			invalid := [][]interface{}{{"status", "like", "open"}}
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeJoin, Data: channel, Filter: invalid})
+			receiveType(t, c, internal.MsgTypeError, nil)
+
+			filter := [][]interface{}{{"status", "==", "open"}}
+			c.send(t, internal.Command{SID: c.id(), Type: internal.MsgTypeJoin, Data: channel, Filter: filter})
+			receiveType(t, c, internal.MsgTypeJoined, nil)
+
+			waitFor(t, func() bool { return ps.subscribers(channel) == 1 })
+
+			events := []internal.Command{
+				{Type: internal.MsgTypeDBCreated, Data: `{"document":{"id":"1","status":"closed"}}`},
+				{Type: internal.MsgTypeDBCreated, Data: `{"document":{"id":"2","status":"open"}}`},
+				{Type: internal.MsgTypeDBUpdated, Data: `{"previous":{"id":"2","status":"open"},"document":{"id":"2","status":"closed"}}`},
+				{Type: internal.MsgTypeDBDeleted, Data: `{"id":"1","previous":{"id":"1","status":"closed"}}`},
+				{Type: internal.MsgTypeDBDeleted, Data: `{"id":"2"}`},
+			}
+			for _, msg := range events {
+				msg.Channel = channel
+				ps.Publish(msg)
+			}
+
+			expected := []string{internal.MsgTypeDBCreated, internal.MsgTypeDBLeft, internal.MsgTypeDBDeleted}
+			for _, typ := range expected {
+				msg := c.receive(t)
+				for msg.Type == internal.MsgTypePresenceJoin {
+					msg = c.receive(t)
+				}
+
+				if msg.Type != typ {
+					t.Fatalf("expected %s got %v", typ, msg)
+				}
+			}
+		})
+	}
+}
+
+func TestRealtimeSSECommandsNeedTheConnection(t *testing.T) {
+	_, transports := newTestEngine(t)
+
+	c := transports[1].connect(t).(*sseClient)
+	defer c.close()
+
+	// only the secret of the init message identifies the connection
+	if status := c.post(t, internal.Command{SID: uuid.New().String(), Type: internal.MsgTypeEcho}); status != http.StatusForbidden {
+		t.Errorf("expected an unknown SID to be refused got %d", status)
+	}
+
+	c.send(t, internal.Command{Type: internal.MsgTypeAuth, Data: "valid-jwt"})
+	receiveType(t, c, internal.MsgTypeToken, nil)
+
+	if status := c.post(t, internal.Command{SID: c.id(), Type: internal.MsgTypeJoin, Data: "room"}); status != http.StatusForbidden {
+		t.Errorf("expected a command without the connection's token to be refused got %d", status)
+	}
+
+	c.send(t, internal.Command{Type: internal.MsgTypeJoin, Data: "room"})
+	receiveType(t, c, internal.MsgTypeJoined, nil)
+}
@@ -0,0 +1,71 @@
+package realtime
+
+import (
+	"sync/atomic"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// Stats are the realtime counters since the server started
+type Stats struct {
+	// Connections currently connected
+	Connections int64 `json:"connections"`
+	// Dropped messages of slow consumers
+	Dropped int64 `json:"dropped"`
+	// SlowDisconnects are the connections dropped because they were too slow
+	SlowDisconnects int64 `json:"slowDisconnects"`
+	// WriteErrors are the failed writes to the clients
+	WriteErrors int64 `json:"writeErrors"`
+}
+
+// Stats returns a snapshot of the engine's counters
+func (e *Engine) Stats() Stats {
+	return Stats{
+		Connections:     atomic.LoadInt64(&e.stats.Connections),
+		Dropped:         atomic.LoadInt64(&e.stats.Dropped),
+		SlowDisconnects: atomic.LoadInt64(&e.stats.SlowDisconnects),
+		WriteErrors:     atomic.LoadInt64(&e.stats.WriteErrors),
+	}
+}
+
+// WriteError counts a failed write of a transport
+func (e *Engine) WriteError() {
+	atomic.AddInt64(&e.stats.WriteErrors, 1)
+}
+
+// enqueue adds the message to the connection's bounded queue. When the
+// queue is full the connection's slow consumer policy applies, it returns
+// false if the connection must be disconnected.
+//
+// It never blocks so a slow client can't hold the engine or the channels'
+// subscriptions.
+func (e *Engine) enqueue(c *Conn, msg internal.Command) bool {
+	select {
+	case c.Send <- msg:
+		return true
+	default:
+	}
+
+	switch c.policy {
+	case internal.SlowConsumerDropNewest:
+		atomic.AddInt64(&e.stats.Dropped, 1)
+		return true
+	case internal.SlowConsumerDropOldest:
+		for {
+			select {
+			case c.Send <- msg:
+				return true
+			default:
+			}
+
+			select {
+			case <-c.Send:
+				atomic.AddInt64(&e.stats.Dropped, 1)
+			default:
+			}
+		}
+	}
+
+	atomic.AddInt64(&e.stats.SlowDisconnects, 1)
+	return false
+}
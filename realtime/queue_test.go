@@ -0,0 +1,46 @@
+package realtime
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestSlowConsumerPolicies(t *testing.T) {
+	tables := make(map[string][]string)
+	tables[internal.SlowConsumerDropNewest] = []string{"0", "1"}
+	tables[internal.SlowConsumerDropOldest] = []string{"1", "2"}
+	tables[internal.SlowConsumerDisconnect] = []string{"0", "1"}
+
+	for policy, expected := range tables {
+		e := &Engine{}
+		c := &Conn{Send: make(chan internal.Command, 2), policy: policy}
+
+		ok := true
+		for i := 0; i < 3; i++ {
+			ok = e.enqueue(c, internal.Command{Data: fmt.Sprintf("%d", i)})
+		}
+
+		if disconnect := policy == internal.SlowConsumerDisconnect; ok == disconnect {
+			t.Errorf("%s: expected disconnect to be %v", policy, disconnect)
+		}
+
+		close(c.Send)
+		var got []string
+		for msg := range c.Send {
+			got = append(got, msg.Data)
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("%s: expected queue %v got %v", policy, expected, got)
+		}
+
+		stats := e.Stats()
+		if policy == internal.SlowConsumerDisconnect && stats.SlowDisconnects != 1 {
+			t.Errorf("%s: expected 1 slow disconnect got %d", policy, stats.SlowDisconnects)
+		} else if policy != internal.SlowConsumerDisconnect && stats.Dropped != 1 {
+			t.Errorf("%s: expected 1 dropped message got %d", policy, stats.Dropped)
+		}
+	}
+}
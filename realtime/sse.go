@@ -0,0 +1,122 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+)
+
+type lastEventIDKey struct{}
+
+// ServeSSE streams the messages of a new connection as Server-Sent Events,
+// an alternative to WebSocket. The client sends its commands to Receive.
+func (e *Engine) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	// check if writer handles flushing
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is unsupported with your connection.", http.StatusBadRequest)
+		return
+	}
+
+	// set headers related to event streaming
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	// reconnecting clients send the last message ID they received, their
+	// joins replay what they missed
+	ctx := r.Context()
+	if id := r.Header.Get("Last-Event-ID"); len(id) > 0 {
+		ctx = context.WithValue(ctx, lastEventIDKey{}, id)
+	}
+
+	c := e.Connect(ctx)
+
+	// make sure we'r removing this connection
+	// when the handler completes.
+	defer e.Disconnect(c)
+
+	for {
+		select {
+		case msg := <-c.Send:
+			b, err := json.Marshal(msg)
+			if err != nil {
+				fmt.Println("error converting to JSON", err)
+				continue
+			}
+			if len(msg.ID) > 0 {
+				fmt.Fprintf(w, "id: %s\n", msg.ID)
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
+				e.WriteError()
+				return
+			}
+
+			// flush immediately.
+			flusher.Flush()
+		case <-c.Done():
+			return
+		case <-r.Context().Done():
+			// client-side disconnection
+			return
+		}
+	}
+}
+
+// received is a command posted by a Server-Sent Events client
+type received struct {
+	secret string
+	base   string
+	msg    internal.Command
+	err    chan error
+}
+
+// Receive accepts the commands of Server-Sent Events clients, their SID is
+// the secret of the init message. Once authenticated, the commands carry the
+// connection's token. Commands are limited to the base's maximum message
+// size.
+func (e *Engine) Receive(w http.ResponseWriter, r *http.Request) {
+	conf, _ := r.Context().Value(middleware.ContextBase).(internal.BaseConfig)
+	settings := conf.Settings.Realtime.WithDefaults()
+
+	r.Body = http.MaxBytesReader(w, r.Body, settings.MaxMessageSize)
+
+	var msg internal.Command
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rcv := received{secret: msg.SID, base: conf.Name, msg: msg, err: make(chan error, 1)}
+	e.received <- rcv
+	if err := <-rcv.err; err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(true)
+}
+
+// receive handles the command of the connection holding the secret, the
+// client sending it must be connected to the same base and authenticated as
+// the same user
+func (e *Engine) receive(r received) error {
+	c, ok := e.secrets[r.secret]
+	if !ok || c.base != r.base {
+		return errors.New("cannot find your connection")
+	} else if len(c.token) > 0 && r.msg.Type != internal.MsgTypeAuth && r.msg.Token != c.token {
+		return errors.New("this connection is authenticated with another token")
+	}
+
+	// the client only acts as its own connection
+	msg := r.msg
+	msg.SID = c.ID
+	e.handle(msg)
+	return nil
+}
@@ -0,0 +1,152 @@
+package realtime
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a message to the peer.
+	writeWait = 10 * time.Second
+
+	// Time allowed to read the next pong message from the peer.
+	pongWait = 60 * time.Second
+
+	// Send pings to peer with this period. Must be less than pongWait.
+	pingPeriod = (pongWait * 9) / 10
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// permessage-deflate, used when the client supports it
+	EnableCompression: true,
+	Subprotocols:      []string{SubprotocolMsgPack, SubprotocolJSON},
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// ServeWS handles websocket requests from the peer. The request's context
+// must hold the base, see middleware.WithDB.
+//
+// Messages are JSON text frames unless the client negotiates the
+// sb.msgpack subprotocol.
+func (e *Engine) ServeWS(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	conf, _ := r.Context().Value(middleware.ContextBase).(internal.BaseConfig)
+	settings := conf.Settings.Realtime.WithDefaults()
+
+	ws.EnableWriteCompression(true)
+
+	c := e.Connect(r.Context())
+	cdc := codecFor(ws.Subprotocol())
+
+	// Allow collection of memory referenced by the caller by doing all work in
+	// new goroutines.
+	go e.writePump(ws, c, cdc)
+	go e.readPump(ws, c, cdc, settings.MaxMessageSize)
+}
+
+// readPump pumps messages from the websocket connection to the engine.
+//
+// The application runs readPump in a per-connection goroutine. The application
+// ensures that there is at most one reader on a connection by executing all
+// reads from this goroutine.
+//
+// The limit applies to the decompressed messages.
+func (e *Engine) readPump(ws *websocket.Conn, c *Conn, cdc codec, limit int64) {
+	defer func() {
+		e.Disconnect(c)
+		ws.Close()
+	}()
+	ws.SetReadDeadline(time.Now().Add(pongWait))
+	ws.SetPongHandler(func(string) error { ws.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	for {
+		_, r, err := ws.NextReader()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("error: %v", err)
+			}
+			break
+		}
+
+		b, err := io.ReadAll(io.LimitReader(r, limit+1))
+		if err != nil {
+			log.Printf("error: %v", err)
+			break
+		} else if int64(len(b)) > limit {
+			closeMsg := websocket.FormatCloseMessage(websocket.CloseMessageTooBig, "message too big")
+			ws.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(writeWait))
+			break
+		}
+
+		var msg internal.Command
+		if err := cdc.decode(b, &msg); err != nil {
+			log.Println("error decoding websocket message", err)
+			break
+		}
+
+		// a socket can only send commands for itself
+		msg.SID = c.ID
+		e.Broadcast <- msg
+	}
+}
+
+// writePump pumps messages from the engine to the websocket connection.
+//
+// A goroutine running writePump is started for each connection. The
+// application ensures that there is at most one writer to a connection by
+// executing all writes from this goroutine.
+//
+// A failed write disconnects the client, its readPump then stops since the
+// connection is closed.
+func (e *Engine) writePump(ws *websocket.Conn, c *Conn, cdc codec) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		ws.Close()
+	}()
+	for {
+		select {
+		case msg := <-c.Send:
+			b, err := cdc.encode(msg)
+			if err != nil {
+				log.Println("error encoding websocket message", err)
+				continue
+			}
+
+			ws.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := ws.WriteMessage(cdc.frameType(), b); err != nil {
+				log.Println("error writing to websocket", err)
+				e.WriteError()
+				e.Disconnect(c)
+				return
+			}
+		case <-c.Done():
+			// The engine dropped the connection.
+			ws.SetWriteDeadline(time.Now().Add(writeWait))
+			ws.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+		case <-ticker.C:
+			ws.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				e.WriteError()
+				e.Disconnect(c)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package staticbackend
+
+import (
+	"net/http"
+
+	"github.com/staticbackendhq/core/cache"
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+)
+
+func (database *Database) rules(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		database.saveRule(w, r)
+	} else if r.Method == http.MethodDelete {
+		database.deleteRule(w, r)
+	} else if r.Method == http.MethodGet {
+		database.listRules(w, r)
+	} else {
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func (database *Database) saveRule(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var rule internal.Rule
+	if err := parseBody(r.Body, &rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := rule.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := datastore.SaveRule(conf.Name, rule); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the databases and realtime permission checks read the rule from cache
+	if err := database.cache.SetTyped(cache.RuleKey(conf.Name, rule.Collection), rule); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// the other nodes read the channel rules again once their cache expires
+	channelAuths.forget(conf.Name)
+
+	respond(w, http.StatusOK, true)
+}
+
+func (database *Database) listRules(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rules, err := datastore.ListRules(conf.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rules == nil {
+		rules = make([]internal.Rule, 0)
+	}
+
+	respond(w, http.StatusOK, rules)
+}
+
+func (database *Database) deleteRule(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	col := r.URL.Query().Get("col")
+	if err := datastore.DeleteRule(conf.Name, col); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// an empty rule is cached so the permission suffixes apply again
+	if err := database.cache.SetTyped(cache.RuleKey(conf.Name, col), internal.Rule{}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	channelAuths.forget(conf.Name)
+
+	respond(w, http.StatusOK, true)
+}
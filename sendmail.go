@@ -16,17 +16,7 @@ func sudoSendMail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// if only body is provided
-	if len(data.Body) > 0 {
-		data.HTMLBody = data.Body
-		data.TextBody = email.StripHTML(data.Body)
-	} else if len(data.TextBody) == 0 && len(data.HTMLBody) > 0 {
-		data.TextBody = email.StripHTML(data.HTMLBody)
-	} else if len(data.HTMLBody) == 0 && len(data.TextBody) > 0 {
-		data.HTMLBody = data.TextBody
-	}
-
-	if err := emailer.Send(data); err != nil {
+	if err := emailer.Send(email.FillBodies(data)); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
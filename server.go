@@ -3,8 +3,6 @@ package staticbackend
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -23,6 +21,7 @@ import (
 	"github.com/staticbackendhq/core/middleware"
 	"github.com/staticbackendhq/core/realtime"
 	"github.com/staticbackendhq/core/storage"
+	"github.com/staticbackendhq/core/webhook"
 
 	"github.com/stripe/stripe-go/v71"
 	mongodrv "go.mongodb.org/mongo-driver/mongo"
@@ -39,11 +38,13 @@ const (
 )
 
 var (
-	datastore internal.Persister
-	volatile  *cache.Cache
-	emailer   internal.Mailer
-	storer    internal.Storer
-	AppEnv    = os.Getenv("APP_ENV")
+	datastore           internal.Persister
+	volatile            *cache.Cache
+	emailer             internal.Mailer
+	storer              internal.Storer
+	hooks               *webhook.Dispatcher
+	functionsSubscriber *function.Subscriber
+	AppEnv              = os.Getenv("APP_ENV")
 )
 
 // Start starts the web server and all dependencies services
@@ -59,52 +60,8 @@ func Start(dbHost, port string) {
 
 	initServices(dbHost)
 
-	// websockets
-	hub := newHub(volatile)
-	go hub.run()
-
-	// Server Send Event, alternative to websocket
-	b := realtime.NewBroker(func(ctx context.Context, key string) (string, error) {
-		//TODO: Experimental, let un-authenticated user connect
-		// useful for an Intercom-like SaaS I'm building.
-		if strings.HasPrefix(key, "__tmp__experimental_public") {
-			// let's create the most minimal authentication possible
-			a := internal.Auth{
-				AccountID: randStringRunes(30),
-				UserID:    randStringRunes(30),
-				Email:     "exp@tmp.com",
-				Role:      0,
-				Token:     key,
-			}
-
-			if err := volatile.SetTyped(key, a); err != nil {
-				return key, err
-			}
-
-			return key, nil
-		}
-
-		auth, err := middleware.ValidateAuthKey(datastore, volatile, ctx, key)
-		if err != nil {
-			return "", err
-		}
-
-		// set base:token useful when executing pubsub event message / function
-		conf, ok := ctx.Value(middleware.ContextBase).(internal.BaseConfig)
-		if !ok {
-			return "", errors.New("could not find base config")
-		}
-
-		//TODO: Lots of repetition of this, needs to be refactor
-		if err := volatile.SetTyped(key, auth); err != nil {
-			return "", err
-		}
-		if err := volatile.SetTyped("base:"+key, conf); err != nil {
-			return "", err
-		}
-
-		return key, nil
-	}, volatile)
+	// realtime over websockets or Server-Sent Events
+	rt := realtime.NewEngine(realtimeAuth, realtimeAuthorize, volatile)
 
 	database := &Database{
 		cache: volatile,
@@ -118,6 +75,7 @@ func Start(dbHost, port string) {
 	stdAuth := []middleware.Middleware{
 		middleware.Cors(),
 		middleware.WithDB(datastore, volatile),
+		middleware.RequireAPIKey(datastore),
 		middleware.RequireAuth(datastore, volatile),
 	}
 
@@ -128,12 +86,28 @@ func Start(dbHost, port string) {
 
 	m := &membership{volatile: volatile}
 
-	http.Handle("/login", middleware.Chain(http.HandlerFunc(m.login), pubWithDB...))
-	http.Handle("/register", middleware.Chain(http.HandlerFunc(m.register), pubWithDB...))
-	http.Handle("/email", middleware.Chain(http.HandlerFunc(m.emailExists), pubWithDB...))
+	// auth endpoints are rate limited per IP and per email
+	authLimited := []middleware.Middleware{
+		middleware.Cors(),
+		middleware.WithDB(datastore, volatile),
+		middleware.RateLimit(volatile, middleware.IdentityFromRequest("email")),
+	}
+
+	// checking if an email exists is limited per IP to prevent enumeration
+	emailLimited := []middleware.Middleware{
+		middleware.Cors(),
+		middleware.WithDB(datastore, volatile),
+		middleware.RateLimit(volatile, nil),
+	}
+
+	http.Handle("/login", middleware.Chain(http.HandlerFunc(m.login), authLimited...))
+	http.Handle("/register", middleware.Chain(http.HandlerFunc(m.register), authLimited...))
+	http.Handle("/email", middleware.Chain(http.HandlerFunc(m.emailExists), emailLimited...))
 	http.Handle("/password/resetcode", middleware.Chain(http.HandlerFunc(m.setResetCode), stdRoot...))
-	http.Handle("/password/reset", middleware.Chain(http.HandlerFunc(m.resetPassword), pubWithDB...))
+	http.Handle("/password/reset", middleware.Chain(http.HandlerFunc(m.resetPassword), authLimited...))
 	//http.Handle("/setrole", chain(http.HandlerFunc(setRole), withDB))
+	http.Handle("/invitation", middleware.Chain(http.HandlerFunc(m.invitations), stdAuth...))
+	http.Handle("/invitation/accept", middleware.Chain(http.HandlerFunc(m.acceptInvitation), pubWithDB...))
 
 	http.Handle("/sudogettoken/", middleware.Chain(http.HandlerFunc(m.sudoGetTokenFromAccountID), stdRoot...))
 
@@ -144,6 +118,7 @@ func Start(dbHost, port string) {
 	http.Handle("/sudoquery/", middleware.Chain(http.HandlerFunc(database.query), stdRoot...))
 	http.Handle("/sudolistall/", middleware.Chain(http.HandlerFunc(database.listCollections), stdRoot...))
 	http.Handle("/sudo/index", middleware.Chain(http.HandlerFunc(database.index), stdRoot...))
+	http.Handle("/sudo/rules", middleware.Chain(http.HandlerFunc(database.rules), stdRoot...))
 	http.Handle("/sudo/", middleware.Chain(http.HandlerFunc(database.dbreq), stdRoot...))
 	http.Handle("/newid", middleware.Chain(http.HandlerFunc(database.newID), stdAuth...))
 
@@ -156,8 +131,15 @@ func Start(dbHost, port string) {
 	http.Handle("/sudostorage/delete", middleware.Chain(http.HandlerFunc(deleteFile), stdRoot...))
 
 	// sudo actions
+	http.Handle("/sudo/apikeys", middleware.Chain(http.HandlerFunc(apiKeys), stdRoot...))
+	http.Handle("/sudo/signingkeys", middleware.Chain(http.HandlerFunc(signingKeys), stdRoot...))
+	http.Handle("/sudo/settings", middleware.Chain(http.HandlerFunc(baseSettings), stdRoot...))
 	http.Handle("/sudo/sendmail", middleware.Chain(http.HandlerFunc(sudoSendMail), stdRoot...))
 	http.Handle("/sudo/cache", middleware.Chain(http.HandlerFunc(sudoCache), stdRoot...))
+	http.Handle("/sudo/webhooks", middleware.Chain(http.HandlerFunc(webhooks), stdRoot...))
+	http.Handle("/sudo/webhooks/deliveries", middleware.Chain(http.HandlerFunc(listWebhookDeliveries), stdRoot...))
+	http.Handle("/sudo/webhooks/replay", middleware.Chain(http.HandlerFunc(replayWebhookDelivery), stdRoot...))
+	http.Handle("/sudo/webhooks/rotate", middleware.Chain(http.HandlerFunc(rotateWebhookSecret), stdRoot...))
 
 	// account
 	acct := &accounts{membership: m}
@@ -170,24 +152,12 @@ func Start(dbHost, port string) {
 	http.HandleFunc("/stripe", swh.process)
 
 	http.HandleFunc("/ping", ping)
+	http.Handle("/.well-known/jwks.json", middleware.Chain(http.HandlerFunc(jwks), pubWithDB...))
 
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		serveWs(hub, w, r)
-	})
-
-	http.Handle("/sse/connect", middleware.Chain(http.HandlerFunc(b.Accept), pubWithDB...))
-	receiveMessage := func(w http.ResponseWriter, r *http.Request) {
-		var msg internal.Command
-		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		b.Broadcast <- msg
-
-		respond(w, http.StatusOK, true)
-	}
-	http.Handle("/sse/msg", middleware.Chain(http.HandlerFunc(receiveMessage), pubWithDB...))
+	http.Handle("/ws", middleware.Chain(http.HandlerFunc(rt.ServeWS), middleware.WithDB(datastore, volatile)))
+	http.Handle("/sse/connect", middleware.Chain(http.HandlerFunc(rt.ServeSSE), pubWithDB...))
+	http.Handle("/sse/msg", middleware.Chain(http.HandlerFunc(rt.Receive), pubWithDB...))
+	http.Handle("/sudo/realtime", middleware.Chain(realtimeStats(rt), stdRoot...))
 
 	// server-side functions
 	f := &functions{datastore: datastore}
@@ -197,6 +167,15 @@ func Start(dbHost, port string) {
 	http.Handle("/fn/del/", middleware.Chain(http.HandlerFunc(f.del), stdRoot...))
 	http.Handle("/fn/info/", middleware.Chain(http.HandlerFunc(f.info), stdRoot...))
 	http.Handle("/fn/exec/", middleware.Chain(http.HandlerFunc(f.exec), stdAuth...))
+	http.Handle("/fn/test", middleware.Chain(http.HandlerFunc(f.test), stdRoot...))
+	http.Handle("/fn/versions/", middleware.Chain(http.HandlerFunc(f.versions), stdRoot...))
+	http.Handle("/fn/diff/", middleware.Chain(http.HandlerFunc(f.diff), stdRoot...))
+	http.Handle("/fn/rollback", middleware.Chain(http.HandlerFunc(f.rollback), stdRoot...))
+	http.Handle("/fn/pin", middleware.Chain(http.HandlerFunc(f.pin), stdRoot...))
+	http.Handle("/fn/runs/", middleware.Chain(http.HandlerFunc(f.runs), stdRoot...))
+	http.Handle("/fn/tail/", middleware.Chain(http.HandlerFunc(f.tail), stdRoot...))
+	http.Handle("/fn/deadletters", middleware.Chain(http.HandlerFunc(f.deadLetters), stdRoot...))
+	http.Handle("/fn/deadletters/replay", middleware.Chain(http.HandlerFunc(f.replayDeadLetter), stdRoot...))
 	http.Handle("/fn", middleware.Chain(http.HandlerFunc(f.list), stdRoot...))
 
 	// extras routes
@@ -213,10 +192,25 @@ func Start(dbHost, port string) {
 	http.Handle("/ui/fn/new", middleware.Chain(http.HandlerFunc(webUI.fnNew), stdRoot...))
 	http.Handle("/ui/fn/save", middleware.Chain(http.HandlerFunc(webUI.fnSave), stdRoot...))
 	http.Handle("/ui/fn/del/", middleware.Chain(http.HandlerFunc(webUI.fnDel), stdRoot...))
+	http.Handle("/ui/fn/version/", middleware.Chain(http.HandlerFunc(webUI.fnVersion), stdRoot...))
+	http.Handle("/ui/fn/rollback/", middleware.Chain(http.HandlerFunc(webUI.fnRollback), stdRoot...))
+	http.Handle("/ui/fn/pin/", middleware.Chain(http.HandlerFunc(webUI.fnPin), stdRoot...))
+	http.Handle("/ui/fn/test", middleware.Chain(http.HandlerFunc(webUI.fnTest), stdRoot...))
+	http.Handle("/ui/fn/tail/", middleware.Chain(http.HandlerFunc(webUI.fnTail), stdRoot...))
+	http.Handle("/ui/fn/replay/", middleware.Chain(http.HandlerFunc(webUI.fnReplay), stdRoot...))
+	http.Handle("/ui/fn/discard/", middleware.Chain(http.HandlerFunc(webUI.fnDiscard), stdRoot...))
 	http.Handle("/ui/fn/", middleware.Chain(http.HandlerFunc(webUI.fnEdit), stdRoot...))
 	http.Handle("/ui/fn", middleware.Chain(http.HandlerFunc(webUI.fnList), stdRoot...))
 	http.Handle("/ui/forms", middleware.Chain(http.HandlerFunc(webUI.forms), stdRoot...))
 	http.Handle("/ui/forms/del/", middleware.Chain(http.HandlerFunc(webUI.formDel), stdRoot...))
+	http.Handle("/ui/keys", middleware.Chain(http.HandlerFunc(webUI.keys), stdRoot...))
+	http.Handle("/ui/keys/new", middleware.Chain(http.HandlerFunc(webUI.keyNew), stdRoot...))
+	http.Handle("/ui/keys/del/", middleware.Chain(http.HandlerFunc(webUI.keyDel), stdRoot...))
+	http.Handle("/ui/webhooks", middleware.Chain(http.HandlerFunc(webUI.webhooks), stdRoot...))
+	http.Handle("/ui/webhooks/new", middleware.Chain(http.HandlerFunc(webUI.webhookNew), stdRoot...))
+	http.Handle("/ui/webhooks/del/", middleware.Chain(http.HandlerFunc(webUI.webhookDel), stdRoot...))
+	http.Handle("/ui/webhooks/replay/", middleware.Chain(http.HandlerFunc(webUI.webhookReplay), stdRoot...))
+	http.Handle("/ui/webhooks/rotate/", middleware.Chain(http.HandlerFunc(webUI.webhookRotate), stdRoot...))
 	http.HandleFunc("/", webUI.login)
 
 	// graceful shutdown
@@ -258,16 +252,21 @@ func initServices(dbHost string) {
 		if err != nil {
 			log.Fatal(err)
 		}
-		datastore = mongo.New(cl, volatile.PublishDocument)
+		datastore = mongo.New(cl, volatile.PublishDocument, volatile.Rule)
 	} else {
 		cl, err := openPGDatabase(dbHost)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		datastore = postgresql.New(cl, volatile.PublishDocument, "./sql/")
+		datastore = postgresql.New(cl, volatile.PublishDocument, volatile.Rule, "./sql/")
 	}
 
+	volatile.FindRule = datastore.GetRule
+
+	internal.Keys = internal.NewKeyring(datastore)
+	internal.Keys.Locker = volatile
+
 	mp := os.Getenv("MAIL_PROVIDER")
 	if strings.EqualFold(mp, internal.MailProviderSES) {
 		emailer = email.AWSSES{}
@@ -282,23 +281,13 @@ func initServices(dbHost string) {
 		storer = storage.Local{}
 	}
 
-	sub := &function.Subscriber{}
-	sub.PubSub = volatile
-	sub.GetExecEnv = func(token string) (function.ExecutionEnvironment, error) {
+	functionsSubscriber = &function.Subscriber{}
+	functionsSubscriber.PubSub = volatile
+	functionsSubscriber.GetExecEnv = func(token string) (function.ExecutionEnvironment, error) {
 		var exe function.ExecutionEnvironment
 
-		var conf internal.BaseConfig
-		// for public websocket (experimental)
-		if strings.HasPrefix(token, "__tmp__experimental_public") {
-			pk := strings.Replace(token, "__tmp__experimental_public_", "", -1)
-			pairs := strings.Split(pk, "_")
-			fmt.Println("checking for base in cache: ", pairs[0])
-			if err := volatile.GetTyped(pairs[0], &conf); err != nil {
-				log.Println("cannot find base for public websocket")
-				return exe, err
-			}
-		} else if err := volatile.GetTyped("base:"+token, &conf); err != nil {
-			log.Println("cannot find base")
+		conf, err := baseFromToken(token)
+		if err != nil {
 			return exe, err
 		}
 
@@ -308,21 +297,67 @@ func initServices(dbHost string) {
 			return exe, err
 		}
 
+		exe = functionEnv(conf)
 		exe.Auth = auth
-		exe.BaseName = conf.Name
-		exe.DataStore = datastore
-		exe.Volatile = volatile
-
 		return exe, nil
 	}
+	functionsSubscriber.Store = datastore
+	functionsSubscriber.GetBaseEnv = functionEnv
+	functionsSubscriber.Locker = volatile
+
+	// the function logs are tailed from any server
+	function.ShareTails(volatile)
 
 	// start system events subscriber
-	go sub.Start()
+	go functionsSubscriber.Start()
+	go functionsSubscriber.ScheduleRetries(10*time.Second, nil)
+
+	// outgoing webhooks receive the system events too
+	hooks = &webhook.Dispatcher{
+		PubSub: volatile,
+		Store:  datastore,
+		GetBase: func(token string) (string, error) {
+			conf, err := baseFromToken(token)
+			return conf.Name, err
+		},
+		Locker: volatile,
+	}
+	go hooks.Start()
+	go hooks.ScheduleRetries(10*time.Second, nil)
+
+	// rotate the JWT signing keys of all bases
+	maxAge, grace := keyRotationSettings()
+	go internal.Keys.ScheduleRotation(1*time.Hour, maxAge, grace, nil)
+
+	// delete the function runs past their base's retention
+	go scheduleFunctionRunsRetention(1*time.Hour, nil)
+}
+
+// baseFromToken returns the base of a cached user token
+func baseFromToken(token string) (conf internal.BaseConfig, err error) {
+	// for public websocket (experimental)
+	if strings.HasPrefix(token, "__tmp__experimental_public") {
+		pk := strings.Replace(token, "__tmp__experimental_public_", "", -1)
+		pairs := strings.Split(pk, "_")
+		fmt.Println("checking for base in cache: ", pairs[0])
+		if err = volatile.GetTyped(pairs[0], &conf); err != nil {
+			log.Println("cannot find base for public websocket")
+		}
+		return
+	}
+
+	if err = volatile.GetTyped("base:"+token, &conf); err != nil {
+		log.Println("cannot find base")
+	}
+	return
 }
+
 func openMongoDatabase(dbHost string) (*mongodrv.Client, error) {
 	uri := dbHost
 
-	ctx, _ := context.WithTimeout(context.Background(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
 	cl, err := mongodrv.Connect(ctx, options.Client().ApplyURI(uri))
 	if err != nil {
 		return nil, fmt.Errorf("cannot connect to mongo: %v", err)
@@ -0,0 +1,115 @@
+package staticbackend
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+)
+
+const (
+	// the grace period must outlive the JWT expiration (12 hours)
+	defaultKeyGracePeriod = 24 * time.Hour
+	defaultKeyMaxAge      = 30 * 24 * time.Hour
+)
+
+// keyRotationSettings returns the max age of an active signing key and the
+// grace period of the rotated keys from JWT_ROTATE_DAYS and JWT_GRACE_HOURS.
+func keyRotationSettings() (maxAge time.Duration, grace time.Duration) {
+	maxAge, grace = defaultKeyMaxAge, defaultKeyGracePeriod
+
+	if days, err := strconv.Atoi(os.Getenv("JWT_ROTATE_DAYS")); err == nil && days > 0 {
+		maxAge = time.Duration(days) * 24 * time.Hour
+	}
+
+	if hours, err := strconv.Atoi(os.Getenv("JWT_GRACE_HOURS")); err == nil && hours > 0 {
+		grace = time.Duration(hours) * time.Hour
+	}
+	return
+}
+
+func signingKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		rotateSigningKey(w, r)
+	} else if r.Method == http.MethodGet {
+		listSigningKeys(w, r)
+	} else {
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func listSigningKeys(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	keys, err := datastore.ListSigningKeys(conf.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if keys == nil {
+		keys = make([]internal.SigningKey, 0)
+	}
+
+	respond(w, http.StatusOK, keys)
+}
+
+func rotateSigningKey(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var data = new(struct {
+		Algorithm  string `json:"alg"`
+		GraceHours int    `json:"graceHours"`
+	})
+	if err := parseBody(r.Body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(data.Algorithm) == 0 {
+		data.Algorithm = internal.Keys.Algorithm
+	}
+
+	_, grace := keyRotationSettings()
+	if data.GraceHours > 0 {
+		grace = time.Duration(data.GraceHours) * time.Hour
+	}
+
+	key, err := internal.Keys.Rotate(conf.Name, data.Algorithm, grace)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respond(w, http.StatusOK, key)
+}
+
+// jwks serves the public signing keys of the base so third-party services
+// can verify the tokens.
+func jwks(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	set, err := internal.Keys.JWKS(conf.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respond(w, http.StatusOK, set)
+}
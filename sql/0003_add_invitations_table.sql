@@ -0,0 +1,21 @@
+-- add the account invitations table to all existing bases
+DO $$
+DECLARE
+	base RECORD;
+BEGIN
+	FOR base IN SELECT name FROM sb.apps LOOP
+		EXECUTE format('
+			CREATE TABLE IF NOT EXISTS %1$I.sb_invitations (
+				id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+				account_id uuid REFERENCES %1$I.sb_accounts(id) ON DELETE CASCADE,
+				email TEXT NOT NULL,
+				role INTEGER NOT NULL,
+				code TEXT UNIQUE NOT NULL,
+				invited_by uuid REFERENCES %1$I.sb_tokens(id) ON DELETE CASCADE,
+				created timestamp NOT NULL,
+				expires timestamp NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS sb_invitations_acctid_idx ON %1$I.sb_invitations (account_id);
+		', base.name);
+	END LOOP;
+END $$;
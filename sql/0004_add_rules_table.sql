@@ -0,0 +1,18 @@
+-- add the collection permission rules table to all existing bases
+DO $$
+DECLARE
+	base RECORD;
+BEGIN
+	FOR base IN SELECT name FROM sb.apps LOOP
+		EXECUTE format('
+			CREATE TABLE IF NOT EXISTS %1$I.sb_rules (
+				id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+				collection TEXT UNIQUE NOT NULL,
+				read TEXT NOT NULL,
+				write TEXT NOT NULL,
+				del TEXT NOT NULL,
+				updated timestamp NOT NULL
+			);
+		', base.name);
+	END LOOP;
+END $$;
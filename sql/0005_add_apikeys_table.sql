@@ -0,0 +1,21 @@
+-- add the scoped API keys table to all existing bases
+DO $$
+DECLARE
+	base RECORD;
+BEGIN
+	FOR base IN SELECT name FROM sb.apps LOOP
+		EXECUTE format('
+			CREATE TABLE IF NOT EXISTS %1$I.sb_apikeys (
+				id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+				account_id uuid REFERENCES %1$I.sb_accounts(id) ON DELETE CASCADE,
+				token_id uuid REFERENCES %1$I.sb_tokens(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				hash TEXT NOT NULL,
+				scopes TEXT[] NOT NULL,
+				expires timestamp NOT NULL,
+				last_used timestamp NOT NULL,
+				created timestamp NOT NULL
+			);
+		', base.name);
+	END LOOP;
+END $$;
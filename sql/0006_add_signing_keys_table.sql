@@ -0,0 +1,18 @@
+-- add the JWT signing keys table to all existing bases
+DO $$
+DECLARE
+	base RECORD;
+BEGIN
+	FOR base IN SELECT name FROM sb.apps LOOP
+		EXECUTE format('
+			CREATE TABLE IF NOT EXISTS %1$I.sb_signing_keys (
+				id TEXT PRIMARY KEY,
+				alg TEXT NOT NULL,
+				private BYTEA NOT NULL,
+				public BYTEA,
+				created timestamp NOT NULL,
+				expires timestamp NOT NULL
+			);
+		', base.name);
+	END LOOP;
+END $$;
@@ -0,0 +1,2 @@
+-- per-base settings, i.e. rate limits
+ALTER TABLE sb.apps ADD COLUMN IF NOT EXISTS settings jsonb NOT NULL DEFAULT '{}';
@@ -0,0 +1,34 @@
+-- add the outgoing webhooks tables to all existing bases
+DO $$
+DECLARE
+	base RECORD;
+BEGIN
+	FOR base IN SELECT name FROM sb.apps LOOP
+		EXECUTE format('
+			CREATE TABLE IF NOT EXISTS %1$I.sb_webhooks (
+				id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+				name TEXT NOT NULL,
+				url TEXT NOT NULL,
+				events TEXT[] NOT NULL,
+				secret TEXT NOT NULL,
+				active BOOLEAN NOT NULL,
+				created timestamp NOT NULL
+			);
+
+			CREATE TABLE IF NOT EXISTS %1$I.sb_webhook_deliveries (
+				id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+				webhook_id uuid REFERENCES %1$I.sb_webhooks(id) ON DELETE CASCADE,
+				event TEXT NOT NULL,
+				channel TEXT NOT NULL,
+				payload TEXT NOT NULL,
+				state TEXT NOT NULL,
+				attempts INTEGER NOT NULL,
+				status INTEGER NOT NULL,
+				error TEXT NOT NULL,
+				created timestamp NOT NULL,
+				updated timestamp NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS sb_webhook_deliveries_webhook_idx ON %1$I.sb_webhook_deliveries (webhook_id, state);
+		', base.name);
+	END LOOP;
+END $$;
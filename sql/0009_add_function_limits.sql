@@ -0,0 +1,12 @@
+-- per-function resource limits and the reason of failed runs
+DO $$
+DECLARE
+	base RECORD;
+BEGIN
+	FOR base IN SELECT name FROM sb.apps LOOP
+		EXECUTE format('
+			ALTER TABLE %1$I.sb_functions ADD COLUMN IF NOT EXISTS limits jsonb NOT NULL DEFAULT ''{}'';
+			ALTER TABLE %1$I.sb_function_logs ADD COLUMN IF NOT EXISTS reason TEXT NOT NULL DEFAULT '''';
+		', base.name);
+	END LOOP;
+END $$;
@@ -0,0 +1,25 @@
+-- immutable function versions, the current code becomes the first one
+DO $$
+DECLARE
+	base RECORD;
+BEGIN
+	FOR base IN SELECT name FROM sb.apps LOOP
+		EXECUTE format('
+			ALTER TABLE %1$I.sb_functions ADD COLUMN IF NOT EXISTS pinned_version INTEGER NOT NULL DEFAULT 0;
+
+			CREATE TABLE IF NOT EXISTS %1$I.sb_function_versions (
+				id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+				function_id uuid REFERENCES %1$I.sb_functions(id) ON DELETE CASCADE,
+				version INTEGER NOT NULL,
+				code TEXT NOT NULL,
+				trigger_topic TEXT NOT NULL,
+				created timestamp NOT NULL,
+				UNIQUE (function_id, version)
+			);
+
+			INSERT INTO %1$I.sb_function_versions(function_id, version, code, trigger_topic, created)
+			SELECT id, version, code, trigger_topic, last_updated FROM %1$I.sb_functions
+			ON CONFLICT DO NOTHING;
+		', base.name);
+	END LOOP;
+END $$;
@@ -0,0 +1,11 @@
+-- functions are either functions or modules shared with require()
+DO $$
+DECLARE
+	base RECORD;
+BEGIN
+	FOR base IN SELECT name FROM sb.apps LOOP
+		EXECUTE format('
+			ALTER TABLE %1$I.sb_functions ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT ''function'';
+		', base.name);
+	END LOOP;
+END $$;
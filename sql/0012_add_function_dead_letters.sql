@@ -0,0 +1,22 @@
+-- retry policies of the functions and the events failing all their attempts
+DO $$
+DECLARE
+	base RECORD;
+BEGIN
+	FOR base IN SELECT name FROM sb.apps LOOP
+		EXECUTE format('
+			ALTER TABLE %1$I.sb_functions ADD COLUMN IF NOT EXISTS retry jsonb NOT NULL DEFAULT ''{}'';
+
+			CREATE TABLE IF NOT EXISTS %1$I.sb_function_dead_letters (
+				id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+				function_id uuid REFERENCES %1$I.sb_functions(id) ON DELETE CASCADE,
+				function_name TEXT NOT NULL,
+				command jsonb NOT NULL,
+				auth jsonb NOT NULL,
+				attempts INTEGER NOT NULL,
+				error TEXT NOT NULL,
+				created timestamp NOT NULL
+			);
+		', base.name);
+	END LOOP;
+END $$;
@@ -0,0 +1,13 @@
+-- the leveled logs of the function runs and the index filtering them
+DO $$
+DECLARE
+	base RECORD;
+BEGIN
+	FOR base IN SELECT name FROM sb.apps LOOP
+		EXECUTE format('
+			ALTER TABLE %1$I.sb_function_logs ADD COLUMN IF NOT EXISTS logs jsonb NOT NULL DEFAULT ''[]'';
+
+			CREATE INDEX IF NOT EXISTS sb_function_logs_fnid_started_idx ON %1$I.sb_function_logs (function_id, started);
+		', base.name);
+	END LOOP;
+END $$;
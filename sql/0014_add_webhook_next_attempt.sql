@@ -0,0 +1,13 @@
+-- the pending webhook deliveries are attempted again from their next_attempt
+DO $$
+DECLARE
+	base RECORD;
+BEGIN
+	FOR base IN SELECT name FROM sb.apps LOOP
+		EXECUTE format('
+			ALTER TABLE %1$I.sb_webhook_deliveries ADD COLUMN IF NOT EXISTS next_attempt timestamp NOT NULL DEFAULT now();
+
+			CREATE INDEX IF NOT EXISTS sb_webhook_deliveries_due_idx ON %1$I.sb_webhook_deliveries (state, next_attempt);
+		', base.name);
+	END LOOP;
+END $$;
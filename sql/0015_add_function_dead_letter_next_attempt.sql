@@ -0,0 +1,14 @@
+-- the events are saved as pending dead letters while their attempts remain
+DO $$
+DECLARE
+	base RECORD;
+BEGIN
+	FOR base IN SELECT name FROM sb.apps LOOP
+		EXECUTE format('
+			ALTER TABLE %1$I.sb_function_dead_letters ADD COLUMN IF NOT EXISTS pending BOOLEAN NOT NULL DEFAULT false;
+			ALTER TABLE %1$I.sb_function_dead_letters ADD COLUMN IF NOT EXISTS next_attempt timestamp NOT NULL DEFAULT now();
+
+			CREATE INDEX IF NOT EXISTS sb_function_dead_letters_due_idx ON %1$I.sb_function_dead_letters (pending, next_attempt);
+		', base.name);
+	END LOOP;
+END $$;
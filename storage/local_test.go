@@ -2,7 +2,6 @@ package storage
 
 import (
 	"bytes"
-	"fmt"
 	"strings"
 	"testing"
 
@@ -19,6 +18,6 @@ func TestLocalSave(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	} else if !strings.Contains(url, "/unit/test/file.txt") {
-		fmt.Errorf("expected ~/tmp/unit/test/file.txt got %s", url)
+		t.Errorf("expected ~/tmp/unit/test/file.txt got %s", url)
 	}
 }
@@ -3,6 +3,7 @@ package staticbackend
 import (
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"net/http"
 	"strconv"
 	"strings"
@@ -362,9 +363,23 @@ func (x ui) fnList(w http.ResponseWriter, r *http.Request) {
 	render(w, r, "fn_list.html", results, nil)
 }
 
+// fnEditData is a function with its versions, dead letters and a filtered
+// page of its runs
+type fnEditData struct {
+	internal.ExecData
+	Versions    []internal.FunctionVersion
+	DeadLetters []internal.FunctionDeadLetter
+	Runs        internal.FunctionRuns
+	Filter      internal.RunFilter
+	// Query is the run filter's query string, without the page
+	Query template.URL
+	// PrevPage and NextPage are 0 when there's no such page
+	PrevPage int64
+	NextPage int64
+}
+
 func (x *ui) fnNew(w http.ResponseWriter, r *http.Request) {
-	fn := internal.ExecData{}
-	render(w, r, "fn_edit.html", fn, nil)
+	render(w, r, "fn_edit.html", fnEditData{}, nil)
 }
 
 func (x *ui) fnEdit(w http.ResponseWriter, r *http.Request) {
@@ -382,7 +397,162 @@ func (x *ui) fnEdit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	render(w, r, "fn_edit.html", fn, nil)
+	versions, err := datastore.ListFunctionVersions(conf.Name, id)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	deadLetters, err := datastore.ListFunctionDeadLetters(conf.Name, id)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	q := r.URL.Query()
+	filter, err := parseRunFilter(q)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	runs, err := datastore.ListFunctionRuns(conf.Name, id, filter)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	data := fnEditData{
+		ExecData:    fn,
+		Versions:    versions,
+		DeadLetters: deadLetters,
+		Runs:        runs,
+		Filter:      filter,
+	}
+
+	if filter.Page > 1 {
+		data.PrevPage = filter.Page - 1
+	}
+	if filter.Page*filter.Size < runs.Total {
+		data.NextPage = filter.Page + 1
+	}
+
+	q.Del("page")
+	data.Query = template.URL(q.Encode())
+
+	render(w, r, "fn_edit.html", data, nil)
+}
+
+// fnTest dry runs the code of the function's editor with the test payload
+func (x *ui) fnTest(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var data functionTest
+	if err := parseBody(r.Body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := testFunction(conf, auth, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respond(w, http.StatusOK, res)
+}
+
+// fnTail streams the function's logs to the web UI's live tail
+func (x *ui) fnTail(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	tailFunction(w, r, conf.Name, getURLPart(r.URL.Path, 4))
+}
+
+// fnVersion shows a version's code and its changes up to the current version
+func (x *ui) fnVersion(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	id := getURLPart(r.URL.Path, 4)
+	version, _ := strconv.Atoi(getURLPart(r.URL.Path, 5))
+
+	fn, err := datastore.GetFunctionByID(conf.Name, id)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	v, err := datastore.GetFunctionVersion(conf.Name, id, version)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	diff, err := functionDiff(conf.Name, id, version, 0)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	data := new(struct {
+		Function internal.ExecData
+		Version  internal.FunctionVersion
+		Diff     []internal.DiffLine
+	})
+	data.Function = fn
+	data.Version = v
+	data.Diff = diff
+
+	render(w, r, "fn_version.html", data, nil)
+}
+
+func (x *ui) fnRollback(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	id := getURLPart(r.URL.Path, 4)
+	version, _ := strconv.Atoi(getURLPart(r.URL.Path, 5))
+
+	if err := rollbackFunction(conf.Name, id, version); err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/ui/fn/"+id, http.StatusSeeOther)
+}
+
+// fnPin pins the function to a version, version 0 unpins it
+func (x *ui) fnPin(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	id := getURLPart(r.URL.Path, 4)
+	version, _ := strconv.Atoi(getURLPart(r.URL.Path, 5))
+
+	if err := pinFunction(conf.Name, id, version); err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/ui/fn/"+id, http.StatusSeeOther)
 }
 
 func (x *ui) fnSave(w http.ResponseWriter, r *http.Request) {
@@ -399,11 +569,30 @@ func (x *ui) fnSave(w http.ResponseWriter, r *http.Request) {
 	trigger := r.Form.Get("trigger")
 	code := r.Form.Get("code")
 
+	// empty limits use the base's limits
+	var limits internal.FunctionLimits
+	limits.Timeout, _ = strconv.Atoi(r.Form.Get("timeout"))
+	limits.MaxCallStack, _ = strconv.Atoi(r.Form.Get("maxCallStack"))
+	limits.MaxMemory, _ = strconv.ParseInt(r.Form.Get("maxMemory"), 10, 64)
+
+	var retry internal.RetryPolicy
+	retry.MaxAttempts, _ = strconv.Atoi(r.Form.Get("maxAttempts"))
+	retry.Backoff, _ = strconv.Atoi(r.Form.Get("backoff"))
+
+	// modules are only loaded by require()
+	kind := r.Form.Get("kind")
+	if kind == internal.FunctionKindModule {
+		trigger = ""
+	}
+
 	if id == "new" {
 		fn := internal.ExecData{
 			FunctionName: name,
 			Code:         code,
 			TriggerTopic: trigger,
+			Limits:       limits,
+			Retry:        retry,
+			Kind:         kind,
 		}
 		newID, err := datastore.AddFunction(conf.Name, fn)
 		if err != nil {
@@ -420,6 +609,49 @@ func (x *ui) fnSave(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := datastore.UpdateFunctionLimits(conf.Name, id, limits); err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	if err := datastore.UpdateFunctionRetry(conf.Name, id, retry); err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/ui/fn/"+id, http.StatusSeeOther)
+}
+
+// fnReplay runs a dead letter's event again
+func (x *ui) fnReplay(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	id := getURLPart(r.URL.Path, 4)
+	if err := replayDeadLetter(conf, getURLPart(r.URL.Path, 5)); err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/ui/fn/"+id, http.StatusSeeOther)
+}
+
+func (x *ui) fnDiscard(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	id := getURLPart(r.URL.Path, 4)
+	if err := datastore.DeleteFunctionDeadLetter(conf.Name, getURLPart(r.URL.Path, 5)); err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
 	http.Redirect(w, r, "/ui/fn/"+id, http.StatusSeeOther)
 }
 
@@ -437,3 +669,178 @@ func (x *ui) fnDel(w http.ResponseWriter, r *http.Request) {
 
 	http.Redirect(w, r, "/ui/fn", http.StatusSeeOther)
 }
+
+func (x ui) keys(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	x.renderKeys(w, r, conf.Name, nil)
+}
+
+func (x ui) renderKeys(w http.ResponseWriter, r *http.Request, dbName string, flash *Flash) {
+	keys, err := datastore.ListAPIKeys(dbName)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	render(w, r, "keys.html", keys, flash)
+}
+
+func (x ui) keyNew(w http.ResponseWriter, r *http.Request) {
+	conf, auth, err := middleware.Extract(r, true)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	r.ParseForm()
+
+	name := r.Form.Get("name")
+
+	var scopes []string
+	for _, s := range strings.Split(r.Form.Get("scopes"), ",") {
+		if s = strings.TrimSpace(s); len(s) > 0 {
+			scopes = append(scopes, s)
+		}
+	}
+
+	var expires time.Time
+	if days, err := strconv.Atoi(r.Form.Get("days")); err == nil && days > 0 {
+		expires = time.Now().Add(time.Duration(days) * 24 * time.Hour)
+	}
+
+	_, token, err := newAPIKey(conf.Name, auth, name, scopes, expires)
+	if err != nil {
+		x.renderKeys(w, r, conf.Name, &Flash{Type: "danger", Message: err.Error()})
+		return
+	}
+
+	msg := fmt.Sprintf("Copy your API key now, it will not be shown again: %s", token)
+	x.renderKeys(w, r, conf.Name, &Flash{Type: "success", Message: msg})
+}
+
+func (x ui) keyDel(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	id := getURLPart(r.URL.Path, 4)
+	if err := datastore.DeleteAPIKey(conf.Name, id); err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/ui/keys", http.StatusSeeOther)
+}
+
+func (x ui) webhooks(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	x.renderWebhooks(w, r, conf.Name, nil)
+}
+
+func (x ui) renderWebhooks(w http.ResponseWriter, r *http.Request, dbName string, flash *Flash) {
+	list, err := datastore.ListWebhooks(dbName)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	deliveries, err := datastore.ListWebhookDeliveries(dbName, "", "")
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	data := struct {
+		Webhooks   []internal.Webhook
+		Deliveries []internal.WebhookDelivery
+	}{list, deliveries}
+
+	render(w, r, "webhooks.html", data, flash)
+}
+
+func (x ui) webhookNew(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	r.ParseForm()
+
+	var events []string
+	for _, e := range strings.Split(r.Form.Get("events"), ",") {
+		if e = strings.TrimSpace(e); len(e) > 0 {
+			events = append(events, e)
+		}
+	}
+
+	wh, err := newWebhook(conf.Name, r.Form.Get("name"), r.Form.Get("url"), events, r.Form.Get("secret"))
+	if err != nil {
+		x.renderWebhooks(w, r, conf.Name, &Flash{Type: "danger", Message: err.Error()})
+		return
+	}
+
+	msg := fmt.Sprintf("Verify the X-SB-Signature header with this secret: %s", wh.Secret)
+	x.renderWebhooks(w, r, conf.Name, &Flash{Type: "success", Message: msg})
+}
+
+func (x ui) webhookDel(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	id := getURLPart(r.URL.Path, 4)
+	if err := removeWebhook(conf.Name, id); err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/ui/webhooks", http.StatusSeeOther)
+}
+
+func (x ui) webhookRotate(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	wh, err := rotateSecret(conf.Name, getURLPart(r.URL.Path, 4))
+	if err != nil {
+		x.renderWebhooks(w, r, conf.Name, &Flash{Type: "danger", Message: err.Error()})
+		return
+	}
+
+	msg := fmt.Sprintf("The new secret of %s is: %s", wh.Name, wh.Secret)
+	x.renderWebhooks(w, r, conf.Name, &Flash{Type: "success", Message: msg})
+}
+
+func (x ui) webhookReplay(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		renderErr(w, r, err)
+		return
+	}
+
+	id := getURLPart(r.URL.Path, 4)
+	if err := replayDelivery(conf.Name, id); err != nil {
+		x.renderWebhooks(w, r, conf.Name, &Flash{Type: "danger", Message: err.Error()})
+		return
+	}
+
+	http.Redirect(w, r, "/ui/webhooks", http.StatusSeeOther)
+}
@@ -0,0 +1,367 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// Store persists the webhooks and their deliveries, internal.Persister
+// implements it.
+type Store interface {
+	ListDatabases() ([]internal.BaseConfig, error)
+	ListWebhooks(dbName string) ([]internal.Webhook, error)
+	AddWebhookDelivery(dbName string, d internal.WebhookDelivery) (string, error)
+	UpdateWebhookDelivery(dbName string, d internal.WebhookDelivery) error
+	GetWebhookDelivery(dbName, id string) (internal.WebhookDelivery, error)
+	ListDueWebhookDeliveries(dbName string, now time.Time) ([]internal.WebhookDelivery, error)
+}
+
+// how long an attempt owns its delivery, it's attempted again after that
+// if the server stopped during the call
+const attemptTimeout = time.Minute
+
+// how long a server owns an event's deliveries, the other servers receive
+// it within seconds
+const eventLockTTL = 10 * time.Minute
+
+// Dispatcher POSTs the system events to the webhooks of their base
+type Dispatcher struct {
+	PubSub internal.PubSuber
+	Store  Store
+	// GetBase returns the base name of the token publishing an event, for
+	// the events published without their base
+	GetBase func(token string) (string, error)
+	// Locker makes sure a single server dispatches an event and attempts a
+	// pending delivery, it's optional with a single server
+	Locker internal.Locker
+
+	// Client defaults to a client refusing to call private addresses
+	Client *http.Client
+	// Backoff returns the wait after a failed attempt, defaults to
+	// internal.WebhookBackoff
+	Backoff func(attempts int) time.Duration
+}
+
+// Payload is the JSON body of the webhook calls
+type Payload struct {
+	Event     string          `json:"event"`
+	Channel   string          `json:"channel"`
+	Data      json.RawMessage `json:"data"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// CacheKey returns the key caching a base's webhooks, it must be deleted
+// when they change.
+func CacheKey(dbName string) string {
+	return fmt.Sprintf("%s:webhooks", dbName)
+}
+
+// Start subscribes to the system events and dispatches them
+func (d *Dispatcher) Start() {
+	receiver := make(chan internal.Command)
+	close := make(chan bool)
+
+	go d.PubSub.Subscribe(receiver, "", "sbsys", close)
+
+	for {
+		select {
+		case msg := <-receiver:
+			go d.process(msg)
+		case <-close:
+			log.Println("system event channel closed?!?")
+		}
+	}
+}
+
+func (d *Dispatcher) process(msg internal.Command) {
+	base := msg.Base
+	if len(base) == 0 {
+		// events without base nor publisher can't be linked to a base
+		if len(msg.Token) == 0 || d.GetBase == nil {
+			return
+		}
+
+		var err error
+		if base, err = d.GetBase(msg.Token); err != nil {
+			log.Println("cannot find the base of a webhook event: ", err)
+			return
+		}
+	}
+
+	if err := d.Dispatch(base, msg); err != nil {
+		log.Println("error dispatching webhook event: ", err)
+	}
+}
+
+// Dispatch saves a delivery for each active webhook matching the event and
+// makes their first attempt in the background. Every server receives the
+// system events, the first one claiming an event's webhook delivers it.
+func (d *Dispatcher) Dispatch(base string, msg internal.Command) error {
+	hooks, err := d.webhooks(base)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	for _, wh := range hooks {
+		if !wh.Active || !wh.Matches(msg) {
+			continue
+		} else if ok, err := d.claim(wh, msg); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+
+		if payload == nil {
+			if payload, err = newPayload(msg); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		// the first attempt owns the delivery until it's done
+		dl := internal.WebhookDelivery{
+			WebhookID:   wh.ID,
+			Event:       msg.Type,
+			Channel:     msg.Channel,
+			Payload:     string(payload),
+			State:       internal.WebhookPending,
+			NextAttempt: now.Add(attemptTimeout),
+			Created:     now,
+			Updated:     now,
+		}
+
+		dl.ID, err = d.Store.AddWebhookDelivery(base, dl)
+		if err != nil {
+			return err
+		}
+
+		go d.Deliver(base, wh, dl)
+	}
+	return nil
+}
+
+// claim returns false if another server dispatches the event to the
+// webhook. The lock is kept, the event is received once per server.
+func (d *Dispatcher) claim(wh internal.Webhook, msg internal.Command) (bool, error) {
+	if d.Locker == nil || len(msg.EventID) == 0 {
+		return true, nil
+	}
+
+	key := fmt.Sprintf("webhook_event_%s_%s", wh.ID, msg.EventID)
+	return d.Locker.TryLock(key, eventLockTTL)
+}
+
+func (d *Dispatcher) webhooks(base string) ([]internal.Webhook, error) {
+	var hooks []internal.Webhook
+	if err := d.PubSub.GetTyped(CacheKey(base), &hooks); err == nil {
+		return hooks, nil
+	}
+
+	hooks, err := d.Store.ListWebhooks(base)
+	if err != nil {
+		return nil, err
+	}
+
+	if hooks == nil {
+		hooks = make([]internal.Webhook, 0)
+	}
+
+	if err := d.PubSub.SetTyped(CacheKey(base), hooks); err != nil {
+		log.Println("error caching webhooks: ", err)
+	}
+	return hooks, nil
+}
+
+func newPayload(msg internal.Command) ([]byte, error) {
+	data := json.RawMessage(msg.Data)
+	if !json.Valid(data) {
+		b, err := json.Marshal(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	}
+
+	return json.Marshal(Payload{
+		Event:     msg.Type,
+		Channel:   msg.Channel,
+		Data:      data,
+		Timestamp: time.Now(),
+	})
+}
+
+// Deliver makes an attempt at the delivery and updates it. A failed attempt
+// is scheduled at the delivery's NextAttempt, see ScheduleRetries, until it
+// is dead after internal.WebhookMaxAttempts attempts.
+func (d *Dispatcher) Deliver(base string, wh internal.Webhook, dl internal.WebhookDelivery) {
+	backoff := d.Backoff
+	if backoff == nil {
+		backoff = internal.WebhookBackoff
+	}
+
+	dl.Attempts++
+	dl.Status, dl.Error = d.post(wh, dl)
+	dl.Updated = time.Now()
+
+	if len(dl.Error) == 0 {
+		dl.State = internal.WebhookDelivered
+	} else if dl.Attempts >= internal.WebhookMaxAttempts {
+		dl.State = internal.WebhookDead
+	} else {
+		dl.NextAttempt = dl.Updated.Add(backoff(dl.Attempts))
+	}
+
+	if err := d.Store.UpdateWebhookDelivery(base, dl); err != nil {
+		log.Println("error updating webhook delivery: ", err)
+	}
+}
+
+// ScheduleRetries attempts the due deliveries of all bases every interval
+// until stop is closed. The deliveries left pending when the server stopped
+// are attempted on the first run.
+func (d *Dispatcher) ScheduleRetries(interval time.Duration, stop chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		bases, err := d.Store.ListDatabases()
+		if err != nil {
+			log.Println("error listing bases for webhook retries: ", err)
+		}
+
+		for _, conf := range bases {
+			if err := d.RetryDue(conf.Name); err != nil {
+				log.Println("error retrying webhook deliveries: ", err)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// RetryDue attempts the base's pending deliveries whose next attempt is due
+func (d *Dispatcher) RetryDue(base string) error {
+	due, err := d.Store.ListDueWebhookDeliveries(base, time.Now())
+	if err != nil || len(due) == 0 {
+		return err
+	}
+
+	hooks, err := d.webhooks(base)
+	if err != nil {
+		return err
+	}
+
+	for _, dl := range due {
+		for _, wh := range hooks {
+			if wh.ID != dl.WebhookID || !wh.Active {
+				continue
+			}
+
+			go d.retry(base, wh, dl.ID)
+		}
+	}
+	return nil
+}
+
+// retry attempts the delivery unless another attempt owns it
+func (d *Dispatcher) retry(base string, wh internal.Webhook, id string) {
+	key := "webhook_delivery_" + id
+	if d.Locker != nil {
+		ok, err := d.Locker.TryLock(key, attemptTimeout)
+		if err != nil {
+			log.Println("error locking webhook delivery: ", err)
+			return
+		} else if !ok {
+			return
+		}
+		defer d.Locker.Unlock(key)
+	}
+
+	// the delivery might have been attempted since it was listed
+	dl, err := d.Store.GetWebhookDelivery(base, id)
+	if err != nil {
+		log.Println("error getting webhook delivery: ", err)
+		return
+	} else if dl.State != internal.WebhookPending || dl.NextAttempt.After(time.Now()) {
+		return
+	}
+
+	dl.NextAttempt = time.Now().Add(attemptTimeout)
+	if err := d.Store.UpdateWebhookDelivery(base, dl); err != nil {
+		log.Println("error updating webhook delivery: ", err)
+		return
+	}
+
+	d.Deliver(base, wh, dl)
+}
+
+// post returns the response status and an error message if the call failed
+func (d *Dispatcher) post(wh internal.Webhook, dl internal.WebhookDelivery) (int, string) {
+	body := []byte(dl.Payload)
+	ts := time.Now().Unix()
+
+	req, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err.Error()
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "StaticBackend-Webhook")
+	req.Header.Set("X-SB-Event", dl.Event)
+	req.Header.Set("X-SB-Delivery", dl.ID)
+	req.Header.Set("X-SB-Timestamp", strconv.FormatInt(ts, 10))
+	req.Header.Set("X-SB-Signature", "sha256="+internal.SignWebhook(wh.Secret, ts, body))
+
+	client := d.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer res.Body.Close()
+
+	// the connection can be reused once the body is read
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Sprintf("unexpected status %d", res.StatusCode)
+	}
+	return res.StatusCode, ""
+}
+
+// defaultClient cannot call the private addresses of the server's network,
+// the addresses are checked once resolved
+var defaultClient = newClient()
+
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: internal.DenyPrivateDial,
+	}
+
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: dialer.Timeout,
+		},
+	}
+}
@@ -0,0 +1,362 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+// memCache only implements the cache part of the PubSuber
+type memCache struct {
+	internal.PubSuber
+
+	sync.Mutex
+	data map[string]string
+}
+
+func (c *memCache) GetTyped(key string, v interface{}) error {
+	c.Lock()
+	defer c.Unlock()
+
+	s, ok := c.data[key]
+	if !ok {
+		return fmt.Errorf("key not found: %s", key)
+	}
+	return json.Unmarshal([]byte(s), v)
+}
+
+func (c *memCache) SetTyped(key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.data[key] = string(b)
+	return nil
+}
+
+type memStore struct {
+	sync.Mutex
+	hooks      []internal.Webhook
+	deliveries map[string]internal.WebhookDelivery
+}
+
+func (s *memStore) ListDatabases() ([]internal.BaseConfig, error) {
+	return []internal.BaseConfig{{Name: "testdb"}}, nil
+}
+
+func (s *memStore) ListWebhooks(dbName string) ([]internal.Webhook, error) {
+	return s.hooks, nil
+}
+
+func (s *memStore) AddWebhookDelivery(dbName string, d internal.WebhookDelivery) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	d.ID = fmt.Sprintf("d%d", len(s.deliveries)+1)
+	s.deliveries[d.ID] = d
+	return d.ID, nil
+}
+
+func (s *memStore) UpdateWebhookDelivery(dbName string, d internal.WebhookDelivery) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.deliveries[d.ID] = d
+	return nil
+}
+
+func (s *memStore) GetWebhookDelivery(dbName, id string) (internal.WebhookDelivery, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	d, ok := s.deliveries[id]
+	if !ok {
+		return d, fmt.Errorf("delivery not found: %s", id)
+	}
+	return d, nil
+}
+
+func (s *memStore) ListDueWebhookDeliveries(dbName string, now time.Time) ([]internal.WebhookDelivery, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var due []internal.WebhookDelivery
+	for _, d := range s.deliveries {
+		if d.State == internal.WebhookPending && !d.NextAttempt.After(now) {
+			due = append(due, d)
+		}
+	}
+	return due, nil
+}
+
+func (s *memStore) delivery(id string) internal.WebhookDelivery {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.deliveries[id]
+}
+
+// memLocker is a lock shared by the test servers
+type memLocker struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func (l *memLocker) TryLock(key string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.keys[key] {
+		return false, nil
+	}
+	l.keys[key] = true
+	return true, nil
+}
+
+func (l *memLocker) Unlock(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.keys, key)
+	return nil
+}
+
+func newTestDispatcher(url string) (*Dispatcher, *memStore) {
+	store := &memStore{
+		hooks: []internal.Webhook{
+			{ID: "wh1", URL: url, Events: []string{"db_*:db-orders"}, Secret: "s3cret", Active: true},
+			{ID: "wh2", URL: url, Events: []string{"*"}, Secret: "s3cret", Active: false},
+		},
+		deliveries: make(map[string]internal.WebhookDelivery),
+	}
+
+	// the test servers listen on the loopback address
+	d := &Dispatcher{
+		PubSub:  &memCache{data: make(map[string]string)},
+		Store:   store,
+		Client:  http.DefaultClient,
+		Backoff: func(int) time.Duration { return time.Millisecond },
+	}
+	return d, store
+}
+
+func waitForState(t *testing.T, store *memStore, id, state string) internal.WebhookDelivery {
+	t.Helper()
+
+	for i := 0; i < 200; i++ {
+		if d := store.delivery(id); d.State == state {
+			return d
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("delivery %s never reached the %s state: %v", id, state, store.delivery(id))
+	return internal.WebhookDelivery{}
+}
+
+func TestDispatchSignedPayload(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- b
+	}))
+	defer srv.Close()
+
+	d, store := newTestDispatcher(srv.URL)
+
+	msg := internal.Command{Type: internal.MsgTypeDBCreated, Channel: "db-orders", Data: `{"id":"42"}`}
+	if err := d.Dispatch("testdb", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// other channels and inactive webhooks don't receive it
+	other := internal.Command{Type: internal.MsgTypeDBCreated, Channel: "db-users", Data: `{}`}
+	if err := d.Dispatch("testdb", other); err != nil {
+		t.Fatal(err)
+	}
+
+	r, body := <-received, <-bodies
+
+	ts, err := strconv.ParseInt(r.Header.Get("X-SB-Timestamp"), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "sha256=" + internal.SignWebhook("s3cret", ts, body)
+	if sig := r.Header.Get("X-SB-Signature"); sig != expected {
+		t.Errorf("expected signature %s got %s", expected, sig)
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	} else if payload.Event != internal.MsgTypeDBCreated || string(payload.Data) != `{"id":"42"}` {
+		t.Errorf("unexpected payload %s", body)
+	}
+
+	dl := waitForState(t, store, r.Header.Get("X-SB-Delivery"), internal.WebhookDelivered)
+	if dl.Attempts != 1 || dl.Status != http.StatusOK {
+		t.Errorf("expected 1 successful attempt got %v", dl)
+	}
+
+	if n := len(store.deliveries); n != 1 {
+		t.Errorf("expected 1 delivery got %d", n)
+	}
+}
+
+func TestDispatchOncePerEvent(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	// every server receives the system events
+	d1, store := newTestDispatcher(srv.URL)
+	d2 := *d1
+
+	locker := &memLocker{keys: make(map[string]bool)}
+	d1.Locker, d2.Locker = locker, locker
+
+	msg := internal.Command{Type: internal.MsgTypeDBCreated, Channel: "db-orders", Data: `{}`, EventID: "e1"}
+	for _, d := range []*Dispatcher{d1, &d2} {
+		if err := d.Dispatch("testdb", msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitForState(t, store, "d1", internal.WebhookDelivered)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if calls != 1 {
+		t.Errorf("expected 1 call got %d", calls)
+	} else if n := len(store.deliveries); n != 1 {
+		t.Errorf("expected 1 delivery got %d", n)
+	}
+}
+
+func TestProcessResolvesEventBase(t *testing.T) {
+	received := make(chan string, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("X-SB-Event")
+	}))
+	defer srv.Close()
+
+	d, _ := newTestDispatcher(srv.URL)
+
+	// root and API key tokens have no cached base, the event carries it
+	d.GetBase = func(token string) (string, error) {
+		return "", fmt.Errorf("no base for token %s", token)
+	}
+
+	d.process(internal.Command{Type: internal.MsgTypeDBCreated, Channel: "db-orders", Data: `{}`, Token: "root", Base: "testdb"})
+
+	select {
+	case evt := <-received:
+		if evt != internal.MsgTypeDBCreated {
+			t.Errorf("expected event %s got %s", internal.MsgTypeDBCreated, evt)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the event was never delivered")
+	}
+}
+
+func TestDeliverRetriesAndDeadLetters(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls++
+		// the flaky webhook succeeds on its third call
+		if r.URL.Path == "/flaky" && calls >= 3 {
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	d, store := newTestDispatcher(srv.URL + "/flaky")
+
+	// without events, it only receives the pending delivery d2 below
+	store.hooks = append(store.hooks, internal.Webhook{ID: "wh3", URL: srv.URL + "/down", Secret: "s3cret", Active: true})
+
+	stop := make(chan bool)
+	defer close(stop)
+
+	go d.ScheduleRetries(5*time.Millisecond, stop)
+
+	msg := internal.Command{Type: internal.MsgTypeDBUpdated, Channel: "db-orders", Data: `{}`}
+	if err := d.Dispatch("testdb", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	dl := waitForState(t, store, "d1", internal.WebhookDelivered)
+	if dl.Attempts != 3 {
+		t.Errorf("expected 3 attempts got %d", dl.Attempts)
+	}
+
+	mu.Lock()
+	calls = 0
+	mu.Unlock()
+
+	// a delivery left pending, i.e. by a stopped server, is resumed
+	store.Lock()
+	store.deliveries["d2"] = internal.WebhookDelivery{ID: "d2", WebhookID: "wh3", Payload: `{}`, State: internal.WebhookPending}
+	store.Unlock()
+
+	dl = waitForState(t, store, "d2", internal.WebhookDead)
+	if dl.Attempts != internal.WebhookMaxAttempts {
+		t.Errorf("expected a dead letter after %d attempts got %v", internal.WebhookMaxAttempts, dl)
+	} else if dl.Status != http.StatusServiceUnavailable || len(dl.Error) == 0 {
+		t.Errorf("expected the last status and error to be recorded got %v", dl)
+	}
+}
+
+func TestDefaultClientRefusesPrivateAddresses(t *testing.T) {
+	called := false
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	d, store := newTestDispatcher(srv.URL)
+	d.Client = nil
+
+	dl := internal.WebhookDelivery{ID: "d1", WebhookID: "wh1", Payload: `{}`, State: internal.WebhookPending}
+	d.Deliver("testdb", store.hooks[0], dl)
+
+	dl = store.delivery("d1")
+	if called {
+		t.Fatal("the webhook on the loopback address was called")
+	} else if !strings.Contains(dl.Error, "private address") {
+		t.Errorf("expected a private address error got %v", dl)
+	} else if dl.State != internal.WebhookPending || !dl.NextAttempt.After(dl.Updated) {
+		t.Errorf("expected the next attempt to be scheduled got %v", dl)
+	}
+}
@@ -0,0 +1,277 @@
+package staticbackend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+	"github.com/staticbackendhq/core/middleware"
+	"github.com/staticbackendhq/core/webhook"
+)
+
+func webhooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		createWebhook(w, r)
+	} else if r.Method == http.MethodDelete {
+		deleteWebhook(w, r)
+	} else if r.Method == http.MethodGet {
+		listWebhooks(w, r)
+	} else {
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func createWebhook(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var data = new(struct {
+		Name   string   `json:"name"`
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+	})
+	if err := parseBody(r.Body, &data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wh, err := newWebhook(conf.Name, data.Name, data.URL, data.Events, data.Secret)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respond(w, http.StatusCreated, wh)
+}
+
+// newWebhook saves an active webhook, a secret is generated if empty
+func newWebhook(dbName, name, rawURL string, events []string, secret string) (wh internal.Webhook, err error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		err = errors.New("a webhook needs a name")
+		return
+	} else if len(events) == 0 {
+		err = errors.New("a webhook needs at least one event")
+		return
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	} else if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		err = fmt.Errorf("invalid webhook URL: %s", rawURL)
+		return
+	}
+
+	if len(secret) == 0 {
+		if secret, err = randomSecret(24); err != nil {
+			return
+		}
+	}
+
+	wh = internal.Webhook{
+		Name:    name,
+		URL:     u.String(),
+		Events:  events,
+		Secret:  secret,
+		Active:  true,
+		Created: time.Now(),
+	}
+
+	id, err := datastore.AddWebhook(dbName, wh)
+	if err != nil {
+		return
+	}
+
+	wh.ID = id
+
+	err = volatile.Del(webhook.CacheKey(dbName))
+	return
+}
+
+func listWebhooks(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := datastore.ListWebhooks(conf.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if list == nil {
+		list = make([]internal.Webhook, 0)
+	}
+
+	// the secrets are only returned on create and rotate
+	for i := range list {
+		list[i].Secret = ""
+	}
+
+	respond(w, http.StatusOK, list)
+}
+
+func deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if err := removeWebhook(conf.Name, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, http.StatusOK, true)
+}
+
+// rotateWebhookSecret generates a new secret for the webhook "id" and
+// returns the webhook with its secret
+func rotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wh, err := rotateSecret(conf.Name, r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respond(w, http.StatusOK, wh)
+}
+
+func rotateSecret(dbName, id string) (wh internal.Webhook, err error) {
+	list, err := datastore.ListWebhooks(dbName)
+	if err != nil {
+		return
+	}
+
+	for _, item := range list {
+		if item.ID != id {
+			continue
+		}
+
+		wh = item
+		if wh.Secret, err = randomSecret(24); err != nil {
+			return
+		}
+
+		if err = datastore.UpdateWebhookSecret(dbName, id, wh.Secret); err != nil {
+			return
+		}
+
+		err = volatile.Del(webhook.CacheKey(dbName))
+		return
+	}
+
+	err = errors.New("cannot find this webhook")
+	return
+}
+
+func removeWebhook(dbName, id string) error {
+	if err := datastore.DeleteWebhook(dbName, id); err != nil {
+		return err
+	}
+	return volatile.Del(webhook.CacheKey(dbName))
+}
+
+// listWebhookDeliveries returns the last deliveries, the "id" and "state"
+// query string parameters filter them by webhook and state, i.e. "dead" for
+// the dead letters.
+func listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, state := r.URL.Query().Get("id"), r.URL.Query().Get("state")
+
+	deliveries, err := datastore.ListWebhookDeliveries(conf.Name, id, state)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if deliveries == nil {
+		deliveries = make([]internal.WebhookDelivery, 0)
+	}
+
+	respond(w, http.StatusOK, deliveries)
+}
+
+func replayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	conf, _, err := middleware.Extract(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := replayDelivery(conf.Name, r.URL.Query().Get("id")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respond(w, http.StatusOK, true)
+}
+
+// replayDelivery delivers a dead letter again with a fresh set of attempts
+func replayDelivery(dbName, id string) error {
+	dl, err := datastore.GetWebhookDelivery(dbName, id)
+	if err != nil {
+		return err
+	} else if dl.State != internal.WebhookDead {
+		return errors.New("only dead letters can be replayed")
+	}
+
+	list, err := datastore.ListWebhooks(dbName)
+	if err != nil {
+		return err
+	}
+
+	for _, wh := range list {
+		if wh.ID != dl.WebhookID {
+			continue
+		}
+
+		// the pending delivery is due right away
+		dl.State = internal.WebhookPending
+		dl.Attempts = 0
+		dl.Error = ""
+		dl.Updated = time.Now()
+		dl.NextAttempt = dl.Updated
+		if err := datastore.UpdateWebhookDelivery(dbName, dl); err != nil {
+			return err
+		}
+
+		go hooks.RetryDue(dbName)
+		return nil
+	}
+	return errors.New("cannot find the webhook of this delivery")
+}
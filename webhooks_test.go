@@ -0,0 +1,108 @@
+package staticbackend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/staticbackendhq/core/internal"
+)
+
+func TestWebhookDeliveryAndReplay(t *testing.T) {
+	fail := int32(1)
+	received := make(chan string, 10)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("X-SB-Delivery")
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	data := new(struct {
+		Name   string   `json:"name"`
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	})
+	data.Name = "unit-test"
+	data.URL = srv.URL
+	data.Events = []string{"db_created:db-webhooks"}
+
+	resp := dbReq(t, webhooks, "POST", "/sudo/webhooks", data, true)
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp))
+	}
+
+	var wh internal.Webhook
+	if err := json.NewDecoder(resp.Body).Decode(&wh); err != nil {
+		t.Fatal(err)
+	} else if len(wh.Secret) == 0 {
+		t.Errorf("expected a generated secret")
+	}
+	defer removeWebhook(dbName, wh.ID)
+
+	resp3 := dbReq(t, webhooks, "GET", "/sudo/webhooks", nil, true)
+	defer resp3.Body.Close()
+
+	var list []internal.Webhook
+	if err := json.NewDecoder(resp3.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, item := range list {
+		if len(item.Secret) > 0 {
+			t.Errorf("the secret of webhook %s was listed", item.ID)
+		}
+	}
+
+	msg := internal.Command{Type: internal.MsgTypeDBCreated, Channel: "db-webhooks", Data: `{}`}
+	if err := hooks.Dispatch(dbName, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	var id string
+	for i := 0; i < internal.WebhookMaxAttempts; i++ {
+		select {
+		case id = <-received:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("attempt %d never received", i+1)
+		}
+	}
+
+	var dead []internal.WebhookDelivery
+	for i := 0; i < 50 && len(dead) == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+
+		resp := dbReq(t, listWebhookDeliveries, "GET", "/sudo/webhooks/deliveries?state=dead&id="+wh.ID, nil, true)
+		defer resp.Body.Close()
+
+		if err := json.NewDecoder(resp.Body).Decode(&dead); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(dead) != 1 || dead[0].ID != id {
+		t.Fatalf("expected delivery %s to be a dead letter got %v", id, dead)
+	}
+
+	atomic.StoreInt32(&fail, 0)
+
+	resp2 := dbReq(t, replayWebhookDelivery, "POST", "/sudo/webhooks/replay?id="+id, nil, true)
+	defer resp2.Body.Close()
+
+	if resp2.StatusCode > 299 {
+		t.Fatal(GetResponseBody(t, resp2))
+	}
+
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the replayed delivery was never received")
+	}
+}